@@ -11,10 +11,22 @@
 #define MAX_ARGC_FOR_CMD 16
 #define MAX_ARGS_TO_READ 4
 #define ARGV0_READ_LEN 256
+#define TTY_NAME_LEN 32
 #define CMD_LINE_SAFETY_MARGIN 64
 #define EVENT_TYPE_EXEC 1
 #define EVENT_TYPE_FILE_OPEN 2
 #define EVENT_TYPE_CONNECT 3
+#define EVENT_TYPE_TAMPER 4
+
+#define TAMPER_FILE_WRITE 1
+#define TAMPER_FILE_UNLINK 2
+#define TAMPER_FILE_RENAME 3
+#define TAMPER_KILL 4
+#define TAMPER_FILE_TRUNCATE 5
+#define TAMPER_FILE_SETATTR 6
+
+#define FMODE_WRITE 0x2
+#define ATTR_SIZE (1 << 3)
 
 #define EPERM 1
 #define AF_INET 2
@@ -23,6 +35,15 @@
 #define ACTION_MONITOR 1
 #define ACTION_BLOCK 2
 
+/* Hide a value from the optimizer so it cannot turn arithmetic into branches. */
+#define opaque(x) asm volatile("" : "+r"(x))
+
+/* loginuid and sessionid of tasks that never logged in (AUDIT_UID_UNSET). */
+#define AUDIT_UNSET ((u32)-1)
+
+#define NSEC_PER_SEC 1000000000ULL
+#define RATE_LIMIT_MAX_ELAPSED_NS (10 * NSEC_PER_SEC)
+
 struct event_header {
     u64 timestamp_ns;
     u64 cgroup_id;
@@ -30,16 +51,22 @@ struct event_header {
     u32 tid;
     u32 uid;
     u32 gid;
+    u32 pidns_ino;  /* inode number of the task's PID namespace */
+    u32 ns_pid;     /* tgid as seen inside that namespace */
+    u32 ns_ppid;    /* parent's tgid in that namespace, 0 if outside it */
     u8  type;
     u8  blocked;
-    u8  _pad[6];
+    u8  _pad[2];
     char comm[TASK_COMM_LEN];
 } __attribute__((packed));
 
 struct exec_event {
     struct event_header hdr;
     u32 ppid;
-    u8  _pad[4];
+    u32 loginuid;        /* audit login UID, AUDIT_UNSET if none */
+    u32 sessionid;       /* audit session ID, AUDIT_UNSET if none */
+    u32 session_leader;  /* PID of the session leader */
+    char tty[TTY_NAME_LEN]; /* controlling terminal, empty if none */
     char pcomm[TASK_COMM_LEN];
     char filename[PATH_MAX_LEN];
     char command_line[COMMAND_LINE_LEN];
@@ -62,25 +89,55 @@ struct connect_event {
     u8  addr_v6[16];
 } __attribute__((packed));
 
+struct tamper_event {
+    struct event_header hdr;
+    u32 kind;
+    u32 target_pid;
+    u64 ino;
+    u64 dev;
+    u32 signal;
+    u8  _pad[4];
+    char filename[PATH_MAX_LEN];
+} __attribute__((packed));
+
 struct {
     __uint(type, BPF_MAP_TYPE_RINGBUF);
     __uint(max_entries, 2 * 1024 * 1024);
 } events SEC(".maps");
 
+/*
+ * action applies in every cgroup; block_policies has bit i set when policy i
+ * blocks the entry, which applies only in cgroups bound to that policy.
+ */
+struct rule_action {
+    u8  action;
+    u8  _pad[3];
+    u32 block_policies;
+};
+
 struct {
     __uint(type, BPF_MAP_TYPE_HASH);
     __uint(max_entries, 1024);
     __type(key, char[PATH_MAX_LEN]);
-    __type(value, u8);
+    __type(value, struct rule_action);
 } monitored_files SEC(".maps");
 
 struct {
     __uint(type, BPF_MAP_TYPE_HASH);
     __uint(max_entries, 1024);
     __type(key, u16);
-    __type(value, u8);
+    __type(value, struct rule_action);
 } blocked_ports SEC(".maps");
 
+/* Cgroup ID to the mask of enforcing policies bound to it. The loader
+ * grows max_entries to workload_registry_max_size when that is larger. */
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 8192);
+    __type(key, u64);
+    __type(value, u32);
+} cgroup_policies SEC(".maps");
+
 struct {
     __uint(type, BPF_MAP_TYPE_LRU_HASH);
     __uint(max_entries, 32768);
@@ -88,10 +145,77 @@ struct {
     __type(value, u32);
 } pid_to_ppid SEC(".maps");
 
+struct rate_limit {
+    u32 rate;
+    u32 burst;
+};
+
+struct token_bucket {
+    u64 tokens;
+    u64 last_ns;
+    u64 suppressed;
+};
+
+/* Index 0 holds the default per-cgroup budget; rate 0 disables limiting. */
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, struct rate_limit);
+} rate_limit_config SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 1024);
+    __type(key, u64);
+    __type(value, struct rate_limit);
+} cgroup_rate_limits SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(max_entries, 8192);
+    __type(key, u64);
+    __type(value, struct token_bucket);
+} cgroup_buckets SEC(".maps");
+
+struct inode_key {
+    u64 ino;
+    u64 dev;
+};
+
+struct self_protection_config {
+    u32 agent_pid;
+    u32 enabled;
+};
+
+/* Files only the agent itself may modify: rules, config, BPF object, binary. */
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 64);
+    __type(key, struct inode_key);
+    __type(value, u8);
+} protected_inodes SEC(".maps");
+
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __uint(max_entries, 1);
+    __type(key, u32);
+    __type(value, struct self_protection_config);
+} self_protection SEC(".maps");
+
+/* Executables denied by digest; userspace adds their inodes once hashed. */
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(max_entries, 1024);
+    __type(key, struct inode_key);
+    __type(value, u8);
+} blocked_exes SEC(".maps");
+
 struct path_scratch {
     char path_buf[PATH_MAX_LEN];
     char filename[NAME_MAX];
     char parent[NAME_MAX];
+    char user_path[PATH_MAX_LEN];
 };
 
 struct {
@@ -108,6 +232,47 @@ struct {
     __type(value, struct exec_event);
 } event_scratch SEC(".maps");
 
+/*
+ * tgid_in_ns returns the process ID of task's thread group leader in the PID
+ * namespace at level, or 0 when the process is not visible there.
+ */
+static __always_inline u32 tgid_in_ns(struct task_struct *task, unsigned int level, u64 ns)
+{
+    struct pid *pid = BPF_CORE_READ(task, group_leader, thread_pid);
+    if (!pid || BPF_CORE_READ(pid, level) < level)
+        return 0;
+
+    struct upid upid = {};
+    bpf_core_read(&upid, sizeof(upid), pid->numbers + level);
+    if ((u64)upid.ns != ns)
+        return 0;
+    return upid.nr;
+}
+
+/*
+ * fill_pid_namespace records the task's PID namespace and its PID and
+ * parent PID as seen from inside it, which is what ps shows in a container.
+ */
+static __always_inline void fill_pid_namespace(struct event_header *hdr, struct task_struct *task)
+{
+    hdr->pidns_ino = 0;
+    hdr->ns_pid = 0;
+    hdr->ns_ppid = 0;
+    if (!task)
+        return;
+
+    struct pid *pid = BPF_CORE_READ(task, group_leader, thread_pid);
+    if (!pid)
+        return;
+    unsigned int level = BPF_CORE_READ(pid, level);
+
+    struct upid upid = {};
+    bpf_core_read(&upid, sizeof(upid), pid->numbers + level);
+    hdr->pidns_ino = BPF_CORE_READ(upid.ns, ns.inum);
+    hdr->ns_pid = upid.nr;
+    hdr->ns_ppid = tgid_in_ns(BPF_CORE_READ(task, real_parent), level, (u64)upid.ns);
+}
+
 static __always_inline void fill_event_header(
     struct event_header *hdr,
     u8 type,
@@ -127,6 +292,58 @@ static __always_inline void fill_event_header(
     
     hdr->cgroup_id = bpf_get_current_cgroup_id();
     bpf_get_current_comm(&hdr->comm, sizeof(hdr->comm));
+    fill_pid_namespace(hdr, task);
+}
+
+/*
+ * rate_limit_allow charges one event against the current cgroup's token
+ * bucket. Tokens are kept in nanosecond units so refills stay integral.
+ * Concurrent updates from different CPUs may race; the budget is a
+ * best-effort guard against ring buffer floods, not an exact meter.
+ */
+static __always_inline bool rate_limit_allow(void)
+{
+    u32 zero = 0;
+    struct rate_limit* cfg = bpf_map_lookup_elem(&rate_limit_config, &zero);
+    u64 cgroup_id = bpf_get_current_cgroup_id();
+
+    struct rate_limit* override = bpf_map_lookup_elem(&cgroup_rate_limits, &cgroup_id);
+    if (override)
+        cfg = override;
+    if (!cfg || cfg->rate == 0)
+        return true;
+
+    u64 capacity = (u64)(cfg->burst > cfg->rate ? cfg->burst : cfg->rate) * NSEC_PER_SEC;
+    u64 now = bpf_ktime_get_ns();
+
+    struct token_bucket* bucket = bpf_map_lookup_elem(&cgroup_buckets, &cgroup_id);
+    if (!bucket) {
+        struct token_bucket fresh = {
+            .tokens = capacity - NSEC_PER_SEC,
+            .last_ns = now,
+            .suppressed = 0,
+        };
+        bpf_map_update_elem(&cgroup_buckets, &cgroup_id, &fresh, BPF_NOEXIST);
+        return true;
+    }
+
+    u64 elapsed = now - bucket->last_ns;
+    if (elapsed > RATE_LIMIT_MAX_ELAPSED_NS)
+        elapsed = RATE_LIMIT_MAX_ELAPSED_NS;
+
+    u64 tokens = bucket->tokens + elapsed * cfg->rate;
+    if (tokens > capacity)
+        tokens = capacity;
+    bucket->last_ns = now;
+
+    if (tokens < NSEC_PER_SEC) {
+        bucket->tokens = tokens;
+        __sync_fetch_and_add(&bucket->suppressed, 1);
+        return false;
+    }
+
+    bucket->tokens = tokens - NSEC_PER_SEC;
+    return true;
 }
 
 static __always_inline u32 get_parent_pid(struct task_struct* task)
@@ -136,30 +353,43 @@ static __always_inline u32 get_parent_pid(struct task_struct* task)
     return BPF_CORE_READ(task, real_parent, tgid);
 }
 
-static __always_inline u8 check_file_action(struct dentry* dentry, char* out_path)
+/*
+ * fill_session records who the exec runs for: the audit login UID and
+ * session, which survive su and sudo, the session leader and the
+ * controlling terminal. Kernels without CONFIG_AUDITSYSCALL report the
+ * audit fields as unset.
+ */
+static __always_inline void fill_session(struct exec_event* event, struct task_struct* task)
 {
-    if (!dentry)
-        return 0;
+    event->loginuid = AUDIT_UNSET;
+    event->sessionid = AUDIT_UNSET;
+    if (bpf_core_field_exists(task->loginuid)) {
+        event->loginuid = BPF_CORE_READ(task, loginuid.val);
+        event->sessionid = BPF_CORE_READ(task, sessionid);
+    }
 
-    u32 key = 0;
-    struct path_scratch* s = bpf_map_lookup_elem(&scratch, &key);
-    if (!s)
-        return 0;
-    __builtin_memset(s, 0, sizeof(*s));
+    struct pid* sid = BPF_CORE_READ(task, signal, pids[PIDTYPE_SID]);
+    event->session_leader = sid ? BPF_CORE_READ(sid, numbers[0].nr) : 0;
 
-    struct qstr d_name = BPF_CORE_READ(dentry, d_name);
-    if (!d_name.name || d_name.len == 0 || d_name.len >= NAME_MAX)
-        return 0;
-    bpf_probe_read_kernel_str(s->filename, NAME_MAX, d_name.name);
+    event->tty[0] = '\0';
+    struct tty_struct* tty = BPF_CORE_READ(task, signal, tty);
+    if (tty)
+        BPF_CORE_READ_STR_INTO(&event->tty, tty, name);
+}
 
-    struct dentry* parent_dentry = BPF_CORE_READ(dentry, d_parent);
-    if (parent_dentry && parent_dentry != dentry) {
-        struct qstr pd_name = BPF_CORE_READ(parent_dentry, d_name);
-        if (pd_name.name && pd_name.len > 0 && pd_name.len < NAME_MAX) {
-            bpf_probe_read_kernel_str(s->parent, NAME_MAX, pd_name.name);
-        }
-    }
+static __always_inline u8 resolve_action(const struct rule_action* ra)
+{
+    if (ra->action == ACTION_BLOCK || !ra->block_policies)
+        return ra->action;
+    u64 cgroup_id = bpf_get_current_cgroup_id();
+    u32* mask = bpf_map_lookup_elem(&cgroup_policies, &cgroup_id);
+    if (mask && (*mask & ra->block_policies))
+        return ACTION_BLOCK;
+    return ra->action;
+}
 
+static __always_inline u8 lookup_file_action(struct path_scratch* s, char* out_path)
+{
     int pos = 0;
     if (s->parent[0]) {
         for (int i = 0; i < NAME_MAX - 1 && s->parent[i] && pos < PATH_MAX_LEN - 2; i++) {
@@ -174,9 +404,9 @@ static __always_inline u8 check_file_action(struct dentry* dentry, char* out_pat
     }
 
     __builtin_memcpy(out_path, s->path_buf, PATH_MAX_LEN);
-    u8* action = bpf_map_lookup_elem(&monitored_files, s->path_buf);
+    struct rule_action* action = bpf_map_lookup_elem(&monitored_files, s->path_buf);
     if (action)
-        return *action;
+        return resolve_action(action);
 
     if (s->parent[0]) {
         __builtin_memset(s->path_buf, 0, PATH_MAX_LEN);
@@ -186,20 +416,104 @@ static __always_inline u8 check_file_action(struct dentry* dentry, char* out_pat
         }
         action = bpf_map_lookup_elem(&monitored_files, s->path_buf);
         if (action)
-            return *action;
+            return resolve_action(action);
     }
 
     __builtin_memset(s->path_buf, 0, PATH_MAX_LEN);
     __builtin_memcpy(s->path_buf, s->filename, NAME_MAX);
     action = bpf_map_lookup_elem(&monitored_files, s->path_buf);
     if (action)
-        return *action;
+        return resolve_action(action);
 
     return 0;
 }
 
-SEC("lsm/bprm_check_security")
-int BPF_PROG(lsm_bprm_check, struct linux_binprm* bprm)
+static __always_inline u8 check_file_action(struct dentry* dentry, char* out_path)
+{
+    if (!dentry)
+        return 0;
+
+    u32 key = 0;
+    struct path_scratch* s = bpf_map_lookup_elem(&scratch, &key);
+    if (!s)
+        return 0;
+    __builtin_memset(s, 0, sizeof(*s));
+
+    struct qstr d_name = BPF_CORE_READ(dentry, d_name);
+    if (!d_name.name || d_name.len == 0 || d_name.len >= NAME_MAX)
+        return 0;
+    bpf_probe_read_kernel_str(s->filename, NAME_MAX, d_name.name);
+
+    struct dentry* parent_dentry = BPF_CORE_READ(dentry, d_parent);
+    if (parent_dentry && parent_dentry != dentry) {
+        struct qstr pd_name = BPF_CORE_READ(parent_dentry, d_name);
+        if (pd_name.name && pd_name.len > 0 && pd_name.len < NAME_MAX) {
+            bpf_probe_read_kernel_str(s->parent, NAME_MAX, pd_name.name);
+        }
+    }
+
+    return lookup_file_action(s, out_path);
+}
+
+/*
+ * check_user_path_action is the tracepoint-mode counterpart of
+ * check_file_action. It splits the path passed to openat into its last two
+ * components; paths relative to a dirfd are matched on those components
+ * only. The separator scan uses masks instead of branches so the verifier
+ * sees a single path through the loop.
+ */
+static __always_inline u8 check_user_path_action(const char* user_path, char* out_path)
+{
+    u32 key = 0;
+    struct path_scratch* s = bpf_map_lookup_elem(&scratch, &key);
+    if (!s || !user_path)
+        return 0;
+    __builtin_memset(s, 0, sizeof(*s));
+
+    if (bpf_probe_read_user_str(s->user_path, PATH_MAX_LEN, user_path) <= 0)
+        return 0;
+
+    /* Offsets just past the last and second-to-last '/', 0 if absent. */
+    u32 last = 0;
+    u32 prev = 0;
+    for (u32 i = 0; i < PATH_MAX_LEN; i++) {
+        u32 c = (u8)s->user_path[i];
+        if (c == 0)
+            break;
+        u32 mask = 0 - ((((c ^ '/') - 1) >> 31) & 1);
+        opaque(mask);
+        prev = (mask & last) | (~mask & prev);
+        last = (mask & (i + 1)) | (~mask & last);
+    }
+
+    for (u32 j = 0; j < NAME_MAX - 1; j++) {
+        u32 idx = last + j;
+        if (idx >= PATH_MAX_LEN)
+            break;
+        char c = s->user_path[idx & (PATH_MAX_LEN - 1)];
+        if (!c)
+            break;
+        s->filename[j] = c;
+    }
+    for (u32 j = 0; j < NAME_MAX - 1; j++) {
+        u32 idx = prev + j;
+        if (idx + 1 >= last || idx >= PATH_MAX_LEN)
+            break;
+        s->parent[j] = s->user_path[idx & (PATH_MAX_LEN - 1)];
+    }
+
+    if (!s->filename[0])
+        return 0;
+    return lookup_file_action(s, out_path);
+}
+
+/*
+ * handle_exec builds and submits an exec event. The exec is denied when its
+ * path matches a block rule or its inode is in blocked_exes. With enforce
+ * unset (the tracepoint fallback) block rules are reported but cannot deny
+ * the exec.
+ */
+static __always_inline int handle_exec(struct linux_binprm* bprm, bool enforce)
 {
     struct exec_event* event;
     struct task_struct* task = (struct task_struct*)bpf_get_current_task_btf();
@@ -220,7 +534,16 @@ int BPF_PROG(lsm_bprm_check, struct linux_binprm* bprm)
     if (file) {
         struct dentry* dentry = BPF_CORE_READ(file, f_path.dentry);
         u8 action = check_file_action(dentry, s->path_buf);
-        if (action == ACTION_BLOCK) {
+        if (action == ACTION_BLOCK && enforce) {
+            ret = -EPERM;
+            blocked = 1;
+        }
+
+        struct inode_key exe_key = {
+            .ino = BPF_CORE_READ(file, f_inode, i_ino),
+            .dev = BPF_CORE_READ(file, f_inode, i_sb, s_dev),
+        };
+        if (enforce && bpf_map_lookup_elem(&blocked_exes, &exe_key)) {
             ret = -EPERM;
             blocked = 1;
         }
@@ -230,6 +553,9 @@ int BPF_PROG(lsm_bprm_check, struct linux_binprm* bprm)
     if (!scratch_event)
         return ret;
 
+    if (!blocked && !rate_limit_allow())
+        return ret;
+
     event = bpf_ringbuf_reserve(&events, sizeof(*event), 0);
     if (!event)
         return ret;
@@ -246,6 +572,7 @@ int BPF_PROG(lsm_bprm_check, struct linux_binprm* bprm)
     } else {
         event->pcomm[0] = '\0';
     }
+    fill_session(event, task);
 
     __builtin_memcpy(event->filename, s->path_buf, PATH_MAX_LEN);
     __builtin_memcpy(event->command_line, s->path_buf, PATH_MAX_LEN);
@@ -344,69 +671,201 @@ submit:
     return ret;
 }
 
-SEC("lsm/file_open")
-int BPF_PROG(lsm_file_open, struct file* file)
-{
+static __always_inline int submit_file_event(
+    struct path_scratch* s,
+    u8 action,
+    bool enforce,
+    u32 flags,
+    u64 ino,
+    u64 dev
+) {
     struct file_event* event;
-    u64 pid_tgid = bpf_get_current_pid_tgid();
-    u32 pid = pid_tgid >> 32;
     int ret = 0;
     u8 blocked = 0;
 
-    u32 scratch_key = 0;
-    struct path_scratch* s = bpf_map_lookup_elem(&scratch, &scratch_key);
-    if (!s)
-        return 0;
+    if (action == ACTION_BLOCK && enforce) {
+        ret = -EPERM;
+        blocked = 1;
+    }
 
-    __builtin_memset(s->path_buf, 0, PATH_MAX_LEN);
+    if (!blocked && !rate_limit_allow())
+        return ret;
 
-    struct dentry* dentry = BPF_CORE_READ(file, f_path.dentry);
-    u8 action = check_file_action(dentry, s->path_buf);
-    if (!action)
+    event = bpf_ringbuf_reserve(&events, sizeof(*event), 0);
+    if (!event)
+        return ret;
+
+    struct task_struct* task = (struct task_struct*)bpf_get_current_task_btf();
+    fill_event_header(&event->hdr, EVENT_TYPE_FILE_OPEN, task);
+    event->hdr.blocked = blocked;
+
+    event->flags = flags;
+    event->ino = ino;
+    event->dev = dev;
+    __builtin_memcpy(event->filename, s->path_buf, PATH_MAX_LEN);
+    bpf_ringbuf_submit(event, 0);
+
+    return ret;
+}
+
+static __always_inline int handle_connect(
+    u16 family,
+    u16 port,
+    u32 addr_v4,
+    const u8* addr_v6,
+    bool enforce
+) {
+    struct connect_event* event;
+    int ret = 0;
+    u8 blocked = 0;
+
+    struct rule_action* port_action = bpf_map_lookup_elem(&blocked_ports, &port);
+    if (!port_action)
         return 0;
 
-    if (action == ACTION_BLOCK) {
+    if (resolve_action(port_action) == ACTION_BLOCK && enforce) {
         ret = -EPERM;
         blocked = 1;
     }
 
+    if (!blocked && !rate_limit_allow())
+        return ret;
+
     event = bpf_ringbuf_reserve(&events, sizeof(*event), 0);
     if (!event)
         return ret;
 
     struct task_struct* task = (struct task_struct*)bpf_get_current_task_btf();
-    fill_event_header(&event->hdr, EVENT_TYPE_FILE_OPEN, task);
+    fill_event_header(&event->hdr, EVENT_TYPE_CONNECT, task);
     event->hdr.blocked = blocked;
 
-    event->flags = BPF_CORE_READ(file, f_flags);
-    event->ino = 0;
-    event->dev = 0;
-    if (file) {
-        struct inode* inode = BPF_CORE_READ(file, f_inode);
-        if (inode) {
-            event->ino = BPF_CORE_READ(inode, i_ino);
-            struct super_block* sb = BPF_CORE_READ(inode, i_sb);
-            if (sb) {
-                event->dev = BPF_CORE_READ(sb, s_dev);
-            }
-        }
+    event->family = family;
+    event->port = port;
+    event->addr_v4 = addr_v4;
+    __builtin_memcpy(event->addr_v6, addr_v6, 16);
+
+    bpf_ringbuf_submit(event, 0);
+    return ret;
+}
+
+/* ---- Self-protection ---- */
+
+static __always_inline struct self_protection_config* self_protection_active(void)
+{
+    u32 zero = 0;
+    struct self_protection_config* cfg = bpf_map_lookup_elem(&self_protection, &zero);
+    if (!cfg || !cfg->enabled || cfg->agent_pid == 0)
+        return 0;
+    return cfg;
+}
+
+static __always_inline bool inode_protected(struct inode* inode, struct inode_key* key)
+{
+    if (!inode)
+        return false;
+    key->ino = BPF_CORE_READ(inode, i_ino);
+    key->dev = BPF_CORE_READ(inode, i_sb, s_dev);
+    return bpf_map_lookup_elem(&protected_inodes, key) != 0;
+}
+
+static __always_inline void emit_tamper(
+    u32 kind,
+    struct inode_key* key,
+    struct dentry* dentry,
+    u32 target_pid,
+    u32 sig
+) {
+    struct tamper_event* event = bpf_ringbuf_reserve(&events, sizeof(*event), 0);
+    if (!event)
+        return;
+
+    struct task_struct* task = (struct task_struct*)bpf_get_current_task_btf();
+    fill_event_header(&event->hdr, EVENT_TYPE_TAMPER, task);
+    event->hdr.blocked = 1;
+    event->kind = kind;
+    event->target_pid = target_pid;
+    event->signal = sig;
+    event->ino = key ? key->ino : 0;
+    event->dev = key ? key->dev : 0;
+    event->filename[0] = '\0';
+    if (dentry) {
+        const unsigned char* name = BPF_CORE_READ(dentry, d_name.name);
+        if (name)
+            bpf_probe_read_kernel_str(event->filename, NAME_MAX, name);
     }
-    __builtin_memcpy(event->filename, s->path_buf, PATH_MAX_LEN);
     bpf_ringbuf_submit(event, 0);
+}
 
-    return ret;
+/*
+ * deny_protected_dentry returns -EPERM (and reports the attempt) when a
+ * process other than the agent modifies a protected file.
+ */
+static __always_inline int deny_protected_dentry(struct dentry* dentry, u32 kind)
+{
+    struct self_protection_config* cfg = self_protection_active();
+    if (!cfg || !dentry)
+        return 0;
+    if ((u32)(bpf_get_current_pid_tgid() >> 32) == cfg->agent_pid)
+        return 0;
+
+    struct inode_key key = {};
+    if (!inode_protected(BPF_CORE_READ(dentry, d_inode), &key))
+        return 0;
+
+    emit_tamper(kind, &key, dentry, 0, 0);
+    return -EPERM;
+}
+
+/* ---- LSM hooks (enforcing) ---- */
+
+SEC("lsm/bprm_check_security")
+int BPF_PROG(lsm_bprm_check, struct linux_binprm* bprm)
+{
+    return handle_exec(bprm, true);
+}
+
+SEC("lsm/file_open")
+int BPF_PROG(lsm_file_open, struct file* file)
+{
+    if (BPF_CORE_READ(file, f_mode) & FMODE_WRITE) {
+        int denied = deny_protected_dentry(BPF_CORE_READ(file, f_path.dentry), TAMPER_FILE_WRITE);
+        if (denied)
+            return denied;
+    }
+
+    u32 scratch_key = 0;
+    struct path_scratch* s = bpf_map_lookup_elem(&scratch, &scratch_key);
+    if (!s)
+        return 0;
+
+    __builtin_memset(s->path_buf, 0, PATH_MAX_LEN);
+
+    struct dentry* dentry = BPF_CORE_READ(file, f_path.dentry);
+    u8 action = check_file_action(dentry, s->path_buf);
+    if (!action)
+        return 0;
+
+    u64 ino = 0;
+    u64 dev = 0;
+    struct inode* inode = BPF_CORE_READ(file, f_inode);
+    if (inode) {
+        ino = BPF_CORE_READ(inode, i_ino);
+        struct super_block* sb = BPF_CORE_READ(inode, i_sb);
+        if (sb) {
+            dev = BPF_CORE_READ(sb, s_dev);
+        }
+    }
+
+    return submit_file_event(s, action, true, BPF_CORE_READ(file, f_flags), ino, dev);
 }
 
 SEC("lsm/socket_connect")
 int BPF_PROG(lsm_socket_connect, struct socket* sock, struct sockaddr* address, int addrlen)
 {
-    struct connect_event* event;
-    u64 pid_tgid = bpf_get_current_pid_tgid();
-    u32 pid = pid_tgid >> 32;
-    int ret = 0;
-    u8 blocked = 0;
-    u16 port = 0;
     u16 family = 0;
+    u16 port_net = 0;
+    u32 addr_v4 = 0;
+    u8 addr_v6[16] = {};
 
     if (!address)
         return 0;
@@ -415,50 +874,135 @@ int BPF_PROG(lsm_socket_connect, struct socket* sock, struct sockaddr* address,
 
     if (family == AF_INET) {
         struct sockaddr_in* addr_in = (struct sockaddr_in*)address;
-        u16 port_net = 0;
         bpf_probe_read_kernel(&port_net, sizeof(port_net), &addr_in->sin_port);
-        port = __bpf_ntohs(port_net);
+        bpf_probe_read_kernel(&addr_v4, sizeof(addr_v4), &addr_in->sin_addr.s_addr);
     } else if (family == AF_INET6) {
         struct sockaddr_in6* addr_in6 = (struct sockaddr_in6*)address;
-        u16 port_net = 0;
         bpf_probe_read_kernel(&port_net, sizeof(port_net), &addr_in6->sin6_port);
-        port = __bpf_ntohs(port_net);
+        bpf_probe_read_kernel(addr_v6, 16, &addr_in6->sin6_addr);
     } else {
         return 0;
     }
 
-    u8* port_action = bpf_map_lookup_elem(&blocked_ports, &port);
-    if (!port_action)
+    return handle_connect(family, __bpf_ntohs(port_net), addr_v4, addr_v6, true);
+}
+
+SEC("lsm/inode_unlink")
+int BPF_PROG(lsm_inode_unlink, struct inode* dir, struct dentry* dentry)
+{
+    return deny_protected_dentry(dentry, TAMPER_FILE_UNLINK);
+}
+
+SEC("lsm/inode_rename")
+int BPF_PROG(lsm_inode_rename, struct inode* old_dir, struct dentry* old_dentry,
+             struct inode* new_dir, struct dentry* new_dentry)
+{
+    /* Moving a protected file away, or replacing it, are both tampering. */
+    int denied = deny_protected_dentry(old_dentry, TAMPER_FILE_RENAME);
+    if (denied)
+        return denied;
+    return deny_protected_dentry(new_dentry, TAMPER_FILE_RENAME);
+}
+
+SEC("lsm/path_truncate")
+int BPF_PROG(lsm_path_truncate, const struct path* path)
+{
+    return deny_protected_dentry(BPF_CORE_READ(path, dentry), TAMPER_FILE_TRUNCATE);
+}
+
+/*
+ * chmod, chown, utimes and truncate all end in notify_change. Since 5.12
+ * the hook's first argument is the mount's idmap (user namespace before
+ * 6.3), so the dentry is the second on every kernel this targets.
+ */
+SEC("lsm/inode_setattr")
+int BPF_PROG(lsm_inode_setattr, void* idmap, struct dentry* dentry, struct iattr* attr)
+{
+    u32 kind = TAMPER_FILE_SETATTR;
+    if (BPF_CORE_READ(attr, ia_valid) & ATTR_SIZE)
+        kind = TAMPER_FILE_TRUNCATE;
+    return deny_protected_dentry(dentry, kind);
+}
+
+SEC("lsm/task_kill")
+int BPF_PROG(lsm_task_kill, struct task_struct* p, struct kernel_siginfo* info, int sig, const struct cred* cred)
+{
+    struct self_protection_config* cfg = self_protection_active();
+    if (!cfg || sig == 0)
         return 0;
 
-    if (*port_action == ACTION_BLOCK) {
-        ret = -EPERM;
-        blocked = 1;
-    }
+    if (BPF_CORE_READ(p, tgid) != cfg->agent_pid)
+        return 0;
 
-    event = bpf_ringbuf_reserve(&events, sizeof(*event), 0);
-    if (!event)
-        return ret;
+    /* The agent may signal itself, and PID 1 stays able to stop the service. */
+    u32 sender = bpf_get_current_pid_tgid() >> 32;
+    if (sender == cfg->agent_pid || sender == 1)
+        return 0;
 
-    struct task_struct* task = (struct task_struct*)bpf_get_current_task_btf();
-    fill_event_header(&event->hdr, EVENT_TYPE_CONNECT, task);
-    event->hdr.blocked = blocked;
+    emit_tamper(TAMPER_KILL, 0, 0, cfg->agent_pid, sig);
+    return -EPERM;
+}
 
-    event->family = family;
-    event->port = port;
-    event->addr_v4 = 0;
-    __builtin_memset(event->addr_v6, 0, 16);
+/*
+ * ---- Tracepoint fallback (monitor only) ----
+ * Used on kernels booted without "bpf" in the active LSM list. These hooks
+ * emit the same event structs but cannot deny the operation.
+ */
+
+SEC("tp_btf/sched_process_exec")
+int BPF_PROG(tp_sched_process_exec, struct task_struct* p, pid_t old_pid, struct linux_binprm* bprm)
+{
+    handle_exec(bprm, false);
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_openat")
+int tp_sys_enter_openat(struct trace_event_raw_sys_enter* ctx)
+{
+    u32 scratch_key = 0;
+    struct path_scratch* s = bpf_map_lookup_elem(&scratch, &scratch_key);
+    if (!s)
+        return 0;
+
+    __builtin_memset(s->path_buf, 0, PATH_MAX_LEN);
+
+    u8 action = check_user_path_action((const char*)ctx->args[1], s->path_buf);
+    if (!action)
+        return 0;
+
+    submit_file_event(s, action, false, (u32)ctx->args[2], 0, 0);
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_connect")
+int tp_sys_enter_connect(struct trace_event_raw_sys_enter* ctx)
+{
+    struct sockaddr* address = (struct sockaddr*)ctx->args[1];
+    u16 family = 0;
+    u16 port_net = 0;
+    u32 addr_v4 = 0;
+    u8 addr_v6[16] = {};
+
+    if (!address)
+        return 0;
+
+    if (bpf_probe_read_user(&family, sizeof(family), &address->sa_family))
+        return 0;
 
     if (family == AF_INET) {
         struct sockaddr_in* addr_in = (struct sockaddr_in*)address;
-        bpf_probe_read_kernel(&event->addr_v4, sizeof(event->addr_v4), &addr_in->sin_addr.s_addr);
+        bpf_probe_read_user(&port_net, sizeof(port_net), &addr_in->sin_port);
+        bpf_probe_read_user(&addr_v4, sizeof(addr_v4), &addr_in->sin_addr.s_addr);
     } else if (family == AF_INET6) {
         struct sockaddr_in6* addr_in6 = (struct sockaddr_in6*)address;
-        bpf_probe_read_kernel(event->addr_v6, 16, &addr_in6->sin6_addr);
+        bpf_probe_read_user(&port_net, sizeof(port_net), &addr_in6->sin6_port);
+        bpf_probe_read_user(addr_v6, 16, &addr_in6->sin6_addr);
+    } else {
+        return 0;
     }
 
-    bpf_ringbuf_submit(event, 0);
-    return ret;
+    handle_connect(family, __bpf_ntohs(port_net), addr_v4, addr_v6, false);
+    return 0;
 }
 
 char LICENSE[] SEC("license") = "GPL";
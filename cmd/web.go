@@ -7,6 +7,8 @@ import (
 	"context"
 	"embed"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"aegis/pkg/ai/runtime"
@@ -18,6 +20,16 @@ import (
 var assets embed.FS
 
 func main() {
+	// Server flags (e.g. -port) start with a dash; anything else is a
+	// maintenance subcommand.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runSubcommand(os.Args[1], os.Args[2:])
+		return
+	}
+	startServer()
+}
+
+func startServer() {
 	opts := config.ParseOptions()
 
 	prewarmAIRuntime(opts)
@@ -28,6 +40,26 @@ func main() {
 	}
 }
 
+// runSubcommand handles maintenance commands that do not start the server.
+func runSubcommand(name string, args []string) {
+	var err error
+	switch name {
+	case "unload":
+		err = cmd.RunUnload(config.LoadOptions(), args)
+	case "doctor":
+		err = cmd.RunDoctor(config.LoadOptions(), args)
+	case "replay":
+		err = cmd.RunReplay(config.LoadOptions(), args, assets)
+	case "export":
+		err = cmd.RunExport(config.LoadOptions(), args)
+	default:
+		log.Fatalf("aegis-web: unknown command %q", name)
+	}
+	if err != nil {
+		log.Fatalf("aegis-web %s: %v", name, err)
+	}
+}
+
 func prewarmAIRuntime(opts config.Options) {
 	if opts.AI.Mode != "ollama" {
 		return
@@ -175,7 +175,6 @@ export function useInvestigation() {
 
     return await explainEvent({
       eventId: state.value.selectedEvent.id,
-      eventData: state.value.selectedEvent,
       question
     })
   }
@@ -16,8 +16,7 @@ export interface RuleGenResponse {
 }
 
 export interface ExplainRequest {
-  eventId?: string
-  eventData?: any
+  eventId: number
   question?: string
 }
 
@@ -7,7 +7,23 @@ export interface SystemStats {
     workloadCount: number
     eventsPerSec: number
     alertCount: number
-    probeStatus: string
+    probeStatus: string // 'active', 'monitor-only', 'replay', 'starting'
+    probeMode?: string  // 'lsm', 'tracepoint' or 'replay'
+    enforcement?: boolean
+    workloadLimit?: number     // size of the workload registry
+    workloadEvictions?: number // workloads evicted to stay within it
+    policyMapFailures?: number // policy bindings the kernel could not record
+}
+
+// Container, pod or systemd unit behind a cgroup (omitted when unknown)
+export interface ContainerInfo {
+    runtime?: string // 'docker', 'containerd', 'cri-o', 'podman', 'cri'
+    id?: string
+    name?: string
+    image?: string
+    podUid?: string
+    systemdUnit?: string
+    systemdSlice?: string
 }
 
 export interface Alert {
@@ -21,6 +37,68 @@ export interface Alert {
     cgroupId: string
     action: string   // 'alert', 'block', 'allow'
     blocked: boolean // Whether the action was blocked by LSM
+    exeSha256?: string
+    eventId?: number // Event that raised the alert, see getEvent
+    container?: ContainerInfo
+    evidence?: string[] // Measurements behind a rate anomaly
+    pidNamespace?: PidNamespace
+    session?: Session // Login session of an exec alert, without commands
+    policy?: string // Policy the rule applied through, for workload-scoped rules
+}
+
+export interface ProcessInfo {
+    pid: number
+    ppid: number
+    comm: string
+    cgroupId: string
+    timestamp: number
+    pidNamespace?: PidNamespace
+}
+
+// PidNamespace places a process in its PID namespace; pid and ppid are as
+// seen inside it (what `ps` shows in a container), ppid 0 when the parent
+// is outside.
+export interface PidNamespace {
+    inode: number
+    pid: number
+    ppid: number
+    host: boolean
+}
+
+// EventDetail is an event with its process ancestry, nearest first.
+export interface EventDetail {
+    event: ExecEvent | ConnectEvent | FileEvent
+    ancestors: ProcessInfo[]
+}
+
+export interface AggregateRequest {
+    query?: string
+    op: 'count' | 'top' | 'distinct' | 'histogram'
+    group_by?: string[]
+    field?: string
+    limit?: number
+    interval?: string
+    window?: string
+}
+
+export interface AggregateResponse {
+    op: string
+    matched: number
+    scanned: number
+    plan: string
+    group_by?: string[]
+    groups?: { key: string[]; count: number; blocked: number }[]
+    field?: string
+    distinct?: number
+    interval_ms?: number
+    buckets?: { start: number; count: number; blocked: number }[]
+}
+
+export interface StatsHistory {
+    from: number
+    to: number
+    step_ms: number
+    series: { metric: string; points: { t: number; value: number; rate: number }[] }[]
 }
 
 export interface EventRates {
@@ -31,6 +109,7 @@ export interface EventRates {
 
 
 export interface ExecEvent {
+    id: number
     type: 'exec'
     timestamp: number
     pid: number
@@ -39,9 +118,16 @@ export interface ExecEvent {
     comm: string
     parentComm: string
     blocked?: boolean
+    exeSha256?: string
+    exeFirstSeen?: boolean // First execution of this binary on the host
+    loginUid?: number
+    tty?: string
+    sessionId?: string // see getSession
+    container?: ContainerInfo
 }
 
 export interface ConnectEvent {
+    id: number
     type: 'connect'
     timestamp: number
     pid: number
@@ -51,9 +137,11 @@ export interface ConnectEvent {
     port: number
     addr: string
     blocked?: boolean
+    container?: ContainerInfo
 }
 
 export interface FileEvent {
+    id: number
     type: 'file'
     timestamp: number
     pid: number
@@ -63,6 +151,7 @@ export interface FileEvent {
     dev?: number
     filename: string
     blocked?: boolean
+    container?: ContainerInfo
 }
 
 // Unified Rule type - used for both detection rules and generated allow rules
@@ -96,6 +185,274 @@ export async function getAlerts(): Promise<Alert[]> {
 }
 
 
+export async function getEvent(id: number): Promise<EventDetail> {
+    const resp = await fetch(`/api/events/${id}`)
+    if (!resp.ok) throw new Error(`Failed to load event ${id}`)
+    return resp.json()
+}
+
+export async function aggregateEvents(req: AggregateRequest): Promise<AggregateResponse> {
+    const resp = await fetch('/api/query/aggregate', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(req)
+    })
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+// metric: comma-separated names such as "rate.exec,alerts.critical";
+// from: a duration ago ("6h"), RFC 3339 or Unix ms; step: e.g. "1m".
+export async function getStatsHistory(metric: string, from = '1h', step?: string): Promise<StatsHistory> {
+    const params = new URLSearchParams({ metric, from })
+    if (step) params.set('step', step)
+    const resp = await fetch(`/api/stats/history?${params}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+export interface ProcessInfo {
+    pid: number
+    ppid: number
+    comm: string
+    cgroupId: string
+    timestamp: number
+}
+
+export interface ProcessNode extends ProcessInfo {
+    children?: ProcessNode[]
+    truncated?: boolean // children cut by the depth or size limit
+}
+
+export interface ProcessProfile {
+    startTime: number
+    commandLine?: string
+    genealogy?: number[]
+    execCount: number
+    fileOpenCount: number
+    connectCount: number
+    lastExec?: number
+    lastFileOpen?: number
+    lastConnect?: number
+}
+
+export interface ProcessDetail {
+    process: ProcessInfo
+    ancestors: ProcessInfo[] // nearest first
+    children: ProcessInfo[]
+    profile?: ProcessProfile
+    container?: ContainerInfo
+    events: any[]
+}
+
+export async function getProcesses(filter: { comm?: string; cgroupId?: string; ppid?: number; limit?: number } = {}): Promise<{ processes: ProcessInfo[]; total: number }> {
+    const params = new URLSearchParams()
+    if (filter.comm) params.set('comm', filter.comm)
+    if (filter.cgroupId) params.set('cgroup_id', filter.cgroupId)
+    if (filter.ppid !== undefined) params.set('ppid', String(filter.ppid))
+    if (filter.limit) params.set('limit', String(filter.limit))
+    const resp = await fetch(`${API_BASE}/processes?${params}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+export async function getProcess(pid: number): Promise<ProcessDetail> {
+    const resp = await fetch(`${API_BASE}/processes/${pid}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+export async function getProcessTree(root = 1, depth = 4): Promise<ProcessNode> {
+    const resp = await fetch(`${API_BASE}/processes/tree?root=${root}&depth=${depth}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+// Login session and the commands run in it. loginUid and auditSessionId
+// are omitted when the kernel assigned none.
+export interface Session {
+    id: string
+    description: string // e.g. 'ssh session from 10.1.2.3 by uid 1001 on pts/0'
+    loginUid?: number
+    auditSessionId?: number
+    leader: number
+    leaderComm?: string
+    tty?: string
+    interactive: boolean
+    origin?: string // 'ssh' or 'console'
+    remoteAddr?: string
+    cgroupId: string
+    active: boolean
+    started: number
+    lastSeen: number
+    commandCount: number
+    commands?: SessionCommand[] // most recent, oldest first
+}
+
+export interface SessionCommand {
+    timestamp: number
+    eventId?: number
+    pid: number
+    ppid: number
+    uid: number
+    comm: string
+    commandLine?: string
+    blocked?: boolean
+}
+
+export async function getSessions(filter: { active?: boolean; uid?: number; interactive?: boolean; since?: string; limit?: number; commands?: boolean } = {}): Promise<{ sessions: Session[]; total: number }> {
+    const params = new URLSearchParams()
+    if (filter.active) params.set('active', 'true')
+    if (filter.uid !== undefined) params.set('uid', String(filter.uid))
+    if (filter.interactive) params.set('interactive', 'true')
+    if (filter.since) params.set('since', filter.since)
+    if (filter.limit) params.set('limit', String(filter.limit))
+    if (filter.commands === false) params.set('commands', 'false')
+    const resp = await fetch(`${API_BASE}/sessions?${params}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+export async function getSession(id: string): Promise<Session> {
+    const resp = await fetch(`${API_BASE}/sessions/${encodeURIComponent(id)}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+// Learned behaviour of one program in a workload. Rates are per active
+// minute, peaks the most seen in one minute.
+export interface Baseline {
+    exe: string
+    cgroupId: string
+    learning: boolean
+    started: number
+    lastSeen: number
+    children: string[]
+    filePrefixes: string[]
+    ports: string[]
+    destinations: string[]
+    execRate: number
+    fileRate: number
+    connectRate: number
+    execPeak: number
+    filePeak: number
+    connectPeak: number
+}
+
+export interface Workload {
+    id: string
+    name: string // e.g. the container name, 'docker 3f4e5a6b7c8d' or 'sshd.service'
+    cgroupPath: string
+    execCount: number
+    fileCount: number
+    connectCount: number
+    alertCount: number
+    blockedCount: number
+    firstSeen: number
+    lastSeen: number
+    suppressedCount: number
+    container?: ContainerInfo
+    policies?: string[] // names of the policies bound to the workload
+}
+
+export type WorkloadSort = 'name' | 'firstSeen' | 'lastSeen' | 'execs' | 'files' | 'connects' | 'alerts' | 'blocked'
+
+export async function getWorkloads(filter: { q?: string; runtime?: string; container?: boolean; sort?: WorkloadSort; order?: 'asc' | 'desc'; limit?: number } = {}): Promise<Workload[]> {
+    const params = new URLSearchParams()
+    if (filter.q) params.set('q', filter.q)
+    if (filter.runtime) params.set('runtime', filter.runtime)
+    if (filter.container !== undefined) params.set('container', String(filter.container))
+    if (filter.sort) params.set('sort', filter.sort)
+    if (filter.order) params.set('order', filter.order)
+    if (filter.limit) params.set('limit', String(filter.limit))
+    const resp = await fetch(`${API_BASE}/workloads?${params}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+// Events sharing one value: a process name, file path or 'ip:port'.
+export interface TopCount {
+    value: string
+    count: number
+    blocked: number
+}
+
+export interface WorkloadDetail {
+    workload: Workload
+    runningProcesses: number
+    windowStart: number
+    topProcesses: TopCount[]
+    topFiles: TopCount[]
+    topDestinations: TopCount[]
+    alerts: Alert[] // most recent first
+}
+
+export async function getWorkload(workloadId: string, window = '24h'): Promise<WorkloadDetail> {
+    const resp = await fetch(`${API_BASE}/workloads/${workloadId}?window=${window}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+export interface WorkloadBucket {
+    start: number
+    exec: number
+    file: number
+    connect: number
+    blocked: number
+    alerts: number
+}
+
+export async function getWorkloadTimeline(workloadId: string, window = '1h', interval = '1m'): Promise<{ id: string; intervalMs: number; buckets: WorkloadBucket[] }> {
+    const resp = await fetch(`${API_BASE}/workloads/${workloadId}/timeline?window=${window}&interval=${interval}`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+export async function getWorkloadBaselines(workloadId: string): Promise<Baseline[]> {
+    const resp = await fetch(`${API_BASE}/workloads/${workloadId}/baselines`)
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+// Forgets a workload's baselines; its programs start learning again.
+export async function resetWorkloadBaselines(workloadId: string): Promise<{ removed: number }> {
+    const resp = await fetch(`${API_BASE}/workloads/${workloadId}/baselines`, { method: 'DELETE' })
+    if (!resp.ok) throw new Error(await resp.text())
+    return resp.json()
+}
+
+export type PolicyMode = 'off' | 'monitor' | 'enforce'
+
+export interface Policy {
+    name: string
+    mode: PolicyMode
+    selector: { cgroupPath?: string; image?: string; systemdUnit?: string; labels?: Record<string, string> }
+    rules: string[]
+    workloads: string[] // IDs of the known workloads the policy is bound to
+}
+
+export async function getPolicies(): Promise<Policy[]> {
+    const resp = await fetch(`${API_BASE}/policies`)
+    if (!resp.ok) throw new Error(await resp.text())
+    const data = await resp.json()
+    return data.policies
+}
+
+export type ExportFormat = 'jsonl' | 'csv' | 'ecs'
+
+// Download links for GET /api/export/*; the browser streams the file.
+export function exportEventsUrl(format: ExportFormat, query = '', from = '24h'): string {
+    const params = new URLSearchParams({ format, from })
+    if (query) params.set('query', query)
+    return `/api/export/events?${params}`
+}
+
+export function exportAlertsUrl(format: ExportFormat, severity?: string[]): string {
+    const params = new URLSearchParams({ format })
+    if (severity?.length) params.set('severity', severity.join(','))
+    return `/api/export/alerts?${params}`
+}
+
 export async function getRules(): Promise<DetectionRule[]> {
     const resp = await fetch('/api/rules')
     return resp.json()
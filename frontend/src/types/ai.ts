@@ -15,8 +15,7 @@ export interface RuleGenResponse {
 }
 
 export interface ExplainRequest {
-  eventId?: string
-  eventData?: any
+  eventId: number
   question?: string
 }
 
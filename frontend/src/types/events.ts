@@ -56,9 +56,18 @@ export interface QueryFilter {
     end: string
   }
   correlation?: boolean
+  // Answered from the server's path, destination and command-line indexes.
+  paths?: string[]
+  path_prefixes?: string[]
+  dst_ips?: string[]
+  dst_ports?: number[]
+  cmdline_terms?: string[]
 }
 
 export interface QueryRequest {
+  // Event query language, e.g. `type = exec and comm = curl since 1h`.
+  // Takes precedence over filter.
+  query?: string
   filter?: QueryFilter
   semantic?: string
   page?: number
@@ -78,5 +87,6 @@ export interface QueryResponse {
     file: number
     connect: number
   }
+  plan?: string
 }
 
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"aegis/pkg/ai/prompt"
 	"aegis/pkg/ai/providers"
 	"aegis/pkg/ai/snapshot"
 	"aegis/pkg/ai/types"
+	"aegis/pkg/anomaly"
 	"aegis/pkg/proc"
 	"aegis/pkg/rules"
 	"aegis/pkg/workload"
@@ -44,7 +46,7 @@ func Analyze(
 			return nil, fmt.Errorf("process profile not found for PID %d", pid)
 		}
 		analysisData = prompt.FormatProcessProfile(profile)
-		anomalies = analyzeProcessAnomalies(profile)
+		anomalies = analyzeProcessAnomalies(profileReg, profile)
 
 	case types.AnalyzeTypeWorkload:
 		cgroupID, err := strconv.ParseUint(req.ID, 10, 64)
@@ -56,7 +58,7 @@ func Analyze(
 			return nil, fmt.Errorf("workload not found for CgroupID %d", cgroupID)
 		}
 		analysisData = prompt.FormatWorkloadMetadata(w)
-		anomalies = analyzeWorkloadAnomalies(w)
+		anomalies = analyzeWorkloadAnomalies(profileReg, w)
 
 	case types.AnalyzeTypeRule:
 		allRules := ruleEngine.GetRules()
@@ -108,49 +110,26 @@ func Analyze(
 }
 
 
-func analyzeProcessAnomalies(profile *proc.ProcessProfile) []types.Anomaly {
-	var out []types.Anomaly
+// anomalyLookback is how far back Analyze reports rate anomalies.
+const anomalyLookback = time.Hour
 
-	// Very simple heuristics: high IO or network counts are considered interesting.
-	if profile.Dynamic.FileOpenCount > 1_000 {
-		out = append(out, types.Anomaly{
-			Type:        "unusual_file_activity",
-			Description: "Process has opened an unusually high number of files.",
-			Severity:    "high",
-			Confidence:  0.7,
-			Evidence: []string{
-				fmt.Sprintf("FileOpenCount=%d", profile.Dynamic.FileOpenCount),
-			},
-		})
-	}
-	if profile.Dynamic.NetConnectCount > 1_000 {
-		out = append(out, types.Anomaly{
-			Type:        "unusual_network_activity",
-			Description: "Process has made an unusually high number of network connections.",
-			Severity:    "high",
-			Confidence:  0.7,
-			Evidence: []string{
-				fmt.Sprintf("NetConnectCount=%d", profile.Dynamic.NetConnectCount),
-			},
-		})
+// analyzeProcessAnomalies reports the recent rate anomalies of the process
+// and of its executable.
+func analyzeProcessAnomalies(profileReg *proc.ProfileRegistry, profile *proc.ProcessProfile) []types.Anomaly {
+	d := profileReg.Anomalies()
+	if d == nil {
+		return nil
 	}
-	return out
+	exe := anomaly.Entity{Kind: anomaly.EntityExecutable, ID: profile.Program().Exe}
+	return rateAnomalies(d.Recent(time.Now().Add(-anomalyLookback), proc.ProcessEntity(profile.PID), exe))
 }
 
-
-func analyzeWorkloadAnomalies(w *workload.Metadata) []types.Anomaly {
+func analyzeWorkloadAnomalies(profileReg *proc.ProfileRegistry, w *workload.Metadata) []types.Anomaly {
 	var out []types.Anomaly
-	totalEvents := w.ExecCount + w.FileCount + w.ConnectCount
-	if totalEvents > 10_000 {
-		out = append(out, types.Anomaly{
-			Type:        "high_activity",
-			Description: "Workload is generating a large volume of telemetry.",
-			Severity:    "medium",
-			Confidence:  0.6,
-			Evidence: []string{
-				fmt.Sprintf("TotalEvents=%d", totalEvents),
-			},
-		})
+	if profileReg != nil {
+		if d := profileReg.Anomalies(); d != nil {
+			out = rateAnomalies(d.Recent(time.Now().Add(-anomalyLookback), proc.WorkloadEntity(uint64(w.ID))))
+		}
 	}
 	if w.AlertCount > 0 {
 		out = append(out, types.Anomaly{
@@ -166,6 +145,22 @@ func analyzeWorkloadAnomalies(w *workload.Metadata) []types.Anomaly {
 	return out
 }
 
+// rateAnomalies converts detector anomalies. Confidence grows with the
+// z-score: 0.75 at 4 standard deviations, 0.9 at 10.
+func rateAnomalies(found []anomaly.Anomaly) []types.Anomaly {
+	out := make([]types.Anomaly, 0, len(found))
+	for _, a := range found {
+		out = append(out, types.Anomaly{
+			Type:        a.Type(),
+			Description: a.Description(),
+			Severity:    a.Severity,
+			Confidence:  min(0.99, max(0.5, 1-1/a.Score)),
+			Evidence:    a.Evidence(),
+		})
+	}
+	return out
+}
+
 
 func analyzeRuleAnomalies(rule *rules.Rule, engine *rules.Engine) []types.Anomaly {
 	var out []types.Anomaly
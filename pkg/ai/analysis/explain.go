@@ -9,7 +9,6 @@ import (
 	"aegis/pkg/ai/providers"
 	"aegis/pkg/ai/snapshot"
 	"aegis/pkg/ai/types"
-	"aegis/pkg/events"
 	"aegis/pkg/proc"
 	"aegis/pkg/rules"
 	"aegis/pkg/storage"
@@ -34,22 +33,8 @@ func ExplainEvent(
 
 	var relatedEvents []*storage.Event
 	var pid uint32
-
-	switch ev := event.Data.(type) {
-	case *events.ExecEvent:
-		pid = ev.Hdr.PID
-	case *events.FileOpenEvent:
-		pid = ev.Hdr.PID
-	case *events.ConnectEvent:
-		pid = ev.Hdr.PID
-	case map[string]any:
-		if v, ok := ev["pid"].(float64); ok {
-			pid = uint32(v)
-		} else if hdr, ok := ev["header"].(map[string]any); ok {
-			if v, ok := hdr["pid"].(float64); ok {
-				pid = uint32(v)
-			}
-		}
+	if hdr, ok := event.Header(); ok {
+		pid = hdr.PID
 	}
 
 	if store != nil && pid != 0 {
@@ -118,7 +103,7 @@ func generateSuggestedActions(event *storage.Event, rule *rules.Rule) []types.Ac
 	actions = append(actions, types.Action{
 		Label:    "调查",
 		ActionID: "investigate",
-		Params:   map[string]any{"event_id": fmt.Sprintf("%v", event)},
+		Params:   map[string]any{"event_id": event.ID},
 	})
 
 	return actions
@@ -220,7 +220,7 @@ func BuildExplainContext(event *storage.Event, pid uint32, store storage.EventSt
 				}
 				var evPID uint32
 				var eventTypeStr string
-				switch e := ev.Data.(type) {
+				switch e := ev.TypedData().(type) {
 				case *events.ExecEvent:
 					evPID = e.Hdr.PID
 					eventTypeStr = "exec"
@@ -286,7 +286,11 @@ func FormatEventForExplanation(event *storage.Event, profile *proc.ProcessProfil
 	b.WriteString("Event\n")
 	b.WriteString(fmt.Sprintf("- Time: %s\n", event.Timestamp.Format(time.RFC3339)))
 
-	switch ev := event.Data.(type) {
+	if event.ID != 0 {
+		b.WriteString(fmt.Sprintf("- ID: %d\n", event.ID))
+	}
+
+	switch ev := event.TypedData().(type) {
 	case *events.ExecEvent:
 		b.WriteString("- Type: exec\n")
 		b.WriteString(fmt.Sprintf("- PID: %d\n", ev.Hdr.PID))
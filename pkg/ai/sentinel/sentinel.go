@@ -3,12 +3,16 @@ package sentinel
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"aegis/pkg/ai/insights"
 	"aegis/pkg/ai/types"
+	"aegis/pkg/anomaly"
+	"aegis/pkg/metrics"
 	"aegis/pkg/proc"
 	"aegis/pkg/rules"
 	"aegis/pkg/storage"
@@ -60,10 +64,14 @@ type Sentinel struct {
 	ruleEngine *rules.Engine
 	store      storage.EventStore
 	profileReg *proc.ProfileRegistry
+	history    *metrics.Rollup
 	schedule   ScheduleConfig
 
 	insights *insights.Store[*Insight]
 
+	mu               sync.Mutex
+	lastAnomalyCheck time.Time
+
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 }
@@ -103,6 +111,13 @@ func (s *Sentinel) WithSchedule(cfg ScheduleConfig) *Sentinel {
 	return s
 }
 
+// WithHistory lets anomaly checks compare current event rates with the
+// rolled-up history.
+func (s *Sentinel) WithHistory(h *metrics.Rollup) *Sentinel {
+	s.history = h
+	return s
+}
+
 func (s *Sentinel) Start() {
 	// Clear any old insights when starting fresh
 	s.insights.Reset()
@@ -248,7 +263,89 @@ func (s *Sentinel) checkTestingPromotion(ctx context.Context) []*Insight {
 }
 
 func (s *Sentinel) checkAnomalies(ctx context.Context) []*Insight {
-	if s.store == nil || !s.service.IsEnabled() {
+	if !s.service.IsEnabled() {
+		return nil
+	}
+	var out []*Insight
+	if insight := s.rateAnomalyInsight(time.Now()); insight != nil {
+		out = append(out, insight)
+	}
+	return append(out, s.checkEventActivity()...)
+}
+
+// rateAnomalyInsight reports the rate anomalies found since the previous
+// check, or nil if there were none.
+func (s *Sentinel) rateAnomalyInsight(now time.Time) *Insight {
+	if s.profileReg == nil || s.profileReg.Anomalies() == nil {
+		return nil
+	}
+	s.mu.Lock()
+	since := s.lastAnomalyCheck
+	s.lastAnomalyCheck = now
+	s.mu.Unlock()
+	if since.IsZero() {
+		since = now.Add(-s.schedule.Anomaly)
+	}
+	found := s.profileReg.Anomalies().Recent(since)
+	if len(found) == 0 {
+		return nil
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Score > found[j].Score })
+
+	severity := SeverityMedium
+	list := make([]map[string]any, 0, len(found))
+	var pids []uint32
+	for _, a := range found {
+		if a.Severity == "high" {
+			severity = SeverityHigh
+		}
+		if a.Entity.Kind == anomaly.EntityProcess {
+			if pid, err := strconv.ParseUint(a.Entity.ID, 10, 32); err == nil {
+				pids = append(pids, uint32(pid))
+			}
+		}
+		list = append(list, map[string]any{
+			"type":     a.Type(),
+			"entity":   a.Entity,
+			"name":     a.Name,
+			"metric":   a.Metric,
+			"count":    a.Count,
+			"mean":     a.Mean,
+			"z_score":  a.Score,
+			"severity": a.Severity,
+			"time":     a.Time.UnixMilli(),
+			"evidence": a.Evidence(),
+		})
+	}
+
+	raw := insights.NewInsight(
+		now,
+		insights.NewInsightID("rate-anomalies", now),
+		InsightTypeAnomaly,
+		"Unusual Activity Rates",
+		fmt.Sprintf("%d rate anomalies since the last check. The strongest: %s.", len(found), found[0].Description()),
+		severity,
+	)
+	insight := &Insight{
+		ID:         raw.ID,
+		Type:       raw.Type.(InsightType),
+		Title:      raw.Title,
+		Summary:    raw.Summary,
+		Confidence: 0.85,
+		Severity:   raw.Severity.(Severity),
+		Data:       raw.Data,
+		Actions:    raw.Actions,
+		CreatedAt:  raw.CreatedAt,
+	}
+	insight.Data["anomalies"] = list
+	insight.Data["pids"] = pids
+	insight.Actions = []types.Action{{Label: "Investigate Processes", ActionID: "navigate", Params: map[string]any{"page": "observatory", "pids": pids}}}
+	return insight
+}
+
+// checkEventActivity summarises the notable events of the last 15 minutes.
+func (s *Sentinel) checkEventActivity() []*Insight {
+	if s.store == nil {
 		return nil
 	}
 
@@ -300,11 +397,67 @@ func (s *Sentinel) checkAnomalies(ctx context.Context) []*Insight {
 		Actions:    raw.Actions,
 		CreatedAt:  raw.CreatedAt,
 	}
+	if recent, baseline, ok := s.eventRateTrend(now); ok {
+		insight.Data["event_rate"] = recent
+		insight.Data["event_rate_baseline"] = baseline
+		if recent > rateSpikeFactor*baseline {
+			insight.Severity = SeverityHigh
+			insight.Summary += fmt.Sprintf(" Event rate is %.1f/s against a 24-hour average of %.1f/s.", recent, baseline)
+		}
+	}
+	eventIDs := recentEventIDs(events, maxInsightEventIDs)
 	insight.Data["event_count"] = len(events)
-	insight.Actions = []types.Action{{Label: "Investigate Events", ActionID: "navigate", Params: map[string]any{"page": "observatory"}}}
+	insight.Data["event_ids"] = eventIDs
+	insight.Actions = []types.Action{{Label: "Investigate Events", ActionID: "navigate", Params: map[string]any{"page": "observatory", "event_ids": eventIDs}}}
 	return []*Insight{insight}
 }
 
+// rateSpikeFactor is how far above its 24-hour average the event rate of
+// the last 15 minutes must be to raise an anomaly's severity.
+const rateSpikeFactor = 3
+
+var rateMetrics = []string{"rate.exec", "rate.file", "rate.connect"}
+
+// eventRateTrend returns the event rate of the last 15 minutes and the
+// average over the 24 hours before, in events per second.
+func (s *Sentinel) eventRateTrend(now time.Time) (recent, baseline float64, ok bool) {
+	if s.history == nil {
+		return 0, 0, false
+	}
+	split := now.Add(-15 * time.Minute)
+	sum := func(from, to time.Time, step time.Duration) float64 {
+		var total float64
+		for _, m := range rateMetrics {
+			points, _, err := s.history.Query(m, from, to, step)
+			if err != nil {
+				return 0
+			}
+			for _, p := range points {
+				total += p.Value
+			}
+		}
+		return total
+	}
+	recent = sum(split, now, time.Minute) / now.Sub(split).Seconds()
+	baseline = sum(split.Add(-24*time.Hour), split, time.Hour) / (24 * time.Hour).Seconds()
+	return recent, baseline, baseline > 0
+}
+
+// maxInsightEventIDs bounds the event references carried by an insight.
+const maxInsightEventIDs = 20
+
+// recentEventIDs returns the IDs of the newest events, newest first, for
+// resolution through GET /api/events/{id}.
+func recentEventIDs(evs []*storage.Event, limit int) []uint64 {
+	ids := make([]uint64, 0, min(len(evs), limit))
+	for i := len(evs) - 1; i >= 0 && len(ids) < limit; i-- {
+		if evs[i] != nil && evs[i].ID != 0 {
+			ids = append(ids, evs[i].ID)
+		}
+	}
+	return ids
+}
+
 func (s *Sentinel) checkRuleOptimization(ctx context.Context) []*Insight {
 	if s.ruleEngine == nil || !s.service.IsEnabled() {
 		return nil
@@ -24,36 +24,59 @@ func (s *Snapshot) buildRecentActivity() ([]apimodel.ExecEvent, recentActivity)
 	}
 
 	now := time.Now()
-	windowStart := now.Add(-RecentEventWindow)
-
-	execEvents := s.queryEventsByType(events.EventTypeExec, windowStart, now)
-	connectEvents := s.queryEventsByType(events.EventTypeConnect, windowStart, now)
-	fileEvents := s.queryEventsByType(events.EventTypeFileOpen, windowStart, now)
+	execEvents, activity := s.recentActivityIn(now.Add(-RecentEventWindow), now)
 
 	// Fallback: if queries return nothing but the store has events, it usually means
 	// the event timestamps are not aligned with time.Now() (kernel->wall conversion / clock skew).
-	if len(execEvents) == 0 && len(connectEvents) == 0 && len(fileEvents) == 0 {
+	if len(execEvents) == 0 && len(activity.Connections) == 0 && len(activity.Files) == 0 {
 		if latest, err := s.store.Latest(1); err == nil && len(latest) == 1 && latest[0] != nil {
 			latestTs := latest[0].Timestamp
-			fallbackStart := latestTs.Add(-RecentEventWindow)
-			fallbackEnd := latestTs.Add(10 * time.Second)
-			execEvents = s.queryEventsByType(events.EventTypeExec, fallbackStart, fallbackEnd)
-			connectEvents = s.queryEventsByType(events.EventTypeConnect, fallbackStart, fallbackEnd)
-			fileEvents = s.queryEventsByType(events.EventTypeFileOpen, fallbackStart, fallbackEnd)
+			execEvents, activity = s.recentActivityIn(latestTs.Add(-RecentEventWindow), latestTs.Add(10*time.Second))
 		}
 	}
 
-	procSummaries := buildProcessActivityFromStorage(execEvents)
-	connSummaries := buildConnectionActivityFromStorage(connectEvents)
-	fileSummaries := buildFileActivityFromStorage(fileEvents)
+	return convertStorageExecEvents(execEvents), activity
+}
+
+func (s *Snapshot) recentActivityIn(start, end time.Time) ([]*storage.Event, recentActivity) {
+	execEvents := s.queryEventsByType(events.EventTypeExec, start, end)
 
-	return convertStorageExecEvents(execEvents), recentActivity{
-		Processes:   procSummaries,
-		Connections: connSummaries,
-		Files:       fileSummaries,
+	processes := s.countBy("type = exec", start, end, "comm", "parent")
+	connections := s.countBy("type = connect", start, end, "dst.ip", "dst.port")
+	files := s.countBy("type = file", start, end, "filename")
+
+	return execEvents, recentActivity{
+		Processes:   buildProcessActivity(processes),
+		Connections: buildConnectionActivity(connections),
+		Files:       buildFileActivity(files),
 	}
 }
 
+// countBy counts the events matching filter in [start, end] per value of
+// fields.
+func (s *Snapshot) countBy(filter string, start, end time.Time, fields ...string) []storage.Group {
+	q, err := storage.ParseQuery(filter, end)
+	if err != nil {
+		return nil
+	}
+	q.Since, q.Until = start, end
+	agg := storage.Aggregation{Op: storage.AggCount, GroupBy: fields}
+
+	var res *storage.AggregateResult
+	if manager, ok := s.store.(*storage.Manager); ok {
+		res, err = manager.Aggregate(q, agg, storage.QueryContext{})
+	} else {
+		var evs []*storage.Event
+		if evs, err = s.store.Query(start, end); err == nil {
+			res, err = storage.AggregateEvents(evs, q, agg, storage.QueryContext{})
+		}
+	}
+	if err != nil {
+		return nil
+	}
+	return res.Groups
+}
+
 // queryEventsByType queries events of a specific type from storage
 func (s *Snapshot) queryEventsByType(eventType events.EventType, start, end time.Time) []*storage.Event {
 	if manager, ok := s.store.(*storage.Manager); ok {
@@ -113,109 +136,63 @@ func convertStorageExecEvents(storageEvents []*storage.Event) []apimodel.ExecEve
 	return execs
 }
 
-func buildProcessActivityFromStorage(storageEvents []*storage.Event) []ProcessActivity {
-	groups := make(map[string]*ProcessActivity)
-
-	for _, sev := range storageEvents {
-		var execEv *events.ExecEvent
-		switch v := sev.Data.(type) {
-		case *events.ExecEvent:
-			execEv = v
-		case events.ExecEvent:
-			execEv = &v
-		default:
-			continue
-		}
-
-		comm := utils.ExtractCString(execEv.Hdr.Comm[:])
-		parentComm := utils.ExtractCString(execEv.PComm[:])
-
-		key := comm + "|" + parentComm
-		blocked := execEv.Hdr.Blocked == 1
-
-		if existing, ok := groups[key]; ok {
-			existing.Count++
-			existing.Blocked = existing.Blocked || blocked
-		} else {
-			groups[key] = &ProcessActivity{
-				Comm:       comm,
-				ParentComm: parentComm,
-				Count:      1,
-				Blocked:    blocked,
-			}
+func buildProcessActivity(groups []storage.Group) []ProcessActivity {
+	activity := make(map[string]*ProcessActivity, len(groups))
+	for _, g := range groups {
+		activity[g.Key[0]+"|"+g.Key[1]] = &ProcessActivity{
+			Comm:       g.Key[0],
+			ParentComm: g.Key[1],
+			Count:      g.Count,
+			Blocked:    g.Blocked > 0,
 		}
 	}
 
-	return finalizeGroup(groups, MaxAlertSummaries, func(a, b ProcessActivity) bool {
+	return finalizeGroup(activity, MaxAlertSummaries, func(a, b ProcessActivity) bool {
 		return compareByBlockedThenCount(a.Blocked, a.Count, b.Blocked, b.Count)
 	})
 }
 
-func buildConnectionActivityFromStorage(storageEvents []*storage.Event) []ConnectionActivity {
-	groups := make(map[string]*ConnectionActivity)
-
-	for _, sev := range storageEvents {
-		connEv, ok := sev.Data.(*events.ConnectEvent)
-		if !ok {
-			continue
-		}
-
-		addr := utils.ExtractIP(connEv)
-		if addr == "" {
-			continue
-		}
-		if connEv.Port != 0 {
-			addr = fmt.Sprintf("%s:%d", addr, connEv.Port)
+func buildConnectionActivity(groups []storage.Group) []ConnectionActivity {
+	activity := make(map[string]*ConnectionActivity, len(groups))
+	for _, g := range groups {
+		addr := g.Key[0]
+		if g.Key[1] != "0" {
+			addr = fmt.Sprintf("%s:%s", addr, g.Key[1])
 		}
-
-		blocked := connEv.Hdr.Blocked == 1
-		if existing, ok := groups[addr]; ok {
-			existing.Count++
-			existing.Blocked = existing.Blocked || blocked
-		} else {
-			groups[addr] = &ConnectionActivity{
-				Destination: addr,
-				Count:       1,
-				Blocked:     blocked,
-			}
+		activity[addr] = &ConnectionActivity{
+			Destination: addr,
+			Count:       g.Count,
+			Blocked:     g.Blocked > 0,
 		}
 	}
 
-	return finalizeGroup(groups, MaxActivitySummaries, func(a, b ConnectionActivity) bool {
+	return finalizeGroup(activity, MaxActivitySummaries, func(a, b ConnectionActivity) bool {
 		return compareByBlockedThenCount(a.Blocked, a.Count, b.Blocked, b.Count)
 	})
 }
 
-func buildFileActivityFromStorage(storageEvents []*storage.Event) []FileActivity {
-	groups := make(map[string]*FileActivity)
-
-	for _, sev := range storageEvents {
-		fileEv, ok := sev.Data.(*events.FileOpenEvent)
-		if !ok {
+func buildFileActivity(groups []storage.Group) []FileActivity {
+	activity := make(map[string]*FileActivity)
+	for _, g := range groups {
+		if g.Key[0] == "" {
 			continue
 		}
 
-		filename := utils.ExtractCString(fileEv.Filename[:])
-		if filename == "" {
-			continue
-		}
-
-		path := simplifyFilePath(filename)
-		blocked := fileEv.Hdr.Blocked == 1
-
-		if existing, ok := groups[path]; ok {
-			existing.Count++
-			existing.Blocked = existing.Blocked || blocked
+		// Simplified paths merge several filenames into one entry.
+		path := simplifyFilePath(g.Key[0])
+		if existing, ok := activity[path]; ok {
+			existing.Count += g.Count
+			existing.Blocked = existing.Blocked || g.Blocked > 0
 		} else {
-			groups[path] = &FileActivity{
+			activity[path] = &FileActivity{
 				Path:    path,
-				Count:   1,
-				Blocked: blocked,
+				Count:   g.Count,
+				Blocked: g.Blocked > 0,
 			}
 		}
 	}
 
-	return finalizeGroup(groups, MaxActivitySummaries, func(a, b FileActivity) bool {
+	return finalizeGroup(activity, MaxActivitySummaries, func(a, b FileActivity) bool {
 		return compareByBlockedThenCount(a.Blocked, a.Count, b.Blocked, b.Count)
 	})
 }
@@ -80,9 +80,8 @@ type AnalyzeResponse struct {
 }
 
 type ExplainRequest struct {
-	EventID   string         `json:"event_id"`
-	EventData *storage.Event `json:"event_data"`
-	Question  string         `json:"question"`
+	EventID  uint64 `json:"event_id"`
+	Question string `json:"question"`
 }
 
 type Action struct {
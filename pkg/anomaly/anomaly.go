@@ -0,0 +1,332 @@
+// Package anomaly detects unusual event rates. Each entity (a process, an
+// executable or a workload) has a series per activity, counted in fixed
+// windows. A series keeps an exponentially weighted mean and variance of
+// its past windows, and a window whose count is more than Threshold
+// standard deviations above the mean is reported as it happens.
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWindow          = time.Minute
+	DefaultBaselineWindows = 60
+	DefaultThreshold       = 4
+	DefaultMinSamples      = 10
+	DefaultMinCount        = 20
+
+	// maxSeries bounds the tracked series; new entities are ignored once
+	// it is reached, until idle ones are pruned.
+	maxSeries = 50000
+	// maxRecent is how many anomalies are kept for Recent.
+	maxRecent = 500
+)
+
+// EntityKind is what a series is counted for.
+type EntityKind string
+
+const (
+	EntityProcess    EntityKind = "process"
+	EntityExecutable EntityKind = "executable"
+	EntityWorkload   EntityKind = "workload"
+)
+
+// Entity identifies one process (by PID), executable (by path or comm) or
+// workload (by cgroup ID).
+type Entity struct {
+	Kind EntityKind `json:"kind"`
+	ID   string     `json:"id"`
+}
+
+func (e Entity) String() string {
+	return string(e.Kind) + " " + e.ID
+}
+
+// Metric is the activity a series counts.
+type Metric string
+
+const (
+	MetricExec    Metric = "exec"
+	MetricFile    Metric = "file"
+	MetricConnect Metric = "connect"
+)
+
+// Config tunes the detector. Zero values select defaults.
+type Config struct {
+	Window          time.Duration // length of a counting window
+	BaselineWindows int           // span of the moving average, in windows
+	Threshold       float64       // z-score at which a window is anomalous
+	MinSamples      int           // windows a series needs before it is scored
+	MinCount        int           // events a window needs before it is scored
+}
+
+func (c Config) withDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.BaselineWindows <= 0 {
+		c.BaselineWindows = DefaultBaselineWindows
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultThreshold
+	}
+	if c.MinSamples <= 0 {
+		c.MinSamples = DefaultMinSamples
+	}
+	if c.MinCount <= 0 {
+		c.MinCount = DefaultMinCount
+	}
+	return c
+}
+
+// Anomaly is a window in which an entity's activity was far above its
+// moving average. Count, Mean and StdDev are events per window.
+type Anomaly struct {
+	Entity   Entity
+	Name     string // comm or path, when known
+	Metric   Metric
+	Time     time.Time
+	Window   time.Duration
+	Count    float64
+	Mean     float64
+	StdDev   float64
+	Score    float64 // standard deviations above the mean
+	Samples  int
+	Severity string
+}
+
+// Type names the anomaly for consumers that classify by string, such as
+// "file_rate_spike".
+func (a Anomaly) Type() string {
+	return string(a.Metric) + "_rate_spike"
+}
+
+// Description summarises the anomaly in one sentence.
+func (a Anomaly) Description() string {
+	subject := a.Entity.String()
+	if a.Name != "" && a.Name != a.Entity.ID {
+		subject += " (" + a.Name + ")"
+	}
+	return fmt.Sprintf("%s made %.0f %s events in %s, %.1f standard deviations above its average of %.1f",
+		subject, a.Count, a.Metric, a.Window, a.Score, a.Mean)
+}
+
+// Evidence lists the measurements behind the anomaly.
+func (a Anomaly) Evidence() []string {
+	return []string{
+		fmt.Sprintf("%s=%s", a.Entity.Kind, a.Entity.ID),
+		fmt.Sprintf("%s_count=%.0f per %s", a.Metric, a.Count, a.Window),
+		fmt.Sprintf("moving_average=%.2f", a.Mean),
+		fmt.Sprintf("stddev=%.2f", a.StdDev),
+		fmt.Sprintf("z_score=%.1f", a.Score),
+		fmt.Sprintf("windows_observed=%d", a.Samples),
+	}
+}
+
+type seriesKey struct {
+	entity Entity
+	metric Metric
+}
+
+// series is the state of one entity and metric: the window being counted
+// and the moving statistics of the windows before it.
+type series struct {
+	window   time.Time
+	count    float64
+	mean     float64
+	variance float64
+	samples  int
+	flagged  bool
+}
+
+// Detector tracks windowed rates and reports anomalies. It is safe for
+// concurrent use.
+type Detector struct {
+	cfg   Config
+	alpha float64
+
+	mu     sync.Mutex
+	series map[seriesKey]*series
+	recent []Anomaly
+}
+
+func NewDetector(cfg Config) *Detector {
+	cfg = cfg.withDefaults()
+	return &Detector{
+		cfg:    cfg,
+		alpha:  2 / (float64(cfg.BaselineWindows) + 1),
+		series: make(map[seriesKey]*series),
+	}
+}
+
+func (d *Detector) Config() Config {
+	return d.cfg
+}
+
+// Observe counts one metric event at now for each entity and returns the
+// anomalies it completes, highest score first. name describes the source
+// of the event for reports. An entity is reported at most once per window.
+func (d *Detector) Observe(metric Metric, name string, now time.Time, entities ...Entity) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window := now.Truncate(d.cfg.Window)
+	var out []Anomaly
+	for _, e := range entities {
+		key := seriesKey{e, metric}
+		s, ok := d.series[key]
+		if !ok {
+			if len(d.series) >= maxSeries {
+				continue
+			}
+			s = &series{window: window}
+			d.series[key] = s
+		}
+		d.advance(s, window)
+		s.count++
+
+		if a, ok := d.score(s, e, metric, now); ok {
+			a.Name = name
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+
+	d.recent = append(d.recent, out...)
+	if over := len(d.recent) - maxRecent; over > 0 {
+		d.recent = append(d.recent[:0], d.recent[over:]...)
+	}
+	return out
+}
+
+// advance closes the windows of s that ended before window, folding their
+// counts into the moving statistics. Windows without events count as zero.
+// Late events are counted into the current window.
+func (d *Detector) advance(s *series, window time.Time) {
+	if !window.After(s.window) {
+		return
+	}
+	d.update(s, s.count)
+	idle := int(window.Sub(s.window)/d.cfg.Window) - 1
+	for i := 0; i < min(idle, d.cfg.BaselineWindows); i++ {
+		d.update(s, 0)
+	}
+	s.window, s.count, s.flagged = window, 0, false
+}
+
+// update adds one window's count to the exponentially weighted mean and
+// variance.
+func (d *Detector) update(s *series, x float64) {
+	if s.samples == 0 {
+		s.mean, s.variance = x, 0
+	} else {
+		diff := x - s.mean
+		incr := d.alpha * diff
+		s.mean += incr
+		s.variance = (1 - d.alpha) * (s.variance + diff*incr)
+	}
+	s.samples++
+}
+
+// score checks the current window of s. The deviation is measured against
+// at least the square root of the mean, the spread of a steady Poisson
+// process, so series that have been nearly constant are not reported for
+// small changes.
+func (d *Detector) score(s *series, e Entity, metric Metric, now time.Time) (Anomaly, bool) {
+	if s.flagged || s.samples < d.cfg.MinSamples || s.count < float64(d.cfg.MinCount) {
+		return Anomaly{}, false
+	}
+	std := math.Sqrt(s.variance)
+	spread := max(std, math.Sqrt(s.mean), 1)
+	z := (s.count - s.mean) / spread
+	if z < d.cfg.Threshold {
+		return Anomaly{}, false
+	}
+	s.flagged = true
+
+	severity := "medium"
+	if z >= 2*d.cfg.Threshold {
+		severity = "high"
+	}
+	return Anomaly{
+		Entity:   e,
+		Metric:   metric,
+		Time:     now,
+		Window:   d.cfg.Window,
+		Count:    s.count,
+		Mean:     s.mean,
+		StdDev:   std,
+		Score:    z,
+		Samples:  s.samples,
+		Severity: severity,
+	}, true
+}
+
+// Rate returns the count of the window containing now and the moving
+// average, in events per window, for an entity and metric.
+func (d *Detector) Rate(e Entity, metric Metric, now time.Time) (current, mean float64, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.series[seriesKey{e, metric}]
+	if !ok {
+		return 0, 0, false
+	}
+	d.advance(s, now.Truncate(d.cfg.Window))
+	return s.count, s.mean, true
+}
+
+// Forget drops the series of an entity, for example when a PID is reused.
+func (d *Detector) Forget(e Entity) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, m := range []Metric{MetricExec, MetricFile, MetricConnect} {
+		delete(d.series, seriesKey{e, m})
+	}
+}
+
+// Prune drops series without events since before.
+func (d *Detector) Prune(before time.Time) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cutoff := before.Truncate(d.cfg.Window)
+	n := 0
+	for key, s := range d.series {
+		if s.window.Before(cutoff) {
+			delete(d.series, key)
+			n++
+		}
+	}
+	return n
+}
+
+// Recent returns the anomalies reported since since, oldest first. With
+// entities, only anomalies of those entities are returned.
+func (d *Detector) Recent(since time.Time, entities ...Entity) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []Anomaly
+	for _, a := range d.recent {
+		if a.Time.Before(since) {
+			continue
+		}
+		if len(entities) > 0 {
+			match := false
+			for _, e := range entities {
+				if a.Entity == e {
+					match = true
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// feed observes n events for each entity, spread over the window starting
+// at at, and returns the anomalies reported.
+func feed(d *Detector, n int, at time.Time, entities ...Entity) []Anomaly {
+	var out []Anomaly
+	for i := 0; i < n; i++ {
+		t := at.Add(time.Duration(i) * d.cfg.Window / time.Duration(n+1))
+		out = append(out, d.Observe(MetricFile, "worker", t, entities...)...)
+	}
+	return out
+}
+
+func TestDetectorFlagsBurstOncePerWindow(t *testing.T) {
+	d := NewDetector(Config{})
+	proc := Entity{EntityProcess, "42"}
+	exe := Entity{EntityExecutable, "/usr/bin/worker"}
+
+	for i := 0; i < 30; i++ {
+		if got := feed(d, 25+i%5, start.Add(time.Duration(i)*time.Minute), proc, exe); len(got) != 0 {
+			t.Fatalf("steady window %d reported %+v", i, got)
+		}
+	}
+
+	burst := start.Add(30 * time.Minute)
+	got := feed(d, 200, burst, proc, exe)
+	if len(got) != 2 {
+		t.Fatalf("burst reported %d anomalies, want one per entity: %+v", len(got), got)
+	}
+	// Reported as soon as the count crosses the threshold, not at the end
+	// of the window.
+	a := got[0]
+	if a.Type() != "file_rate_spike" || a.Score < 4 || a.Count >= 200 || a.Mean < 25 || a.Mean > 30 {
+		t.Errorf("anomaly = %+v", a)
+	}
+	if recent := d.Recent(burst, exe); len(recent) != 1 || recent[0].Entity != exe {
+		t.Errorf("recent for %v = %+v", exe, recent)
+	}
+	if recent := d.Recent(burst.Add(time.Minute)); len(recent) != 0 {
+		t.Errorf("recent after burst = %+v", recent)
+	}
+
+	// The burst raises the average, so the next window is judged against it.
+	if cur, mean, ok := d.Rate(proc, MetricFile, burst.Add(time.Minute)); !ok || cur != 0 || mean <= 30 {
+		t.Errorf("rate after burst = %v %v %v", cur, mean, ok)
+	}
+}
+
+func TestDetectorNeedsHistoryAndVolume(t *testing.T) {
+	d := NewDetector(Config{MinSamples: 5, MinCount: 50})
+	e := Entity{EntityWorkload, "7"}
+
+	// Too little history: a burst in the second window is not scored.
+	feed(d, 2, start, e)
+	if got := feed(d, 100, start.Add(time.Minute), e); len(got) != 0 {
+		t.Fatalf("burst without history reported %+v", got)
+	}
+
+	// Enough history, but the jump stays under MinCount.
+	d = NewDetector(Config{MinSamples: 5, MinCount: 50})
+	for i := 0; i < 10; i++ {
+		feed(d, 1, start.Add(time.Duration(i)*time.Minute), e)
+	}
+	if got := feed(d, 40, start.Add(10*time.Minute), e); len(got) != 0 {
+		t.Fatalf("small burst reported %+v", got)
+	}
+	if got := feed(d, 60, start.Add(11*time.Minute), e); len(got) != 1 {
+		t.Fatalf("burst over MinCount reported %+v", got)
+	}
+
+	if n := d.Prune(start.Add(time.Hour)); n != 1 {
+		t.Errorf("pruned %d series", n)
+	}
+}
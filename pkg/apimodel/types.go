@@ -1,6 +1,19 @@
 package apimodel
 
+// Container identifies the container, pod or systemd unit behind a cgroup.
+// It is omitted for workloads nothing is known about.
+type Container struct {
+	Runtime      string `json:"runtime,omitempty"`
+	ID           string `json:"id,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Image        string `json:"image,omitempty"`
+	PodUID       string `json:"podUid,omitempty"`
+	SystemdUnit  string `json:"systemdUnit,omitempty"`
+	SystemdSlice string `json:"systemdSlice,omitempty"`
+}
+
 type ExecEvent struct {
+	ID          uint64 `json:"id"`
 	Type        string `json:"type"`
 	Timestamp   int64  `json:"timestamp"`
 	PID         uint32 `json:"pid"`
@@ -10,9 +23,19 @@ type ExecEvent struct {
 	ParentComm  string `json:"parentComm"`
 	CommandLine string `json:"commandLine,omitempty"`
 	Blocked     bool   `json:"blocked"`
+	ExeSHA256   string `json:"exeSha256,omitempty"`
+	// ExeFirstSeen marks the first execution of this binary on the host.
+	ExeFirstSeen bool `json:"exeFirstSeen,omitempty"`
+	// LoginUID is the audit login UID, omitted outside login sessions.
+	LoginUID  *uint32 `json:"loginUid,omitempty"`
+	TTY       string  `json:"tty,omitempty"`
+	SessionID string  `json:"sessionId,omitempty"` // see GET /api/sessions/{id}
+
+	Container *Container `json:"container,omitempty"`
 }
 
 type FileEvent struct {
+	ID        uint64 `json:"id"`
 	Type      string `json:"type"`
 	Timestamp int64  `json:"timestamp"`
 	PID       uint32 `json:"pid"`
@@ -22,9 +45,12 @@ type FileEvent struct {
 	Dev       uint64 `json:"dev,omitempty"`
 	Filename  string `json:"filename"`
 	Blocked   bool   `json:"blocked"`
+
+	Container *Container `json:"container,omitempty"`
 }
 
 type ConnectEvent struct {
+	ID          uint64 `json:"id"`
 	Type        string `json:"type"`
 	Timestamp   int64  `json:"timestamp"`
 	PID         uint32 `json:"pid"`
@@ -34,6 +60,8 @@ type ConnectEvent struct {
 	Port        uint16 `json:"port"`
 	Addr        string `json:"addr"`
 	Blocked     bool   `json:"blocked"`
+
+	Container *Container `json:"container,omitempty"`
 }
 
 type Alert struct {
@@ -48,10 +76,60 @@ type Alert struct {
 	CgroupID    string `json:"cgroupId"`
 	Action      string `json:"action"`
 	Blocked     bool   `json:"blocked"`
+	ExeSHA256   string `json:"exeSha256,omitempty"`
+	// EventID is the event that raised the alert, see GET /api/events/{id}.
+	EventID uint64 `json:"eventId,omitempty"`
+	// Evidence lists the measurements behind alerts that are not raised by
+	// a rule, such as rate anomalies.
+	Evidence []string `json:"evidence,omitempty"`
+	// Policy names the policy the rule applied through, for rules scoped
+	// to some workloads.
+	Policy string `json:"policy,omitempty"`
+
+	Container    *Container    `json:"container,omitempty"`
+	PidNamespace *PidNamespace `json:"pidNamespace,omitempty"`
+	// Session is the login session an exec alert was raised in, without
+	// its commands.
+	Session *Session `json:"session,omitempty"`
+}
+
+// Session is a login session and the commands run in it, for
+// GET /api/sessions. LoginUID and AuditSessionID are omitted when the
+// kernel did not assign them.
+type Session struct {
+	ID             string           `json:"id"`
+	Description    string           `json:"description"`
+	LoginUID       *uint32          `json:"loginUid,omitempty"`
+	AuditSessionID *uint32          `json:"auditSessionId,omitempty"`
+	Leader         uint32           `json:"leader"`
+	LeaderComm     string           `json:"leaderComm,omitempty"`
+	TTY            string           `json:"tty,omitempty"`
+	Interactive    bool             `json:"interactive"`
+	Origin         string           `json:"origin,omitempty"`
+	RemoteAddr     string           `json:"remoteAddr,omitempty"`
+	CgroupID       string           `json:"cgroupId"`
+	Active         bool             `json:"active"`
+	Started        int64            `json:"started"`
+	LastSeen       int64            `json:"lastSeen"`
+	CommandCount   int              `json:"commandCount"`
+	Commands       []SessionCommand `json:"commands,omitempty"`
+}
+
+// SessionCommand is one exec in a session's timeline.
+type SessionCommand struct {
+	Timestamp   int64  `json:"timestamp"`
+	EventID     uint64 `json:"eventId,omitempty"`
+	PID         uint32 `json:"pid"`
+	PPID        uint32 `json:"ppid"`
+	UID         uint32 `json:"uid"`
+	Comm        string `json:"comm"`
+	CommandLine string `json:"commandLine,omitempty"`
+	Blocked     bool   `json:"blocked,omitempty"`
 }
 
 type Workload struct {
 	ID           string `json:"id"`
+	Name         string `json:"name"` // friendly name derived from the cgroup
 	CgroupPath   string `json:"cgroupPath"`
 	ExecCount    int64  `json:"execCount"`
 	FileCount    int64  `json:"fileCount"`
@@ -60,6 +138,63 @@ type Workload struct {
 	BlockedCount int64  `json:"blockedCount"`
 	FirstSeen    int64  `json:"firstSeen"`
 	LastSeen     int64  `json:"lastSeen"`
+
+	SuppressedCount int64 `json:"suppressedCount"`
+
+	Container *Container `json:"container,omitempty"`
+	// Policies names the policies bound to the workload, in rules file
+	// order.
+	Policies []string `json:"policies,omitempty"`
+}
+
+// Policy is a named group of rules applied to the workloads its selector
+// matches, for GET /api/policies. Workloads lists the IDs of the known
+// workloads it is bound to.
+type Policy struct {
+	Name      string         `json:"name"`
+	Mode      string         `json:"mode"`
+	Selector  PolicySelector `json:"selector"`
+	Rules     []string       `json:"rules"`
+	Workloads []string       `json:"workloads"`
+}
+
+// PolicySelector mirrors a policy's workload selector; unset fields are
+// omitted.
+type PolicySelector struct {
+	CgroupPath  string            `json:"cgroupPath,omitempty"`
+	Image       string            `json:"image,omitempty"`
+	SystemdUnit string            `json:"systemdUnit,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// WorkloadDetail is a workload with what ran in it over a window: the
+// busiest processes, files and destinations, and its most recent alerts.
+type WorkloadDetail struct {
+	Workload         Workload   `json:"workload"`
+	RunningProcesses int        `json:"runningProcesses"`
+	WindowStart      int64      `json:"windowStart"`
+	TopProcesses     []TopCount `json:"topProcesses"`
+	TopFiles         []TopCount `json:"topFiles"`
+	TopDestinations  []TopCount `json:"topDestinations"`
+	Alerts           []Alert    `json:"alerts"`
+}
+
+// TopCount is the number of events sharing one value, such as a process
+// name or an "ip:port" destination.
+type TopCount struct {
+	Value   string `json:"value"`
+	Count   int    `json:"count"`
+	Blocked int    `json:"blocked"`
+}
+
+// WorkloadBucket is a workload's activity in [Start, Start+interval).
+type WorkloadBucket struct {
+	Start   int64 `json:"start"`
+	Exec    int   `json:"exec"`
+	File    int   `json:"file"`
+	Connect int   `json:"connect"`
+	Blocked int   `json:"blocked"`
+	Alerts  int   `json:"alerts"`
 }
 
 type ProcessInfo struct {
@@ -68,6 +203,81 @@ type ProcessInfo struct {
 	Comm      string `json:"comm"`
 	CgroupID  string `json:"cgroupId"`
 	Timestamp int64  `json:"timestamp"`
+
+	PidNamespace *PidNamespace `json:"pidNamespace,omitempty"`
+}
+
+// PidNamespace is the PID namespace a process runs in. PID and PPID are as
+// seen inside it, which is what ps shows in a container; PPID is 0 when the
+// parent is outside the namespace.
+type PidNamespace struct {
+	Inode uint32 `json:"inode"`
+	PID   uint32 `json:"pid"`
+	PPID  uint32 `json:"ppid"`
+	Host  bool   `json:"host"`
+}
+
+// ProcessNode is a process with its descendants, for
+// GET /api/processes/tree.
+type ProcessNode struct {
+	ProcessInfo
+	Children []ProcessNode `json:"children,omitempty"`
+	// Truncated marks nodes whose children were cut by the depth or size
+	// limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ProcessProfile is the activity recorded for a process since it was
+// first seen. Times are Unix milliseconds, zero when never seen.
+type ProcessProfile struct {
+	StartTime     int64    `json:"startTime"`
+	CommandLine   string   `json:"commandLine,omitempty"`
+	Genealogy     []uint32 `json:"genealogy,omitempty"`
+	ExecCount     int64    `json:"execCount"`
+	FileOpenCount int64    `json:"fileOpenCount"`
+	ConnectCount  int64    `json:"connectCount"`
+	LastExec      int64    `json:"lastExec,omitempty"`
+	LastFileOpen  int64    `json:"lastFileOpen,omitempty"`
+	LastConnect   int64    `json:"lastConnect,omitempty"`
+}
+
+// ProcessDetail is a tracked process with its ancestry (nearest first),
+// children, profile and most recent events.
+type ProcessDetail struct {
+	Process   ProcessInfo     `json:"process"`
+	Ancestors []ProcessInfo   `json:"ancestors"`
+	Children  []ProcessInfo   `json:"children"`
+	Profile   *ProcessProfile `json:"profile,omitempty"`
+	Container *Container      `json:"container,omitempty"`
+	Events    []any           `json:"events"` // ExecEvent, FileEvent or ConnectEvent
+}
+
+// EventDetail is a stored event together with the ancestry of the process
+// that produced it, nearest first.
+type EventDetail struct {
+	Event     any           `json:"event"` // ExecEvent, FileEvent or ConnectEvent
+	Ancestors []ProcessInfo `json:"ancestors"`
+}
+
+// Baseline is the learned behaviour of one program in a workload. Rates
+// are events per active minute; peaks the most seen in one minute. Times
+// are Unix milliseconds.
+type Baseline struct {
+	Exe          string   `json:"exe"`
+	CgroupID     string   `json:"cgroupId"`
+	Learning     bool     `json:"learning"`
+	Started      int64    `json:"started"`
+	LastSeen     int64    `json:"lastSeen"`
+	Children     []string `json:"children"`
+	FilePrefixes []string `json:"filePrefixes"`
+	Ports        []string `json:"ports"`
+	Destinations []string `json:"destinations"`
+	ExecRate     float64  `json:"execRate"`
+	FileRate     float64  `json:"fileRate"`
+	ConnectRate  float64  `json:"connectRate"`
+	ExecPeak     uint64   `json:"execPeak"`
+	FilePeak     uint64   `json:"filePeak"`
+	ConnectPeak  uint64   `json:"connectPeak"`
 }
 
 type InsightAction struct {
@@ -98,5 +308,3 @@ type AskInsightResponse struct {
 	Confidence  float64     `json:"confidence"`
 	RelatedData interface{} `json:"related_data,omitempty"`
 }
-
-
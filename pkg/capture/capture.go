@@ -0,0 +1,243 @@
+// Package capture records raw ring buffer samples to a file and replays them
+// later, so detections can be reproduced without BPF.
+//
+// A capture file starts with a fixed header followed by frames:
+//
+//	header: magic "AEGISCAP" | version u16 | event header size u16 |
+//	        exec, file open, connect, tamper sizes u32 | boot time ns i64 |
+//	        created ns i64
+//	frame:  sample length u32 | sample bytes
+//
+// All integers are little endian. Samples are stored exactly as read from
+// the ring buffer, so the struct sizes in the header must match the decoder
+// of the replaying binary.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+const (
+	Magic   = "AEGISCAP"
+	Version = 1
+
+	headerSize = 8 + 2 + 2 + 4*4 + 8 + 8
+
+	// maxFrameSize guards against reading a corrupt length as a huge
+	// allocation; real samples are well under a page.
+	maxFrameSize = 64 * 1024
+)
+
+// Header describes the binary layout and clock of the capturing host.
+type Header struct {
+	Version         uint16
+	EventHeaderSize uint16
+	ExecEventSize   uint32
+	FileEventSize   uint32
+	ConnectSize     uint32
+	TamperSize      uint32
+	BootTime        time.Time
+	Created         time.Time
+}
+
+func currentHeader() Header {
+	return Header{
+		Version:         Version,
+		EventHeaderSize: events.EventHeaderSize,
+		ExecEventSize:   events.ExecEventSize,
+		FileEventSize:   events.FileOpenEventSize,
+		ConnectSize:     events.ConnectEventSize,
+		TamperSize:      events.TamperEventSize,
+		BootTime:        events.BootTime(),
+		Created:         time.Now(),
+	}
+}
+
+// Compatible reports whether samples described by h can be decoded by this
+// binary.
+func (h Header) Compatible() error {
+	cur := currentHeader()
+	if h.Version != cur.Version {
+		return fmt.Errorf("capture version %d, expected %d", h.Version, cur.Version)
+	}
+	if h.EventHeaderSize != cur.EventHeaderSize || h.ExecEventSize != cur.ExecEventSize ||
+		h.FileEventSize != cur.FileEventSize || h.ConnectSize != cur.ConnectSize ||
+		h.TamperSize != cur.TamperSize {
+		return fmt.Errorf("capture event layout (header %d, exec %d, file %d, connect %d, tamper %d) does not match this build",
+			h.EventHeaderSize, h.ExecEventSize, h.FileEventSize, h.ConnectSize, h.TamperSize)
+	}
+	return nil
+}
+
+func (h Header) marshal() []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, Magic)
+	off := len(Magic)
+	binary.LittleEndian.PutUint16(buf[off:], h.Version)
+	off += 2
+	binary.LittleEndian.PutUint16(buf[off:], h.EventHeaderSize)
+	off += 2
+	for _, v := range []uint32{h.ExecEventSize, h.FileEventSize, h.ConnectSize, h.TamperSize} {
+		binary.LittleEndian.PutUint32(buf[off:], v)
+		off += 4
+	}
+	binary.LittleEndian.PutUint64(buf[off:], uint64(h.BootTime.UnixNano()))
+	off += 8
+	binary.LittleEndian.PutUint64(buf[off:], uint64(h.Created.UnixNano()))
+	return buf
+}
+
+func unmarshalHeader(buf []byte) (Header, error) {
+	if string(buf[:len(Magic)]) != Magic {
+		return Header{}, errors.New("not an Aegis capture file")
+	}
+	var h Header
+	off := len(Magic)
+	h.Version = binary.LittleEndian.Uint16(buf[off:])
+	off += 2
+	h.EventHeaderSize = binary.LittleEndian.Uint16(buf[off:])
+	off += 2
+	for _, v := range []*uint32{&h.ExecEventSize, &h.FileEventSize, &h.ConnectSize, &h.TamperSize} {
+		*v = binary.LittleEndian.Uint32(buf[off:])
+		off += 4
+	}
+	h.BootTime = time.Unix(0, int64(binary.LittleEndian.Uint64(buf[off:])))
+	off += 8
+	h.Created = time.Unix(0, int64(binary.LittleEndian.Uint64(buf[off:])))
+	return h, nil
+}
+
+// Writer appends samples to a capture file. It is safe for concurrent use.
+type Writer struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	frames uint64
+}
+
+// Create truncates path and writes a header for the running host.
+func Create(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create capture file: %w", err)
+	}
+	w := &Writer{f: f, w: bufio.NewWriterSize(f, 256*1024)}
+	if _, err := w.w.Write(currentHeader().marshal()); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("write capture header: %w", err)
+	}
+	return w, nil
+}
+
+// Write appends one raw ring buffer sample.
+func (w *Writer) Write(sample []byte) error {
+	if len(sample) > maxFrameSize {
+		return fmt.Errorf("sample of %d bytes exceeds capture frame limit", len(sample))
+	}
+	var lenBuf [4]byte
+	binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(sample)))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(sample); err != nil {
+		return err
+	}
+	w.frames++
+	return nil
+}
+
+// Frames returns the number of samples written so far.
+func (w *Writer) Frames() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.frames
+}
+
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Flush()
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	flushErr := w.w.Flush()
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// Reader reads samples back from a capture file.
+type Reader struct {
+	Header Header
+
+	f *os.File
+	r *bufio.Reader
+}
+
+// Open reads and validates the header of a capture file.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open capture file: %w", err)
+	}
+	r := bufio.NewReaderSize(f, 256*1024)
+
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read capture header: %w", err)
+	}
+	h, err := unmarshalHeader(buf)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := h.Compatible(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Reader{Header: h, f: f, r: r}, nil
+}
+
+// Next returns the next sample, or io.EOF after the last complete frame.
+// A frame truncated by a crash while capturing is treated as the end.
+func (r *Reader) Next() ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r.r, lenBuf[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(lenBuf[:])
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("corrupt capture frame length %d", n)
+	}
+	sample := make([]byte, n)
+	if _, err := io.ReadFull(r.r, sample); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	return sample, nil
+}
+
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
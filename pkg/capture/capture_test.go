@@ -0,0 +1,94 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.cap")
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := [][]byte{[]byte("exec"), {}, bytes.Repeat([]byte{0xab}, 4096)}
+	for _, s := range samples {
+		if err := w.Write(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Frames() != uint64(len(samples)) {
+		t.Errorf("Frames() = %d", w.Frames())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A frame cut short by a crash while capturing ends the replay.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{100, 0, 0, 0, 1, 2})
+	f.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Header.Version != Version || r.Header.Created.IsZero() {
+		t.Errorf("header = %+v", r.Header)
+	}
+	for i, want := range samples {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatalf("sample %d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("sample %d = %d bytes, want %d", i, len(got), len(want))
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("after last frame: %v", err)
+	}
+}
+
+func TestHeaderCompatibleRejectsLayoutChange(t *testing.T) {
+	h := currentHeader()
+	if err := h.Compatible(); err != nil {
+		t.Fatalf("current header: %v", err)
+	}
+
+	changed := []func(*Header){
+		func(h *Header) { h.Version++ },
+		func(h *Header) { h.EventHeaderSize += 8 },
+		func(h *Header) { h.ExecEventSize += 8 },
+		func(h *Header) { h.FileEventSize-- },
+		func(h *Header) { h.ConnectSize++ },
+		func(h *Header) { h.TamperSize++ },
+	}
+	for i, change := range changed {
+		old := currentHeader()
+		change(&old)
+		if err := old.Compatible(); err == nil {
+			t.Errorf("change %d accepted", i)
+		}
+	}
+
+	// Open refuses a file recorded with another layout.
+	old := currentHeader()
+	old.ExecEventSize -= 16
+	path := filepath.Join(t.TempDir(), "old.cap")
+	if err := os.WriteFile(path, old.marshal(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := Open(path); err == nil {
+		r.Close()
+		t.Error("capture with an older exec layout opened")
+	}
+}
@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+// maxReplayGap caps the pause between two samples so idle periods in a
+// capture do not stall a replay.
+const maxReplayGap = 5 * time.Second
+
+// Pacer spaces samples according to their kernel timestamps. With speed
+// <= 0 it never waits; otherwise the original spacing is divided by speed
+// (1 is real time, 10 is ten times faster).
+type Pacer struct {
+	speed     float64
+	started   bool
+	firstTs   uint64
+	startWall time.Time
+}
+
+func NewPacer(speed float64) *Pacer {
+	return &Pacer{speed: speed}
+}
+
+// Wait blocks until sample is due or ctx is done.
+func (p *Pacer) Wait(ctx context.Context, sample []byte) error {
+	if p.speed <= 0 || len(sample) < 8 {
+		return nil
+	}
+	ts := binary.LittleEndian.Uint64(sample[:8])
+	if !p.started || ts < p.firstTs {
+		p.started, p.firstTs, p.startWall = true, ts, time.Now()
+		return nil
+	}
+
+	due := time.Duration(float64(ts-p.firstTs) / p.speed)
+	wait := due - time.Since(p.startWall)
+	if wait <= 0 {
+		return nil
+	}
+	if wait > maxReplayGap {
+		// Skip the idle stretch and re-anchor on this sample.
+		p.firstTs, p.startWall = ts, time.Now()
+		return nil
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// PrepareReplay makes decoded timestamps match the capturing host by
+// adopting its boot time.
+func PrepareReplay(r *Reader) {
+	events.SetBootTime(r.Header.BootTime)
+}
@@ -15,6 +15,27 @@ const (
 	DefaultProcessTreeMaxSize        = 10000
 	DefaultProcessTreeMaxChainLength = 50
 	DefaultRingBufferSize            = 256 * 1024 // 256KB
+	DefaultRateLimitEventsPerSec     = 2000
+	DefaultRateLimitBurst            = 5000
+	DefaultBPFPinPath                = "/sys/fs/bpf/aegis"
+	DefaultPipelineQueueDepth        = 1024
+	DefaultExeHashLearningPeriod     = time.Hour
+	DefaultExeHashMaxFileSizeMB      = 256
+	DefaultEventStoreMaxAge          = 7 * 24 * time.Hour
+	DefaultEventStoreMaxSizeMB       = 1024
+	DefaultEventStoreSegmentSizeMB   = 64
+	DefaultStorageMemoryMB           = 256
+	DefaultBaselineLearningPeriod    = 24 * time.Hour
+	DefaultBaselineIdlePeriods       = 7
+	DefaultAnomalyWindow             = time.Minute
+	DefaultAnomalyBaselineWindows    = 60
+	DefaultAnomalyThreshold          = 4.0
+	DefaultAnomalyMinSamples         = 10
+	DefaultAnomalyMinCount           = 20
+	DefaultSessionMaxSessions        = 1000
+	DefaultSessionMaxCommands        = 200
+	DefaultSessionIdleTimeout        = 30 * time.Minute
+	DefaultWorkloadRegistryMaxSize   = 1000
 )
 
 type Options struct {
@@ -25,16 +46,174 @@ type Options struct {
 	ProcessTreeMaxSize        int           `yaml:"process_tree_max_size"`
 	ProcessTreeMaxChainLength int           `yaml:"process_tree_max_chain_length"`
 
+	// Probe attach mode: "auto", "lsm" or "tracepoint" (monitor only)
+	AttachMode string `yaml:"attach_mode"`
+
+	// Keep programs, links and maps pinned in bpffs so enforcement survives
+	// agent restarts and upgrades.
+	PinBPFObjects bool   `yaml:"pin_bpf_objects"`
+	BPFPinPath    string `yaml:"bpf_pin_path"`
+
+	// Deny writes to the rules, config, BPF object and agent binary, and
+	// signals to the agent, from every process but the agent itself.
+	SelfProtection bool `yaml:"self_protection"`
+
+	// SHA-256 of executed binaries for exe_sha256 and exe_first_seen rules
+	ExeHash ExeHashOptions `yaml:"exe_hash"`
+
+	// Learned per-program behaviour and "new behavior" alerts
+	Baselines BaselineOptions `yaml:"baselines"`
+
+	// Event rate anomalies of processes, executables and workloads
+	Anomaly AnomalyOptions `yaml:"anomaly"`
+
+	// Login sessions and the commands run in them
+	Sessions SessionOptions `yaml:"sessions"`
+
+	// Concurrent dispatch of events to enrichment, storage and rules
+	Pipeline PipelineOptions `yaml:"pipeline"`
+
+	// Persistent event history behind the in-memory ring
+	EventStore EventStoreOptions `yaml:"event_store"`
+
+	// Estimated memory for the in-memory event ring and its indexes; the
+	// oldest events are dropped once it is exceeded. 0 bounds the ring by
+	// event count only.
+	StorageMemoryMB int `yaml:"storage_memory_mb"`
+
+	// Minute and hour rollups of rates, alerts and per-workload and
+	// per-rule hits, kept across restarts. Empty keeps them in memory.
+	StatsHistoryPath string `yaml:"stats_history_path"`
+
+	// Where events come from; the ring buffer unless testing offline
+	EventSource EventSourceOptions `yaml:"event_source"`
+
+	// Append every raw ring buffer sample to this capture file for later
+	// replay with 'aegis replay'. Empty disables capturing.
+	CapturePath string `yaml:"capture_path"`
+
+	// Docker-compatible API socket (docker, or podman's compat socket)
+	// queried for container names and images. Empty disables the lookup;
+	// runtime, container ID and pod UID still come from cgroup paths.
+	ContainerRuntimeSocket string `yaml:"container_runtime_socket"`
+
+	// Number of workloads (cgroups) tracked; the least recently active are
+	// evicted beyond it.
+	WorkloadRegistryMaxSize int `yaml:"workload_registry_max_size"`
+
+	// ConfigPath is the config.yaml the options were loaded from.
+	ConfigPath string `yaml:"-"`
+
 	// Rule promotion configuration
 	PromotionMinObservationMinutes int `yaml:"promotion_min_observation_minutes"`
 	PromotionMinHits               int `yaml:"promotion_min_hits"`
 
+	// Kernel-side per-cgroup telemetry budget
+	RateLimit RateLimitOptions `yaml:"rate_limit"`
+
 	WebPort int `yaml:"-"`
 
 	// AI configuration
 	AI AIOptions `yaml:"ai"`
 }
 
+// RateLimitOptions configures the per-cgroup token bucket in the BPF
+// program. Events that carry a block decision are never rate limited.
+type RateLimitOptions struct {
+	EventsPerSec int                 `yaml:"events_per_sec"` // 0 disables limiting
+	Burst        int                 `yaml:"burst"`
+	Workloads    []WorkloadRateLimit `yaml:"workloads,omitempty"`
+}
+
+// WorkloadRateLimit overrides the default budget for workloads selected by
+// cgroup ID or by a cgroup path glob (e.g. "/system.slice/docker-*.scope").
+// EventsPerSec defaults to the global rate when the entry does not set it.
+type WorkloadRateLimit struct {
+	CgroupPath   string `yaml:"cgroup_path,omitempty"`
+	CgroupID     uint64 `yaml:"cgroup_id,omitempty"`
+	EventsPerSec int    `yaml:"events_per_sec"`
+	Burst        int    `yaml:"burst"`
+}
+
+// PipelineOptions sizes the PID-sharded dispatch pipeline. Events with a
+// kernel block decision are never dropped, whatever the policy.
+type PipelineOptions struct {
+	Workers    int    `yaml:"workers"`     // 0 picks GOMAXPROCS (at most 8)
+	QueueDepth int    `yaml:"queue_depth"` // per worker and stage
+	DropPolicy string `yaml:"drop_policy"` // "block", "drop_newest" or "drop_oldest"
+}
+
+// ExeHashOptions configures executable hashing. StatePath holds the digests
+// seen on this host so first-seen detection survives restarts; binaries
+// first seen within LearningPeriod of the state's creation are not flagged.
+type ExeHashOptions struct {
+	Enabled        bool          `yaml:"enabled"`
+	StatePath      string        `yaml:"state_path"`
+	LearningPeriod time.Duration `yaml:"learning_period"`
+	MaxFileSizeMB  int           `yaml:"max_file_size_mb"`
+}
+
+// BaselineOptions configures behavioural baselines. Each program, by
+// executable path and cgroup, learns its child processes, file prefixes,
+// ports, destinations and per-minute rates for LearningPeriod after it is
+// first seen; behaviour outside that baseline is then alerted on. StatePath
+// keeps baselines across restarts. Baselines of programs not seen for
+// IdlePeriods learning periods are dropped.
+type BaselineOptions struct {
+	Enabled        bool          `yaml:"enabled"`
+	StatePath      string        `yaml:"state_path"`
+	LearningPeriod time.Duration `yaml:"learning_period"`
+	IdlePeriods    int           `yaml:"idle_periods"`
+}
+
+// AnomalyOptions configures rate anomaly detection. Exec, file and connect
+// events are counted per process, executable and workload in windows of
+// Window; each count is compared with an exponentially weighted average
+// spanning BaselineWindows windows and reported when it is Threshold
+// standard deviations above it. Series with fewer than MinSamples windows,
+// and windows with fewer than MinCount events, are not scored.
+type AnomalyOptions struct {
+	Enabled         bool          `yaml:"enabled"`
+	Window          time.Duration `yaml:"window"`
+	BaselineWindows int           `yaml:"baseline_windows"`
+	Threshold       float64       `yaml:"threshold"`
+	MinSamples      int           `yaml:"min_samples"`
+	MinCount        int           `yaml:"min_count"`
+	Alerts          bool          `yaml:"alerts"` // raise "Rate Anomaly" alerts
+}
+
+// SessionOptions bounds login session tracking. Sessions beyond
+// MaxSessions are dropped least recently active first, and each keeps its
+// last MaxCommands commands. Sessions of offline sources count as active
+// until they have run no command for IdleTimeout.
+type SessionOptions struct {
+	MaxSessions int           `yaml:"max_sessions"`
+	MaxCommands int           `yaml:"max_commands"`
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+// EventStoreOptions configures the on-disk event store. Events are kept
+// until they are older than MaxAge or the store exceeds MaxSizeMB, whichever
+// comes first; whole segments are deleted. An empty Path keeps events in
+// memory only.
+type EventStoreOptions struct {
+	Path          string        `yaml:"path"`
+	MaxAge        time.Duration `yaml:"max_age"`     // 0 keeps events regardless of age
+	MaxSizeMB     int           `yaml:"max_size_mb"` // 0 is unlimited
+	SegmentSizeMB int           `yaml:"segment_size_mb"`
+}
+
+// EventSourceOptions selects the event source. "ringbuf" loads the BPF
+// programs; "replay" (capture file), "jsonl" (one JSON event per line) and
+// "generator" (synthetic traffic) run without BPF or root.
+type EventSourceOptions struct {
+	Type         string  `yaml:"type"`
+	Path         string  `yaml:"path,omitempty"`           // replay and jsonl
+	Speed        float64 `yaml:"speed,omitempty"`          // replay: 1 is real time, 0 as fast as possible
+	EventsPerSec int     `yaml:"events_per_sec,omitempty"` // generator: 0 as fast as possible
+	Count        int     `yaml:"count,omitempty"`          // generator: 0 is unlimited
+}
+
 type AIOptions struct {
 	Mode   string        `yaml:"mode"` // "ollama" or "openai"
 	Ollama OllamaOptions `yaml:"ollama"`
@@ -60,7 +239,20 @@ type OpenAIOptions struct {
 	Timeout  int    `yaml:"timeout"`
 }
 
+// ParseOptions loads config.yaml and applies command line flags.
 func ParseOptions() Options {
+	opts := LoadOptions()
+
+	// Parse command line flags (override config file)
+	flag.IntVar(&opts.WebPort, "port", 3000, "Port for web GUI (default: 3000)")
+	flag.Parse()
+
+	return opts
+}
+
+// LoadOptions loads config.yaml from the working directory without touching
+// command line flags, so subcommands can parse their own.
+func LoadOptions() Options {
 	cwd, err := os.Getwd()
 	if err != nil {
 		cwd = "."
@@ -74,9 +266,53 @@ func ParseOptions() Options {
 		ProcessTreeMaxAge:              DefaultProcessTreeMaxAge,
 		ProcessTreeMaxSize:             DefaultProcessTreeMaxSize,
 		ProcessTreeMaxChainLength:      DefaultProcessTreeMaxChainLength,
+		WorkloadRegistryMaxSize:        DefaultWorkloadRegistryMaxSize,
 		RingBufferSize:                 DefaultRingBufferSize,
+		BPFPinPath:                     DefaultBPFPinPath,
+		AttachMode:                     "auto",
+		ConfigPath:                     configPath,
+		EventSource:                    EventSourceOptions{Type: "ringbuf", Speed: 1},
+		Pipeline:                       PipelineOptions{QueueDepth: DefaultPipelineQueueDepth, DropPolicy: "block"},
 		PromotionMinObservationMinutes: 1440, // 24 hours
 		PromotionMinHits:               100,
+		RateLimit: RateLimitOptions{
+			EventsPerSec: DefaultRateLimitEventsPerSec,
+			Burst:        DefaultRateLimitBurst,
+		},
+		ExeHash: ExeHashOptions{
+			Enabled:        true,
+			StatePath:      filepath.Join(cwd, "exe_seen.json"),
+			LearningPeriod: DefaultExeHashLearningPeriod,
+			MaxFileSizeMB:  DefaultExeHashMaxFileSizeMB,
+		},
+		Baselines: BaselineOptions{
+			Enabled:        true,
+			StatePath:      filepath.Join(cwd, "baselines.json"),
+			LearningPeriod: DefaultBaselineLearningPeriod,
+			IdlePeriods:    DefaultBaselineIdlePeriods,
+		},
+		Anomaly: AnomalyOptions{
+			Enabled:         true,
+			Window:          DefaultAnomalyWindow,
+			BaselineWindows: DefaultAnomalyBaselineWindows,
+			Threshold:       DefaultAnomalyThreshold,
+			MinSamples:      DefaultAnomalyMinSamples,
+			MinCount:        DefaultAnomalyMinCount,
+			Alerts:          true,
+		},
+		Sessions: SessionOptions{
+			MaxSessions: DefaultSessionMaxSessions,
+			MaxCommands: DefaultSessionMaxCommands,
+			IdleTimeout: DefaultSessionIdleTimeout,
+		},
+		EventStore: EventStoreOptions{
+			Path:          filepath.Join(cwd, "events"),
+			MaxAge:        DefaultEventStoreMaxAge,
+			MaxSizeMB:     DefaultEventStoreMaxSizeMB,
+			SegmentSizeMB: DefaultEventStoreSegmentSizeMB,
+		},
+		StorageMemoryMB:  DefaultStorageMemoryMB,
+		StatsHistoryPath: filepath.Join(cwd, "stats_history.json"),
 	}
 
 	data, err := os.ReadFile(configPath)
@@ -109,12 +345,128 @@ func ParseOptions() Options {
 	if v, ok := raw["process_tree_max_chain_length"].(int); ok && v > 0 {
 		opts.ProcessTreeMaxChainLength = v
 	}
+	if v, ok := raw["workload_registry_max_size"].(int); ok && v > 0 {
+		opts.WorkloadRegistryMaxSize = v
+	}
 	if v, ok := raw["process_tree_max_age"].(string); ok && v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
 			opts.ProcessTreeMaxAge = d
 		}
 	}
 
+	if v, ok := raw["attach_mode"].(string); ok && v != "" {
+		switch v {
+		case "auto", "lsm", "tracepoint":
+			opts.AttachMode = v
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: unknown attach_mode %q, using auto\n", v)
+		}
+	}
+	if v, ok := raw["pin_bpf_objects"].(bool); ok {
+		opts.PinBPFObjects = v
+	}
+	if v, ok := raw["bpf_pin_path"].(string); ok && v != "" {
+		opts.BPFPinPath = v
+	}
+	if v, ok := raw["self_protection"].(bool); ok {
+		opts.SelfProtection = v
+	}
+	if ehRaw, ok := raw["exe_hash"].(map[string]any); ok {
+		if v, ok := ehRaw["enabled"].(bool); ok {
+			opts.ExeHash.Enabled = v
+		}
+		if v, ok := ehRaw["state_path"].(string); ok {
+			opts.ExeHash.StatePath = v
+		}
+		if v, ok := ehRaw["learning_period"].(string); ok && v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+				opts.ExeHash.LearningPeriod = d
+			}
+		}
+		if v, ok := ehRaw["max_file_size_mb"].(int); ok && v > 0 {
+			opts.ExeHash.MaxFileSizeMB = v
+		}
+	}
+	if blRaw, ok := raw["baselines"].(map[string]any); ok {
+		if v, ok := blRaw["enabled"].(bool); ok {
+			opts.Baselines.Enabled = v
+		}
+		if v, ok := blRaw["state_path"].(string); ok {
+			opts.Baselines.StatePath = v
+		}
+		if v, ok := blRaw["learning_period"].(string); ok && v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+				opts.Baselines.LearningPeriod = d
+			}
+		}
+		if v, ok := blRaw["idle_periods"].(int); ok && v > 0 {
+			opts.Baselines.IdlePeriods = v
+		}
+	}
+	if anRaw, ok := raw["anomaly"].(map[string]any); ok {
+		parseAnomalyOptions(anRaw, &opts.Anomaly)
+	}
+	if sRaw, ok := raw["sessions"].(map[string]any); ok {
+		if v, ok := sRaw["max_sessions"].(int); ok && v > 0 {
+			opts.Sessions.MaxSessions = v
+		}
+		if v, ok := sRaw["max_commands"].(int); ok && v > 0 {
+			opts.Sessions.MaxCommands = v
+		}
+		if v, ok := sRaw["idle_timeout"].(string); ok && v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d > 0 {
+				opts.Sessions.IdleTimeout = d
+			}
+		}
+	}
+	if esRaw, ok := raw["event_store"].(map[string]any); ok {
+		if v, ok := esRaw["path"].(string); ok {
+			opts.EventStore.Path = v
+		}
+		if v, ok := esRaw["max_age"].(string); ok && v != "" {
+			if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+				opts.EventStore.MaxAge = d
+			}
+		}
+		if v, ok := esRaw["max_size_mb"].(int); ok && v >= 0 {
+			opts.EventStore.MaxSizeMB = v
+		}
+		if v, ok := esRaw["segment_size_mb"].(int); ok && v > 0 {
+			opts.EventStore.SegmentSizeMB = v
+		}
+	}
+	if v, ok := raw["storage_memory_mb"].(int); ok && v >= 0 {
+		opts.StorageMemoryMB = v
+	}
+	if v, ok := raw["stats_history_path"].(string); ok {
+		opts.StatsHistoryPath = v
+	}
+	if pRaw, ok := raw["pipeline"].(map[string]any); ok {
+		if v, ok := pRaw["workers"].(int); ok && v >= 0 {
+			opts.Pipeline.Workers = v
+		}
+		if v, ok := pRaw["queue_depth"].(int); ok && v > 0 {
+			opts.Pipeline.QueueDepth = v
+		}
+		if v, ok := pRaw["drop_policy"].(string); ok && v != "" {
+			switch v {
+			case "block", "drop_newest", "drop_oldest":
+				opts.Pipeline.DropPolicy = v
+			default:
+				fmt.Fprintf(os.Stderr, "Warning: unknown pipeline drop_policy %q, using block\n", v)
+			}
+		}
+	}
+	if esRaw, ok := raw["event_source"].(map[string]any); ok {
+		parseEventSourceOptions(esRaw, &opts.EventSource)
+	}
+	if v, ok := raw["capture_path"].(string); ok {
+		opts.CapturePath = v
+	}
+	if v, ok := raw["container_runtime_socket"].(string); ok {
+		opts.ContainerRuntimeSocket = v
+	}
+
 	// Rule promotion configuration
 	if v, ok := raw["promotion_min_observation_minutes"].(int); ok && v > 0 {
 		opts.PromotionMinObservationMinutes = v
@@ -123,6 +475,11 @@ func ParseOptions() Options {
 		opts.PromotionMinHits = v
 	}
 
+	// Rate limit configuration
+	if rlRaw, ok := raw["rate_limit"].(map[string]any); ok {
+		parseRateLimitOptions(rlRaw, &opts.RateLimit)
+	}
+
 	// AI configuration
 	if aiRaw, ok := raw["ai"].(map[string]any); ok {
 		if v, ok := aiRaw["mode"].(string); ok {
@@ -191,9 +548,110 @@ func ParseOptions() Options {
 		opts.AI.OpenAI.Timeout = 30
 	}
 
-	// Parse command line flags (override config file)
-	flag.IntVar(&opts.WebPort, "port", 3000, "Port for web GUI (default: 3000)")
-	flag.Parse()
-
 	return opts
 }
+
+func parseEventSourceOptions(raw map[string]any, opts *EventSourceOptions) {
+	if v, ok := raw["type"].(string); ok && v != "" {
+		switch v {
+		case "ringbuf", "replay", "jsonl", "generator":
+			opts.Type = v
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: unknown event_source type %q, using ringbuf\n", v)
+		}
+	}
+	if v, ok := raw["path"].(string); ok {
+		opts.Path = v
+	}
+	switch v := raw["speed"].(type) {
+	case int:
+		opts.Speed = float64(v)
+	case float64:
+		opts.Speed = v
+	}
+	if v, ok := raw["events_per_sec"].(int); ok && v >= 0 {
+		opts.EventsPerSec = v
+	}
+	if v, ok := raw["count"].(int); ok && v >= 0 {
+		opts.Count = v
+	}
+}
+
+func parseRateLimitOptions(raw map[string]any, opts *RateLimitOptions) {
+	if v, ok := raw["events_per_sec"].(int); ok && v >= 0 {
+		opts.EventsPerSec = v
+	}
+	if v, ok := raw["burst"].(int); ok && v >= 0 {
+		opts.Burst = v
+	}
+
+	workloads, ok := raw["workloads"].([]any)
+	if !ok {
+		return
+	}
+	for _, item := range workloads {
+		wRaw, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		var w WorkloadRateLimit
+		if v, ok := wRaw["cgroup_path"].(string); ok {
+			w.CgroupPath = v
+		}
+		switch v := wRaw["cgroup_id"].(type) {
+		case int:
+			if v > 0 {
+				w.CgroupID = uint64(v)
+			}
+		case uint64:
+			w.CgroupID = v
+		}
+		if w.CgroupPath == "" && w.CgroupID == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: rate_limit workload entry without cgroup_path or cgroup_id ignored\n")
+			continue
+		}
+		// An override that only sets burst keeps the default rate rather
+		// than disabling limiting for the workload.
+		w.EventsPerSec = opts.EventsPerSec
+		if v, ok := wRaw["events_per_sec"].(int); ok && v >= 0 {
+			w.EventsPerSec = v
+		}
+		if v, ok := wRaw["burst"].(int); ok && v >= 0 {
+			w.Burst = v
+		}
+		opts.Workloads = append(opts.Workloads, w)
+	}
+}
+
+func parseAnomalyOptions(raw map[string]any, opts *AnomalyOptions) {
+	if v, ok := raw["enabled"].(bool); ok {
+		opts.Enabled = v
+	}
+	if v, ok := raw["window"].(string); ok && v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			opts.Window = d
+		}
+	}
+	if v, ok := raw["baseline_windows"].(int); ok && v > 0 {
+		opts.BaselineWindows = v
+	}
+	switch v := raw["threshold"].(type) {
+	case int:
+		if v > 0 {
+			opts.Threshold = float64(v)
+		}
+	case float64:
+		if v > 0 {
+			opts.Threshold = v
+		}
+	}
+	if v, ok := raw["min_samples"].(int); ok && v > 0 {
+		opts.MinSamples = v
+	}
+	if v, ok := raw["min_count"].(int); ok && v > 0 {
+		opts.MinCount = v
+	}
+	if v, ok := raw["alerts"].(bool); ok {
+		opts.Alerts = v
+	}
+}
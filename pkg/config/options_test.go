@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestParseRateLimitOptions(t *testing.T) {
+	opts := RateLimitOptions{EventsPerSec: DefaultRateLimitEventsPerSec, Burst: DefaultRateLimitBurst}
+	parseRateLimitOptions(map[string]any{
+		"events_per_sec": 500,
+		"workloads": []any{
+			map[string]any{"cgroup_path": "/system.slice/docker-*.scope", "events_per_sec": 100, "burst": 200},
+			map[string]any{"cgroup_id": 42, "burst": 1000},
+			map[string]any{"cgroup_path": "/noisy", "events_per_sec": 0},
+			map[string]any{"burst": 10}, // no selector
+			"not a map",
+		},
+	}, &opts)
+
+	if opts.EventsPerSec != 500 || opts.Burst != DefaultRateLimitBurst {
+		t.Fatalf("global = %d/%d", opts.EventsPerSec, opts.Burst)
+	}
+	want := []WorkloadRateLimit{
+		{CgroupPath: "/system.slice/docker-*.scope", EventsPerSec: 100, Burst: 200},
+		{CgroupID: 42, EventsPerSec: 500, Burst: 1000},
+		{CgroupPath: "/noisy", EventsPerSec: 0},
+	}
+	if len(opts.Workloads) != len(want) {
+		t.Fatalf("workloads = %+v", opts.Workloads)
+	}
+	for i, w := range want {
+		if opts.Workloads[i] != w {
+			t.Errorf("workload %d = %+v, want %+v", i, opts.Workloads[i], w)
+		}
+	}
+}
+
+func TestParseRateLimitOptionsIgnoresNegative(t *testing.T) {
+	opts := RateLimitOptions{EventsPerSec: 2000, Burst: 5000}
+	parseRateLimitOptions(map[string]any{"events_per_sec": -1, "burst": -1}, &opts)
+	if opts.EventsPerSec != 2000 || opts.Burst != 5000 {
+		t.Errorf("negative values applied: %+v", opts)
+	}
+}
@@ -0,0 +1,21 @@
+package core
+
+import (
+	"aegis/pkg/anomaly"
+	"aegis/pkg/config"
+)
+
+// configureAnomalies enables rate anomaly detection on the profile
+// registry.
+func (c *CoreComponents) configureAnomalies(opts config.AnomalyOptions) {
+	if !opts.Enabled {
+		return
+	}
+	c.ProfileReg.SetAnomalyDetector(anomaly.NewDetector(anomaly.Config{
+		Window:          opts.Window,
+		BaselineWindows: opts.BaselineWindows,
+		Threshold:       opts.Threshold,
+		MinSamples:      opts.MinSamples,
+		MinCount:        opts.MinCount,
+	}))
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"log"
+	"time"
+
+	"aegis/pkg/config"
+	"aegis/pkg/proc"
+)
+
+// configureBaselines sets up behavioural baselines. Events from offline
+// sources are learned in memory only, so a replay or synthetic run does not
+// leave its traffic in the host's baselines.
+func (c *CoreComponents) configureBaselines(opts config.BaselineOptions, offline bool) {
+	if !opts.Enabled {
+		return
+	}
+	path := opts.StatePath
+	if offline {
+		path = ""
+	}
+	store, err := proc.OpenBaselineStore(path, opts.LearningPeriod)
+	if err != nil {
+		log.Printf("Warning: behavioural baselines unavailable, starting empty: %v", err)
+		store, _ = proc.OpenBaselineStore("", opts.LearningPeriod)
+	}
+	c.ProfileReg.SetBaselines(store)
+	if path != "" {
+		log.Printf("Behavioural baselines enabled (%d programs in %s)", store.Len(), path)
+	}
+}
+
+// ExpireBaselines drops the baselines of programs not seen for the
+// configured number of learning periods.
+func (c *CoreComponents) ExpireBaselines(opts config.BaselineOptions, now time.Time) {
+	if c.ProfileReg == nil || c.ProfileReg.Baselines() == nil || opts.LearningPeriod <= 0 || opts.IdlePeriods <= 0 {
+		return
+	}
+	c.ProfileReg.Baselines().Expire(now.Add(-time.Duration(opts.IdlePeriods) * opts.LearningPeriod))
+}
+
+// FlushBaselines persists changed behavioural baselines.
+func (c *CoreComponents) FlushBaselines() error {
+	if c.ProfileReg == nil || c.ProfileReg.Baselines() == nil {
+		return nil
+	}
+	return c.ProfileReg.Baselines().Flush()
+}
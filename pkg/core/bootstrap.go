@@ -3,12 +3,17 @@ package core
 import (
 	"fmt"
 	"log"
+	"sync/atomic"
+	"time"
 
 	"aegis/pkg/config"
 	"aegis/pkg/ebpf"
+	"aegis/pkg/exehash"
 	"aegis/pkg/proc"
 	"aegis/pkg/rules"
+	"aegis/pkg/session"
 	"aegis/pkg/storage"
+	"aegis/pkg/tracer"
 	"aegis/pkg/workload"
 
 	cebpf "github.com/cilium/ebpf"
@@ -19,46 +24,72 @@ import (
 type CoreComponents struct {
 	EBpfObjs    *ebpf.LSMObjects
 	EBpfLinks   []link.Link
-	Reader      *ringbuf.Reader
+	Source      tracer.EventSource
 	ProcessTree *proc.ProcessTree
 	WorkloadReg *workload.Registry
 	RuleEngine  *rules.Engine
 	Rules       []rules.Rule
+	Policies    []rules.Policy
 	Storage     *storage.Manager
 	ProfileReg  *proc.ProfileRegistry
+	Sessions    *session.Tracker
+
+	// ExeReputation hashes executed binaries; nil when disabled or when
+	// reading events from an offline source.
+	ExeReputation *exehash.Reputation
+
+	// PinPath is the bpffs directory holding pinned objects, or empty when
+	// programs are detached on Close.
+	PinPath string
+
+	rateLimitOpts config.RateLimitOptions
+	rateLimited   map[uint64]struct{}
+
+	protectedPaths []string
+
+	policyMapFailures atomic.Int64
 }
 
 // Bootstrap initializes all core components in the correct order.
 func Bootstrap(opts config.Options) (*CoreComponents, error) {
-	// 1. Initialize process tree
-	processTree := proc.NewProcessTree(
-		opts.ProcessTreeMaxAge,
-		opts.ProcessTreeMaxSize,
-		opts.ProcessTreeMaxChainLength,
-	)
+	// 1-4. Process tree, workload registry, rules, storage and profiles
+	c, rulesErr := newUserspaceComponents(opts)
 
-	// 2. Initialize workload registry
-	workloadReg := workload.NewRegistry(1000)
-
-	// 3. Load eBPF objects
-	objs, err := ebpf.LoadLSMObjects(opts.BPFPath, opts.RingBufferSize)
-	if err != nil {
-		return nil, fmt.Errorf("load eBPF LSM objects: %w", err)
+	// Offline sources feed recorded or synthetic events and need no BPF.
+	offline := opts.EventSource.Type != "" && opts.EventSource.Type != tracer.SourceRingBuffer
+	c.configureBaselines(opts.Baselines, offline)
+	c.configureAnomalies(opts.Anomaly)
+	c.configureSessions(opts.Sessions, offline)
+	if offline {
+		source, err := openOfflineSource(opts.EventSource)
+		if err != nil {
+			return nil, err
+		}
+		c.Source = source
+		c.rateLimited = make(map[uint64]struct{})
+		log.Printf("Reading events from %s source; BPF programs are not loaded", opts.EventSource.Type)
+		return c, nil
 	}
 
-	// 4. Set PID resolver if available
-	if processTree != nil && objs.PidToPpid != nil {
-		processTree.SetPIDResolver(newPIDResolver(objs.PidToPpid))
+	// 5. Load eBPF objects and attach hooks
+	pinPath := ""
+	if opts.PinBPFObjects {
+		pinPath = opts.BPFPinPath
+	} else if ebpf.HasPinnedLinks(opts.BPFPinPath) {
+		log.Printf("Warning: pinned Aegis programs found in %s but pinning is disabled; run 'aegis unload' to detach them", opts.BPFPinPath)
 	}
-
-	// 5. Attach LSM hooks
-	links, err := ebpf.AttachLSMHooks(objs)
+	objs, links, err := loadAndAttach(opts, pinPath)
 	if err != nil {
-		objs.Close()
-		return nil, fmt.Errorf("attach LSM hooks: %w", err)
+		return nil, err
 	}
 
-	// 6. Create ring buffer reader
+	// 6. Set PID resolver if available
+	if c.ProcessTree != nil && objs.PidToPpid != nil {
+		c.ProcessTree.SetPIDResolver(newPIDResolver(objs.PidToPpid))
+	}
+
+	// 7. Create ring buffer reader. With pinning the events map is reused,
+	// so the reader resumes from the previous consumer position.
 	reader, err := ringbuf.NewReader(objs.Events)
 	if err != nil {
 		ebpf.CloseLinks(links)
@@ -66,81 +97,232 @@ func Bootstrap(opts config.Options) (*CoreComponents, error) {
 		return nil, fmt.Errorf("create ringbuf reader: %w", err)
 	}
 
-	// 7. Load rules
-	loadedRules, err := rules.LoadRules(opts.RulesPath)
-	if err != nil {
-		log.Printf("Warning: failed to load rules from %s: %v", opts.RulesPath, err)
-		loadedRules = []rules.Rule{}
-	} else {
-		log.Printf("Loaded %d detection rules from %s", len(loadedRules), opts.RulesPath)
+	c.EBpfObjs = objs
+	c.EBpfLinks = links
+	c.Source = tracer.NewRingBufferSource(reader)
+	c.PinPath = pinPath
+
+	// 8. Populate BPF maps. Pinned maps may hold entries from a previous
+	// run, so stale keys are pruned after the current rules are written.
+	// If the rules file is unreadable the pinned entries are left in place.
+	// Policy bindings start over and are rebuilt as workloads are seen.
+	if rulesErr == nil {
+		if err := ebpf.RepopulateMonitoredFiles(objs.MonitoredFiles, c.Rules, c.Policies, opts.RulesPath); err != nil {
+			log.Printf("Warning: failed to populate monitored files: %v", err)
+		}
+		if err := ebpf.RepopulateBlockedPorts(objs.BlockedPorts, c.Rules, c.Policies); err != nil {
+			log.Printf("Warning: failed to populate blocked ports: %v", err)
+		}
+		if err := c.SyncPolicies(); err != nil {
+			log.Printf("Warning: failed to reset policy bindings: %v", err)
+		}
+	}
+
+	// 9. Configure kernel-side rate limiting
+	if err := c.configureRateLimits(opts.RateLimit); err != nil {
+		log.Printf("Warning: failed to configure rate limits: %v", err)
 	}
-	ruleEngine := rules.NewEngine(loadedRules)
 
-	// 8. Populate BPF maps
-	if err := ebpf.PopulateMonitoredFiles(objs.MonitoredFiles, loadedRules, opts.RulesPath); err != nil {
-		log.Printf("Warning: failed to populate monitored files: %v", err)
+	// 10. Protect the agent's own files and process
+	c.configureSelfProtection(opts)
+
+	// 11. Hash executed binaries for digest rules and first-seen tracking
+	c.configureExeReputation(opts.ExeHash)
+
+	// 12. Persist events to disk behind the in-memory ring
+	c.configureEventStore(opts.EventStore)
+
+	return c, nil
+}
+
+// openOfflineSource opens a source that does not need BPF.
+func openOfflineSource(opts config.EventSourceOptions) (tracer.EventSource, error) {
+	switch opts.Type {
+	case tracer.SourceReplay:
+		return tracer.NewReplaySource(opts.Path, opts.Speed)
+	case tracer.SourceJSONL:
+		return tracer.NewJSONLSource(opts.Path)
+	case tracer.SourceGenerator:
+		var interval time.Duration
+		if opts.EventsPerSec > 0 {
+			interval = time.Second / time.Duration(opts.EventsPerSec)
+		}
+		return tracer.NewGeneratorSource(uint64(opts.Count), interval, tracer.SyntheticTraffic), nil
+	default:
+		return nil, fmt.Errorf("unknown event source %q", opts.Type)
+	}
+}
+
+// newUserspaceComponents builds everything that does not depend on BPF. The
+// returned error reports a rules file that could not be loaded; the
+// components are still usable with an empty rule set.
+func newUserspaceComponents(opts config.Options) (*CoreComponents, error) {
+	// Process tree
+	processTree := proc.NewProcessTree(
+		opts.ProcessTreeMaxAge,
+		opts.ProcessTreeMaxSize,
+		opts.ProcessTreeMaxChainLength,
+	)
+
+	// Workload registry
+	workloadReg := workload.NewRegistry(opts.WorkloadRegistryMaxSize)
+	if opts.ContainerRuntimeSocket != "" {
+		workloadReg.SetEnricher(workload.NewEnricher(opts.ContainerRuntimeSocket, 0))
+		log.Printf("Container names and images from %s", opts.ContainerRuntimeSocket)
 	}
-	if err := ebpf.PopulateBlockedPorts(objs.BlockedPorts, loadedRules); err != nil {
-		log.Printf("Warning: failed to populate blocked ports: %v", err)
+
+	// Rules
+	ruleSet, rulesErr := rules.LoadRuleSet(opts.RulesPath)
+	if rulesErr != nil {
+		log.Printf("Warning: failed to load rules from %s: %v", opts.RulesPath, rulesErr)
+		ruleSet = rules.RuleSet{Rules: []rules.Rule{}}
+	} else {
+		log.Printf("Loaded %d detection rules and %d policies from %s",
+			len(ruleSet.Rules), len(ruleSet.Policies), opts.RulesPath)
 	}
 
-	// 9. Initialize storage manager
+	// Storage manager and profile registry
 	storageCapacity := config.DefaultRecentEventsCapacity
 	storageManager := storage.NewManager(storageCapacity, 1000)
-
-	// 10. Initialize profile registry
+	storageManager.SetMemoryBudget(int64(opts.StorageMemoryMB) << 20)
 	profileReg := proc.NewProfileRegistry()
 
-	return &CoreComponents{
-		EBpfObjs:    objs,
-		EBpfLinks:   links,
-		Reader:      reader,
+	c := &CoreComponents{
 		ProcessTree: processTree,
 		WorkloadReg: workloadReg,
-		RuleEngine:  ruleEngine,
-		Rules:       loadedRules,
+		Rules:       ruleSet.Rules,
+		Policies:    ruleSet.Policies,
 		Storage:     storageManager,
 		ProfileReg:  profileReg,
-	}, nil
+	}
+	c.RuleEngine = c.newRuleEngine(ruleSet.Rules, ruleSet.Policies)
+	return c, rulesErr
+}
+
+// loadAndAttach loads and attaches the probe programs. In "auto"
+// mode it prefers BPF LSM and falls back to monitor-only tracepoints when
+// the kernel was not booted with lsm=bpf or the LSM attach fails.
+func loadAndAttach(opts config.Options, pinPath string) (*ebpf.LSMObjects, []link.Link, error) {
+	mode := ebpf.AttachMode(opts.AttachMode)
+	if opts.AttachMode == "" || opts.AttachMode == "auto" {
+		mode = ebpf.DetectAttachMode()
+	}
+
+	objs, err := ebpf.LoadLSMObjects(opts.BPFPath, opts.RingBufferSize, opts.WorkloadRegistryMaxSize, pinPath, mode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load eBPF LSM objects: %w", err)
+	}
+
+	links, err := ebpf.AttachHooks(objs, pinPath)
+	if err == nil {
+		return objs, links, nil
+	}
+	objs.Close()
+
+	if mode != ebpf.AttachModeLSM || opts.AttachMode == "lsm" {
+		return nil, nil, fmt.Errorf("attach %s hooks: %w", mode, err)
+	}
+
+	log.Printf("Warning: BPF LSM attach failed (%v); falling back to tracepoints, enforcement disabled", err)
+	objs, err = ebpf.LoadLSMObjects(opts.BPFPath, opts.RingBufferSize, opts.WorkloadRegistryMaxSize, pinPath, ebpf.AttachModeTracepoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load eBPF tracepoint objects: %w", err)
+	}
+	links, err = ebpf.AttachHooks(objs, pinPath)
+	if err != nil {
+		objs.Close()
+		return nil, nil, fmt.Errorf("attach tracepoint hooks: %w", err)
+	}
+	return objs, links, nil
+}
+
+// AttachMode returns the mode the probes are running in, or
+// ebpf.AttachModeReplay when no programs are loaded.
+func (c *CoreComponents) AttachMode() ebpf.AttachMode {
+	if c.EBpfObjs == nil {
+		return ebpf.AttachModeReplay
+	}
+	return c.EBpfObjs.Mode
 }
 
 // ReloadRules reloads rules and updates BPF maps.
 func (c *CoreComponents) ReloadRules(rulesPath string) error {
-	newRules, err := rules.LoadRules(rulesPath)
+	ruleSet, err := rules.LoadRuleSet(rulesPath)
 	if err != nil {
 		return fmt.Errorf("load rules: %w", err)
 	}
+	newRules := ruleSet.Rules
 
 	c.Rules = newRules
-	c.RuleEngine = rules.NewEngine(newRules)
+	c.Policies = ruleSet.Policies
+	c.RuleEngine = c.newRuleEngine(newRules, ruleSet.Policies)
 
 	if c.EBpfObjs != nil {
 		if c.EBpfObjs.MonitoredFiles != nil {
-			if err := ebpf.RepopulateMonitoredFiles(c.EBpfObjs.MonitoredFiles, newRules, rulesPath); err != nil {
+			if err := ebpf.RepopulateMonitoredFiles(c.EBpfObjs.MonitoredFiles, newRules, ruleSet.Policies, rulesPath); err != nil {
 				return fmt.Errorf("failed to repopulate monitored files: %w", err)
 			}
 		}
 		if c.EBpfObjs.BlockedPorts != nil {
-			if err := ebpf.RepopulateBlockedPorts(c.EBpfObjs.BlockedPorts, newRules); err != nil {
+			if err := ebpf.RepopulateBlockedPorts(c.EBpfObjs.BlockedPorts, newRules, ruleSet.Policies); err != nil {
 				return fmt.Errorf("failed to repopulate blocked ports: %w", err)
 			}
 		}
+		if err := c.refreshSelfProtection(); err != nil {
+			log.Printf("Warning: failed to refresh self-protection: %v", err)
+		}
+		ebpf.ClearBlockedExecutables(c.EBpfObjs)
 	}
 
-	log.Printf("Rules reloaded: %d rules from %s", len(newRules), rulesPath)
+	// Policy indexes may have shifted, so rebind known workloads now
+	// rather than as their next events arrive. The file and port maps
+	// already carry the new indexes; writing masks before them would pair
+	// new masks with the old policy bits.
+	if err := c.SyncPolicies(); err != nil {
+		log.Printf("Warning: failed to rebind policies: %v", err)
+	}
+
+	log.Printf("Rules reloaded: %d rules and %d policies from %s", len(newRules), len(ruleSet.Policies), rulesPath)
 	return nil
 }
 
 func (c *CoreComponents) Close() error {
 	var firstErr error
 
-	if c.Reader != nil {
-		if err := c.Reader.Close(); err != nil {
+	if c.Source != nil {
+		if err := c.Source.Close(); err != nil {
 			firstErr = err
 		}
 	}
 
+	if err := c.FlushExeSeen(); err != nil {
+		log.Printf("Warning: failed to save executable first-seen state: %v", err)
+	}
+	if err := c.FlushBaselines(); err != nil {
+		log.Printf("Warning: failed to save behavioural baselines: %v", err)
+	}
+
+	// The in-memory ring stays readable for requests still in flight.
+	if c.Storage != nil && c.Storage.DiskStore() != nil {
+		if err := c.Storage.DiskStore().Close(); err != nil {
+			log.Printf("Warning: failed to close event store: %v", err)
+		}
+	}
+
+	// The pinned maps outlive this process, so stop treating our PID as
+	// the agent before it can be reused.
+	if len(c.protectedPaths) > 0 {
+		if err := ebpf.DisableSelfProtection(c.EBpfObjs); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// Closing a pinned link only drops our file descriptor; the pin keeps
+	// the program attached until 'aegis unload'.
 	ebpf.CloseLinks(c.EBpfLinks)
+	if c.PinPath != "" {
+		log.Printf("BPF programs remain pinned in %s", c.PinPath)
+	}
 
 	if c.EBpfObjs != nil {
 		if err := c.EBpfObjs.Close(); err != nil && firstErr == nil {
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"log"
+
+	"aegis/pkg/config"
+	"aegis/pkg/storage"
+	"aegis/pkg/tracer"
+)
+
+// configureEventStore persists events behind the in-memory ring. Like
+// executable hashing it only runs with the ring buffer source, so replayed
+// or synthetic traffic does not end up in the host's history.
+func (c *CoreComponents) configureEventStore(opts config.EventStoreOptions) {
+	if opts.Path == "" {
+		return
+	}
+	disk, err := storage.OpenDiskStore(storage.DiskOptions{
+		Dir:          opts.Path,
+		MaxAge:       opts.MaxAge,
+		MaxBytes:     int64(opts.MaxSizeMB) << 20,
+		SegmentBytes: int64(opts.SegmentSizeMB) << 20,
+	})
+	if err != nil {
+		log.Printf("Warning: event history unavailable, keeping events in memory only: %v", err)
+		return
+	}
+	c.Storage.SetDiskStore(disk)
+	tracer.ResumeEventIDs(disk.LastID())
+	log.Printf("Persisting events to %s (%d MB used)", opts.Path, disk.Size()>>20)
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+
+	"aegis/pkg/config"
+	"aegis/pkg/ebpf"
+	"aegis/pkg/exehash"
+)
+
+// configureExeReputation sets up executable hashing. It only runs with the
+// ring buffer source: offline events carry PIDs of processes that are not
+// running on this host.
+func (c *CoreComponents) configureExeReputation(opts config.ExeHashOptions) {
+	// Blocked inodes are relearned from the current rules.
+	ebpf.ClearBlockedExecutables(c.EBpfObjs)
+
+	if !opts.Enabled {
+		return
+	}
+	seen, err := exehash.OpenSeenStore(opts.StatePath, opts.LearningPeriod)
+	if err != nil {
+		log.Printf("Warning: executable first-seen state unavailable, starting empty: %v", err)
+		seen, _ = exehash.OpenSeenStore("", opts.LearningPeriod)
+	}
+	c.ExeReputation = exehash.NewReputation(exehash.NewHasher(int64(opts.MaxFileSizeMB)<<20), seen)
+	log.Printf("Executable hashing enabled (%d known binaries in %s)", seen.Len(), opts.StatePath)
+}
+
+// BlockExecutable kills pid if it still runs the file with digest sum,
+// either as its binary or, for scripts, as the file named filename, and in
+// LSM mode has the kernel deny further execs of that file. The first exec
+// of a denied file cannot be prevented: the digest is only known once the
+// file has been read. Unless everywhere is set, as for rules a policy
+// scopes to some workloads, the kernel deny is skipped and only pid is
+// killed.
+func (c *CoreComponents) BlockExecutable(pid uint32, sum, filename string, everywhere bool) error {
+	if c.ExeReputation == nil {
+		return fmt.Errorf("executable hashing is disabled")
+	}
+	if pid <= 1 || int(pid) == os.Getpid() {
+		return fmt.Errorf("refusing to kill pid %d", pid)
+	}
+
+	hasher := c.ExeReputation.Hasher
+	res, err := hasher.HashProcess(pid, "")
+	if err != nil {
+		return fmt.Errorf("hash pid %d: %w", pid, err)
+	}
+	if res.SHA256 != sum && filename != "" {
+		// An interpreter running the denied script.
+		res, err = hasher.HashPath(pid, filename, false)
+		if err != nil {
+			return fmt.Errorf("hash %s of pid %d: %w", filename, pid, err)
+		}
+	}
+	if res.SHA256 != sum {
+		return fmt.Errorf("pid %d no longer runs %s", pid, sum)
+	}
+
+	if everywhere && c.EBpfObjs != nil && c.EBpfObjs.Mode.Enforcing() {
+		if err := ebpf.BlockExecutable(c.EBpfObjs, res.Key.Ino, res.Key.Dev); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	if err := syscall.Kill(int(pid), syscall.SIGKILL); err != nil {
+		return fmt.Errorf("kill pid %d: %w", pid, err)
+	}
+	return nil
+}
+
+// FlushExeSeen persists newly seen executable digests.
+func (c *CoreComponents) FlushExeSeen() error {
+	if c.ExeReputation == nil || c.ExeReputation.Seen == nil {
+		return nil
+	}
+	return c.ExeReputation.Seen.Flush()
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"log"
+
+	"aegis/pkg/ebpf"
+	"aegis/pkg/proc"
+	"aegis/pkg/rules"
+)
+
+// newRuleEngine builds the rule engine for a rule set. Policies are bound
+// to workloads as the registry learns their cgroup path and container, or
+// earlier when SyncPolicies finds the cgroup in cgroupfs, and each binding
+// is mirrored into the kernel's cgroup_policies map so enforcing policies
+// can block in that cgroup.
+func (c *CoreComponents) newRuleEngine(ruleList []rules.Rule, policies []rules.Policy) *rules.Engine {
+	engine := rules.NewPolicyEngine(ruleList, policies)
+	if len(policies) == 0 {
+		return engine
+	}
+
+	if c.WorkloadReg != nil {
+		reg := c.WorkloadReg
+		engine.SetWorkloadResolver(func(cgroupID uint64) (rules.Workload, bool) {
+			m := reg.Get(cgroupID)
+			if m == nil || m.CgroupPath == "" {
+				// Not seen in an event yet, but maybe found in cgroupfs.
+				path, ok := proc.CachedCgroupPath(cgroupID)
+				if !ok {
+					return rules.Workload{}, false
+				}
+				container, labels := reg.Describe(path)
+				return rules.Workload{
+					CgroupPath:  path,
+					Image:       container.Image,
+					SystemdUnit: container.SystemdUnit,
+					Labels:      labels,
+				}, true
+			}
+			return rules.Workload{
+				CgroupPath:  m.CgroupPath,
+				Image:       m.Container.Image,
+				SystemdUnit: m.Container.SystemdUnit,
+				Labels:      m.Labels,
+			}, true
+		})
+	}
+	engine.SetBindFunc(func(cgroupID uint64, bound []int) {
+		if c.EBpfObjs == nil || c.EBpfObjs.CgroupPolicies == nil {
+			return
+		}
+		c.setCgroupPolicies(cgroupID, ebpf.PolicyMask(policies, bound))
+	})
+	return engine
+}
+
+// setCgroupPolicies writes a cgroup's policy mask, counting failures so a
+// full cgroup_policies map shows in the stats.
+func (c *CoreComponents) setCgroupPolicies(cgroupID uint64, mask uint32) {
+	if err := ebpf.SetCgroupPolicies(c.EBpfObjs.CgroupPolicies, cgroupID, mask); err != nil {
+		if c.policyMapFailures.Add(1) == 1 {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// PolicyMapFailures returns how many cgroup policy masks could not be
+// written to the kernel; those workloads are not blocked by their policies.
+func (c *CoreComponents) PolicyMapFailures() int64 {
+	return c.policyMapFailures.Load()
+}
+
+// SyncPolicies binds policies to every cgroup in cgroupfs and every known
+// workload, rewrites their kernel policy masks and drops the entries of
+// cgroups that are gone, in the kernel and in the engine's binding cache.
+// Binding cgroups before their first event lets the kernel block that
+// event; only cgroups created since the last sync are still bound by the
+// event that reveals them. Rewriting restores masks
+// pruned while a workload was evicted but still cached by the engine, and
+// after a reload replaces the masks written for the previous policy list.
+func (c *CoreComponents) SyncPolicies() error {
+	if c.RuleEngine == nil || c.WorkloadReg == nil {
+		return nil
+	}
+	hasMap := c.EBpfObjs != nil && c.EBpfObjs.CgroupPolicies != nil
+	policies := c.RuleEngine.Policies()
+
+	keep := make(map[uint64]bool)
+	bindCgroup := func(id uint64) {
+		if _, done := keep[id]; done {
+			return
+		}
+		mask := ebpf.PolicyMask(policies, c.RuleEngine.BoundPolicies(id))
+		keep[id] = mask != 0
+		if mask != 0 && hasMap {
+			c.setCgroupPolicies(id, mask)
+		}
+	}
+	walked := false
+	if len(policies) > 0 {
+		if err := proc.WalkCgroups(func(id uint64, _ string) { bindCgroup(id) }); err != nil {
+			log.Printf("Warning: walk cgroups: %v", err)
+		} else {
+			walked = true
+		}
+	}
+	for _, m := range c.WorkloadReg.List() {
+		bindCgroup(uint64(m.ID))
+	}
+	if walked {
+		c.RuleEngine.PruneBindings(keep)
+	}
+
+	if !hasMap {
+		return nil
+	}
+	return ebpf.PruneCgroupPolicies(c.EBpfObjs.CgroupPolicies, keep)
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"aegis/pkg/config"
+	"aegis/pkg/ebpf"
+	"aegis/pkg/proc"
+)
+
+// configureRateLimits installs the default per-cgroup budget and any
+// overrides that can be resolved to a cgroup ID up front. Glob overrides are
+// applied lazily by SyncRateLimits as matching workloads appear.
+func (c *CoreComponents) configureRateLimits(opts config.RateLimitOptions) error {
+	c.rateLimitOpts = opts
+	c.rateLimited = make(map[uint64]struct{})
+
+	if c.EBpfObjs == nil {
+		return nil
+	}
+
+	def := ebpf.NewRateLimit(opts.EventsPerSec, opts.Burst)
+	if err := ebpf.SetDefaultRateLimit(c.EBpfObjs.RateLimitConfig, def); err != nil {
+		return err
+	}
+	if err := ebpf.ClearCgroupRateLimits(c.EBpfObjs.CgroupRateLimits); err != nil {
+		return err
+	}
+
+	for _, w := range opts.Workloads {
+		id := w.CgroupID
+		if id == 0 && !isGlob(w.CgroupPath) {
+			id = proc.CgroupIDForPath(w.CgroupPath)
+		}
+		if id == 0 {
+			continue
+		}
+		if err := c.installRateLimit(id, w); err != nil {
+			return err
+		}
+	}
+
+	if def.Rate == 0 {
+		log.Printf("Kernel rate limiting disabled by default (%d overrides)", len(c.rateLimited))
+	} else {
+		log.Printf("Kernel rate limiting: %d events/s per cgroup, burst %d (%d overrides)",
+			def.Rate, def.Burst, len(c.rateLimited))
+	}
+	return nil
+}
+
+// SyncRateLimits applies path-glob overrides to newly discovered workloads
+// and copies the kernel's suppressed-event counters into the registry.
+func (c *CoreComponents) SyncRateLimits() error {
+	if c.EBpfObjs == nil || c.WorkloadReg == nil {
+		return nil
+	}
+
+	for _, m := range c.WorkloadReg.List() {
+		id := uint64(m.ID)
+		if _, done := c.rateLimited[id]; done || m.CgroupPath == "" {
+			continue
+		}
+		for _, w := range c.rateLimitOpts.Workloads {
+			if w.CgroupPath == "" || !matchCgroupPath(w.CgroupPath, m.CgroupPath) {
+				continue
+			}
+			if err := c.installRateLimit(id, w); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	counts, err := ebpf.ReadSuppressedCounts(c.EBpfObjs.CgroupBuckets)
+	for id, n := range counts {
+		c.WorkloadReg.SetSuppressedCount(id, int64(n))
+	}
+	return err
+}
+
+func (c *CoreComponents) installRateLimit(cgroupID uint64, w config.WorkloadRateLimit) error {
+	limit := ebpf.NewRateLimit(w.EventsPerSec, w.Burst)
+	if err := ebpf.SetCgroupRateLimit(c.EBpfObjs.CgroupRateLimits, cgroupID, limit); err != nil {
+		return fmt.Errorf("install rate limit override: %w", err)
+	}
+	c.rateLimited[cgroupID] = struct{}{}
+	return nil
+}
+
+func matchCgroupPath(pattern, cgroupPath string) bool {
+	if !isGlob(pattern) {
+		return pattern == cgroupPath
+	}
+	ok, err := path.Match(pattern, cgroupPath)
+	return err == nil && ok
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestMatchCgroupPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/system.slice/docker-*.scope", "/system.slice/docker-3f4e.scope", true},
+		{"/system.slice/docker-*.scope", "/system.slice/containerd.service", false},
+		{"/system.slice/*", "/system.slice/a/b", false}, // * does not cross /
+		{"/kubepods/*/*", "/kubepods/burstable/pod1", true},
+		{"/system.slice/sshd.service", "/system.slice/sshd.service", true},
+		{"/system.slice/sshd.service", "/system.slice/sshd.service/child", false},
+		{"/[", "/[", false}, // malformed glob
+	}
+	for _, tt := range tests {
+		if got := matchCgroupPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchCgroupPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"log"
+	"os"
+
+	"aegis/pkg/config"
+	"aegis/pkg/ebpf"
+)
+
+// configureSelfProtection write-protects the agent's own files and shields
+// the agent from signals. It needs BPF LSM; in tracepoint mode nothing can
+// be denied, so the option is reported and ignored.
+func (c *CoreComponents) configureSelfProtection(opts config.Options) {
+	if c.EBpfObjs == nil {
+		return
+	}
+	if !opts.SelfProtection {
+		if err := ebpf.DisableSelfProtection(c.EBpfObjs); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		return
+	}
+	if !c.EBpfObjs.Mode.Enforcing() {
+		log.Printf("Warning: self_protection requires BPF LSM; running without it in %s mode", c.EBpfObjs.Mode)
+		return
+	}
+
+	c.protectedPaths = []string{opts.RulesPath, opts.ConfigPath, opts.BPFPath}
+	if exe, err := os.Executable(); err == nil {
+		c.protectedPaths = append(c.protectedPaths, exe)
+	}
+	if err := c.refreshSelfProtection(); err != nil {
+		log.Printf("Warning: failed to enable self-protection: %v", err)
+		return
+	}
+	log.Printf("Self-protection enabled for pid %d (%d protected files)", os.Getpid(), len(c.protectedPaths))
+}
+
+// refreshSelfProtection re-resolves the protected paths to inodes. Files
+// rewritten by atomic rename (e.g. rules.yaml on save) get a new inode and
+// must be re-registered.
+func (c *CoreComponents) refreshSelfProtection() error {
+	if len(c.protectedPaths) == 0 {
+		return nil
+	}
+	missing, err := ebpf.EnableSelfProtection(c.EBpfObjs, os.Getpid(), c.protectedPaths)
+	for _, path := range missing {
+		log.Printf("Warning: self-protection skipped missing file %s", path)
+	}
+	return err
+}
+
+// RefreshSelfProtection re-registers the protected files after the agent
+// wrote one of them, e.g. on a settings or rules save. Failures are logged:
+// the write itself succeeded.
+func (c *CoreComponents) RefreshSelfProtection() {
+	if err := c.refreshSelfProtection(); err != nil {
+		log.Printf("Warning: failed to refresh self-protection: %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package core
+
+import (
+	"aegis/pkg/config"
+	"aegis/pkg/session"
+)
+
+// configureSessions starts login session tracking. Session leaders are
+// looked up in /proc only for live events.
+func (c *CoreComponents) configureSessions(opts config.SessionOptions, offline bool) {
+	c.Sessions = session.NewTracker(session.Config{
+		MaxSessions: opts.MaxSessions,
+		MaxCommands: opts.MaxCommands,
+		IdleTimeout: opts.IdleTimeout,
+		ReadProc:    !offline,
+	})
+}
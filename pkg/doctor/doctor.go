@@ -0,0 +1,263 @@
+// Package doctor checks whether the host can run Aegis and explains how to
+// fix anything that is missing.
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"aegis/pkg/ai/providers"
+	"aegis/pkg/config"
+	aegisebpf "aegis/pkg/ebpf"
+	"aegis/pkg/rules"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+)
+
+// Check is the outcome of a single capability probe. Required checks must
+// pass for the agent to start; optional ones degrade functionality.
+type Check struct {
+	Name        string `json:"name"`
+	Status      Status `json:"status"`
+	Required    bool   `json:"required"`
+	Detail      string `json:"detail"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+type Report struct {
+	Timestamp time.Time `json:"timestamp"`
+	OK        bool      `json:"ok"`
+	Checks    []Check   `json:"checks"`
+}
+
+// Minimum kernel for BPF ring buffers; BPF LSM itself needs 5.7.
+const minKernelMajor, minKernelMinor = 5, 8
+
+// Run executes every check. It never fails; problems are reported as
+// failed checks.
+func Run(ctx context.Context, opts config.Options) Report {
+	checks := []Check{
+		checkKernelVersion(),
+		checkBTF(),
+		checkBPFLSM(),
+		checkRingBuffer(),
+		checkCgroupV2(),
+		checkDPath(),
+		checkBPFObject(opts.BPFPath),
+		checkRules(opts.RulesPath),
+		checkAIProvider(ctx, opts.AI),
+	}
+
+	report := Report{Timestamp: time.Now(), OK: true, Checks: checks}
+	for _, c := range checks {
+		if c.Required && c.Status == StatusFail {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r Report) WriteText(w io.Writer) {
+	for _, c := range r.Checks {
+		mark := "PASS"
+		if c.Status == StatusFail {
+			mark = "FAIL"
+			if !c.Required {
+				mark = "WARN"
+			}
+		}
+		fmt.Fprintf(w, "[%s] %-16s %s\n", mark, c.Name, c.Detail)
+		if c.Status == StatusFail && c.Remediation != "" {
+			fmt.Fprintf(w, "       %-16s -> %s\n", "", c.Remediation)
+		}
+	}
+	if r.OK {
+		fmt.Fprintln(w, "\nAll required checks passed.")
+	} else {
+		fmt.Fprintln(w, "\nSome required checks failed; Aegis will not start until they are fixed.")
+	}
+}
+
+func pass(name string, required bool, detail string) Check {
+	return Check{Name: name, Status: StatusPass, Required: required, Detail: detail}
+}
+
+func fail(name string, required bool, detail, remediation string) Check {
+	return Check{Name: name, Status: StatusFail, Required: required, Detail: detail, Remediation: remediation}
+}
+
+func checkKernelVersion() Check {
+	const name = "kernel"
+	release, err := kernelRelease()
+	if err != nil {
+		return fail(name, true, fmt.Sprintf("uname failed: %v", err), "Run on Linux 5.8 or newer.")
+	}
+
+	major, minor := parseKernelVersion(release)
+	if major > minKernelMajor || (major == minKernelMajor && minor >= minKernelMinor) {
+		return pass(name, true, "Linux "+release)
+	}
+	return fail(name, true, "Linux "+release+" is too old",
+		fmt.Sprintf("Upgrade to Linux %d.%d or newer (BPF ring buffer and LSM support).", minKernelMajor, minKernelMinor))
+}
+
+func checkBTF() Check {
+	const name = "btf"
+	if _, err := os.Stat("/sys/kernel/btf/vmlinux"); err != nil {
+		return fail(name, true, "/sys/kernel/btf/vmlinux not found",
+			"Use a kernel built with CONFIG_DEBUG_INFO_BTF=y (most distribution kernels since 2021 are).")
+	}
+	return pass(name, true, "kernel BTF available")
+}
+
+func checkBPFLSM() Check {
+	const name = "lsm"
+	data, err := os.ReadFile("/sys/kernel/security/lsm")
+	if err != nil {
+		return fail(name, false, fmt.Sprintf("cannot read active LSM list: %v", err),
+			"Mount securityfs (mount -t securityfs securityfs /sys/kernel/security) and re-run.")
+	}
+	active := strings.TrimSpace(string(data))
+	if aegisebpf.BPFLSMEnabled() {
+		return pass(name, false, "bpf is an active LSM ("+active+"); blocking is available")
+	}
+	return fail(name, false, "bpf is not an active LSM ("+active+"); running in monitor-only tracepoint mode",
+		"Add \"bpf\" to the lsm= kernel parameter, e.g. lsm="+active+",bpf, then reboot.")
+}
+
+func checkRingBuffer() Check {
+	const name = "ringbuf"
+	err := features.HaveMapType(ebpf.RingBuf)
+	switch {
+	case err == nil:
+		return pass(name, true, "BPF ring buffer maps supported")
+	case os.Geteuid() != 0:
+		return fail(name, true, fmt.Sprintf("probe failed: %v", err), "Run doctor as root so BPF features can be probed.")
+	default:
+		return fail(name, true, fmt.Sprintf("BPF ring buffer unavailable: %v", err), "Upgrade to Linux 5.8 or newer.")
+	}
+}
+
+func checkCgroupV2() Check {
+	const name = "cgroup-v2"
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		return pass(name, false, "unified cgroup hierarchy mounted at /sys/fs/cgroup")
+	}
+	if _, err := os.Stat("/sys/fs/cgroup/unified/cgroup.controllers"); err == nil {
+		return pass(name, false, "hybrid hierarchy; cgroup v2 mounted at /sys/fs/cgroup/unified")
+	}
+	return fail(name, false, "cgroup v2 not mounted; workload attribution will be incomplete",
+		"Boot with systemd.unified_cgroup_hierarchy=1 or mount cgroup2 at /sys/fs/cgroup.")
+}
+
+// checkDPath looks for the helper's implementation in kallsyms. The generic
+// helper probe does not support LSM programs, which need an attach target.
+func checkDPath() Check {
+	const name = "bpf_d_path"
+	f, err := os.Open("/proc/kallsyms")
+	if err != nil {
+		return fail(name, false, fmt.Sprintf("cannot read /proc/kallsyms: %v", err), "Run doctor as root.")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[2] == "bpf_d_path" {
+			return pass(name, false, "bpf_d_path helper available")
+		}
+	}
+	return fail(name, false, "bpf_d_path helper not found; file rules match on the last path components only",
+		"Upgrade to Linux 5.10 or newer for full-path resolution.")
+}
+
+func checkBPFObject(path string) Check {
+	const name = "bpf-object"
+	if _, err := os.Stat(path); err != nil {
+		return fail(name, true, fmt.Sprintf("%s: %v", path, err), "Build it with 'make bpf' or set bpf_path in config.yaml.")
+	}
+	return pass(name, true, path)
+}
+
+func checkRules(path string) Check {
+	const name = "rules"
+	loaded, err := rules.LoadRules(path)
+	if err != nil {
+		return fail(name, false, err.Error(), "Fix the reported errors in "+path+"; the agent starts with no rules otherwise.")
+	}
+	return pass(name, false, fmt.Sprintf("%d valid rules in %s", len(loaded), path))
+}
+
+func checkAIProvider(ctx context.Context, opts config.AIOptions) Check {
+	const name = "ai-provider"
+	var provider providers.Provider
+	var remediation string
+	switch opts.Mode {
+	case "ollama":
+		provider = providers.NewOllamaProvider(opts.Ollama)
+		remediation = "Start Ollama (scripts/start_ollama.sh) and pull " + opts.Ollama.Model + ", or set ai.ollama.endpoint."
+	case "openai":
+		provider = providers.NewOpenAIProvider(opts.OpenAI)
+		remediation = "Check ai.openai.endpoint, the API key and network access."
+	default:
+		return fail(name, false, fmt.Sprintf("unknown AI mode %q", opts.Mode), "Set ai.mode to \"ollama\" or \"openai\".")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := provider.CheckHealth(ctx); err != nil {
+		return fail(name, false, fmt.Sprintf("%s unreachable: %v", provider.Name(), err), remediation)
+	}
+	return pass(name, false, provider.Name()+" reachable")
+}
+
+func kernelRelease() (string, error) {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		b.WriteByte(byte(c))
+	}
+	return b.String(), nil
+}
+
+func parseKernelVersion(release string) (int, int) {
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return 0, 0
+	}
+	major, _ := strconv.Atoi(parts[0])
+	minorDigits := parts[1]
+	if i := strings.IndexFunc(minorDigits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		minorDigits = minorDigits[:i]
+	}
+	minor, _ := strconv.Atoi(minorDigits)
+	return major, minor
+}
@@ -3,21 +3,89 @@ package ebpf
 import (
 	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
 )
 
-type lsmHook struct {
+type hook struct {
 	name    string
 	program **ebpf.Program
+	attach  func(*ebpf.Program) (link.Link, error)
 }
 
-func AttachLSMHooks(objs *LSMObjects) ([]link.Link, error) {
-	hooks := []lsmHook{
-		{"bprm_check_security", &objs.LsmBprmCheck},
-		{"file_open", &objs.LsmFileOpen},
-		{"socket_connect", &objs.LsmSocketConnect},
+func lsmHook(name string, program **ebpf.Program) hook {
+	return hook{name, program, func(p *ebpf.Program) (link.Link, error) {
+		return link.AttachLSM(link.LSMOptions{Program: p})
+	}}
+}
+
+func tracingHook(name string, program **ebpf.Program) hook {
+	return hook{name, program, func(p *ebpf.Program) (link.Link, error) {
+		return link.AttachTracing(link.TracingOptions{Program: p})
+	}}
+}
+
+func tracepointHook(group, name string, program **ebpf.Program) hook {
+	return hook{name, program, func(p *ebpf.Program) (link.Link, error) {
+		return link.Tracepoint(group, name, p, nil)
+	}}
+}
+
+// DetectAttachMode returns AttachModeLSM when the running kernel has "bpf"
+// in its active LSM list and AttachModeTracepoint otherwise.
+func DetectAttachMode() AttachMode {
+	if BPFLSMEnabled() {
+		return AttachModeLSM
+	}
+	return AttachModeTracepoint
+}
+
+// BPFLSMEnabled reports whether "bpf" appears in /sys/kernel/security/lsm.
+func BPFLSMEnabled() bool {
+	data, err := os.ReadFile("/sys/kernel/security/lsm")
+	if err != nil {
+		return false
+	}
+	for _, name := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		if name == "bpf" {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachHooks attaches the programs loaded for objs.Mode. When pinPath is
+// non-empty the links are pinned so they stay attached after the agent exits.
+func AttachHooks(objs *LSMObjects, pinPath string) ([]link.Link, error) {
+	var hooks []hook
+	switch objs.Mode {
+	case AttachModeTracepoint:
+		hooks = []hook{
+			tracingHook("sched_process_exec", &objs.TpSchedProcessExec),
+			tracepointHook("syscalls", "sys_enter_openat", &objs.TpSysEnterOpenat),
+			tracepointHook("syscalls", "sys_enter_connect", &objs.TpSysEnterConnect),
+		}
+	default:
+		hooks = []hook{
+			lsmHook("bprm_check_security", &objs.LsmBprmCheck),
+			lsmHook("file_open", &objs.LsmFileOpen),
+			lsmHook("socket_connect", &objs.LsmSocketConnect),
+			lsmHook("inode_unlink", &objs.LsmInodeUnlink),
+			lsmHook("inode_rename", &objs.LsmInodeRename),
+			lsmHook("path_truncate", &objs.LsmPathTruncate),
+			lsmHook("inode_setattr", &objs.LsmInodeSetattr),
+			lsmHook("task_kill", &objs.LsmTaskKill),
+		}
+	}
+
+	// Links pinned by a previous run are only reused when every map they
+	// write to was reused too.
+	reuse := len(objs.newPinnedMaps) == 0
+	if pinPath != "" && !reuse && HasPinnedLinks(pinPath) {
+		log.Printf("Reattaching pinned programs: maps %v were recreated", objs.newPinnedMaps)
 	}
 
 	var links []link.Link
@@ -25,17 +93,33 @@ func AttachLSMHooks(objs *LSMObjects) ([]link.Link, error) {
 		if *h.program == nil {
 			continue
 		}
-		l, err := link.AttachLSM(link.LSMOptions{
-			Program: *h.program,
-		})
+		var l link.Link
+		var err error
+		if pinPath != "" {
+			l, err = attachPinned(*h.program, linkPinPath(pinPath, h.name), reuse, h.attach)
+		} else {
+			l, err = h.attach(*h.program)
+		}
 		if err != nil {
 			CloseLinks(links)
-			return nil, fmt.Errorf("attach %s LSM: %w", h.name, err)
+			return nil, fmt.Errorf("attach %s %s: %w", h.name, objs.Mode, err)
 		}
 		links = append(links, l)
 	}
 
-	log.Printf("Attached %d BPF LSM hooks for active defense", len(links))
+	if pinPath != "" {
+		names := make([]string, 0, len(hooks))
+		for _, h := range hooks {
+			names = append(names, h.name)
+		}
+		pruneStaleLinks(pinPath, names)
+	}
+
+	if objs.Mode.Enforcing() {
+		log.Printf("Attached %d BPF LSM hooks for active defense", len(links))
+	} else {
+		log.Printf("Attached %d BPF tracepoint hooks (monitor only, enforcement disabled)", len(links))
+	}
 	return links, nil
 }
 
@@ -0,0 +1,26 @@
+package ebpf
+
+import "fmt"
+
+// BlockExecutable makes the kernel deny future execs of the file with the
+// given inode and userspace st_dev.
+func BlockExecutable(objs *LSMObjects, ino, dev uint64) error {
+	if objs == nil || objs.BlockedExes == nil {
+		return fmt.Errorf("blocked_exes map is not loaded")
+	}
+	key := inodeKey{Ino: ino, Dev: kernelDev(dev)}
+	if err := objs.BlockedExes.Put(key, uint8(1)); err != nil {
+		return fmt.Errorf("block executable inode %d: %w", ino, err)
+	}
+	return nil
+}
+
+// ClearBlockedExecutables removes every blocked inode. Entries are derived
+// from the digest deny lists in the rules, so they are dropped when the
+// rules change and relearned as denied binaries run again.
+func ClearBlockedExecutables(objs *LSMObjects) {
+	if objs == nil || objs.BlockedExes == nil {
+		return
+	}
+	pruneInodeMap(objs.BlockedExes, nil)
+}
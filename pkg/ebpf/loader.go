@@ -8,18 +8,75 @@ import (
 	"github.com/cilium/ebpf"
 )
 
-type LSMObjects struct {
+// AttachMode selects which set of programs is loaded and attached.
+type AttachMode string
+
+const (
+	// AttachModeLSM uses BPF LSM hooks and can enforce block rules.
+	AttachModeLSM AttachMode = "lsm"
+	// AttachModeTracepoint uses tracepoints on kernels without lsm=bpf.
+	// Events are identical but block rules are only reported.
+	AttachModeTracepoint AttachMode = "tracepoint"
+	// AttachModeReplay means no programs are loaded and events come from
+	// a capture file.
+	AttachModeReplay AttachMode = "replay"
+)
+
+// Enforcing reports whether block rules are enforced in this mode.
+func (m AttachMode) Enforcing() bool {
+	return m == AttachModeLSM
+}
+
+type LSMPrograms struct {
 	LsmBprmCheck     *ebpf.Program `ebpf:"lsm_bprm_check"`
 	LsmFileOpen      *ebpf.Program `ebpf:"lsm_file_open"`
 	LsmSocketConnect *ebpf.Program `ebpf:"lsm_socket_connect"`
+	LsmInodeUnlink   *ebpf.Program `ebpf:"lsm_inode_unlink"`
+	LsmInodeRename   *ebpf.Program `ebpf:"lsm_inode_rename"`
+	LsmPathTruncate  *ebpf.Program `ebpf:"lsm_path_truncate"`
+	LsmInodeSetattr  *ebpf.Program `ebpf:"lsm_inode_setattr"`
+	LsmTaskKill      *ebpf.Program `ebpf:"lsm_task_kill"`
+}
 
+type TracepointPrograms struct {
+	TpSchedProcessExec *ebpf.Program `ebpf:"tp_sched_process_exec"`
+	TpSysEnterOpenat   *ebpf.Program `ebpf:"tp_sys_enter_openat"`
+	TpSysEnterConnect  *ebpf.Program `ebpf:"tp_sys_enter_connect"`
+}
+
+type BPFMaps struct {
 	Events         *ebpf.Map `ebpf:"events"`
 	MonitoredFiles *ebpf.Map `ebpf:"monitored_files"`
 	BlockedPorts   *ebpf.Map `ebpf:"blocked_ports"`
 	PidToPpid      *ebpf.Map `ebpf:"pid_to_ppid"`
+	CgroupPolicies *ebpf.Map `ebpf:"cgroup_policies"`
+
+	RateLimitConfig  *ebpf.Map `ebpf:"rate_limit_config"`
+	CgroupRateLimits *ebpf.Map `ebpf:"cgroup_rate_limits"`
+	CgroupBuckets    *ebpf.Map `ebpf:"cgroup_buckets"`
+
+	ProtectedInodes *ebpf.Map `ebpf:"protected_inodes"`
+	SelfProtection  *ebpf.Map `ebpf:"self_protection"`
+	BlockedExes     *ebpf.Map `ebpf:"blocked_exes"`
+}
+
+// LSMObjects holds the loaded programs for one attach mode plus the maps
+// shared by both modes. Programs of the other mode are left nil.
+type LSMObjects struct {
+	LSMPrograms
+	TracepointPrograms
+	BPFMaps
+
+	Mode AttachMode
+
+	// newPinnedMaps names the pinned maps created by this load instead of
+	// reused, see preparePinnedMaps.
+	newPinnedMaps []string
 }
 
-func LoadLSMObjects(objPath string, ringBufSize int) (*LSMObjects, error) {
+// LoadLSMObjects loads the BPF collection. When pinPath is non-empty the
+// stateful maps are pinned there and reused across restarts.
+func LoadLSMObjects(objPath string, ringBufSize, maxWorkloads int, pinPath string, mode AttachMode) (*LSMObjects, error) {
 	abspath, err := filepath.Abs(objPath)
 	if err != nil {
 		return nil, fmt.Errorf("resolve bpf path: %w", err)
@@ -38,10 +95,48 @@ func LoadLSMObjects(objPath string, ringBufSize int) (*LSMObjects, error) {
 			eventsSpec.MaxEntries = uint32(ringBufSize)
 		}
 	}
+	// cgroup_policies holds an entry per cgroup bound to an enforcing
+	// policy; grow it when the workload registry may hold more.
+	if policiesSpec, ok := spec.Maps["cgroup_policies"]; ok && maxWorkloads > int(policiesSpec.MaxEntries) {
+		policiesSpec.MaxEntries = uint32(maxWorkloads)
+	}
+
+	var collOpts *ebpf.CollectionOptions
+	var newPinned []string
+	if pinPath != "" {
+		newPinned, err = preparePinnedMaps(spec, pinPath)
+		if err != nil {
+			return nil, err
+		}
+		collOpts = &ebpf.CollectionOptions{
+			Maps: ebpf.MapOptions{PinPath: pinPath},
+		}
+	}
+
+	objs := &LSMObjects{Mode: mode, newPinnedMaps: newPinned}
+	var target any
+	switch mode {
+	case AttachModeTracepoint:
+		target = &struct {
+			Programs *TracepointPrograms
+			Maps     *BPFMaps
+		}{&objs.TracepointPrograms, &objs.BPFMaps}
+	default:
+		objs.Mode = AttachModeLSM
+		target = &struct {
+			Programs *LSMPrograms
+			Maps     *BPFMaps
+		}{&objs.LSMPrograms, &objs.BPFMaps}
+	}
 
-	objs := &LSMObjects{}
-	if err := spec.LoadAndAssign(objs, nil); err != nil {
-		return nil, fmt.Errorf("load eBPF LSM programs: %w", err)
+	if err := spec.LoadAndAssign(target, collOpts); err != nil {
+		return nil, fmt.Errorf("load eBPF %s programs: %w", objs.Mode, err)
+	}
+	if pinPath != "" {
+		if err := claimSelfProtection(objs); err != nil {
+			objs.Close()
+			return nil, err
+		}
 	}
 
 	return objs, nil
@@ -58,12 +153,27 @@ func (o *LSMObjects) Close() error {
 	firstErr = closeProgram("lsm_bprm_check", o.LsmBprmCheck, firstErr)
 	firstErr = closeProgram("lsm_file_open", o.LsmFileOpen, firstErr)
 	firstErr = closeProgram("lsm_socket_connect", o.LsmSocketConnect, firstErr)
+	firstErr = closeProgram("lsm_inode_unlink", o.LsmInodeUnlink, firstErr)
+	firstErr = closeProgram("lsm_inode_rename", o.LsmInodeRename, firstErr)
+	firstErr = closeProgram("lsm_path_truncate", o.LsmPathTruncate, firstErr)
+	firstErr = closeProgram("lsm_inode_setattr", o.LsmInodeSetattr, firstErr)
+	firstErr = closeProgram("lsm_task_kill", o.LsmTaskKill, firstErr)
+	firstErr = closeProgram("tp_sched_process_exec", o.TpSchedProcessExec, firstErr)
+	firstErr = closeProgram("tp_sys_enter_openat", o.TpSysEnterOpenat, firstErr)
+	firstErr = closeProgram("tp_sys_enter_connect", o.TpSysEnterConnect, firstErr)
 
 	// Close maps
 	firstErr = closeMap("events", o.Events, firstErr)
 	firstErr = closeMap("monitored_files", o.MonitoredFiles, firstErr)
 	firstErr = closeMap("blocked_ports", o.BlockedPorts, firstErr)
 	firstErr = closeMap("pid_to_ppid", o.PidToPpid, firstErr)
+	firstErr = closeMap("rate_limit_config", o.RateLimitConfig, firstErr)
+	firstErr = closeMap("cgroup_rate_limits", o.CgroupRateLimits, firstErr)
+	firstErr = closeMap("cgroup_buckets", o.CgroupBuckets, firstErr)
+	firstErr = closeMap("protected_inodes", o.ProtectedInodes, firstErr)
+	firstErr = closeMap("self_protection", o.SelfProtection, firstErr)
+	firstErr = closeMap("blocked_exes", o.BlockedExes, firstErr)
+	firstErr = closeMap("cgroup_policies", o.CgroupPolicies, firstErr)
 
 	return firstErr
 }
@@ -11,33 +11,21 @@ import (
 	"github.com/cilium/ebpf"
 )
 
-func PopulateMonitoredFiles(bpfMap *ebpf.Map, ruleList []rules.Rule, rulesPath string) error {
+// RuleAction mirrors struct rule_action in main.bpf.c. Action applies in
+// every cgroup; bit i of BlockPolicies blocks the entry in cgroups bound to
+// policy i.
+type RuleAction struct {
+	Action        uint8
+	_             [3]byte
+	BlockPolicies uint32
+}
+
+func PopulateMonitoredFiles(bpfMap *ebpf.Map, ruleList []rules.Rule, policies []rules.Policy, rulesPath string) error {
 	if bpfMap == nil {
 		return fmt.Errorf("monitored_files map is nil")
 	}
 
-	fileActions := make(map[string]uint8)
-	for _, rule := range ruleList {
-		if !rule.IsActive() {
-			continue
-		}
-
-		paths := rule.Match.ExactPathKeys()
-		if len(paths) == 0 {
-			continue
-		}
-
-		for _, path := range paths {
-			key := extractParentFilename(path)
-			if key == "" {
-				continue
-			}
-
-			action := bpfActionForRule(rule)
-			fileActions[key] = mergeAction(fileActions[key], action)
-		}
-	}
-
+	fileActions := fileActionsForRules(ruleList, policies)
 	if len(fileActions) == 0 {
 		log.Printf("Warning: No file access rules found in %s", rulesPath)
 		return nil
@@ -51,7 +39,7 @@ func PopulateMonitoredFiles(bpfMap *ebpf.Map, ruleList []rules.Rule, rulesPath s
 		if err := bpfMap.Put(key, action); err != nil {
 			return fmt.Errorf("add file %q to BPF map: %w", filename, err)
 		}
-		if action == rules.BPFActionBlock {
+		if action.Action == rules.BPFActionBlock || action.BlockPolicies != 0 {
 			countBlock++
 		} else {
 			countMonitor++
@@ -64,36 +52,50 @@ func PopulateMonitoredFiles(bpfMap *ebpf.Map, ruleList []rules.Rule, rulesPath s
 	return nil
 }
 
-func RepopulateMonitoredFiles(bpfMap *ebpf.Map, ruleList []rules.Rule, rulesPath string) error {
+// RepopulateMonitoredFiles writes the new entries before removing stale
+// ones, so block rules present in both rule sets never lapse.
+func RepopulateMonitoredFiles(bpfMap *ebpf.Map, ruleList []rules.Rule, policies []rules.Policy, rulesPath string) error {
 	if bpfMap == nil {
 		return fmt.Errorf("monitored_files map is nil")
 	}
-	if err := clearMonitoredFilesMap(bpfMap); err != nil {
+	if err := PopulateMonitoredFiles(bpfMap, ruleList, policies, rulesPath); err != nil {
 		return err
 	}
-	return PopulateMonitoredFiles(bpfMap, ruleList, rulesPath)
+	return pruneMonitoredFilesMap(bpfMap, fileActionsForRules(ruleList, policies))
 }
 
-func PopulateBlockedPorts(bpfMap *ebpf.Map, ruleList []rules.Rule) error {
-	if bpfMap == nil {
-		return fmt.Errorf("blocked_ports map is nil")
-	}
-
-	portActions := make(map[uint16]uint8)
+func fileActionsForRules(ruleList []rules.Rule, policies []rules.Policy) map[string]RuleAction {
+	scoped := rules.ScopedRuleNames(policies)
+	rulePolicies := rules.RulePolicies(policies)
+	fileActions := make(map[string]RuleAction)
 	for _, rule := range ruleList {
-		if !rule.IsActive() {
+		if !appliesAnywhere(rule, scoped, rulePolicies) {
 			continue
 		}
 
-		if rule.Match.DestPort == 0 {
+		paths := rule.Match.ExactPathKeys()
+		if len(paths) == 0 {
 			continue
 		}
 
-		action := bpfActionForRule(rule)
-		port := rule.Match.DestPort
-		portActions[port] = mergeAction(portActions[port], action)
+		for _, path := range paths {
+			key := extractParentFilename(path)
+			if key == "" {
+				continue
+			}
+
+			fileActions[key] = mergeRuleAction(fileActions[key], rule, scoped[rule.Name], rulePolicies[rule.Name], policies)
+		}
+	}
+	return fileActions
+}
+
+func PopulateBlockedPorts(bpfMap *ebpf.Map, ruleList []rules.Rule, policies []rules.Policy) error {
+	if bpfMap == nil {
+		return fmt.Errorf("blocked_ports map is nil")
 	}
 
+	portActions := portActionsForRules(ruleList, policies)
 	if len(portActions) == 0 {
 		return nil
 	}
@@ -104,7 +106,7 @@ func PopulateBlockedPorts(bpfMap *ebpf.Map, ruleList []rules.Rule) error {
 		if err := bpfMap.Put(port, action); err != nil {
 			return fmt.Errorf("add port %d to BPF map: %w", port, err)
 		}
-		if action == rules.BPFActionBlock {
+		if action.Action == rules.BPFActionBlock || action.BlockPolicies != 0 {
 			countBlock++
 		} else {
 			countMonitor++
@@ -116,20 +118,56 @@ func PopulateBlockedPorts(bpfMap *ebpf.Map, ruleList []rules.Rule) error {
 	return nil
 }
 
-func RepopulateBlockedPorts(bpfMap *ebpf.Map, ruleList []rules.Rule) error {
+// RepopulateBlockedPorts writes the new entries before removing stale ones.
+func RepopulateBlockedPorts(bpfMap *ebpf.Map, ruleList []rules.Rule, policies []rules.Policy) error {
 	if bpfMap == nil {
 		return fmt.Errorf("blocked_ports map is nil")
 	}
-	if err := clearBlockedPortsMap(bpfMap); err != nil {
+	if err := PopulateBlockedPorts(bpfMap, ruleList, policies); err != nil {
 		return err
 	}
-	return PopulateBlockedPorts(bpfMap, ruleList)
+	return pruneBlockedPortsMap(bpfMap, portActionsForRules(ruleList, policies))
+}
+
+func portActionsForRules(ruleList []rules.Rule, policies []rules.Policy) map[uint16]RuleAction {
+	scoped := rules.ScopedRuleNames(policies)
+	rulePolicies := rules.RulePolicies(policies)
+	portActions := make(map[uint16]RuleAction)
+	for _, rule := range ruleList {
+		if !appliesAnywhere(rule, scoped, rulePolicies) {
+			continue
+		}
+
+		if rule.Match.DestPort == 0 {
+			continue
+		}
+
+		port := rule.Match.DestPort
+		portActions[port] = mergeRuleAction(portActions[port], rule, scoped[rule.Name], rulePolicies[rule.Name], policies)
+	}
+	return portActions
+}
+
+// appliesAnywhere reports whether a rule needs a map entry: it is active and
+// either global or named by a policy that is not off. A rule whose policies
+// are all off must not add an entry, which would send its events to user
+// space for nothing.
+func appliesAnywhere(rule rules.Rule, scoped map[string]bool, rulePolicies map[string][]int) bool {
+	if !rule.IsActive() {
+		return false
+	}
+	return !scoped[rule.Name] || len(rulePolicies[rule.Name]) > 0
 }
 
 func bpfActionForRule(rule rules.Rule) uint8 {
 	if rule.IsTesting() {
 		return rules.BPFActionMonitor
 	}
+	// Map entries have no namespace, so a block there would apply to
+	// every namespace; ValidateRules rejects such rules.
+	if rule.Match.PidNamespace != "" {
+		return rules.BPFActionMonitor
+	}
 	if rule.Action == rules.ActionBlock {
 		return rules.BPFActionBlock
 	}
@@ -143,12 +181,42 @@ func mergeAction(existing, proposed uint8) uint8 {
 	return existing
 }
 
-func clearMonitoredFilesMap(bpfMap *ebpf.Map) error {
+// mergeRuleAction folds a rule into a map entry. Rules no policy names set
+// the global action; a policy-scoped rule is monitored everywhere, so the
+// event reaches the engine, and blocks only where an enforcing policy that
+// names it is bound.
+func mergeRuleAction(existing RuleAction, rule rules.Rule, scoped bool, bound []int, policies []rules.Policy) RuleAction {
+	action := bpfActionForRule(rule)
+	if !scoped {
+		existing.Action = mergeAction(existing.Action, action)
+		return existing
+	}
+	if len(bound) == 0 {
+		// Every policy naming the rule is off.
+		return existing
+	}
+	existing.Action = mergeAction(existing.Action, rules.BPFActionMonitor)
+	if action != rules.BPFActionBlock {
+		return existing
+	}
+	for _, i := range bound {
+		if policies[i].Mode == rules.PolicyModeEnforce {
+			existing.BlockPolicies |= 1 << uint(i)
+		}
+	}
+	return existing
+}
+
+func pruneMonitoredFilesMap(bpfMap *ebpf.Map, keep map[string]RuleAction) error {
 	var key [events.PathMaxLen]byte
-	var val uint8
+	var val RuleAction
 	iter := bpfMap.Iterate()
 	keysToDelete := make([][]byte, 0)
 	for iter.Next(&key, &val) {
+		name := strings.TrimRight(string(key[:]), "\x00")
+		if _, ok := keep[name]; ok {
+			continue
+		}
 		keyCopy := make([]byte, events.PathMaxLen)
 		copy(keyCopy, key[:])
 		keysToDelete = append(keysToDelete, keyCopy)
@@ -159,12 +227,15 @@ func clearMonitoredFilesMap(bpfMap *ebpf.Map) error {
 	return nil
 }
 
-func clearBlockedPortsMap(bpfMap *ebpf.Map) error {
+func pruneBlockedPortsMap(bpfMap *ebpf.Map, keep map[uint16]RuleAction) error {
 	var key uint16
-	var val uint8
+	var val RuleAction
 	iter := bpfMap.Iterate()
 	keysToDelete := make([]uint16, 0)
 	for iter.Next(&key, &val) {
+		if _, ok := keep[key]; ok {
+			continue
+		}
 		keysToDelete = append(keysToDelete, key)
 	}
 	for _, k := range keysToDelete {
@@ -0,0 +1,105 @@
+package ebpf
+
+import (
+	"testing"
+
+	"aegis/pkg/rules"
+)
+
+var testPolicies = []rules.Policy{
+	{Name: "prod", Mode: rules.PolicyModeEnforce, Rules: []string{"Block Shadow", "Block SMTP"}},
+	{Name: "builds", Mode: rules.PolicyModeMonitor, Rules: []string{"Block Shadow"}},
+	{Name: "legacy", Mode: rules.PolicyModeOff, Rules: []string{"Block Passwd", "Block Telnet"}},
+}
+
+func testRule(name string, action rules.ActionType, match rules.MatchCondition) rules.Rule {
+	r := rules.Rule{Name: name, Action: action, State: rules.RuleStateProduction, Match: match}
+	r.Match.Prepare()
+	return r
+}
+
+func TestMergeRuleAction(t *testing.T) {
+	block := testRule("Block Shadow", rules.ActionBlock, rules.MatchCondition{})
+	alert := testRule("Alert Shadow", rules.ActionAlert, rules.MatchCondition{})
+	inTesting := block
+	inTesting.State = rules.RuleStateTesting
+
+	tests := []struct {
+		name     string
+		existing RuleAction
+		rule     rules.Rule
+		scoped   bool
+		bound    []int
+		want     RuleAction
+	}{
+		{"global alert", RuleAction{}, alert, false, nil, RuleAction{Action: rules.BPFActionMonitor}},
+		{"global block", RuleAction{}, block, false, nil, RuleAction{Action: rules.BPFActionBlock}},
+		{"enforce", RuleAction{}, block, true, []int{0}, RuleAction{Action: rules.BPFActionMonitor, BlockPolicies: 1}},
+		{"monitor", RuleAction{}, block, true, []int{1}, RuleAction{Action: rules.BPFActionMonitor}},
+		{"enforce and monitor", RuleAction{}, block, true, []int{0, 1}, RuleAction{Action: rules.BPFActionMonitor, BlockPolicies: 1}},
+		{"scoped alert", RuleAction{}, alert, true, []int{0}, RuleAction{Action: rules.BPFActionMonitor}},
+		{"scoped testing", RuleAction{}, inTesting, true, []int{0}, RuleAction{Action: rules.BPFActionMonitor}},
+		{"all off", RuleAction{}, block, true, nil, RuleAction{}},
+		{"global over scoped", RuleAction{Action: rules.BPFActionMonitor, BlockPolicies: 1}, block, false, nil,
+			RuleAction{Action: rules.BPFActionBlock, BlockPolicies: 1}},
+		{"scoped over global", RuleAction{Action: rules.BPFActionBlock}, block, true, []int{0},
+			RuleAction{Action: rules.BPFActionBlock, BlockPolicies: 1}},
+	}
+	for _, tt := range tests {
+		if got := mergeRuleAction(tt.existing, tt.rule, tt.scoped, tt.bound, testPolicies); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestActionsForRulesSharedKeys(t *testing.T) {
+	ruleList := []rules.Rule{
+		testRule("Alert Shadow", rules.ActionAlert, rules.MatchCondition{Filename: "/etc/shadow"}),
+		testRule("Block Shadow", rules.ActionBlock, rules.MatchCondition{Filename: "/etc/shadow"}),
+		testRule("Block Passwd", rules.ActionBlock, rules.MatchCondition{Filename: "/etc/passwd"}),
+		testRule("Alert SMTP", rules.ActionAlert, rules.MatchCondition{DestPort: 25}),
+		testRule("Block SMTP", rules.ActionBlock, rules.MatchCondition{DestPort: 25}),
+		testRule("Block Telnet", rules.ActionBlock, rules.MatchCondition{DestPort: 23}),
+	}
+
+	files := fileActionsForRules(ruleList, testPolicies)
+	want := RuleAction{Action: rules.BPFActionMonitor, BlockPolicies: 1}
+	if got, ok := files["etc/shadow"]; !ok || got != want {
+		t.Errorf("etc/shadow = %+v, %v; want %+v", got, ok, want)
+	}
+	if got, ok := files["etc/passwd"]; ok {
+		t.Errorf("rule of a policy that is off added %+v", got)
+	}
+
+	nsRule := testRule("Block Group", rules.ActionBlock, rules.MatchCondition{Filename: "/etc/group", PidNamespace: "!host"})
+	if got := fileActionsForRules([]rules.Rule{nsRule}, nil)["etc/group"]; got.Action != rules.BPFActionMonitor {
+		t.Errorf("namespace-scoped block rule installed as %+v", got)
+	}
+
+	ports := portActionsForRules(ruleList, testPolicies)
+	if got, ok := ports[25]; !ok || got != want {
+		t.Errorf("port 25 = %+v, %v; want %+v", got, ok, want)
+	}
+	if got, ok := ports[23]; ok {
+		t.Errorf("rule of a policy that is off added %+v", got)
+	}
+}
+
+func TestPolicyMask(t *testing.T) {
+	tests := []struct {
+		bound []int
+		want  uint32
+	}{
+		{nil, 0},
+		{[]int{0}, 1},
+		{[]int{1}, 0}, // monitor
+		{[]int{2}, 0}, // off
+		{[]int{0, 1, 2}, 1},
+		{[]int{-1, 3, rules.MaxPolicies}, 0},
+	}
+	for _, tt := range tests {
+		if got := PolicyMask(testPolicies, tt.bound); got != tt.want {
+			t.Errorf("PolicyMask(%v) = %#x, want %#x", tt.bound, got, tt.want)
+		}
+	}
+}
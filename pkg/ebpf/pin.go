@@ -0,0 +1,204 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// pinnedMaps lists the maps whose state must survive an agent restart.
+// Per-CPU scratch maps carry no state and are always recreated.
+var pinnedMaps = []string{
+	"events",
+	"monitored_files",
+	"blocked_ports",
+	"pid_to_ppid",
+	"rate_limit_config",
+	"cgroup_rate_limits",
+	"cgroup_buckets",
+	"protected_inodes",
+	"self_protection",
+	"blocked_exes",
+	"cgroup_policies",
+}
+
+func linkPinPath(pinPath, hook string) string {
+	return filepath.Join(pinPath, "links", hook)
+}
+
+// HasPinnedLinks reports whether a previous agent left links pinned under
+// pinPath, i.e. whether programs may still be attached.
+func HasPinnedLinks(pinPath string) bool {
+	entries, err := os.ReadDir(filepath.Join(pinPath, "links"))
+	return err == nil && len(entries) > 0
+}
+
+// preparePinnedMaps marks the stateful maps for pinning and returns the
+// names of those that will be created afresh rather than reused. Programs
+// still attached from a previous run write to the old maps, so they must
+// not be reused when any map is new.
+func preparePinnedMaps(spec *ebpf.CollectionSpec, pinPath string) ([]string, error) {
+	if err := os.MkdirAll(filepath.Join(pinPath, "links"), 0o700); err != nil {
+		return nil, fmt.Errorf("create pin directory: %w", err)
+	}
+
+	var created []string
+	for _, name := range pinnedMaps {
+		mapSpec, ok := spec.Maps[name]
+		if !ok {
+			continue
+		}
+		mapSpec.Pinning = ebpf.PinByName
+
+		// A pinned map from an older object (different layout or ring
+		// buffer size) cannot be reused; drop it so it is recreated.
+		pinned := filepath.Join(pinPath, name)
+		m, err := ebpf.LoadPinnedMap(pinned, nil)
+		if err != nil {
+			created = append(created, name)
+			continue
+		}
+		err = mapSpec.Compatible(m)
+		m.Close()
+		if err != nil {
+			log.Printf("Pinned map %s is incompatible, recreating: %v", name, err)
+			if err := os.Remove(pinned); err != nil {
+				return nil, fmt.Errorf("remove stale pinned map %s: %w", name, err)
+			}
+			created = append(created, name)
+		}
+	}
+	return created, nil
+}
+
+// attachPinned attaches prog and pins the link at path. If a link is
+// already pinned there it is reused when reuse is set and it runs the same
+// program, and otherwise replaced only after the new program is attached,
+// so the hook is never left without enforcement.
+func attachPinned(prog *ebpf.Program, path string, reuse bool, attach func(*ebpf.Program) (link.Link, error)) (link.Link, error) {
+	old, err := link.LoadPinnedLink(path, nil)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: discarding unreadable pinned link %s: %v", path, err)
+		_ = os.Remove(path)
+		old = nil
+	}
+
+	if old != nil && reuse && sameProgram(old, prog) {
+		return old, nil
+	}
+
+	l, err := attach(prog)
+	if err != nil {
+		if old != nil {
+			old.Close()
+		}
+		return nil, err
+	}
+
+	if old != nil {
+		if err := old.Unpin(); err != nil {
+			log.Printf("Warning: unpin previous link %s: %v", path, err)
+		}
+		old.Close()
+	}
+
+	if err := l.Pin(path); err != nil {
+		// Perf-event based tracepoint links cannot be pinned on older
+		// kernels; keep the attachment for this run only.
+		if errors.Is(err, ebpf.ErrNotSupported) {
+			log.Printf("Warning: link %s cannot be pinned on this kernel: %v", filepath.Base(path), err)
+			return l, nil
+		}
+		l.Close()
+		return nil, fmt.Errorf("pin link: %w", err)
+	}
+	return l, nil
+}
+
+// pruneStaleLinks detaches pinned links for hooks that are no longer in
+// use, e.g. after switching between LSM and tracepoint mode.
+func pruneStaleLinks(pinPath string, keep []string) {
+	linksDir := filepath.Join(pinPath, "links")
+	entries, err := os.ReadDir(linksDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if slices.Contains(keep, entry.Name()) {
+			continue
+		}
+		path := filepath.Join(linksDir, entry.Name())
+		if l, err := link.LoadPinnedLink(path, nil); err == nil {
+			_ = l.Unpin()
+			l.Close()
+		} else {
+			_ = os.Remove(path)
+		}
+		log.Printf("Detached stale pinned link %s", entry.Name())
+	}
+}
+
+func sameProgram(l link.Link, prog *ebpf.Program) bool {
+	info, err := l.Info()
+	if err != nil {
+		return false
+	}
+	attached, err := ebpf.NewProgramFromID(info.Program)
+	if err != nil {
+		return false
+	}
+	defer attached.Close()
+
+	oldInfo, err := attached.Info()
+	if err != nil {
+		return false
+	}
+	newInfo, err := prog.Info()
+	if err != nil {
+		return false
+	}
+	return oldInfo.Tag != "" && oldInfo.Tag == newInfo.Tag && oldInfo.Name == newInfo.Name
+}
+
+// UnloadPinned detaches every pinned link and removes the pinned maps under
+// pinPath. After this the kernel no longer enforces any Aegis rules.
+func UnloadPinned(pinPath string) error {
+	if _, err := os.Stat(pinPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("stat pin directory: %w", err)
+	}
+
+	linksDir := filepath.Join(pinPath, "links")
+	entries, err := os.ReadDir(linksDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read pinned links: %w", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(linksDir, entry.Name())
+		l, err := link.LoadPinnedLink(path, nil)
+		if err != nil {
+			log.Printf("Warning: load pinned link %s: %v", path, err)
+			_ = os.Remove(path)
+			continue
+		}
+		if err := l.Unpin(); err != nil {
+			l.Close()
+			return fmt.Errorf("unpin link %s: %w", entry.Name(), err)
+		}
+		l.Close()
+		log.Printf("Detached %s", entry.Name())
+	}
+
+	if err := os.RemoveAll(pinPath); err != nil {
+		return fmt.Errorf("remove pinned maps: %w", err)
+	}
+	return nil
+}
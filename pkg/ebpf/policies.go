@@ -0,0 +1,58 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"aegis/pkg/rules"
+
+	"github.com/cilium/ebpf"
+)
+
+// PolicyMask returns the cgroup_policies value for a set of bound policies:
+// one bit per policy in enforce mode.
+func PolicyMask(policies []rules.Policy, bound []int) uint32 {
+	var mask uint32
+	for _, i := range bound {
+		if i >= 0 && i < rules.MaxPolicies && i < len(policies) && policies[i].Mode == rules.PolicyModeEnforce {
+			mask |= 1 << uint(i)
+		}
+	}
+	return mask
+}
+
+// SetCgroupPolicies records which enforcing policies are bound to a cgroup.
+// A zero mask removes the entry.
+func SetCgroupPolicies(bpfMap *ebpf.Map, cgroupID uint64, mask uint32) error {
+	if bpfMap == nil {
+		return fmt.Errorf("cgroup_policies map is nil")
+	}
+	if mask == 0 {
+		_ = bpfMap.Delete(cgroupID)
+		return nil
+	}
+	if err := bpfMap.Put(cgroupID, mask); err != nil {
+		return fmt.Errorf("set policies for cgroup %d: %w", cgroupID, err)
+	}
+	return nil
+}
+
+// PruneCgroupPolicies removes the entries of cgroups not in keep.
+func PruneCgroupPolicies(bpfMap *ebpf.Map, keep map[uint64]bool) error {
+	if bpfMap == nil {
+		return fmt.Errorf("cgroup_policies map is nil")
+	}
+	var key uint64
+	var val uint32
+	iter := bpfMap.Iterate()
+	keysToDelete := make([]uint64, 0)
+	for iter.Next(&key, &val) {
+		if keep[key] {
+			continue
+		}
+		keysToDelete = append(keysToDelete, key)
+	}
+	for _, k := range keysToDelete {
+		_ = bpfMap.Delete(k)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package ebpf
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/cilium/ebpf"
+)
+
+// inodeKey mirrors struct inode_key in main.bpf.c.
+type inodeKey struct {
+	Ino uint64
+	Dev uint64
+}
+
+// selfProtectionConfig mirrors struct self_protection_config in main.bpf.c.
+type selfProtectionConfig struct {
+	AgentPID uint32
+	Enabled  uint32
+}
+
+// EnableSelfProtection write-protects paths against every process except
+// agentPID and denies signals sent to agentPID. Paths that do not exist are
+// skipped and returned so the caller can report them.
+func EnableSelfProtection(objs *LSMObjects, agentPID int, paths []string) ([]string, error) {
+	if objs.ProtectedInodes == nil || objs.SelfProtection == nil {
+		return nil, fmt.Errorf("self-protection maps are not loaded")
+	}
+
+	keep := make(map[inodeKey]struct{}, len(paths))
+	var missing []string
+	for _, path := range paths {
+		key, err := inodeKeyForPath(path)
+		if err != nil {
+			missing = append(missing, path)
+			continue
+		}
+		if err := objs.ProtectedInodes.Put(key, uint8(1)); err != nil {
+			return missing, fmt.Errorf("protect %s: %w", path, err)
+		}
+		keep[key] = struct{}{}
+	}
+	pruneInodeMap(objs.ProtectedInodes, keep)
+
+	cfg := selfProtectionConfig{AgentPID: uint32(agentPID), Enabled: 1}
+	if err := objs.SelfProtection.Put(uint32(0), cfg); err != nil {
+		return missing, fmt.Errorf("enable self-protection: %w", err)
+	}
+	return missing, nil
+}
+
+// claimSelfProtection points a pinned self_protection entry left by a
+// previous agent at this process. After a crash the entry still names the
+// dead agent's PID, which another process may since have been given; this
+// runs as soon as the maps are loaded so that PID is never trusted. The
+// protected inodes stay enforced until configureSelfProtection decides.
+func claimSelfProtection(objs *LSMObjects) error {
+	if objs.SelfProtection == nil {
+		return nil
+	}
+	var cfg selfProtectionConfig
+	if err := objs.SelfProtection.Lookup(uint32(0), &cfg); err != nil {
+		return fmt.Errorf("read self-protection state: %w", err)
+	}
+	if cfg.AgentPID == 0 || cfg.AgentPID == uint32(os.Getpid()) {
+		return nil
+	}
+	cfg.AgentPID = uint32(os.Getpid())
+	if err := objs.SelfProtection.Put(uint32(0), cfg); err != nil {
+		return fmt.Errorf("reset self-protection agent pid: %w", err)
+	}
+	return nil
+}
+
+// DisableSelfProtection turns the kernel checks off. The protected inode
+// list is kept so pinned maps can be re-enabled by the next agent.
+func DisableSelfProtection(objs *LSMObjects) error {
+	if objs == nil || objs.SelfProtection == nil {
+		return nil
+	}
+	if err := objs.SelfProtection.Put(uint32(0), selfProtectionConfig{}); err != nil {
+		return fmt.Errorf("disable self-protection: %w", err)
+	}
+	return nil
+}
+
+func pruneInodeMap(bpfMap *ebpf.Map, keep map[inodeKey]struct{}) {
+	var key inodeKey
+	var val uint8
+	var stale []inodeKey
+	iter := bpfMap.Iterate()
+	for iter.Next(&key, &val) {
+		if _, ok := keep[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	for _, k := range stale {
+		_ = bpfMap.Delete(k)
+	}
+}
+
+func inodeKeyForPath(path string) (inodeKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return inodeKey{}, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inodeKey{}, fmt.Errorf("stat %s: no inode information", path)
+	}
+	return inodeKey{Ino: stat.Ino, Dev: kernelDev(uint64(stat.Dev))}, nil
+}
+
+// kernelDev converts a userspace st_dev to the kernel's internal dev_t
+// (major << 20 | minor), which is what sb->s_dev holds.
+func kernelDev(dev uint64) uint64 {
+	major := ((dev >> 8) & 0xfff) | ((dev >> 32) & 0xfffff000)
+	minor := (dev & 0xff) | ((dev >> 12) & 0xffffff00)
+	return major<<20 | minor
+}
@@ -0,0 +1,98 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// MaxRateLimitPerSec bounds configured rates so the kernel-side refill
+// arithmetic (elapsed_ns * rate) cannot overflow.
+const MaxRateLimitPerSec = 1_000_000
+
+// RateLimit mirrors struct rate_limit in main.bpf.c.
+type RateLimit struct {
+	Rate  uint32
+	Burst uint32
+}
+
+// tokenBucket mirrors struct token_bucket in main.bpf.c.
+type tokenBucket struct {
+	Tokens     uint64
+	LastNs     uint64
+	Suppressed uint64
+}
+
+func NewRateLimit(eventsPerSec, burst int) RateLimit {
+	if eventsPerSec < 0 {
+		eventsPerSec = 0
+	}
+	if eventsPerSec > MaxRateLimitPerSec {
+		eventsPerSec = MaxRateLimitPerSec
+	}
+	if burst < eventsPerSec {
+		burst = eventsPerSec
+	}
+	return RateLimit{Rate: uint32(eventsPerSec), Burst: uint32(burst)}
+}
+
+// SetDefaultRateLimit installs the budget applied to every cgroup without
+// an explicit override. A zero rate disables kernel-side limiting.
+func SetDefaultRateLimit(bpfMap *ebpf.Map, limit RateLimit) error {
+	if bpfMap == nil {
+		return fmt.Errorf("rate_limit_config map is nil")
+	}
+	key := uint32(0)
+	if err := bpfMap.Put(key, limit); err != nil {
+		return fmt.Errorf("set default rate limit: %w", err)
+	}
+	return nil
+}
+
+func SetCgroupRateLimit(bpfMap *ebpf.Map, cgroupID uint64, limit RateLimit) error {
+	if bpfMap == nil {
+		return fmt.Errorf("cgroup_rate_limits map is nil")
+	}
+	if err := bpfMap.Put(cgroupID, limit); err != nil {
+		return fmt.Errorf("set rate limit for cgroup %d: %w", cgroupID, err)
+	}
+	return nil
+}
+
+func ClearCgroupRateLimits(bpfMap *ebpf.Map) error {
+	if bpfMap == nil {
+		return fmt.Errorf("cgroup_rate_limits map is nil")
+	}
+	var key uint64
+	var val RateLimit
+	iter := bpfMap.Iterate()
+	keysToDelete := make([]uint64, 0)
+	for iter.Next(&key, &val) {
+		keysToDelete = append(keysToDelete, key)
+	}
+	for _, k := range keysToDelete {
+		_ = bpfMap.Delete(k)
+	}
+	return nil
+}
+
+// ReadSuppressedCounts returns the number of monitor-only events dropped by
+// the token bucket for each cgroup currently tracked in the kernel.
+func ReadSuppressedCounts(bpfMap *ebpf.Map) (map[uint64]uint64, error) {
+	if bpfMap == nil {
+		return nil, fmt.Errorf("cgroup_buckets map is nil")
+	}
+	counts := make(map[uint64]uint64)
+	var key uint64
+	var val tokenBucket
+	iter := bpfMap.Iterate()
+	for iter.Next(&key, &val) {
+		if val.Suppressed > 0 {
+			counts[key] = val.Suppressed
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return counts, fmt.Errorf("iterate cgroup_buckets: %w", err)
+	}
+	return counts, nil
+}
@@ -1,18 +1,21 @@
 package events
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
 	// Event sizes with new unified header
-	ExecEventSize     = EventHeaderSize + 4 + 4 + TaskCommLen + PathMaxLen + CommandLineLen // 56 + 4 + 4 + 16 + 256 + 512 = 848
-	FileOpenEventSize = EventHeaderSize + 8 + 8 + 4 + 4 + PathMaxLen                        // 56 + 8 + 8 + 4 + 4 + 256 = 336
-	ConnectEventSize  = EventHeaderSize + 4 + 2 + 2 + 16                                    // 56 + 4 + 2 + 2 + 16 = 80
+	ExecEventSize     = EventHeaderSize + 4*4 + TTYNameLen + TaskCommLen + PathMaxLen + CommandLineLen // 64 + 16 + 32 + 16 + 256 + 512 = 896
+	FileOpenEventSize = EventHeaderSize + 8 + 8 + 4 + 4 + PathMaxLen                                   // 64 + 8 + 8 + 4 + 4 + 256 = 344
+	ConnectEventSize  = EventHeaderSize + 4 + 2 + 2 + 16                                               // 64 + 4 + 2 + 2 + 16 = 88
+	TamperEventSize   = EventHeaderSize + 4 + 4 + 8 + 8 + 4 + 4 + PathMaxLen                           // 64 + 4 + 4 + 8 + 8 + 4 + 4 + 256 = 352
 )
 
 // bootTimeOnce ensures bootTime is calculated only once
@@ -41,10 +44,16 @@ func DecodeHeader(data []byte) (EventHeader, error) {
 	offset += 4
 	hdr.GID = binary.LittleEndian.Uint32(data[offset : offset+4])
 	offset += 4
+	hdr.PidNS = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	hdr.NsPID = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	hdr.NsPPID = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
 	hdr.Type = EventType(data[offset])
 	offset += 1
 	hdr.Blocked = data[offset]
-	offset += 7 // skip padding
+	offset += 3 // skip padding
 	copy(hdr.Comm[:], data[offset:offset+TaskCommLen])
 
 	return hdr, nil
@@ -69,7 +78,15 @@ func DecodeExecEvent(data []byte) (ExecEvent, error) {
 
 	// Decode exec-specific fields
 	ev.PPID = binary.LittleEndian.Uint32(data[offset : offset+4])
-	offset += 8 // skip padding
+	offset += 4
+	ev.LoginUID = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	ev.SessionID = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	ev.SessionLeader = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	copy(ev.TTY[:], data[offset:offset+TTYNameLen])
+	offset += TTYNameLen
 	copy(ev.PComm[:], data[offset:offset+TaskCommLen])
 	offset += TaskCommLen
 	copy(ev.Filename[:], data[offset:offset+PathMaxLen])
@@ -139,6 +156,39 @@ func DecodeConnectEvent(data []byte) (ConnectEvent, error) {
 	return ev, nil
 }
 
+// DecodeTamperEvent decodes a self-protection tamper event.
+func DecodeTamperEvent(data []byte) (TamperEvent, error) {
+	if len(data) < TamperEventSize {
+		return TamperEvent{}, fmt.Errorf("tamper event too small: %d bytes, expected %d", len(data), TamperEventSize)
+	}
+
+	var ev TamperEvent
+	offset := 0
+
+	// Decode header
+	hdr, err := DecodeHeader(data[offset:])
+	if err != nil {
+		return TamperEvent{}, fmt.Errorf("decode header: %w", err)
+	}
+	ev.Hdr = hdr
+	offset += EventHeaderSize
+
+	// Decode tamper-specific fields
+	ev.Kind = TamperKind(binary.LittleEndian.Uint32(data[offset : offset+4]))
+	offset += 4
+	ev.TargetPID = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 4
+	ev.Ino = binary.LittleEndian.Uint64(data[offset : offset+8])
+	offset += 8
+	ev.Dev = binary.LittleEndian.Uint64(data[offset : offset+8])
+	offset += 8
+	ev.Signal = binary.LittleEndian.Uint32(data[offset : offset+4])
+	offset += 8 // skip padding
+	copy(ev.Filename[:], data[offset:offset+PathMaxLen])
+
+	return ev, nil
+}
+
 // initBootTime calculates the system boot time by comparing wall-clock time with monotonic time.
 func initBootTime() {
 	bootTimeOnce.Do(func() {
@@ -158,7 +208,23 @@ func initBootTime() {
 	})
 }
 
+// BootTime returns the boot time used to convert kernel timestamps.
+func BootTime() time.Time {
+	initBootTime()
+	return bootTime
+}
+
+// SetBootTime overrides the boot time, e.g. with the capturing host's when
+// replaying a capture. It must be called before events are decoded.
+func SetBootTime(t time.Time) {
+	bootTimeOnce.Do(func() {})
+	bootTime = t
+}
+
 func (h *EventHeader) Timestamp() time.Time {
+	if h.WallTimeNs != 0 {
+		return time.Unix(0, h.WallTimeNs)
+	}
 	initBootTime()
 	// Convert nanoseconds since boot to absolute time
 	// TimestampNs is in nanoseconds since system boot, so we add it to boot time
@@ -177,6 +243,21 @@ func (e *ExecEvent) GetBlocked() uint8 {
 	return e.Hdr.Blocked
 }
 
+// TTYName returns the name of the controlling terminal as it appears under
+// /dev, or "" if there is none. The kernel names pseudo-terminals "pts0";
+// they are returned as "pts/0".
+func (e *ExecEvent) TTYName() string {
+	n := bytes.IndexByte(e.TTY[:], 0)
+	if n < 0 {
+		n = len(e.TTY)
+	}
+	name := string(e.TTY[:n])
+	if num, ok := strings.CutPrefix(name, "pts"); ok && num != "" && strings.Trim(num, "0123456789") == "" {
+		return "pts/" + num
+	}
+	return name
+}
+
 func (e *FileOpenEvent) GetPID() uint32 {
 	return e.Hdr.PID
 }
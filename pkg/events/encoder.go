@@ -0,0 +1,110 @@
+package events
+
+import "encoding/binary"
+
+// The Encode functions produce the same byte layout the BPF program writes
+// to the ring buffer, so synthetic events can be fed through DispatchEvent.
+
+// EncodeHeader writes hdr into the first EventHeaderSize bytes of buf.
+func EncodeHeader(buf []byte, hdr EventHeader) {
+	offset := 0
+	binary.LittleEndian.PutUint64(buf[offset:], hdr.TimestampNs)
+	offset += 8
+	binary.LittleEndian.PutUint64(buf[offset:], hdr.CgroupID)
+	offset += 8
+	binary.LittleEndian.PutUint32(buf[offset:], hdr.PID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], hdr.TID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], hdr.UID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], hdr.GID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], hdr.PidNS)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], hdr.NsPID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], hdr.NsPPID)
+	offset += 4
+	buf[offset] = byte(hdr.Type)
+	offset += 1
+	buf[offset] = hdr.Blocked
+	offset += 3 // skip padding
+	copy(buf[offset:offset+TaskCommLen], hdr.Comm[:])
+}
+
+func EncodeExecEvent(ev ExecEvent) []byte {
+	buf := make([]byte, ExecEventSize)
+	ev.Hdr.Type = EventTypeExec
+	EncodeHeader(buf, ev.Hdr)
+	offset := EventHeaderSize
+
+	binary.LittleEndian.PutUint32(buf[offset:], ev.PPID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], ev.LoginUID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], ev.SessionID)
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], ev.SessionLeader)
+	offset += 4
+	copy(buf[offset:offset+TTYNameLen], ev.TTY[:])
+	offset += TTYNameLen
+	copy(buf[offset:offset+TaskCommLen], ev.PComm[:])
+	offset += TaskCommLen
+	copy(buf[offset:offset+PathMaxLen], ev.Filename[:])
+	offset += PathMaxLen
+	copy(buf[offset:offset+CommandLineLen], ev.CommandLine[:])
+	return buf
+}
+
+func EncodeFileOpenEvent(ev FileOpenEvent) []byte {
+	buf := make([]byte, FileOpenEventSize)
+	ev.Hdr.Type = EventTypeFileOpen
+	EncodeHeader(buf, ev.Hdr)
+	offset := EventHeaderSize
+
+	binary.LittleEndian.PutUint64(buf[offset:], ev.Ino)
+	offset += 8
+	binary.LittleEndian.PutUint64(buf[offset:], ev.Dev)
+	offset += 8
+	binary.LittleEndian.PutUint32(buf[offset:], ev.Flags)
+	offset += 8 // skip padding
+	copy(buf[offset:offset+PathMaxLen], ev.Filename[:])
+	return buf
+}
+
+func EncodeConnectEvent(ev ConnectEvent) []byte {
+	buf := make([]byte, ConnectEventSize)
+	ev.Hdr.Type = EventTypeConnect
+	EncodeHeader(buf, ev.Hdr)
+	offset := EventHeaderSize
+
+	binary.LittleEndian.PutUint32(buf[offset:], ev.AddrV4)
+	offset += 4
+	binary.LittleEndian.PutUint16(buf[offset:], ev.Family)
+	offset += 2
+	binary.LittleEndian.PutUint16(buf[offset:], ev.Port)
+	offset += 2
+	copy(buf[offset:offset+16], ev.AddrV6[:])
+	return buf
+}
+
+func EncodeTamperEvent(ev TamperEvent) []byte {
+	buf := make([]byte, TamperEventSize)
+	ev.Hdr.Type = EventTypeTamper
+	EncodeHeader(buf, ev.Hdr)
+	offset := EventHeaderSize
+
+	binary.LittleEndian.PutUint32(buf[offset:], uint32(ev.Kind))
+	offset += 4
+	binary.LittleEndian.PutUint32(buf[offset:], ev.TargetPID)
+	offset += 4
+	binary.LittleEndian.PutUint64(buf[offset:], ev.Ino)
+	offset += 8
+	binary.LittleEndian.PutUint64(buf[offset:], ev.Dev)
+	offset += 8
+	binary.LittleEndian.PutUint32(buf[offset:], ev.Signal)
+	offset += 8 // skip padding
+	copy(buf[offset:offset+PathMaxLen], ev.Filename[:])
+	return buf
+}
@@ -4,6 +4,7 @@ type EventHandler interface {
 	HandleExec(ev ExecEvent)
 	HandleFileOpen(ev FileOpenEvent, filename string)
 	HandleConnect(ev ConnectEvent)
+	HandleTamper(ev TamperEvent)
 }
 
 type HandlerChain struct {
@@ -35,3 +36,9 @@ func (c *HandlerChain) HandleConnect(ev ConnectEvent) {
 		h.HandleConnect(ev)
 	}
 }
+
+func (c *HandlerChain) HandleTamper(ev TamperEvent) {
+	for _, h := range c.handlers {
+		h.HandleTamper(ev)
+	}
+}
@@ -8,14 +8,27 @@ const (
 	EventTypeExec     EventType = 1
 	EventTypeFileOpen EventType = 2
 	EventTypeConnect  EventType = 3
+	EventTypeTamper   EventType = 4
 
 	// Buffer sizes (must match BPF definitions)
 	TaskCommLen      = 16
 	PathMaxLen       = 256
 	CommandLineLen   = 512 // Full command line (executable + all args)
+	TTYNameLen       = 32
 
-	// EventHeaderSize is the size of the unified event header (56 bytes)
-	EventHeaderSize = 56
+	// EventHeaderSize is the size of the unified event header (64 bytes)
+	EventHeaderSize = 64
+	// EventTypeOffset is where the event type sits in the header, after
+	// timestamp, cgroup_id, pid, tid, uid, gid, pidns, ns_pid and ns_ppid.
+	EventTypeOffset = 44
+
+	// HostPidNS is the inode number of the initial PID namespace
+	// (PROC_PID_INIT_INO), which the kernel fixes.
+	HostPidNS = 0xEFFFFFFC
+
+	// AuditUnset is the login UID and session ID of processes that never
+	// went through a login (AUDIT_UID_UNSET).
+	AuditUnset = 0xFFFFFFFF
 )
 
 type EventHeader struct {
@@ -25,19 +38,38 @@ type EventHeader struct {
 	TID         uint32
 	UID         uint32
 	GID         uint32
+	PidNS       uint32 // inode number of the process's PID namespace
+	NsPID       uint32 // PID inside PidNS
+	NsPPID      uint32 // parent PID inside PidNS, 0 if the parent is outside it
 	Type        EventType
 	Blocked     uint8
-	_           [6]byte // padding
+	_           [2]byte // padding
 	Comm        [TaskCommLen]byte
+
+	// ID is assigned by the agent when the event is dispatched; it is not
+	// part of the kernel layout. IDs increase in arrival order.
+	ID uint64
+
+	// WallTimeNs, when set, is the event time in Unix nanoseconds and takes
+	// precedence over TimestampNs. Events read back from disk may predate
+	// the current boot, which TimestampNs cannot express.
+	WallTimeNs int64
 }
 
 type ExecEvent struct {
-	Hdr         EventHeader
-	PPID        uint32
-	_           [4]byte // padding
-	PComm       [TaskCommLen]byte
-	Filename    [PathMaxLen]byte
-	CommandLine [CommandLineLen]byte
+	Hdr           EventHeader
+	PPID          uint32
+	LoginUID      uint32 // audit login UID, AuditUnset if none
+	SessionID     uint32 // audit session ID, AuditUnset if none
+	SessionLeader uint32 // PID of the session leader
+	TTY           [TTYNameLen]byte
+	PComm         [TaskCommLen]byte
+	Filename      [PathMaxLen]byte
+	CommandLine   [CommandLineLen]byte
+
+	// Filled in by userspace enrichment; not part of the kernel layout.
+	ExeSHA256    string // hex digest of the executed binary, empty if unknown
+	ExeFirstSeen bool   // first execution of this digest on the host
 }
 
 type FileOpenEvent struct {
@@ -57,6 +89,50 @@ type ConnectEvent struct {
 	AddrV6 [16]byte
 }
 
+// TamperKind identifies what a blocked tamper attempt targeted.
+type TamperKind uint32
+
+const (
+	TamperFileWrite    TamperKind = 1
+	TamperFileUnlink   TamperKind = 2
+	TamperFileRename   TamperKind = 3
+	TamperKill         TamperKind = 4
+	TamperFileTruncate TamperKind = 5
+	TamperFileSetattr  TamperKind = 6 // chmod, chown or utimes
+)
+
+func (k TamperKind) String() string {
+	switch k {
+	case TamperFileWrite:
+		return "write"
+	case TamperFileUnlink:
+		return "unlink"
+	case TamperFileRename:
+		return "rename"
+	case TamperKill:
+		return "kill"
+	case TamperFileTruncate:
+		return "truncate"
+	case TamperFileSetattr:
+		return "attribute change"
+	default:
+		return "unknown"
+	}
+}
+
+// TamperEvent reports a denied attempt to modify Aegis' own files or to
+// signal the agent process.
+type TamperEvent struct {
+	Hdr       EventHeader
+	Kind      TamperKind
+	TargetPID uint32
+	Ino       uint64
+	Dev       uint64
+	Signal    uint32
+	_         [4]byte // padding
+	Filename  [PathMaxLen]byte
+}
+
 type Event struct {
 	Type     EventType
 	Exec     *ExecEvent
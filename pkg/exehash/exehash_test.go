@@ -0,0 +1,142 @@
+package exehash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHasherCachesByFileVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHasher(0)
+
+	first, err := h.HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte("v1"))
+	if first.SHA256 != hex.EncodeToString(want[:]) {
+		t.Fatalf("digest = %s", first.SHA256)
+	}
+
+	// Rewriting in place keeps the inode but must not return the old digest.
+	if err := os.WriteFile(path, []byte("version 2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	second, err := h.HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.SHA256 == first.SHA256 || second.Key.Ino != first.Key.Ino {
+		t.Fatalf("rewrite not detected: %+v then %+v", first, second)
+	}
+	if len(h.cache) != 2 {
+		t.Fatalf("cache holds %d entries, want 2", len(h.cache))
+	}
+}
+
+func TestHasherRejectsLargeFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(path, make([]byte, 64), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHasher(16).HashFile(path); err != ErrTooLarge {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestHashProcessChecksExecutableName(t *testing.T) {
+	h := NewHasher(0)
+	self, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	pid := uint32(os.Getpid())
+	res, err := h.HashProcess(pid, "bin/"+filepath.Base(self))
+	if err != nil {
+		t.Fatalf("HashProcess: %v", err)
+	}
+	if res.SHA256 == "" || res.Path == "" {
+		t.Fatalf("result = %+v", res)
+	}
+	if _, err := h.HashProcess(pid, "bin/some-other-binary"); err != ErrExecPending {
+		t.Fatalf("err = %v, want ErrExecPending", err)
+	}
+}
+
+func TestHashPathHashesScriptsAndExitedProcesses(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "deploy.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho hi\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256([]byte("#!/bin/sh\necho hi\n"))
+	h := NewHasher(0)
+
+	// A running process: the path is resolved through its root.
+	res, err := h.HashPath(uint32(os.Getpid()), script, false)
+	if err != nil || res.SHA256 != hex.EncodeToString(want[:]) || res.Path != script {
+		t.Fatalf("running process: %+v, %v", res, err)
+	}
+
+	// An exited process: only read on the host when allowed.
+	const gone = 1 << 30
+	if _, err := h.HashPath(gone, script, false); err == nil {
+		t.Error("exited process hashed without host fallback")
+	}
+	if res, err := h.HashPath(gone, script, true); err != nil || res.SHA256 != hex.EncodeToString(want[:]) {
+		t.Errorf("host fallback: %+v, %v", res, err)
+	}
+	if _, err := h.HashPath(gone, "deploy.sh", true); err == nil {
+		t.Error("relative path of an exited process hashed")
+	}
+}
+
+func TestSeenStorePersistsFirstSeen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.json")
+	now := time.Now()
+
+	s, err := OpenSeenStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Observe("aa", "/usr/bin/a", now) {
+		t.Fatal("first execution not reported as new")
+	}
+	if s.Observe("aa", "/usr/bin/a", now) {
+		t.Fatal("second execution reported as new")
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenSeenStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Observe("aa", "/usr/bin/a", now) {
+		t.Fatal("digest forgotten across restart")
+	}
+	if e, ok := reopened.Get("aa"); !ok || e.Count != 3 || e.Path != "/usr/bin/a" {
+		t.Fatalf("entry = %+v, %v", e, ok)
+	}
+}
+
+func TestSeenStoreLearningPeriod(t *testing.T) {
+	s, err := OpenSeenStore("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Observe("aa", "", time.Now()) {
+		t.Fatal("binary flagged as new during learning period")
+	}
+	if !s.Observe("bb", "", time.Now().Add(2*time.Hour)) {
+		t.Fatal("binary not flagged as new after learning period")
+	}
+}
@@ -0,0 +1,164 @@
+// Package exehash computes SHA-256 digests of executed binaries and keeps
+// track of which digests the host has seen before.
+package exehash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	DefaultMaxFileSize = 256 << 20 // 256MB
+	maxCacheEntries    = 8192
+)
+
+// ErrTooLarge is returned for binaries above the configured size limit.
+var ErrTooLarge = errors.New("executable exceeds hash size limit")
+
+// ErrExecPending is returned when /proc/<pid>/exe does not yet point to the
+// binary named in the exec event. The LSM hook reports an exec before the
+// kernel commits it, and scripts report the script before the interpreter.
+var ErrExecPending = errors.New("process has not switched to the executed binary")
+
+// FileKey identifies one version of a file. A rewrite in place keeps the
+// inode but changes mtime or size, which invalidates the cached digest.
+type FileKey struct {
+	Dev     uint64 // userspace st_dev
+	Ino     uint64
+	MtimeNs int64
+	Size    int64
+}
+
+// Result is the digest of an executable and the file it was read from.
+type Result struct {
+	SHA256 string
+	Path   string
+	Key    FileKey
+}
+
+// Hasher hashes the binaries of running processes, reading each file
+// version only once.
+type Hasher struct {
+	maxSize int64
+	procDir string
+
+	mu    sync.RWMutex
+	cache map[FileKey]string
+}
+
+// NewHasher returns a hasher that skips files larger than maxSize bytes;
+// zero selects DefaultMaxFileSize.
+func NewHasher(maxSize int64) *Hasher {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+	return &Hasher{
+		maxSize: maxSize,
+		procDir: "/proc",
+		cache:   make(map[FileKey]string),
+	}
+}
+
+// HashProcess hashes the executable of pid through /proc/<pid>/exe, which
+// works even when the binary was deleted or lives in another mount
+// namespace. filename is the name reported by the exec event; when set, the
+// executable's base name must match it.
+func (h *Hasher) HashProcess(pid uint32, filename string) (Result, error) {
+	exeLink := filepath.Join(h.procDir, fmt.Sprint(pid), "exe")
+	target, err := os.Readlink(exeLink)
+	if err != nil {
+		return Result{}, err
+	}
+	target = strings.TrimSuffix(target, " (deleted)")
+	if filename != "" && filepath.Base(target) != filepath.Base(filename) {
+		return Result{}, ErrExecPending
+	}
+
+	res, err := h.hashFile(exeLink)
+	res.Path = target
+	return res, err
+}
+
+// HashPath hashes the file an exec event named, for when /proc/<pid>/exe
+// does not lead to it: scripts run an interpreter, and short-lived
+// processes are gone before they are hashed. The path is resolved in pid's
+// root and working directory while it runs; once it has exited, absolute
+// paths are read on the host if hostFallback is set, i.e. when pid shared
+// the host's filesystem view.
+func (h *Hasher) HashPath(pid uint32, filename string, hostFallback bool) (Result, error) {
+	if filename == "" {
+		return Result{}, errors.New("exec event has no filename")
+	}
+	procPath := filepath.Join(h.procDir, fmt.Sprint(pid), "root", filename)
+	if !filepath.IsAbs(filename) {
+		procPath = filepath.Join(h.procDir, fmt.Sprint(pid), "cwd", filename)
+	}
+	res, err := h.hashFile(procPath)
+	if errors.Is(err, os.ErrNotExist) && hostFallback && filepath.IsAbs(filename) {
+		res, err = h.hashFile(filename)
+	}
+	res.Path = filename
+	return res, err
+}
+
+// HashFile hashes the file at path.
+func (h *Hasher) HashFile(path string) (Result, error) {
+	res, err := h.hashFile(path)
+	res.Path = path
+	return res, err
+}
+
+func (h *Hasher) hashFile(path string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Result{}, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Result{}, fmt.Errorf("stat %s: no inode information", path)
+	}
+	key := FileKey{
+		Dev:     uint64(stat.Dev),
+		Ino:     stat.Ino,
+		MtimeNs: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+	}
+
+	h.mu.RLock()
+	sum, ok := h.cache[key]
+	h.mu.RUnlock()
+	if ok {
+		return Result{SHA256: sum, Key: key}, nil
+	}
+
+	if key.Size > h.maxSize {
+		return Result{Key: key}, ErrTooLarge
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return Result{Key: key}, err
+	}
+	sum = hex.EncodeToString(digest.Sum(nil))
+
+	h.mu.Lock()
+	if len(h.cache) >= maxCacheEntries {
+		clear(h.cache)
+	}
+	h.cache[key] = sum
+	h.mu.Unlock()
+	return Result{SHA256: sum, Key: key}, nil
+}
@@ -0,0 +1,54 @@
+package exehash
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"aegis/pkg/events"
+	"aegis/pkg/utils"
+)
+
+// pendingRetries bounds how long enrichment waits for an exec reported by
+// the LSM hook to be committed before giving up on the digest.
+const (
+	pendingRetries = 2
+	pendingBackoff = time.Millisecond
+)
+
+// Reputation hashes exec events and marks binaries new to the host.
+type Reputation struct {
+	Hasher *Hasher
+	Seen   *SeenStore
+}
+
+func NewReputation(hasher *Hasher, seen *SeenStore) *Reputation {
+	return &Reputation{Hasher: hasher, Seen: seen}
+}
+
+// EnrichExec sets ExeSHA256 and ExeFirstSeen. The digest is that of the
+// executed file: the binary, or the script for interpreted programs. Execs
+// the kernel denied never ran, and files that can no longer be read are
+// left without a digest.
+func (r *Reputation) EnrichExec(ev *events.ExecEvent) {
+	if ev.Hdr.Blocked == 1 {
+		return
+	}
+	filename := utils.ExtractCString(ev.Filename[:])
+	res, err := r.Hasher.HashProcess(ev.Hdr.PID, filename)
+	for i := 0; i < pendingRetries && errors.Is(err, ErrExecPending); i++ {
+		time.Sleep(pendingBackoff)
+		res, err = r.Hasher.HashProcess(ev.Hdr.PID, filename)
+	}
+	if errors.Is(err, ErrExecPending) || errors.Is(err, os.ErrNotExist) {
+		res, err = r.Hasher.HashPath(ev.Hdr.PID, filename, ev.Hdr.PidNS == events.HostPidNS)
+	}
+	if err != nil || res.SHA256 == "" {
+		return
+	}
+
+	ev.ExeSHA256 = res.SHA256
+	if r.Seen != nil {
+		ev.ExeFirstSeen = r.Seen.Observe(res.SHA256, res.Path, time.Now())
+	}
+}
@@ -0,0 +1,150 @@
+package exehash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SeenEntry records when a digest first executed on the host.
+type SeenEntry struct {
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Path      string    `json:"path"`
+	Count     uint64    `json:"count"`
+}
+
+type seenFile struct {
+	Created time.Time             `json:"created"`
+	Hashes  map[string]*SeenEntry `json:"hashes"`
+}
+
+// SeenStore is the host's memory of executed binaries. It is kept in memory
+// and written to a JSON file by Flush, so first-seen state survives
+// restarts.
+type SeenStore struct {
+	path     string
+	learning time.Duration
+
+	mu      sync.Mutex
+	created time.Time
+	hashes  map[string]*SeenEntry
+	dirty   bool
+}
+
+// OpenSeenStore loads the store at path, or starts an empty one if the file
+// does not exist. An empty path keeps the store in memory only. Digests
+// first seen within learning of the store's creation are recorded without
+// being reported as new, so a fresh install does not flag every binary.
+func OpenSeenStore(path string, learning time.Duration) (*SeenStore, error) {
+	s := &SeenStore{
+		path:     path,
+		learning: learning,
+		created:  time.Now(),
+		hashes:   make(map[string]*SeenEntry),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		s.dirty = true
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var f seenFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if !f.Created.IsZero() {
+		s.created = f.Created
+	}
+	if f.Hashes != nil {
+		s.hashes = f.Hashes
+	}
+	return s, nil
+}
+
+// Observe records an execution of sum and reports whether it is a binary
+// never seen before on this host, outside the learning period.
+func (s *SeenStore) Observe(sum, path string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.hashes[sum]; ok {
+		e.LastSeen = now
+		e.Count++
+		return false
+	}
+	s.hashes[sum] = &SeenEntry{FirstSeen: now, LastSeen: now, Path: path, Count: 1}
+	s.dirty = true
+	return s.learning <= 0 || now.Sub(s.created) >= s.learning
+}
+
+// Get returns the record for sum.
+func (s *SeenStore) Get(sum string) (SeenEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.hashes[sum]; ok {
+		return *e, true
+	}
+	return SeenEntry{}, false
+}
+
+func (s *SeenStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.hashes)
+}
+
+// Flush writes the store if a new digest was recorded since the last flush.
+// Counts and last-seen times of known digests are only written along with
+// new digests.
+func (s *SeenStore) Flush() error {
+	s.mu.Lock()
+	if s.path == "" || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(seenFile{Created: s.created, Hashes: s.hashes})
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".exe-seen-*")
+	if err != nil {
+		s.markDirty()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	return nil
+}
+
+func (s *SeenStore) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
@@ -0,0 +1,146 @@
+package export
+
+import (
+	"strconv"
+	"time"
+
+	"aegis/pkg/apimodel"
+)
+
+// doc is an ECS document under construction; empty values are left out.
+type doc map[string]any
+
+// set stores v under the dotted ECS field name, creating parent objects.
+func (d doc) set(field string, v any) {
+	switch x := v.(type) {
+	case string:
+		if x == "" {
+			return
+		}
+	case uint32:
+		if x == 0 {
+			return
+		}
+	}
+	m := d
+	start := 0
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+		key := field[start:i]
+		child, ok := m[key].(doc)
+		if !ok {
+			child = doc{}
+			m[key] = child
+		}
+		m, start = child, i+1
+	}
+	m[field[start:]] = v
+}
+
+func newECSDoc(ts time.Time, kind string) doc {
+	d := doc{"@timestamp": ts.UTC().Format(time.RFC3339Nano)}
+	d.set("ecs.version", ecsVersion)
+	d.set("agent.type", "aegis")
+	d.set("event.kind", kind)
+	return d
+}
+
+func setContainer(d doc, c *apimodel.Container) {
+	if c == nil {
+		return
+	}
+	d.set("container.id", c.ID)
+	d.set("container.name", c.Name)
+	d.set("container.image.name", c.Image)
+	d.set("container.runtime", c.Runtime)
+	d.set("orchestrator.resource.id", c.PodUID)
+	d.set("labels.systemd_unit", c.SystemdUnit)
+}
+
+func outcome(blocked bool) string {
+	if blocked {
+		return "failure"
+	}
+	return "success"
+}
+
+func eventECS(r eventRecord, c *apimodel.Container) doc {
+	d := newECSDoc(r.ts, "event")
+	d.set("event.id", strconv.FormatUint(r.id, 10))
+	d.set("event.outcome", outcome(r.blocked))
+
+	var category, action string
+	var types []string
+	switch r.typ {
+	case "exec":
+		category, action, types = "process", "exec", []string{"start"}
+		d.set("process.executable", r.filename)
+		d.set("process.command_line", r.cmdline)
+		d.set("process.parent.pid", r.ppid)
+		d.set("process.parent.name", r.parentComm)
+		d.set("process.hash.sha256", r.sha256)
+	case "file":
+		category, action, types = "file", "open", []string{"access"}
+		d.set("file.path", r.filename)
+	case "connect":
+		category, action, types = "network", "connect", []string{"connection", "start"}
+		d.set("destination.ip", r.dstIP)
+		d.set("destination.port", r.dstPort)
+		switch r.family {
+		case 2:
+			d.set("network.type", "ipv4")
+		case 10:
+			d.set("network.type", "ipv6")
+		}
+	}
+	if r.blocked {
+		types = append(types, "denied")
+	}
+	d.set("event.category", []string{category})
+	d.set("event.type", types)
+	d.set("event.action", action)
+
+	d.set("process.pid", r.pid)
+	d.set("process.name", r.comm)
+	d.set("labels.cgroup_id", strconv.FormatUint(r.cgroupID, 10))
+	setContainer(d, c)
+	return d
+}
+
+// alertSeverity maps rule severities to ECS's numeric event.severity, on
+// the scale Elastic's own detection rules use.
+var alertSeverity = map[string]int{
+	"info":     1,
+	"low":      21,
+	"medium":   47,
+	"warning":  47,
+	"high":     73,
+	"critical": 99,
+}
+
+func alertECS(a apimodel.Alert) doc {
+	d := newECSDoc(time.UnixMilli(a.Timestamp), "alert")
+	d.set("event.id", a.ID)
+	d.set("event.action", a.Action)
+	d.set("event.outcome", outcome(a.Blocked))
+	if n, ok := alertSeverity[a.Severity]; ok {
+		d.set("event.severity", n)
+	}
+	d.set("labels.severity", a.Severity)
+	d.set("message", a.Description)
+	d.set("rule.name", a.RuleName)
+	d.set("rule.description", a.Description)
+
+	d.set("process.pid", a.PID)
+	d.set("process.name", a.ProcessName)
+	d.set("process.parent.name", a.ParentName)
+	d.set("process.hash.sha256", a.ExeSHA256)
+	d.set("labels.cgroup_id", a.CgroupID)
+	if a.EventID != 0 {
+		d.set("labels.event_id", strconv.FormatUint(a.EventID, 10))
+	}
+	setContainer(d, a.Container)
+	return d
+}
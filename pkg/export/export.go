@@ -0,0 +1,271 @@
+// Package export encodes events and alerts for other tools: JSON Lines in
+// the API's own shapes, CSV, or Elastic Common Schema documents (one per
+// line, ready for a bulk or Filebeat ingest).
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"aegis/pkg/apimodel"
+	"aegis/pkg/events"
+	"aegis/pkg/frontend"
+	"aegis/pkg/storage"
+	"aegis/pkg/utils"
+)
+
+// Export formats.
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+	FormatECS   = "ecs"
+)
+
+const ecsVersion = "8.11.0"
+
+// ContentType returns the MIME type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// Extension returns the file name extension of format.
+func Extension(format string) string {
+	switch format {
+	case FormatCSV:
+		return "csv"
+	case FormatECS:
+		return "ecs.ndjson"
+	default:
+		return "jsonl"
+	}
+}
+
+var (
+	eventColumns = []string{
+		"id", "time", "type", "pid", "ppid", "comm", "parent_comm", "cgroup_id",
+		"filename", "command_line", "exe_sha256", "dst_ip", "dst_port", "blocked",
+		"container_id", "container_name", "image",
+	}
+	alertColumns = []string{
+		"id", "time", "severity", "rule", "description", "pid", "process", "parent",
+		"cgroup_id", "action", "blocked", "exe_sha256", "event_id",
+		"container_id", "container_name", "image",
+	}
+)
+
+// Writer encodes a stream of events or alerts. Output is buffered; call
+// Flush after the last record, and periodically to push partial output.
+type Writer struct {
+	format string
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	csv    *csv.Writer
+	count  int
+}
+
+// NewEventWriter returns a writer for events in format.
+func NewEventWriter(w io.Writer, format string) (*Writer, error) {
+	return newWriter(w, format, eventColumns)
+}
+
+// NewAlertWriter returns a writer for alerts in format.
+func NewAlertWriter(w io.Writer, format string) (*Writer, error) {
+	return newWriter(w, format, alertColumns)
+}
+
+func newWriter(w io.Writer, format string, columns []string) (*Writer, error) {
+	x := &Writer{format: format, buf: bufio.NewWriterSize(w, 64<<10)}
+	switch format {
+	case FormatJSONL, FormatECS:
+		x.enc = json.NewEncoder(x.buf)
+	case FormatCSV:
+		x.csv = csv.NewWriter(x.buf)
+		if err := x.csv.Write(columns); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown export format %q (want %s, %s or %s)", format, FormatJSONL, FormatCSV, FormatECS)
+	}
+	return x, nil
+}
+
+// Count returns the number of records written.
+func (x *Writer) Count() int { return x.count }
+
+// Flush writes buffered output.
+func (x *Writer) Flush() error {
+	if x.csv != nil {
+		x.csv.Flush()
+		if err := x.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return x.buf.Flush()
+}
+
+// eventRecord is the flattened form of a stored event.
+type eventRecord struct {
+	id         uint64
+	typ        string
+	ts         time.Time
+	pid, ppid  uint32
+	comm       string
+	parentComm string
+	cgroupID   uint64
+	filename   string
+	cmdline    string
+	sha256     string
+	dstIP      string
+	dstPort    uint16
+	family     uint16
+	blocked    bool
+}
+
+func flatten(ev *storage.Event) (eventRecord, bool) {
+	hdr, ok := ev.Header()
+	if !ok {
+		return eventRecord{}, false
+	}
+	r := eventRecord{
+		id:       ev.ID,
+		ts:       ev.Timestamp,
+		pid:      hdr.PID,
+		comm:     utils.ExtractCString(hdr.Comm[:]),
+		cgroupID: hdr.CgroupID,
+		blocked:  hdr.Blocked == 1,
+	}
+	switch v := ev.TypedData().(type) {
+	case *events.ExecEvent:
+		r.typ = "exec"
+		r.ppid = v.PPID
+		r.parentComm = utils.ExtractCString(v.PComm[:])
+		r.filename = utils.ExtractCString(v.Filename[:])
+		r.cmdline = utils.ExtractCString(v.CommandLine[:])
+		r.sha256 = v.ExeSHA256
+	case *events.FileOpenEvent:
+		r.typ = "file"
+		r.filename = utils.ExtractCString(v.Filename[:])
+	case *events.ConnectEvent:
+		r.typ = "connect"
+		r.dstIP = utils.ExtractIP(v)
+		r.dstPort = v.Port
+		r.family = v.Family
+	default:
+		return eventRecord{}, false
+	}
+	return r, true
+}
+
+// WriteEvent writes one event with the container metadata of its workload,
+// which may be nil. Events of unknown types are skipped.
+func (x *Writer) WriteEvent(ev *storage.Event, c *apimodel.Container) error {
+	r, ok := flatten(ev)
+	if !ok {
+		return nil
+	}
+	var err error
+	switch x.format {
+	case FormatJSONL:
+		err = x.enc.Encode(eventJSON(ev, r, c))
+	case FormatECS:
+		err = x.enc.Encode(eventECS(r, c))
+	case FormatCSV:
+		var port string
+		if r.typ == "connect" {
+			port = strconv.Itoa(int(r.dstPort))
+		}
+		row := []string{
+			strconv.FormatUint(r.id, 10), r.ts.UTC().Format(time.RFC3339Nano), r.typ,
+			strconv.FormatUint(uint64(r.pid), 10), optionalUint(r.ppid), r.comm, r.parentComm,
+			strconv.FormatUint(r.cgroupID, 10), r.filename, r.cmdline, r.sha256,
+			r.dstIP, port, strconv.FormatBool(r.blocked),
+		}
+		err = x.csv.Write(csvRow(append(row, containerColumns(c)...)))
+	}
+	if err == nil {
+		x.count++
+	}
+	return err
+}
+
+// eventJSON returns the event as the API serves it.
+func eventJSON(ev *storage.Event, r eventRecord, c *apimodel.Container) any {
+	switch v := ev.TypedData().(type) {
+	case *events.ExecEvent:
+		fe := frontend.ExecToFrontend(*v)
+		fe.Container = c
+		return fe
+	case *events.FileOpenEvent:
+		fe := frontend.FileToFrontend(*v, r.filename)
+		fe.Container = c
+		return fe
+	case *events.ConnectEvent:
+		fe := frontend.ConnectToFrontend(*v, fmt.Sprintf("%s:%d", r.dstIP, r.dstPort), r.comm)
+		fe.Container = c
+		return fe
+	}
+	return nil
+}
+
+// WriteAlert writes one alert.
+func (x *Writer) WriteAlert(a apimodel.Alert) error {
+	var err error
+	switch x.format {
+	case FormatJSONL:
+		err = x.enc.Encode(a)
+	case FormatECS:
+		err = x.enc.Encode(alertECS(a))
+	case FormatCSV:
+		var eventID string
+		if a.EventID != 0 {
+			eventID = strconv.FormatUint(a.EventID, 10)
+		}
+		row := []string{
+			a.ID, time.UnixMilli(a.Timestamp).UTC().Format(time.RFC3339Nano), a.Severity,
+			a.RuleName, a.Description, strconv.FormatUint(uint64(a.PID), 10), a.ProcessName,
+			a.ParentName, a.CgroupID, a.Action, strconv.FormatBool(a.Blocked), a.ExeSHA256, eventID,
+		}
+		err = x.csv.Write(csvRow(append(row, containerColumns(a.Container)...)))
+	}
+	if err == nil {
+		x.count++
+	}
+	return err
+}
+
+// csvRow prefixes cells a spreadsheet would read as a formula with a
+// quote, so a command line or file name cannot run one when the export is
+// opened. No numeric column can start with these characters.
+func csvRow(row []string) []string {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
+
+func optionalUint(v uint32) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+func containerColumns(c *apimodel.Container) []string {
+	if c == nil {
+		return []string{"", "", ""}
+	}
+	return []string{c.ID, c.Name, c.Image}
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"aegis/pkg/apimodel"
+	"aegis/pkg/events"
+	"aegis/pkg/storage"
+)
+
+func connectEvent() *storage.Event {
+	ev := events.ConnectEvent{Family: 2, Port: 4444, AddrV4: 0x0100000a} // 10.0.0.1
+	ev.Hdr.PID = 42
+	ev.Hdr.Blocked = 1
+	copy(ev.Hdr.Comm[:], "nc")
+	return storage.EventFromBackend(7, events.EventTypeConnect, time.Unix(1700000000, 0), ev)
+}
+
+func TestEventCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewEventWriter(&buf, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteEvent(connectEvent(), &apimodel.Container{ID: "abc", Image: "alpine"})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || len(rows[1]) != len(eventColumns) {
+		t.Fatalf("rows = %v", rows)
+	}
+	got := make(map[string]string)
+	for i, col := range rows[0] {
+		got[col] = rows[1][i]
+	}
+	if got["dst_ip"] != "10.0.0.1" || got["dst_port"] != "4444" || got["comm"] != "nc" ||
+		got["blocked"] != "true" || got["image"] != "alpine" || got["ppid"] != "" {
+		t.Fatalf("row = %v", got)
+	}
+}
+
+func TestAlertCSVNeutralizesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewAlertWriter(&buf, FormatCSV)
+	w.WriteAlert(apimodel.Alert{
+		ID: "a1", RuleName: "=HYPERLINK(\"http://x\")", Description: "-1+2",
+		ProcessName: "@sum", ParentName: "\tbash", CgroupID: "\r1", Action: "+a", Severity: "high",
+	})
+	w.Flush()
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("rows = %v, %v", rows, err)
+	}
+	got := make(map[string]string)
+	for i, col := range rows[0] {
+		got[col] = rows[1][i]
+	}
+	want := map[string]string{
+		"rule": "'=HYPERLINK(\"http://x\")", "description": "'-1+2", "process": "'@sum",
+		"parent": "'\tbash", "cgroup_id": "'\r1", "action": "'+a", "severity": "high", "id": "a1",
+	}
+	for col, v := range want {
+		if got[col] != v {
+			t.Errorf("%s = %q, want %q", col, got[col], v)
+		}
+	}
+}
+
+func TestEventECS(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewEventWriter(&buf, FormatECS)
+	w.WriteEvent(connectEvent(), nil)
+	w.Flush()
+
+	var d struct {
+		Timestamp string `json:"@timestamp"`
+		Event     struct {
+			Category []string `json:"category"`
+			Type     []string `json:"type"`
+			Outcome  string   `json:"outcome"`
+		} `json:"event"`
+		Destination struct {
+			IP   string `json:"ip"`
+			Port int    `json:"port"`
+		} `json:"destination"`
+		Process struct {
+			PID  int    `json:"pid"`
+			Name string `json:"name"`
+		} `json:"process"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Timestamp != "2023-11-14T22:13:20Z" || d.Event.Category[0] != "network" || d.Event.Outcome != "failure" ||
+		d.Event.Type[len(d.Event.Type)-1] != "denied" || d.Destination.IP != "10.0.0.1" ||
+		d.Destination.Port != 4444 || d.Process.PID != 42 || d.Process.Name != "nc" {
+		t.Fatalf("document = %s", buf.String())
+	}
+}
+
+func TestAlertJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewAlertWriter(&buf, FormatJSONL)
+	w.WriteAlert(apimodel.Alert{ID: "a1", RuleName: "Reverse Shell", Severity: "high"})
+	w.WriteAlert(apimodel.Alert{ID: "a2", RuleName: "Reverse Shell", Severity: "high"})
+	w.Flush()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || w.Count() != 2 || !strings.Contains(lines[1], `"ruleName":"Reverse Shell"`) {
+		t.Fatalf("output = %q", buf.String())
+	}
+
+	if _, err := NewAlertWriter(&buf, "xml"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"aegis/pkg/apimodel"
 	"aegis/pkg/events"
+	"aegis/pkg/session"
 	"aegis/pkg/utils"
 )
 
@@ -18,7 +19,8 @@ func ExecToFrontend(ev events.ExecEvent) apimodel.ExecEvent {
 		commandLine = utils.ExtractCString(ev.Hdr.Comm[:])
 	}
 
-	return apimodel.ExecEvent{
+	out := apimodel.ExecEvent{
+		ID:          ev.Hdr.ID,
 		Type:        "exec",
 		Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 		PID:         ev.Hdr.PID,
@@ -28,12 +30,23 @@ func ExecToFrontend(ev events.ExecEvent) apimodel.ExecEvent {
 		ParentComm:  utils.ExtractCString(ev.PComm[:]),
 		CommandLine: commandLine,
 		Blocked:     ev.Hdr.Blocked == 1,
+
+		ExeSHA256:    ev.ExeSHA256,
+		ExeFirstSeen: ev.ExeFirstSeen,
+		TTY:          ev.TTYName(),
+	}
+	if ev.LoginUID != events.AuditUnset {
+		uid := ev.LoginUID
+		out.LoginUID = &uid
 	}
+	out.SessionID, _ = session.IDFor(&ev)
+	return out
 }
 
 
 func FileToFrontend(ev events.FileOpenEvent, filename string) apimodel.FileEvent {
 	return apimodel.FileEvent{
+		ID:        ev.Hdr.ID,
 		Type:      "file",
 		Timestamp: ev.Hdr.Timestamp().UnixMilli(),
 		PID:       ev.Hdr.PID,
@@ -49,6 +62,7 @@ func FileToFrontend(ev events.FileOpenEvent, filename string) apimodel.FileEvent
 
 func ConnectToFrontend(ev events.ConnectEvent, addr string, processName string) apimodel.ConnectEvent {
 	return apimodel.ConnectEvent{
+		ID:          ev.Hdr.ID,
 		Type:        "connect",
 		Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 		PID:         ev.Hdr.PID,
@@ -0,0 +1,392 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tier is one resolution of a Rollup: values are summed into buckets of
+// Step and kept for Retention.
+type Tier struct {
+	Step      time.Duration
+	Retention time.Duration
+	Persist   bool // written by Save
+	Dynamic   bool // holds per-workload and per-rule series
+}
+
+// DefaultTiers keep one-second points for an hour, one-minute points for a
+// day and one-hour points for thirty days. Per-workload and per-rule series
+// are only kept at minute and hour resolution.
+var DefaultTiers = []Tier{
+	{Step: time.Second, Retention: time.Hour},
+	{Step: time.Minute, Retention: 24 * time.Hour, Persist: true, Dynamic: true},
+	{Step: time.Hour, Retention: 30 * 24 * time.Hour, Persist: true, Dynamic: true},
+}
+
+const (
+	// MaxDynamicSeries bounds the workload.* and rule.* series each. Further
+	// workloads or rules are counted under workload.other and rule.other.
+	MaxDynamicSeries = 256
+
+	maxHistoryPoints = 10000
+)
+
+// Metric name prefixes of per-workload and per-rule series.
+const (
+	WorkloadPrefix = "workload."
+	RulePrefix     = "rule."
+)
+
+// Point is the sum of a metric over [Time, Time+Step).
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// slot holds one bucket; idx is the bucket number (Unix time / step) so
+// stale slots from a previous lap of the ring read as empty.
+type slot struct {
+	idx int64
+	v   float64
+}
+
+type tierData struct {
+	Tier
+	size   int
+	series map[string][]slot
+}
+
+// Rollup keeps time series of counters at several resolutions with bounded
+// retention. Values are added with Add, or accumulated with Incr and
+// committed once per second by Flush.
+type Rollup struct {
+	path string
+
+	mu      sync.Mutex
+	tiers   []*tierData
+	pending map[string]float64
+	dynamic map[string]int // series per dynamic prefix
+	pruned  time.Time
+}
+
+// NewRollup returns an in-memory rollup with the given tiers, finest first.
+func NewRollup(tiers []Tier) *Rollup {
+	r := &Rollup{
+		pending: make(map[string]float64),
+		dynamic: make(map[string]int),
+	}
+	for _, t := range tiers {
+		r.tiers = append(r.tiers, &tierData{
+			Tier:   t,
+			size:   int(t.Retention / t.Step),
+			series: make(map[string][]slot),
+		})
+	}
+	return r
+}
+
+// OpenRollup returns a rollup with DefaultTiers that Save writes to path,
+// loading the persisted tiers if the file exists.
+func OpenRollup(path string) (*Rollup, error) {
+	r := NewRollup(DefaultTiers)
+	r.path = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var f rollupFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, saved := range f.Tiers {
+		for _, t := range r.tiers {
+			if t.Step != time.Duration(saved.StepMs)*time.Millisecond {
+				continue
+			}
+			for name, points := range saved.Series {
+				name = r.admitLocked(name)
+				for _, p := range points {
+					r.addLocked(t, name, int64(p[0]), p[1])
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+type rollupFile struct {
+	Tiers []savedTier `json:"tiers"`
+}
+
+type savedTier struct {
+	StepMs int64                   `json:"stepMs"`
+	Series map[string][][2]float64 `json:"series"` // [bucket index, value]
+}
+
+// Save writes the persisted tiers. It is a no-op for in-memory rollups.
+func (r *Rollup) Save() error {
+	if r.path == "" {
+		return nil
+	}
+	r.mu.Lock()
+	var f rollupFile
+	for _, t := range r.tiers {
+		if !t.Persist {
+			continue
+		}
+		st := savedTier{StepMs: t.Step.Milliseconds(), Series: make(map[string][][2]float64)}
+		for name, slots := range t.series {
+			var points [][2]float64
+			for _, s := range slots {
+				if s.v != 0 {
+					points = append(points, [2]float64{float64(s.idx), s.v})
+				}
+			}
+			if len(points) > 0 {
+				st.Series[name] = points
+			}
+		}
+		f.Tiers = append(f.Tiers, st)
+	}
+	r.mu.Unlock()
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".stats-history-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Add adds v to metric at t in every tier.
+func (r *Rollup) Add(metric string, t time.Time, v float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metric = r.admitLocked(metric)
+	for _, td := range r.tiers {
+		r.addLocked(td, metric, t.UnixNano()/int64(td.Step), v)
+	}
+}
+
+// Incr counts one occurrence of metric in the current second.
+func (r *Rollup) Incr(metric string) {
+	r.mu.Lock()
+	r.pending[metric]++
+	r.mu.Unlock()
+}
+
+// Flush adds the counts accumulated by Incr at t.
+func (r *Rollup) Flush(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for metric, v := range r.pending {
+		name := r.admitLocked(metric)
+		for _, td := range r.tiers {
+			r.addLocked(td, name, t.UnixNano()/int64(td.Step), v)
+		}
+	}
+	clear(r.pending)
+
+	if t.Sub(r.pruned) >= time.Hour {
+		r.pruneLocked(t)
+		r.pruned = t
+	}
+}
+
+// pruneLocked drops series with no data left in any tier, so workloads and
+// rules that went away free their slots under MaxDynamicSeries.
+func (r *Rollup) pruneLocked(now time.Time) {
+	live := make(map[string]bool)
+	for _, td := range r.tiers {
+		oldest := now.Add(-td.Retention).UnixNano() / int64(td.Step)
+		for name, slots := range td.series {
+			empty := true
+			for _, s := range slots {
+				if s.idx > oldest && s.v != 0 {
+					empty = false
+					break
+				}
+			}
+			if empty {
+				delete(td.series, name)
+			} else {
+				live[name] = true
+			}
+		}
+	}
+	clear(r.dynamic)
+	for name := range live {
+		if p := dynamicPrefix(name); p != "" {
+			r.dynamic[p]++
+		}
+	}
+}
+
+// admitLocked maps a dynamic metric beyond MaxDynamicSeries to its prefix's
+// "other" series.
+func (r *Rollup) admitLocked(metric string) string {
+	prefix := dynamicPrefix(metric)
+	if prefix == "" {
+		return metric
+	}
+	for _, td := range r.tiers {
+		if td.Dynamic {
+			if _, ok := td.series[metric]; ok {
+				return metric
+			}
+			break
+		}
+	}
+	if r.dynamic[prefix] >= MaxDynamicSeries {
+		return prefix + "other"
+	}
+	r.dynamic[prefix]++
+	return metric
+}
+
+func dynamicPrefix(metric string) string {
+	for _, p := range []string{WorkloadPrefix, RulePrefix} {
+		if strings.HasPrefix(metric, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+func (r *Rollup) addLocked(td *tierData, metric string, idx int64, v float64) {
+	if dynamicPrefix(metric) != "" && !td.Dynamic {
+		return
+	}
+	slots, ok := td.series[metric]
+	if !ok {
+		slots = make([]slot, td.size)
+		td.series[metric] = slots
+	}
+	s := &slots[idx%int64(td.size)]
+	if s.idx != idx {
+		if s.idx > idx {
+			return // older than the retained window
+		}
+		*s = slot{idx: idx}
+	}
+	s.v += v
+}
+
+// Metrics returns the names of all series, sorted.
+func (r *Rollup) Metrics() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, td := range r.tiers {
+		for name := range td.series {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Query returns metric over [from, to] in buckets of step, which must be a
+// multiple of a tier's step; the coarsest such tier retaining from answers.
+// A zero step selects the finest tier retaining from that yields at most
+// autoStepPoints buckets. Buckets without data are zero.
+func (r *Rollup) Query(metric string, from, to time.Time, step time.Duration) ([]Point, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !to.After(from) {
+		return nil, 0, fmt.Errorf("empty time range")
+	}
+	td := r.pickTier(metric, from, to, step)
+	if td == nil {
+		return nil, 0, fmt.Errorf("step %s is not a multiple of any resolution of %s", step, metric)
+	}
+	if step == 0 {
+		step = td.Step
+	}
+	if n := to.Sub(from) / step; n > maxHistoryPoints {
+		return nil, 0, fmt.Errorf("query would return %d points, more than %d; use a larger step", n, maxHistoryPoints)
+	}
+
+	slots := td.series[metric]
+	per := int64(step / td.Step)
+	first := from.UnixNano() / int64(step) * per
+	last := to.UnixNano() / int64(td.Step)
+	var points []Point
+	for idx := first; idx <= last; idx += per {
+		p := Point{Time: time.Unix(0, idx*int64(td.Step))}
+		for i := idx; i < idx+per && i <= last && slots != nil; i++ {
+			if s := slots[i%int64(td.size)]; s.idx == i {
+				p.Value += s.v
+			}
+		}
+		points = append(points, p)
+	}
+	return points, step, nil
+}
+
+const autoStepPoints = 1000
+
+func (r *Rollup) pickTier(metric string, from, to time.Time, step time.Duration) *tierData {
+	dynamic := dynamicPrefix(metric) != ""
+	retains := func(td *tierData) bool { return time.Since(from) <= td.Retention }
+
+	var candidates []*tierData
+	for _, td := range r.tiers {
+		if dynamic && !td.Dynamic {
+			continue
+		}
+		if step != 0 && (step < td.Step || step%td.Step != 0) {
+			continue
+		}
+		candidates = append(candidates, td)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if step == 0 {
+		for _, td := range candidates {
+			if retains(td) && to.Sub(from)/td.Step <= autoStepPoints {
+				return td
+			}
+		}
+	} else {
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if retains(candidates[i]) {
+				return candidates[i]
+			}
+		}
+	}
+	return candidates[len(candidates)-1]
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRollupQuery(t *testing.T) {
+	r := NewRollup(DefaultTiers)
+	now := time.Now().Truncate(time.Minute)
+	for i := 0; i < 120; i++ {
+		r.Add("rate.exec", now.Add(time.Duration(i)*time.Second), 2)
+	}
+
+	points, step, err := r.Query("rate.exec", now, now.Add(2*time.Minute-time.Second), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step != time.Minute || len(points) != 2 || points[0].Value != 120 || points[1].Value != 120 {
+		t.Fatalf("minute points = %+v (step %s)", points, step)
+	}
+
+	points, step, _ = r.Query("rate.exec", now, now.Add(10*time.Second), 0)
+	if step != time.Second || len(points) != 11 || points[3].Value != 2 {
+		t.Fatalf("second points = %+v (step %s)", points, step)
+	}
+
+	if _, _, err := r.Query("rate.exec", now, now.Add(time.Minute), 1500*time.Millisecond); err == nil {
+		t.Fatal("step that is not a multiple of a tier accepted")
+	}
+}
+
+func TestRollupBoundsDynamicSeries(t *testing.T) {
+	r := NewRollup(DefaultTiers)
+	now := time.Now()
+	for i := 0; i < MaxDynamicSeries+5; i++ {
+		r.Incr(fmt.Sprintf("%s%d", WorkloadPrefix, i))
+	}
+	r.Flush(now)
+
+	points, _, _ := r.Query(WorkloadPrefix+"other", now.Add(-time.Minute), now, time.Minute)
+	var other float64
+	for _, p := range points {
+		other += p.Value
+	}
+	if other != 5 {
+		t.Fatalf("workload.other = %v, want 5", other)
+	}
+	if points, _, _ := r.Query(WorkloadPrefix+"0", now.Add(-time.Second), now, time.Second); len(points) != 0 && points[len(points)-1].Value != 0 {
+		t.Fatal("per-workload series kept at one-second resolution")
+	}
+}
+
+func TestRollupPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	r, err := OpenRollup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.Add("alerts.critical", now, 3)
+	r.Add(RulePrefix+"Reverse Shell", now, 1)
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = OpenRollup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, _, _ := r.Query("alerts.critical", now.Add(-time.Minute), now, time.Minute)
+	if len(points) == 0 || points[len(points)-1].Value != 3 {
+		t.Fatalf("reloaded points = %+v", points)
+	}
+	if got := r.Metrics(); len(got) != 2 {
+		t.Fatalf("metrics = %v", got)
+	}
+}
@@ -0,0 +1,525 @@
+package proc
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxBaselines bounds the number of programs learned; the least
+	// recently seen baseline makes room for a new program.
+	maxBaselines = 10000
+	// maxBaselineValues bounds each learned set. A set that fills up while
+	// learning is too varied to be useful and is not checked.
+	maxBaselineValues = 256
+)
+
+// BaselineKey identifies the program a baseline describes: an executable
+// path, or the comm when the process' exec was not seen, in one cgroup.
+type BaselineKey struct {
+	Exe      string `json:"exe"`
+	CgroupID uint64 `json:"cgroupId"`
+}
+
+func (k BaselineKey) String() string {
+	return k.Exe + "@" + strconv.FormatUint(k.CgroupID, 10)
+}
+
+// BehaviorKind names one dimension of a baseline.
+type BehaviorKind string
+
+const (
+	BehaviorChild       BehaviorKind = "child"
+	BehaviorFile        BehaviorKind = "file"
+	BehaviorPort        BehaviorKind = "port"
+	BehaviorDestination BehaviorKind = "destination"
+)
+
+// Deviation is behaviour of a program outside its learned baseline.
+type Deviation struct {
+	Key   BaselineKey
+	PID   uint32
+	Kind  BehaviorKind
+	Value string
+	Time  time.Time
+}
+
+// rateCounter counts one activity per minute.
+type rateCounter struct {
+	Total   uint64 `json:"total"`
+	Peak    uint64 `json:"peak"`
+	current uint64
+}
+
+// Baseline is the learned behaviour of one program. Sets hold how often
+// each value was seen.
+type Baseline struct {
+	Key          BaselineKey       `json:"key"`
+	Started      time.Time         `json:"started"`
+	LastSeen     time.Time         `json:"lastSeen"`
+	Minutes      uint64            `json:"minutes"` // active minutes counted into the rates
+	Children     map[string]uint64 `json:"children"`
+	FilePrefixes map[string]uint64 `json:"filePrefixes"`
+	Ports        map[string]uint64 `json:"ports"`
+	Destinations map[string]uint64 `json:"destinations"`
+	Exec         rateCounter       `json:"exec"`
+	File         rateCounter       `json:"file"`
+	Connect      rateCounter       `json:"connect"`
+
+	minute time.Time // start of the minute being counted
+}
+
+func newBaseline(key BaselineKey, now time.Time) *Baseline {
+	return &Baseline{
+		Key:          key,
+		Started:      now,
+		LastSeen:     now,
+		Children:     make(map[string]uint64),
+		FilePrefixes: make(map[string]uint64),
+		Ports:        make(map[string]uint64),
+		Destinations: make(map[string]uint64),
+	}
+}
+
+// BaselineSummary is a copy of a baseline for display.
+type BaselineSummary struct {
+	Key          BaselineKey
+	Learning     bool
+	Started      time.Time
+	LastSeen     time.Time
+	Children     []string
+	FilePrefixes []string
+	Ports        []string
+	Destinations []string
+	ExecRate     float64 // mean per active minute
+	FileRate     float64
+	ConnectRate  float64
+	ExecPeak     uint64 // highest count in one minute
+	FilePeak     uint64
+	ConnectPeak  uint64
+}
+
+type baselineFile struct {
+	Baselines []*Baseline `json:"baselines"`
+}
+
+// BaselineStore learns how each program behaves and reports behaviour it
+// has not seen before. A program's baseline is built during the learning
+// window after it is first seen; afterwards new child processes, file
+// prefixes, ports and destinations are reported once, and are then part of
+// the baseline. Rates are learned for reference; unusual rates are the
+// anomaly detector's concern. Baselines are kept in memory and written to a
+// JSON file by Flush; those of programs no longer seen are dropped by
+// Expire or to make room for new ones.
+type BaselineStore struct {
+	path   string
+	window time.Duration
+
+	mu        sync.Mutex
+	baselines map[BaselineKey]*Baseline
+	lru       *list.List // keys, most recently seen first
+	lruIndex  map[BaselineKey]*list.Element
+	dirty     bool
+}
+
+// OpenBaselineStore loads the store at path, or starts an empty one if the
+// file does not exist. An empty path keeps baselines in memory only.
+func OpenBaselineStore(path string, window time.Duration) (*BaselineStore, error) {
+	s := &BaselineStore{
+		path:      path,
+		window:    window,
+		baselines: make(map[BaselineKey]*Baseline),
+		lru:       list.New(),
+		lruIndex:  make(map[BaselineKey]*list.Element),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var f baselineFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	loaded := f.Baselines[:0]
+	for _, b := range f.Baselines {
+		if b != nil {
+			loaded = append(loaded, b)
+		}
+	}
+	// Oldest first, so the most recently seen end up at the front.
+	sort.SliceStable(loaded, func(i, j int) bool { return loaded[i].LastSeen.Before(loaded[j].LastSeen) })
+	for _, b := range loaded {
+		for _, m := range []*map[string]uint64{&b.Children, &b.FilePrefixes, &b.Ports, &b.Destinations} {
+			if *m == nil {
+				*m = make(map[string]uint64)
+			}
+		}
+		if _, dup := s.baselines[b.Key]; dup {
+			s.remove(b.Key)
+		}
+		if len(s.baselines) >= maxBaselines {
+			s.evictOldest()
+		}
+		s.add(b)
+	}
+	return s, nil
+}
+
+func (s *BaselineStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.baselines)
+}
+
+// learning reports whether b is still within its learning window.
+func (s *BaselineStore) learning(b *Baseline, now time.Time) bool {
+	return now.Sub(b.Started) < s.window
+}
+
+// get returns the baseline of key, creating it and evicting the least
+// recently seen baseline if the store is full.
+func (s *BaselineStore) get(key BaselineKey, now time.Time) *Baseline {
+	b, ok := s.baselines[key]
+	if ok {
+		s.lru.MoveToFront(s.lruIndex[key])
+	} else {
+		if len(s.baselines) >= maxBaselines {
+			s.evictOldest()
+		}
+		b = newBaseline(key, now)
+		s.add(b)
+		s.dirty = true
+	}
+	b.LastSeen = now
+	return b
+}
+
+// add makes b the most recently seen baseline.
+func (s *BaselineStore) add(b *Baseline) {
+	s.baselines[b.Key] = b
+	s.lruIndex[b.Key] = s.lru.PushFront(b.Key)
+}
+
+func (s *BaselineStore) remove(key BaselineKey) {
+	if elem, ok := s.lruIndex[key]; ok {
+		s.lru.Remove(elem)
+		delete(s.lruIndex, key)
+	}
+	delete(s.baselines, key)
+}
+
+func (s *BaselineStore) evictOldest() {
+	if elem := s.lru.Back(); elem != nil {
+		s.remove(elem.Value.(BaselineKey))
+		s.dirty = true
+	}
+}
+
+// Expire drops the baselines of programs last seen before before, such as
+// those of containers that are gone. It returns how many were removed.
+func (s *BaselineStore) Expire(before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for elem := s.lru.Back(); elem != nil; elem = s.lru.Back() {
+		key := elem.Value.(BaselineKey)
+		if !s.baselines[key].LastSeen.Before(before) {
+			break
+		}
+		s.remove(key)
+		n++
+	}
+	if n > 0 {
+		s.dirty = true
+	}
+	return n
+}
+
+// behavior is one observed value of a baseline dimension.
+type behavior struct {
+	kind  BehaviorKind
+	value string
+}
+
+// ObserveExec records that a process of key started a child running exe.
+func (s *BaselineStore) ObserveExec(key BaselineKey, pid uint32, exe string, now time.Time) []Deviation {
+	return s.observe(key, pid, now, BehaviorChild, behavior{BehaviorChild, exe})
+}
+
+// ObserveFile records a file opened by a process of key.
+func (s *BaselineStore) ObserveFile(key BaselineKey, pid uint32, path string, now time.Time) []Deviation {
+	return s.observe(key, pid, now, BehaviorFile, behavior{BehaviorFile, FilePrefix(path)})
+}
+
+// ObserveConnect records a connection by a process of key.
+func (s *BaselineStore) ObserveConnect(key BaselineKey, pid uint32, ip string, port uint16, now time.Time) []Deviation {
+	return s.observe(key, pid, now, BehaviorPort,
+		behavior{BehaviorPort, strconv.Itoa(int(port))}, behavior{BehaviorDestination, ip})
+}
+
+// observe counts one event towards the rate of kind and records the
+// values seen with it.
+func (s *BaselineStore) observe(key BaselineKey, pid uint32, now time.Time, kind BehaviorKind, seen ...behavior) []Deviation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.get(key, now)
+	if b == nil {
+		return nil
+	}
+	s.countRate(b, kind, now)
+
+	var devs []Deviation
+	for _, v := range seen {
+		if v.value == "" {
+			continue
+		}
+		if d, ok := s.addValue(b, v.kind, v.value, now); ok {
+			devs = append(devs, d)
+		}
+	}
+	for i := range devs {
+		devs[i].PID = pid
+	}
+	return devs
+}
+
+// addValue records value in b's set for kind and reports it if it is new
+// behaviour.
+func (s *BaselineStore) addValue(b *Baseline, kind BehaviorKind, value string, now time.Time) (Deviation, bool) {
+	var set map[string]uint64
+	switch kind {
+	case BehaviorChild:
+		set = b.Children
+	case BehaviorFile:
+		set = b.FilePrefixes
+	case BehaviorPort:
+		set = b.Ports
+	case BehaviorDestination:
+		set = b.Destinations
+	default:
+		return Deviation{}, false
+	}
+
+	if _, ok := set[value]; ok {
+		set[value]++
+		return Deviation{}, false
+	}
+	if len(set) >= maxBaselineValues {
+		return Deviation{}, false
+	}
+	set[value] = 1
+	s.dirty = true
+	if s.learning(b, now) {
+		return Deviation{}, false
+	}
+	return Deviation{Key: b.Key, Kind: kind, Value: value, Time: now}, true
+}
+
+// countRate counts one event of kind in the current minute. Minutes that
+// end during learning raise the learned rates.
+func (s *BaselineStore) countRate(b *Baseline, kind BehaviorKind, now time.Time) {
+	minute := now.Truncate(time.Minute)
+	if !minute.Equal(b.minute) {
+		if !b.minute.IsZero() && s.learning(b, b.minute) {
+			b.Minutes++
+			for _, c := range []*rateCounter{&b.Exec, &b.File, &b.Connect} {
+				c.Total += c.current
+				c.Peak = max(c.Peak, c.current)
+			}
+			s.dirty = true
+		}
+		for _, c := range []*rateCounter{&b.Exec, &b.File, &b.Connect} {
+			c.current = 0
+		}
+		b.minute = minute
+	}
+
+	switch kind {
+	case BehaviorChild:
+		b.Exec.current++
+	case BehaviorFile:
+		b.File.current++
+	case BehaviorPort:
+		b.Connect.current++
+	}
+}
+
+// Profile returns the learned rates and sets of key in the form used for
+// anomaly checks, or nil while the baseline is still learning.
+func (s *BaselineStore) Profile(key BaselineKey, now time.Time) *BaselineProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.baselines[key]
+	if !ok || s.learning(b, now) || b.Minutes == 0 {
+		return nil
+	}
+	p := &BaselineProfile{
+		NormalFileRate:     float64(b.File.Total) / float64(b.Minutes),
+		NormalNetRate:      float64(b.Connect.Total) / float64(b.Minutes),
+		NormalExecRate:     float64(b.Exec.Total) / float64(b.Minutes),
+		CommonFilePatterns: sortedKeys(b.FilePrefixes),
+	}
+	for _, port := range sortedKeys(b.Ports) {
+		if n, err := strconv.ParseUint(port, 10, 16); err == nil {
+			p.CommonNetPorts = append(p.CommonNetPorts, uint16(n))
+		}
+	}
+	return p
+}
+
+// List returns the baselines of a cgroup, or of every cgroup when
+// cgroupID is 0, ordered by executable.
+func (s *BaselineStore) List(cgroupID uint64, now time.Time) []BaselineSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]BaselineSummary, 0)
+	for key, b := range s.baselines {
+		if cgroupID != 0 && key.CgroupID != cgroupID {
+			continue
+		}
+		sum := BaselineSummary{
+			Key:          key,
+			Learning:     s.learning(b, now),
+			Started:      b.Started,
+			LastSeen:     b.LastSeen,
+			Children:     sortedKeys(b.Children),
+			FilePrefixes: sortedKeys(b.FilePrefixes),
+			Ports:        sortedKeys(b.Ports),
+			Destinations: sortedKeys(b.Destinations),
+			ExecPeak:     b.Exec.Peak,
+			FilePeak:     b.File.Peak,
+			ConnectPeak:  b.Connect.Peak,
+		}
+		if b.Minutes > 0 {
+			sum.ExecRate = float64(b.Exec.Total) / float64(b.Minutes)
+			sum.FileRate = float64(b.File.Total) / float64(b.Minutes)
+			sum.ConnectRate = float64(b.Connect.Total) / float64(b.Minutes)
+		}
+		out = append(out, sum)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Key.Exe != out[j].Key.Exe {
+			return out[i].Key.Exe < out[j].Key.Exe
+		}
+		return out[i].Key.CgroupID < out[j].Key.CgroupID
+	})
+	return out
+}
+
+// Reset forgets the baselines of a cgroup so its programs learn again. It
+// returns how many were removed.
+func (s *BaselineStore) Reset(cgroupID uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key := range s.baselines {
+		if key.CgroupID == cgroupID {
+			s.remove(key)
+			n++
+		}
+	}
+	if n > 0 {
+		s.dirty = true
+	}
+	return n
+}
+
+// Flush writes the store if a baseline changed since the last flush.
+func (s *BaselineStore) Flush() error {
+	s.mu.Lock()
+	if s.path == "" || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	f := baselineFile{Baselines: make([]*Baseline, 0, len(s.baselines))}
+	for _, b := range s.baselines {
+		f.Baselines = append(f.Baselines, b)
+	}
+	data, err := json.Marshal(f)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".baselines-*")
+	if err != nil {
+		s.markDirty()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	return nil
+}
+
+func (s *BaselineStore) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+// FilePrefix reduces a path to its first two directories, with numeric
+// components such as PIDs replaced by "*": /proc/4242/status becomes
+// /proc/*. Relative paths have the prefix ".".
+func FilePrefix(path string) string {
+	if path == "" {
+		return ""
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "."
+	}
+	dir := filepath.Dir(filepath.Clean(path))
+	if dir == "/" {
+		return "/"
+	}
+	parts := strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	for i, p := range parts {
+		if _, err := strconv.ParseUint(p, 10, 64); err == nil {
+			parts[i] = "*"
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
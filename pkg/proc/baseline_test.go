@@ -0,0 +1,143 @@
+package proc
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBaselineLearnsThenReportsNewBehavior(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store, _ := OpenBaselineStore("", time.Hour)
+	reg := NewProfileRegistry()
+	reg.SetBaselines(store)
+	var devs []Deviation
+	reg.SetDeviationFunc(func(d Deviation) { devs = append(devs, d) })
+
+	// Learning: nginx, whose exec was not seen, runs a worker that reads
+	// its config and talks to the upstream.
+	reg.RecordExec(200, 100, 7, "/usr/sbin/nginx", "nginx", "nginx: worker", nil, start)
+	for i := 0; i < 10; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		reg.RecordFileOpen(200, 7, "nginx", "/etc/nginx/conf.d/site.conf", at)
+		reg.RecordConnect(200, 7, "nginx", "10.0.0.5", 8080, at)
+	}
+	if len(devs) != 0 {
+		t.Fatalf("deviations while learning: %+v", devs)
+	}
+
+	// Detection: known behaviour is quiet, new behaviour is reported once.
+	now := start.Add(2 * time.Hour)
+	reg.RecordFileOpen(200, 7, "nginx", "/etc/nginx/nginx.conf", now)
+	reg.RecordConnect(200, 7, "nginx", "10.0.0.5", 8080, now)
+	if len(devs) != 0 {
+		t.Fatalf("known behaviour reported: %+v", devs)
+	}
+	reg.RecordExec(300, 100, 7, "/bin/sh", "nginx", "sh -c id", nil, now)
+	reg.RecordConnect(200, 7, "nginx", "203.0.113.9", 4444, now)
+	reg.RecordConnect(200, 7, "nginx", "203.0.113.9", 4444, now)
+
+	// The master is keyed by comm; the worker by the path it was exec'd
+	// from.
+	master, worker := BaselineKey{"nginx", 7}, BaselineKey{"/usr/sbin/nginx", 7}
+	want := []struct {
+		key   BaselineKey
+		kind  BehaviorKind
+		value string
+		pid   uint32
+	}{
+		{master, BehaviorChild, "/bin/sh", 100},
+		{worker, BehaviorPort, "4444", 200},
+		{worker, BehaviorDestination, "203.0.113.9", 200},
+	}
+	if len(devs) != len(want) {
+		t.Fatalf("deviations = %+v", devs)
+	}
+	for i, w := range want {
+		d := devs[i]
+		if d.Kind != w.kind || d.Value != w.value || d.PID != w.pid || d.Key != w.key {
+			t.Errorf("deviation %d = %+v, want %v %s from %d", i, d, w.kind, w.value, w.pid)
+		}
+	}
+
+	// The learned rates reach the worker's profile for anomaly checks.
+	p, _ := reg.GetProfile(200)
+	if p.Key != worker || p.Baseline == nil || p.Baseline.NormalNetRate != 1 {
+		t.Fatalf("profile key %v, baseline %+v", p.Key, p.Baseline)
+	}
+}
+
+func TestBaselinePersistAndReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baselines.json")
+	start := time.Now().Add(-2 * time.Hour)
+	store, err := OpenBaselineStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.ObserveConnect(BaselineKey{"curl", 1}, 1, "1.1.1.1", 443, start)
+	store.ObserveConnect(BaselineKey{"curl", 2}, 1, "1.1.1.1", 443, start)
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenBaselineStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devs := store.ObserveConnect(BaselineKey{"curl", 1}, 1, "1.1.1.1", 443, time.Now()); len(devs) != 0 {
+		t.Fatalf("reloaded baseline reported %+v", devs)
+	}
+	if n := store.Reset(1); n != 1 {
+		t.Fatalf("reset removed %d baselines", n)
+	}
+	list := store.List(0, time.Now())
+	if len(list) != 1 || list[0].Key.CgroupID != 2 || list[0].Learning || list[0].Ports[0] != "443" {
+		t.Fatalf("baselines = %+v", list)
+	}
+	// The reset workload learns again rather than alerting.
+	if devs := store.ObserveConnect(BaselineKey{"curl", 1}, 1, "8.8.8.8", 53, time.Now()); len(devs) != 0 {
+		t.Fatalf("relearning baseline reported %+v", devs)
+	}
+}
+
+func TestBaselineExpireAndEvict(t *testing.T) {
+	store, err := OpenBaselineStore("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().Add(-10 * time.Hour)
+	store.ObserveExec(BaselineKey{"old", 1}, 1, "/bin/sh", base)
+	store.ObserveExec(BaselineKey{"recent", 1}, 1, "/bin/sh", base.Add(8*time.Hour))
+	if n := store.Expire(base.Add(time.Hour)); n != 1 {
+		t.Fatalf("expired %d baselines, want 1", n)
+	}
+	if list := store.List(0, time.Now()); len(list) != 1 || list[0].Key.Exe != "recent" {
+		t.Fatalf("baselines after expiry = %+v", list)
+	}
+
+	// A full store makes room by dropping the least recently seen.
+	for i := 1; i < maxBaselines; i++ {
+		store.ObserveExec(BaselineKey{"churn", uint64(i + 1)}, 1, "/bin/sh", base.Add(9*time.Hour))
+	}
+	store.ObserveExec(BaselineKey{"new", 1}, 1, "/bin/sh", time.Now())
+	if store.Len() != maxBaselines {
+		t.Fatalf("store holds %d baselines", store.Len())
+	}
+	if list := store.List(1, time.Now()); len(list) != 1 || list[0].Key.Exe != "new" {
+		t.Fatalf("cgroup 1 baselines = %+v", list)
+	}
+}
+
+func TestFilePrefix(t *testing.T) {
+	for path, want := range map[string]string{
+		"/etc/passwd":               "/etc",
+		"/usr/lib/x86_64/libc.so.6": "/usr/lib",
+		"/proc/4242/status":         "/proc/*",
+		"/vmlinuz":                  "/",
+		"data/out.csv":              ".",
+	} {
+		if got := FilePrefix(path); got != want {
+			t.Errorf("FilePrefix(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
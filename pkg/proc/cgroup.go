@@ -3,7 +3,9 @@ package proc
 import (
 	"bufio"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -77,6 +79,12 @@ func ResolveCgroupPath(pid uint32, cgroupID uint64) string {
 	return ""
 }
 
+// CgroupIDForPath returns the cgroup v2 ID (the inode of the cgroup
+// directory) for a path relative to the cgroup mount, or 0 if unknown.
+func CgroupIDForPath(cgroupPath string) uint64 {
+	return getCgroupInode(cgroupPath)
+}
+
 func getCgroupInode(cgroupPath string) uint64 {
 	if cgroupPath == "" {
 		cgroupPath = "/"
@@ -98,6 +106,72 @@ func getCgroupInode(cgroupPath string) uint64 {
 	return 0
 }
 
+// CachedCgroupPath returns the path of a cgroup resolved earlier from a
+// process or by WalkCgroups.
+func CachedCgroupPath(cgroupID uint64) (string, bool) {
+	cached, ok := cgroupPathCache.Load(cgroupID)
+	if !ok {
+		return "", false
+	}
+	return cached.(string), true
+}
+
+// WalkCgroups calls fn with the ID and path of every cgroup in the cgroup
+// v2 hierarchy, remembering each path for CachedCgroupPath and forgetting
+// the paths of cgroups it did not find. Without a v2 hierarchy it does
+// nothing.
+func WalkCgroups(fn func(cgroupID uint64, cgroupPath string)) error {
+	root := ""
+	for _, mount := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"} {
+		if _, err := os.Stat(filepath.Join(mount, "cgroup.controllers")); err == nil {
+			root = mount
+			break
+		}
+	}
+	if root == "" {
+		return nil
+	}
+
+	found := make(map[uint64]bool)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Cgroups are removed while we walk.
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		cgroupPath := "/" + strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+		cgroupPathCache.Store(stat.Ino, cgroupPath)
+		found[stat.Ino] = true
+		fn(stat.Ino, cgroupPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Cgroups created during the walk are resolved again from their
+	// processes' next events.
+	cgroupPathCache.Range(func(key, _ any) bool {
+		if id := key.(uint64); !found[id] {
+			cgroupPathCache.Delete(id)
+		}
+		return true
+	})
+	return nil
+}
+
 func readCgroupIDAndPath(pid uint32) (uint64, string) {
 	unified, hybrid, err := readCgroupPaths(pid)
 	if err != nil {
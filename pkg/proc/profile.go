@@ -1,17 +1,23 @@
 package proc
 
 import (
+	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
+
+	"aegis/pkg/anomaly"
 )
 
 type ProcessProfile struct {
 	PID      uint32
+	Key      BaselineKey // program and cgroup whose baseline the process feeds
 	Static   StaticProfile
 	Dynamic  DynamicProfile
 	Baseline *BaselineProfile // Optional baseline for anomaly detection
 	mu       sync.RWMutex
+
+	lastSeen       time.Time
+	baselineLookup time.Time // last time Baseline was looked up while nil
 }
 
 type StaticProfile struct {
@@ -37,15 +43,86 @@ type BaselineProfile struct {
 	CommonNetPorts     []uint16
 }
 
-// ProfileRegistry manages process profiles.
+// Snapshot returns a consistent copy of the profile's static and dynamic
+// parts.
+func (p *ProcessProfile) Snapshot() (StaticProfile, DynamicProfile) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	static := p.Static
+	static.Genealogy = append([]uint32(nil), p.Static.Genealogy...)
+	return static, p.Dynamic
+}
+
+// Program returns the program and cgroup the process is profiled as.
+func (p *ProcessProfile) Program() BaselineKey {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Key
+}
+
+// ProfileRegistry manages process profiles. With a baseline store it also
+// feeds each process' activity into the baseline of its program and reports
+// deviations from learned behaviour; with an anomaly detector it tracks the
+// event rates of processes, executables and workloads.
 type ProfileRegistry struct {
 	profiles sync.Map // map[uint32]*ProcessProfile
+
+	mu          sync.RWMutex
+	baselines   *BaselineStore
+	onDeviation func(Deviation)
+	anomalies   *anomaly.Detector
+	onAnomaly   func([]anomaly.Anomaly)
 }
 
 func NewProfileRegistry() *ProfileRegistry {
 	return &ProfileRegistry{}
 }
 
+// SetBaselines enables behavioural baselines.
+func (pr *ProfileRegistry) SetBaselines(store *BaselineStore) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.baselines = store
+}
+
+// SetDeviationFunc installs fn to be called with each deviation from a
+// learned baseline. It is called on the dispatch path and must not block.
+func (pr *ProfileRegistry) SetDeviationFunc(fn func(Deviation)) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.onDeviation = fn
+}
+
+// Baselines returns the baseline store, or nil when baselines are disabled.
+func (pr *ProfileRegistry) Baselines() *BaselineStore {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	return pr.baselines
+}
+
+// SetAnomalyDetector enables rate anomaly detection.
+func (pr *ProfileRegistry) SetAnomalyDetector(d *anomaly.Detector) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.anomalies = d
+}
+
+// SetAnomalyFunc installs fn to be called with the rate anomalies an event
+// completes, highest score first. It is called on the dispatch path and
+// must not block.
+func (pr *ProfileRegistry) SetAnomalyFunc(fn func([]anomaly.Anomaly)) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.onAnomaly = fn
+}
+
+// Anomalies returns the anomaly detector, or nil when it is disabled.
+func (pr *ProfileRegistry) Anomalies() *anomaly.Detector {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	return pr.anomalies
+}
+
 func (pr *ProfileRegistry) GetProfile(pid uint32) (*ProcessProfile, bool) {
 	profile, ok := pr.profiles.Load(pid)
 	if !ok {
@@ -67,92 +144,200 @@ func (pr *ProfileRegistry) GetOrCreateProfile(pid uint32, startTime time.Time, c
 			CommandLine: commandLine,
 			Genealogy:   genealogy,
 		},
+		lastSeen: startTime,
 	}
 
 	actual, _ := pr.profiles.LoadOrStore(pid, newProfile)
 	return actual.(*ProcessProfile)
 }
 
-// RecordFileOpen records a file open event for a process.
-func (pr *ProfileRegistry) RecordFileOpen(pid uint32) {
-	profile, ok := pr.GetProfile(pid)
-	if !ok {
-		return
+// profileFor returns the profile of pid, creating one keyed by comm for
+// processes whose exec was not seen.
+func (pr *ProfileRegistry) profileFor(pid uint32, cgroupID uint64, comm string, now time.Time) *ProcessProfile {
+	if profile, ok := pr.GetProfile(pid); ok {
+		return profile
 	}
-
+	profile := pr.GetOrCreateProfile(pid, now, "", nil)
 	profile.mu.Lock()
-	atomic.AddInt64(&profile.Dynamic.FileOpenCount, 1)
-	profile.Dynamic.LastFileOpen = time.Now()
+	if profile.Key.Exe == "" {
+		profile.Key = BaselineKey{Exe: comm, CgroupID: cgroupID}
+	}
 	profile.mu.Unlock()
+	return profile
 }
 
-// RecordConnect records a network connection event for a process.
-func (pr *ProfileRegistry) RecordConnect(pid uint32) {
-	profile, ok := pr.GetProfile(pid)
-	if !ok {
+// RecordExec records that ppid started pid running exe. The exec replaces
+// any profile pid had under its previous image and counts as a child of
+// the parent. pcomm keys the parent when its own exec was not seen.
+func (pr *ProfileRegistry) RecordExec(pid, ppid uint32, cgroupID uint64, exe, pcomm, commandLine string, genealogy []uint32, now time.Time) {
+	if d := pr.Anomalies(); d != nil {
+		d.Forget(ProcessEntity(pid))
+	}
+	pr.profiles.Store(pid, &ProcessProfile{
+		PID: pid,
+		Key: BaselineKey{Exe: exe, CgroupID: cgroupID},
+		Static: StaticProfile{
+			StartTime:   now,
+			CommandLine: commandLine,
+			Genealogy:   genealogy,
+		},
+		lastSeen: now,
+	})
+	if ppid == 0 {
 		return
 	}
 
-	profile.mu.Lock()
-	atomic.AddInt64(&profile.Dynamic.NetConnectCount, 1)
-	profile.Dynamic.LastConnect = time.Now()
-	profile.mu.Unlock()
-}
+	parent := pr.profileFor(ppid, cgroupID, pcomm, now)
+	parent.mu.Lock()
+	parent.Dynamic.ExecCount++
+	parent.Dynamic.LastExec = now
+	parent.lastSeen = now
+	key := parent.Key
+	parent.mu.Unlock()
 
-// RecordExec records an exec event for a process.
-func (pr *ProfileRegistry) RecordExec(pid uint32) {
-	profile, ok := pr.GetProfile(pid)
-	if !ok {
-		return
+	if store, fn := pr.baselineStore(); store != nil {
+		pr.report(fn, store.ObserveExec(key, ppid, exe, now))
+		pr.refreshBaseline(parent, store, now)
 	}
+	pr.observeRate(anomaly.MetricExec, ppid, key, now)
+}
 
+// RecordFileOpen records a file open event for a process.
+func (pr *ProfileRegistry) RecordFileOpen(pid uint32, cgroupID uint64, comm, path string, now time.Time) {
+	profile := pr.profileFor(pid, cgroupID, comm, now)
 	profile.mu.Lock()
-	atomic.AddInt64(&profile.Dynamic.ExecCount, 1)
-	profile.Dynamic.LastExec = time.Now()
+	profile.Dynamic.FileOpenCount++
+	profile.Dynamic.LastFileOpen = now
+	profile.lastSeen = now
+	key := profile.Key
 	profile.mu.Unlock()
+
+	if store, fn := pr.baselineStore(); store != nil {
+		pr.report(fn, store.ObserveFile(key, pid, path, now))
+		pr.refreshBaseline(profile, store, now)
+	}
+	pr.observeRate(anomaly.MetricFile, pid, key, now)
 }
 
-func (pr *ProfileRegistry) GetAnomalousProcesses() []*ProcessProfile {
-	var anomalous []*ProcessProfile
+// RecordConnect records a network connection event for a process.
+func (pr *ProfileRegistry) RecordConnect(pid uint32, cgroupID uint64, comm, ip string, port uint16, now time.Time) {
+	profile := pr.profileFor(pid, cgroupID, comm, now)
+	profile.mu.Lock()
+	profile.Dynamic.NetConnectCount++
+	profile.Dynamic.LastConnect = now
+	profile.lastSeen = now
+	key := profile.Key
+	profile.mu.Unlock()
 
-	pr.profiles.Range(func(key, value any) bool {
-		profile := value.(*ProcessProfile)
-		if pr.isAnomalous(profile) {
-			anomalous = append(anomalous, profile)
-		}
-		return true
-	})
+	if store, fn := pr.baselineStore(); store != nil {
+		pr.report(fn, store.ObserveConnect(key, pid, ip, port, now))
+		pr.refreshBaseline(profile, store, now)
+	}
+	pr.observeRate(anomaly.MetricConnect, pid, key, now)
+}
 
-	return anomalous
+func (pr *ProfileRegistry) baselineStore() (*BaselineStore, func(Deviation)) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	return pr.baselines, pr.onDeviation
 }
 
-// isAnomalous checks if a process shows anomalous behavior.
-func (pr *ProfileRegistry) isAnomalous(profile *ProcessProfile) bool {
-	profile.mu.RLock()
-	defer profile.mu.RUnlock()
+func (pr *ProfileRegistry) report(fn func(Deviation), devs []Deviation) {
+	if fn == nil {
+		return
+	}
+	for _, d := range devs {
+		fn(d)
+	}
+}
 
-	if profile.Baseline == nil {
-		return false // No baseline to compare against
+// observeRate counts an event towards the rates of the process, its
+// executable and its workload.
+func (pr *ProfileRegistry) observeRate(metric anomaly.Metric, pid uint32, key BaselineKey, now time.Time) {
+	pr.mu.RLock()
+	d, fn := pr.anomalies, pr.onAnomaly
+	pr.mu.RUnlock()
+	if d == nil {
+		return
 	}
+	found := d.Observe(metric, key.Exe, now,
+		ProcessEntity(pid),
+		anomaly.Entity{Kind: anomaly.EntityExecutable, ID: key.Exe},
+		WorkloadEntity(key.CgroupID))
+	if len(found) > 0 && fn != nil {
+		fn(found)
+	}
+}
 
-	// Simple anomaly detection: check if current rates exceed baseline significantly
-	// This is a simplified version; Phase 3 will add AI-powered anomaly detection
+// ProcessEntity is the anomaly entity of a process.
+func ProcessEntity(pid uint32) anomaly.Entity {
+	return anomaly.Entity{Kind: anomaly.EntityProcess, ID: strconv.FormatUint(uint64(pid), 10)}
+}
 
-	// Calculate current rates (simplified - should use time windows)
-	fileRate := float64(profile.Dynamic.FileOpenCount)
-	netRate := float64(profile.Dynamic.NetConnectCount)
+// WorkloadEntity is the anomaly entity of a workload.
+func WorkloadEntity(cgroupID uint64) anomaly.Entity {
+	return anomaly.Entity{Kind: anomaly.EntityWorkload, ID: strconv.FormatUint(cgroupID, 10)}
+}
 
-	// Check if rates are significantly higher than baseline (3x threshold)
-	if profile.Baseline.NormalFileRate > 0 && fileRate > profile.Baseline.NormalFileRate*3 {
-		return true
+// refreshBaseline attaches the learned baseline to a profile once its
+// program has finished learning, looking it up at most once a minute.
+func (pr *ProfileRegistry) refreshBaseline(profile *ProcessProfile, store *BaselineStore, now time.Time) {
+	profile.mu.Lock()
+	defer profile.mu.Unlock()
+	if profile.Baseline != nil || now.Sub(profile.baselineLookup) < time.Minute {
+		return
 	}
-	if profile.Baseline.NormalNetRate > 0 && netRate > profile.Baseline.NormalNetRate*3 {
-		return true
+	profile.baselineLookup = now
+	profile.Baseline = store.Profile(profile.Key, now)
+}
+
+// GetAnomalousProcesses returns the profiles of processes with a rate
+// anomaly in the last anomalousWindows windows.
+func (pr *ProfileRegistry) GetAnomalousProcesses() []*ProcessProfile {
+	d := pr.Anomalies()
+	if d == nil {
+		return nil
 	}
 
-	return false
+	var anomalous []*ProcessProfile
+	seen := make(map[uint32]bool)
+	since := time.Now().Add(-anomalousWindows * d.Config().Window)
+	for _, a := range d.Recent(since) {
+		if a.Entity.Kind != anomaly.EntityProcess {
+			continue
+		}
+		pid, err := strconv.ParseUint(a.Entity.ID, 10, 32)
+		if err != nil || seen[uint32(pid)] {
+			continue
+		}
+		seen[uint32(pid)] = true
+		if profile, ok := pr.GetProfile(uint32(pid)); ok {
+			anomalous = append(anomalous, profile)
+		}
+	}
+	return anomalous
 }
 
+// anomalousWindows is how long, in detector windows, a process counts as
+// anomalous after a rate anomaly.
+const anomalousWindows = 15
+
 func (pr *ProfileRegistry) RemoveProfile(pid uint32) {
 	pr.profiles.Delete(pid)
 }
+
+// Prune removes the profiles of processes without activity since before.
+func (pr *ProfileRegistry) Prune(before time.Time) int {
+	n := 0
+	pr.profiles.Range(func(key, value any) bool {
+		profile := value.(*ProcessProfile)
+		profile.mu.RLock()
+		idle := profile.lastSeen.Before(before)
+		profile.mu.RUnlock()
+		if idle && pr.profiles.CompareAndDelete(key, value) {
+			n++
+		}
+		return true
+	})
+	return n
+}
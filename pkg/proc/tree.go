@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"aegis/pkg/events"
 )
 
 type ProcessInfo struct {
@@ -17,6 +20,26 @@ type ProcessInfo struct {
 	CgroupID  uint64
 	Comm      string
 	Timestamp time.Time
+	PidNS     PidNamespace // zero when unknown
+}
+
+// PidNamespace is the PID namespace a process runs in, by inode number, with
+// the process's PID and parent PID as seen inside it. PPID is 0 when the
+// parent is outside the namespace, as for a container's init.
+type PidNamespace struct {
+	Inode uint32
+	PID   uint32
+	PPID  uint32
+}
+
+// PidNamespaceOf returns the PID namespace recorded in an event header.
+func PidNamespaceOf(hdr events.EventHeader) PidNamespace {
+	return PidNamespace{Inode: hdr.PidNS, PID: hdr.NsPID, PPID: hdr.NsPPID}
+}
+
+// IsHost reports whether ns is the initial PID namespace.
+func (ns PidNamespace) IsHost() bool {
+	return ns.Inode == events.HostPidNS
 }
 
 type PIDResolver func(pid uint32) (uint32, bool)
@@ -24,6 +47,8 @@ type PIDResolver func(pid uint32) (uint32, bool)
 type ProcessTree struct {
 	processes      sync.Map
 	timeIndex      *timeIndex
+	childMu        sync.RWMutex                   // guards children; held while processes is written
+	children       map[uint32]map[uint32]struct{} // parent PID -> child PIDs
 	maxAge         time.Duration
 	maxSize        int
 	maxChainLength int
@@ -33,14 +58,7 @@ type ProcessTree struct {
 }
 
 func NewProcessTree(maxAge time.Duration, maxSize int, maxChainLength int) *ProcessTree {
-	pt := &ProcessTree{
-		timeIndex:      newTimeIndex(),
-		maxAge:         maxAge,
-		maxSize:        maxSize,
-		maxChainLength: maxChainLength,
-	}
-
-	pt.SetPIDResolver(nil)
+	pt := NewEmptyProcessTree(maxAge, maxSize, maxChainLength)
 
 	go func() {
 		if err := pt.seedFromProc(); err != nil {
@@ -53,6 +71,19 @@ func NewProcessTree(maxAge time.Duration, maxSize int, maxChainLength int) *Proc
 	return pt
 }
 
+// NewEmptyProcessTree returns a tree without seeding it from /proc or
+// starting the cleanup loop, so it holds only the processes it is told
+// about. Tests use it to keep host PIDs out of synthetic trees.
+func NewEmptyProcessTree(maxAge time.Duration, maxSize int, maxChainLength int) *ProcessTree {
+	return &ProcessTree{
+		timeIndex:      newTimeIndex(),
+		children:       make(map[uint32]map[uint32]struct{}),
+		maxAge:         maxAge,
+		maxSize:        maxSize,
+		maxChainLength: maxChainLength,
+	}
+}
+
 func (pt *ProcessTree) seedFromProc() error {
 	entries, err := os.ReadDir("/proc")
 	if err != nil {
@@ -78,9 +109,7 @@ func (pt *ProcessTree) seedFromProc() error {
 			cgroupPathCache.Store(info.CgroupID, cgroupPath)
 		}
 
-		pt.processes.Store(uint32(pid), info)
-		pt.timeIndex.Add(uint32(pid), info.Timestamp)
-		pt.size.Add(1)
+		pt.put(info)
 		count++
 	}
 
@@ -124,28 +153,117 @@ func (pt *ProcessTree) readProcInfo(pid uint32) (*ProcessInfo, string, error) {
 		CgroupID:  cgroupID,
 		Comm:      comm,
 		Timestamp: time.Now(),
+		PidNS:     readPidNamespace(pid, uint32(ppid)),
 	}, cgroupPath, nil
 }
 
-func (pt *ProcessTree) AddProcess(pid, ppid uint32, cgroupID uint64, comm string) {
+// readPidNamespace reads the PID namespace of pid, and its PID and parent
+// PID inside it, from /proc.
+func readPidNamespace(pid, ppid uint32) PidNamespace {
+	inode, nsPID := readNSpid(pid)
+	if inode == 0 {
+		return PidNamespace{}
+	}
+	ns := PidNamespace{Inode: inode, PID: nsPID}
+	if parentInode, parentPID := readNSpid(ppid); parentInode == inode {
+		ns.PPID = parentPID
+	}
+	return ns
+}
+
+// readNSpid returns the inode of pid's PID namespace and the PID it has
+// there, the last entry of the NSpid line in its status.
+func readNSpid(pid uint32) (inode, nsPID uint32) {
+	if pid == 0 {
+		return 0, 0
+	}
+	link, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", pid))
+	if err != nil {
+		return 0, 0
+	}
+	ino, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "pid:["), "]"), 10, 32)
+	if err != nil {
+		return 0, 0
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		rest, ok := strings.CutPrefix(line, "NSpid:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			break
+		}
+		if n, err := strconv.ParseUint(fields[len(fields)-1], 10, 32); err == nil {
+			return uint32(ino), uint32(n)
+		}
+		break
+	}
+	return uint32(ino), 0
+}
+
+func (pt *ProcessTree) AddProcess(pid, ppid uint32, cgroupID uint64, comm string, ns PidNamespace) {
 	if pt.size.Load() >= int32(pt.maxSize) {
 		pt.evictOldest()
 	}
 
-	info := &ProcessInfo{
+	pt.put(&ProcessInfo{
 		PID:       pid,
 		PPID:      ppid,
 		CgroupID:  cgroupID,
 		Comm:      comm,
 		Timestamp: time.Now(),
-	}
+		PidNS:     ns,
+	})
+}
 
-	if _, exists := pt.processes.Load(pid); !exists {
+// put stores info and files it under its parent in the children index.
+func (pt *ProcessTree) put(info *ProcessInfo) {
+	pt.childMu.Lock()
+	if prev, loaded := pt.processes.Swap(info.PID, info); loaded {
+		pt.unlinkLocked(prev.(*ProcessInfo))
+	} else {
 		pt.size.Add(1)
 	}
+	pt.linkLocked(info)
+	pt.childMu.Unlock()
+
+	pt.timeIndex.Add(info.PID, info.Timestamp)
+}
+
+// remove drops pid from the tree. Its children stay indexed under it.
+func (pt *ProcessTree) remove(pid uint32) bool {
+	pt.childMu.Lock()
+	defer pt.childMu.Unlock()
+	prev, loaded := pt.processes.LoadAndDelete(pid)
+	if !loaded {
+		return false
+	}
+	pt.size.Add(-1)
+	pt.unlinkLocked(prev.(*ProcessInfo))
+	return true
+}
+
+func (pt *ProcessTree) linkLocked(info *ProcessInfo) {
+	kids, ok := pt.children[info.PPID]
+	if !ok {
+		kids = make(map[uint32]struct{})
+		pt.children[info.PPID] = kids
+	}
+	kids[info.PID] = struct{}{}
+}
 
-	pt.processes.Store(pid, info)
-	pt.timeIndex.Add(pid, info.Timestamp)
+func (pt *ProcessTree) unlinkLocked(info *ProcessInfo) {
+	if kids, ok := pt.children[info.PPID]; ok {
+		delete(kids, info.PID)
+		if len(kids) == 0 {
+			delete(pt.children, info.PPID)
+		}
+	}
 }
 
 func (pt *ProcessTree) evictOldest() {
@@ -153,10 +271,7 @@ func (pt *ProcessTree) evictOldest() {
 	if !ok {
 		return
 	}
-
-	if _, loaded := pt.processes.LoadAndDelete(oldestPID); loaded {
-		pt.size.Add(-1)
-	}
+	pt.remove(oldestPID)
 }
 
 func (pt *ProcessTree) GetProcess(pid uint32) (*ProcessInfo, bool) {
@@ -171,6 +286,91 @@ func (pt *ProcessTree) Size() int {
 	return int(pt.size.Load())
 }
 
+// Processes returns every tracked process, ordered by PID.
+func (pt *ProcessTree) Processes() []*ProcessInfo {
+	var list []*ProcessInfo
+	pt.processes.Range(func(_, v any) bool {
+		list = append(list, v.(*ProcessInfo))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].PID < list[j].PID })
+	return list
+}
+
+// GetChildren returns the tracked children of pid, ordered by PID.
+func (pt *ProcessTree) GetChildren(pid uint32) []*ProcessInfo {
+	pt.childMu.RLock()
+	defer pt.childMu.RUnlock()
+	return pt.childrenLocked(pid)
+}
+
+func (pt *ProcessTree) childrenLocked(pid uint32) []*ProcessInfo {
+	kids := make([]*ProcessInfo, 0, len(pt.children[pid]))
+	for child := range pt.children[pid] {
+		if v, ok := pt.processes.Load(child); ok {
+			kids = append(kids, v.(*ProcessInfo))
+		}
+	}
+	sort.Slice(kids, func(i, j int) bool { return kids[i].PID < kids[j].PID })
+	return kids
+}
+
+// ProcessNode is a process and its descendants, as returned by Subtree.
+type ProcessNode struct {
+	Info     *ProcessInfo
+	Children []*ProcessNode
+	// Truncated is set when children were left out by the depth or node
+	// limit.
+	Truncated bool
+}
+
+// Subtree returns root and its descendants down to depth levels below it,
+// breadth first so that at most maxNodes nodes are returned. A root that is
+// not tracked itself (such as PID 0, the parent of init and kthreadd) gets
+// a node holding only its PID.
+func (pt *ProcessTree) Subtree(root uint32, depth, maxNodes int) *ProcessNode {
+	pt.childMu.RLock()
+	defer pt.childMu.RUnlock()
+
+	info, ok := pt.GetProcess(root)
+	if !ok {
+		info = &ProcessInfo{PID: root}
+	}
+	top := &ProcessNode{Info: info}
+	nodes := 1
+	level := []*ProcessNode{top}
+	visited := map[uint32]bool{root: true}
+	for d := 0; len(level) > 0; d++ {
+		var next []*ProcessNode
+		for _, n := range level {
+			kids := pt.childrenLocked(n.Info.PID)
+			if len(kids) == 0 {
+				continue
+			}
+			if d >= depth {
+				n.Truncated = true
+				continue
+			}
+			for _, k := range kids {
+				if visited[k.PID] {
+					continue
+				}
+				if nodes >= maxNodes {
+					n.Truncated = true
+					break
+				}
+				visited[k.PID] = true
+				child := &ProcessNode{Info: k}
+				n.Children = append(n.Children, child)
+				next = append(next, child)
+				nodes++
+			}
+		}
+		level = next
+	}
+	return top
+}
+
 func (pt *ProcessTree) GetAncestors(pid uint32) []*ProcessInfo {
 	chain := make([]*ProcessInfo, 0, pt.maxChainLength)
 	visited := make(map[uint32]bool)
@@ -237,8 +437,7 @@ func (pt *ProcessTree) cleanup() {
 		if !ok {
 			break
 		}
-		if _, loaded := pt.processes.LoadAndDelete(pid); loaded {
-			pt.size.Add(-1)
+		if pt.remove(pid) {
 			count++
 		}
 	}
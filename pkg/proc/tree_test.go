@@ -0,0 +1,68 @@
+package proc
+
+import (
+	"testing"
+	"time"
+)
+
+func pids(list []*ProcessInfo) []uint32 {
+	out := make([]uint32, len(list))
+	for i, p := range list {
+		out[i] = p.PID
+	}
+	return out
+}
+
+func TestProcessTreeChildren(t *testing.T) {
+	pt := NewEmptyProcessTree(time.Hour, 100, 50)
+	pt.AddProcess(1, 0, 0, "systemd", PidNamespace{})
+	pt.AddProcess(10, 1, 0, "sshd", PidNamespace{})
+	pt.AddProcess(20, 10, 0, "bash", PidNamespace{})
+	pt.AddProcess(21, 10, 0, "bash", PidNamespace{})
+	pt.AddProcess(30, 20, 0, "curl", PidNamespace{})
+
+	if got := pids(pt.GetChildren(10)); len(got) != 2 || got[0] != 20 || got[1] != 21 {
+		t.Fatalf("children of 10 = %v", got)
+	}
+
+	// Re-parenting (e.g. to a subreaper) moves the child.
+	pt.AddProcess(30, 1, 0, "curl", PidNamespace{})
+	if got := pids(pt.GetChildren(20)); len(got) != 0 {
+		t.Fatalf("children of 20 after re-parenting = %v", got)
+	}
+	if got := pids(pt.GetChildren(1)); len(got) != 2 || got[1] != 30 {
+		t.Fatalf("children of 1 = %v", got)
+	}
+
+	pt.remove(21)
+	if got := pids(pt.GetChildren(10)); len(got) != 1 || pt.Size() != 4 {
+		t.Fatalf("children of 10 after exit = %v, size %d", got, pt.Size())
+	}
+}
+
+func TestProcessTreeSubtree(t *testing.T) {
+	pt := NewEmptyProcessTree(time.Hour, 100, 50)
+	pt.AddProcess(1, 0, 0, "systemd", PidNamespace{})
+	pt.AddProcess(10, 1, 0, "sshd", PidNamespace{})
+	pt.AddProcess(11, 1, 0, "cron", PidNamespace{})
+	pt.AddProcess(20, 10, 0, "bash", PidNamespace{})
+	pt.AddProcess(30, 20, 0, "curl", PidNamespace{})
+
+	root := pt.Subtree(1, 2, 100)
+	if len(root.Children) != 2 || root.Children[0].Info.Comm != "sshd" {
+		t.Fatalf("root children = %+v", root.Children)
+	}
+	bash := root.Children[0].Children[0]
+	if bash.Info.PID != 20 || len(bash.Children) != 0 || !bash.Truncated {
+		t.Fatalf("depth limit not applied: %+v", bash)
+	}
+
+	root = pt.Subtree(1, 10, 3)
+	if len(root.Children) != 2 || len(root.Children[0].Children) != 0 || !root.Children[0].Truncated {
+		t.Fatalf("node limit not applied: %+v", root.Children[0])
+	}
+
+	if forest := pt.Subtree(0, 1, 100); forest.Info.PID != 0 || len(forest.Children) != 1 {
+		t.Fatalf("subtree of untracked PID 0 = %+v", forest)
+	}
+}
@@ -74,5 +74,6 @@ func (m *connectMatcher) matchRule(rule *Rule, event *events.ConnectEvent) bool
 			return false
 		}
 	}
-	return matchCgroupID(match.CgroupID, event.Hdr.CgroupID) && matchPID(match.PID, event.Hdr.PID)
+	return matchCgroupID(match.CgroupID, event.Hdr.CgroupID) && matchPID(match.PID, event.Hdr.PID) &&
+		matchPidNamespace(match.PidNamespace, event.Hdr.PidNS)
 }
@@ -1,79 +1,315 @@
 package rules
 
 import (
+	"strconv"
+	"strings"
+	"sync"
+
 	"aegis/pkg/events"
 )
 
+// maxBindings is the least number of cgroup to policy bindings cached;
+// PruneBindings raises the limit to fit the cgroups on the host. Evicting a
+// binding only causes its workload to be bound, and its kernel mask
+// written, again.
+const maxBindings = 16384
+
 type Engine struct {
-	rules          []Rule
+	rules         []Rule
+	policies      []Policy
+	global        *ruleSet // rules no policy names; all rules without policies
+	testingBuffer *TestingBuffer
+
+	mu       sync.RWMutex
+	resolve  WorkloadResolver
+	onBind   func(cgroupID uint64, bound []int)
+	bindings map[uint64]string   // cgroup ID to key of its bound policies
+	limit    int                 // bindings cached before one is evicted
+	sets     map[string]*ruleSet // bound policies key to matchers
+}
+
+// ruleSet holds the matchers for one combination of bound policies.
+type ruleSet struct {
 	execMatcher    *execMatcher
 	fileMatcher    *fileMatcher
 	connectMatcher *connectMatcher
-	testingBuffer  *TestingBuffer
 }
 
 func NewEngine(rules []Rule) *Engine {
+	return NewPolicyEngine(rules, nil)
+}
+
+// NewPolicyEngine returns an engine that applies each policy's rules only
+// to the workloads the policy selects. Workloads are looked up with the
+// resolver set by SetWorkloadResolver; until then, and for cgroups whose
+// workload is unknown, only the rules no policy names apply.
+func NewPolicyEngine(rules []Rule, policies []Policy) *Engine {
 	// Separate active rules (testing/production) from draft rules.
 	// Draft rules should not be included in matchers.
-	var activeRules []Rule
+	scoped := ScopedRuleNames(policies)
+	var globalRules []Rule
 	for i := range rules {
 		rules[i].Match.Prepare()
 		// Only include rules that are active (testing or production)
 		// Draft rules and empty state rules are excluded from matching
-		if rules[i].IsActive() {
-			activeRules = append(activeRules, rules[i])
+		if rules[i].IsActive() && !scoped[rules[i].Name] {
+			globalRules = append(globalRules, rules[i])
 		}
 	}
 	b := NewTestingBuffer(10000)
+	global := newRuleSet(globalRules, b)
 	return &Engine{
-		rules:          rules, // Keep all rules for GetRules(), but only active ones in matchers
-		execMatcher:    newExecMatcher(activeRules, b),
-		fileMatcher:    newFileMatcher(activeRules, b),
-		connectMatcher: newConnectMatcher(activeRules, b),
-		testingBuffer:  b,
+		rules:         rules, // Keep all rules for GetRules(), but only active ones in matchers
+		policies:      policies,
+		global:        global,
+		testingBuffer: b,
+		bindings:      make(map[uint64]string),
+		limit:         maxBindings,
+		sets:          map[string]*ruleSet{"": global},
+	}
+}
+
+func newRuleSet(rules []Rule, b *TestingBuffer) *ruleSet {
+	return &ruleSet{
+		execMatcher:    newExecMatcher(rules, b),
+		fileMatcher:    newFileMatcher(rules, b),
+		connectMatcher: newConnectMatcher(rules, b),
+	}
+}
+
+// SetWorkloadResolver sets how the engine finds the workload of a cgroup
+// to bind policies to it.
+func (e *Engine) SetWorkloadResolver(resolve WorkloadResolver) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resolve = resolve
+}
+
+// SetBindFunc sets a function called with the indexes of the policies bound
+// to a cgroup whenever the engine binds one, so the kernel can enforce
+// them. It runs without the engine locked, possibly concurrently for
+// different cgroups.
+func (e *Engine) SetBindFunc(fn func(cgroupID uint64, bound []int)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onBind = fn
+}
+
+// Policies returns the engine's policies; indexes in BoundPolicies refer to
+// this slice.
+func (e *Engine) Policies() []Policy {
+	return e.policies
+}
+
+// BoundPolicies returns the indexes of the policies bound to a cgroup, in
+// file order, binding it first if needed. Policies that are off are never
+// bound.
+func (e *Engine) BoundPolicies(cgroupID uint64) []int {
+	key, _ := e.bind(cgroupID)
+	return parseBindingKey(key)
+}
+
+// setFor returns the matchers for the policies bound to a cgroup.
+func (e *Engine) setFor(cgroupID uint64) *ruleSet {
+	if len(e.policies) == 0 {
+		return e.global
+	}
+	_, set := e.bind(cgroupID)
+	return set
+}
+
+// bind returns the binding of a cgroup. Cached bindings are served under
+// the read lock; on a miss the resolver runs and the matchers are built
+// unlocked, and the write lock is only held to record the result.
+func (e *Engine) bind(cgroupID uint64) (string, *ruleSet) {
+	if len(e.policies) == 0 {
+		return "", e.global
+	}
+	e.mu.RLock()
+	key, cached := e.bindings[cgroupID]
+	set := e.sets[key]
+	resolve := e.resolve
+	e.mu.RUnlock()
+	if cached {
+		return key, set
+	}
+	if resolve == nil {
+		return "", e.global
+	}
+	w, ok := resolve(cgroupID)
+	if !ok {
+		// Not cached: the workload may be described by a later event.
+		return "", e.global
+	}
+
+	var bound []int
+	for i, p := range e.policies {
+		if p.Mode != PolicyModeOff && p.Selector.Matches(w) {
+			bound = append(bound, i)
+		}
+	}
+	key = bindingKey(bound)
+	e.mu.RLock()
+	set, ok = e.sets[key]
+	e.mu.RUnlock()
+	if !ok {
+		set = e.newPolicySet(bound)
+	}
+
+	e.mu.Lock()
+	if prev, ok := e.bindings[cgroupID]; ok {
+		// Bound concurrently; keep the first binding.
+		set = e.sets[prev]
+		e.mu.Unlock()
+		return prev, set
+	}
+	if existing, ok := e.sets[key]; ok {
+		set = existing
+	} else {
+		e.sets[key] = set
+	}
+	if len(e.bindings) >= e.limit {
+		for id := range e.bindings {
+			delete(e.bindings, id)
+			break
+		}
+	}
+	e.bindings[cgroupID] = key
+	onBind := e.onBind
+	e.mu.Unlock()
+
+	if onBind != nil {
+		onBind(cgroupID, bound)
+	}
+	return key, set
+}
+
+// PruneBindings drops the bindings of cgroups not in live, the cgroups
+// that still exist, and sizes the cache to hold twice as many.
+func (e *Engine) PruneBindings(live map[uint64]bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for id := range e.bindings {
+		if _, ok := live[id]; !ok {
+			delete(e.bindings, id)
+		}
+	}
+	e.limit = max(maxBindings, 2*len(live))
+}
+
+// newPolicySet builds matchers for the global rules plus those of the bound
+// policies. Rules are copied per policy so matches name it; in monitor mode
+// block rules are downgraded to alerts.
+func (e *Engine) newPolicySet(bound []int) *ruleSet {
+	if len(bound) == 0 {
+		return e.global
+	}
+	byName := make(map[string]*Rule, len(e.rules))
+	for i := range e.rules {
+		byName[e.rules[i].Name] = &e.rules[i]
+	}
+	scoped := ScopedRuleNames(e.policies)
+	var active []Rule
+	for _, r := range e.rules {
+		if r.IsActive() && !scoped[r.Name] {
+			active = append(active, r)
+		}
+	}
+	// A rule named by several bound policies applies once, through the
+	// first that enforces it, else the first that names it.
+	added := make(map[string]int)
+	for _, i := range bound {
+		p := e.policies[i]
+		for _, name := range p.Rules {
+			r, ok := byName[name]
+			if !ok || !r.IsActive() {
+				continue
+			}
+			rule := *r
+			rule.Policy = p.Name
+			if p.Mode == PolicyModeMonitor && rule.Action == ActionBlock {
+				rule.Action = ActionAlert
+			}
+			if j, dup := added[name]; dup {
+				if p.Mode == PolicyModeEnforce && active[j].Action != rule.Action {
+					active[j] = rule
+				}
+				continue
+			}
+			added[name] = len(active)
+			active = append(active, rule)
+		}
+	}
+	return newRuleSet(active, e.testingBuffer)
+}
+
+func bindingKey(bound []int) string {
+	parts := make([]string, len(bound))
+	for i, idx := range bound {
+		parts[i] = strconv.Itoa(idx)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseBindingKey(key string) []int {
+	if key == "" {
+		return nil
+	}
+	var bound []int
+	for _, part := range strings.Split(key, ",") {
+		if idx, err := strconv.Atoi(part); err == nil {
+			bound = append(bound, idx)
+		}
 	}
+	return bound
 }
 
 func (e *Engine) MatchExec(event events.ProcessedEvent) (matched bool, rule *Rule, allowed bool) {
-	if e.execMatcher == nil {
+	set := e.setFor(event.Event.Hdr.CgroupID)
+	if set.execMatcher == nil {
 		return false, nil, false
 	}
-	return e.execMatcher.Match(event)
+	return set.execMatcher.Match(event)
 }
 
 func (e *Engine) CollectExecAlerts(event events.ProcessedEvent) []MatchedAlert {
-	if e.execMatcher == nil {
+	set := e.setFor(event.Event.Hdr.CgroupID)
+	if set.execMatcher == nil {
 		return nil
 	}
-	return e.execMatcher.CollectAlerts(event)
+	return set.execMatcher.CollectAlerts(event)
 }
 
-func (e *Engine) MatchFile(ino, dev uint64, filename string, pid uint32, cgroupID uint64) (matched bool, rule *Rule, allowed bool) {
-	if e.fileMatcher == nil {
+func (e *Engine) MatchFile(ino, dev uint64, filename string, pid uint32, cgroupID uint64, pidNS uint32) (matched bool, rule *Rule, allowed bool) {
+	set := e.setFor(cgroupID)
+	if set.fileMatcher == nil {
 		return false, nil, false
 	}
-	return e.fileMatcher.Match(ino, dev, filename, pid, cgroupID)
+	return set.fileMatcher.Match(ino, dev, filename, pid, cgroupID, pidNS)
 }
 
-func (e *Engine) CollectFileAlerts(ino, dev uint64, filename string, pid uint32, cgroupID uint64, processName string) []MatchedAlert {
-	if e.fileMatcher == nil {
+func (e *Engine) CollectFileAlerts(ino, dev uint64, filename string, pid uint32, cgroupID uint64, pidNS uint32, processName string) []MatchedAlert {
+	set := e.setFor(cgroupID)
+	if set.fileMatcher == nil {
 		return nil
 	}
-	return e.fileMatcher.CollectAlerts(ino, dev, filename, pid, cgroupID, processName)
+	return set.fileMatcher.CollectAlerts(ino, dev, filename, pid, cgroupID, pidNS, processName)
 }
 
 func (e *Engine) MatchConnect(event *events.ConnectEvent) (matched bool, rule *Rule, allowed bool) {
-	if e.connectMatcher == nil {
+	set := e.setFor(event.Hdr.CgroupID)
+	if set.connectMatcher == nil {
 		return false, nil, false
 	}
-	return e.connectMatcher.Match(event)
+	return set.connectMatcher.Match(event)
 }
 
 func (e *Engine) CollectConnectAlerts(event *events.ConnectEvent, processName string) []MatchedAlert {
-	if e.connectMatcher == nil {
+	set := e.setFor(event.Hdr.CgroupID)
+	if set.connectMatcher == nil {
 		return nil
 	}
-	return e.connectMatcher.CollectAlerts(event, processName)
+	return set.connectMatcher.CollectAlerts(event, processName)
 }
 
 func (e *Engine) GetRules() []Rule {
@@ -41,7 +41,9 @@ func setDefaultMatchTypes(rule *Rule) {
 
 func hasExecCriteria(rule *Rule) bool {
 	m := rule.Match
-	return m.ProcessName != "" || m.ParentName != "" || m.PID != 0 || m.PPID != 0
+	return m.ProcessName != "" || m.ParentName != "" || m.PID != 0 || m.PPID != 0 ||
+		m.HasExeHashes() || m.ExeFirstSeen || m.PidNamespace != "" ||
+		m.Interactive || m.TTY != ""
 }
 
 func (m *execMatcher) indexRule(rule *Rule) {
@@ -123,5 +125,16 @@ func (m *execMatcher) matchRule(rule *Rule, event events.ProcessedEvent) bool {
 		(match.ParentName == "" || matchString(event.Parent, match.ParentName, match.ParentNameType)) &&
 		matchPID(match.PID, event.Event.Hdr.PID) &&
 		(match.PPID == 0 || event.Event.PPID == match.PPID) &&
-		matchCgroupID(match.CgroupID, event.Event.Hdr.CgroupID)
+		matchCgroupID(match.CgroupID, event.Event.Hdr.CgroupID) &&
+		matchPidNamespace(match.PidNamespace, event.Event.Hdr.PidNS) &&
+		match.MatchExeHash(event.Event.ExeSHA256) &&
+		(!match.ExeFirstSeen || event.Event.ExeFirstSeen) &&
+		(!match.Interactive || isInteractive(&event.Event)) &&
+		matchTTY(match.TTY, event.Event.TTY[0] != 0)
+}
+
+// isInteractive reports whether an exec runs in a login session with a
+// terminal.
+func isInteractive(ev *events.ExecEvent) bool {
+	return ev.TTY[0] != 0 && ev.LoginUID != events.AuditUnset
 }
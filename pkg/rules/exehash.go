@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"bufio"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+)
+
+// HasExeHashes reports whether the condition matches on executable digests.
+func (m *MatchCondition) HasExeHashes() bool {
+	return m != nil && (len(m.ExeSHA256) > 0 || m.ExeSHA256File != "")
+}
+
+// MatchExeHash reports whether sum is in the condition's digest list.
+// Conditions without a list match everything; an unknown digest matches no
+// list.
+func (m *MatchCondition) MatchExeHash(sum string) bool {
+	if !m.HasExeHashes() {
+		return true
+	}
+	if sum == "" {
+		return false
+	}
+	_, ok := m.exeHashes[sum]
+	return ok
+}
+
+func (m *MatchCondition) prepareExeHashes() {
+	if !m.HasExeHashes() {
+		m.exeHashes = nil
+		return
+	}
+
+	m.exeHashes = make(map[string]struct{}, len(m.ExeSHA256))
+	for _, sum := range m.ExeSHA256 {
+		if sum, ok := normalizeSHA256(sum); ok {
+			m.exeHashes[sum] = struct{}{}
+		} else {
+			log.Printf("Skipping invalid exe_sha256 %q", sum)
+		}
+	}
+	if m.ExeSHA256File != "" {
+		if err := loadExeHashFile(m.ExeSHA256File, m.exeHashes); err != nil {
+			log.Printf("Failed to load exe_sha256_file %s: %v", m.ExeSHA256File, err)
+		}
+	}
+}
+
+// loadExeHashFile reads one digest per line. Blank lines and lines starting
+// with '#' are ignored, and only the first field is used, so the output of
+// sha256sum can be used directly.
+func loadExeHashFile(path string, into map[string]struct{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if sum, ok := normalizeSHA256(strings.Fields(line)[0]); ok {
+			into[sum] = struct{}{}
+		} else {
+			log.Printf("%s:%d: skipping invalid SHA-256 digest", path, lineNo)
+		}
+	}
+	return scanner.Err()
+}
+
+func normalizeSHA256(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", false
+	}
+	return s, true
+}
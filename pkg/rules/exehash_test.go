@@ -0,0 +1,69 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"aegis/pkg/events"
+)
+
+func execWithDigest(sum string, firstSeen bool) events.ProcessedEvent {
+	ev := events.ExecEvent{ExeSHA256: sum, ExeFirstSeen: firstSeen}
+	return events.ProcessedEvent{Event: ev, Process: "tool", Parent: "bash"}
+}
+
+func TestExeHashDenyListFromFile(t *testing.T) {
+	bad := strings.Repeat("ab", 32)
+	list := filepath.Join(t.TempDir(), "bad.txt")
+	content := "# known bad\n" + strings.ToUpper(bad) + "  /tmp/miner\n\nnot-a-digest\n"
+	if err := os.WriteFile(list, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine([]Rule{{
+		Name:   "Known Bad Binary",
+		Action: ActionBlock,
+		State:  RuleStateProduction,
+		Match:  MatchCondition{ExeSHA256File: list},
+	}})
+
+	if matched, rule, _ := engine.MatchExec(execWithDigest(bad, false)); !matched || rule.Name != "Known Bad Binary" {
+		t.Fatalf("deny-listed digest not matched")
+	}
+	if matched, _, _ := engine.MatchExec(execWithDigest(strings.Repeat("cd", 32), false)); matched {
+		t.Fatal("unlisted digest matched")
+	}
+	if matched, _, _ := engine.MatchExec(execWithDigest("", false)); matched {
+		t.Fatal("event without digest matched a digest rule")
+	}
+}
+
+func TestExeHashAllowListSuppressesFirstSeen(t *testing.T) {
+	trusted := strings.Repeat("01", 32)
+	engine := NewEngine([]Rule{
+		{
+			Name:   "New Binary",
+			Action: ActionAlert,
+			State:  RuleStateProduction,
+			Match:  MatchCondition{ExeFirstSeen: true},
+		},
+		{
+			Name:   "Trusted Binaries",
+			Action: ActionAllow,
+			State:  RuleStateProduction,
+			Match:  MatchCondition{ExeSHA256: []string{trusted}},
+		},
+	})
+
+	if alerts := engine.CollectExecAlerts(execWithDigest(strings.Repeat("02", 32), true)); len(alerts) != 1 {
+		t.Fatalf("got %d alerts for a new binary, want 1", len(alerts))
+	}
+	if alerts := engine.CollectExecAlerts(execWithDigest(trusted, true)); len(alerts) != 0 {
+		t.Fatalf("allow-listed binary raised %d alerts", len(alerts))
+	}
+	if alerts := engine.CollectExecAlerts(execWithDigest(strings.Repeat("02", 32), false)); len(alerts) != 0 {
+		t.Fatalf("known binary raised %d alerts", len(alerts))
+	}
+}
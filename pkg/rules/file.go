@@ -14,6 +14,7 @@ type fileEvent struct {
 	pathVariants   []string
 	pid            uint32
 	cgroupID       uint64
+	pidNS          uint32
 	matchedByInode bool
 }
 
@@ -87,7 +88,7 @@ func newFileMatcher(rules []Rule, testingBuffer *TestingBuffer) *fileMatcher {
 	return matcher
 }
 
-func (m *fileMatcher) Match(ino, dev uint64, filename string, pid uint32, cgroupID uint64) (matched bool, rule *Rule, allowed bool) {
+func (m *fileMatcher) Match(ino, dev uint64, filename string, pid uint32, cgroupID uint64, pidNS uint32) (matched bool, rule *Rule, allowed bool) {
 	if m == nil {
 		return false, nil, false
 	}
@@ -104,6 +105,7 @@ func (m *fileMatcher) Match(ino, dev uint64, filename string, pid uint32, cgroup
 		pathVariants: variants,
 		pid:          pid,
 		cgroupID:     cgroupID,
+		pidNS:        pidNS,
 	}
 
 	if rules := m.inodeRules[InodeKey{Ino: ino, Dev: dev}]; len(rules) > 0 {
@@ -226,7 +228,8 @@ func (m *fileMatcher) matchRule(rule *Rule, event fileEvent) bool {
 		}
 	}
 
-	return matchCgroupID(match.CgroupID, event.cgroupID) && matchPID(match.PID, event.pid)
+	return matchCgroupID(match.CgroupID, event.cgroupID) && matchPID(match.PID, event.pid) &&
+		matchPidNamespace(match.PidNamespace, event.pidNS)
 }
 
 // pathBase is a minimal, allocation-free base path extractor for both absolute and relative paths.
@@ -285,7 +288,7 @@ func (m *fileMatcher) getCandidateRules(event fileEvent, ino, dev uint64) []*Rul
 	return candidates
 }
 
-func (m *fileMatcher) CollectAlerts(ino, dev uint64, filename string, pid uint32, cgroupID uint64, processName string) []MatchedAlert {
+func (m *fileMatcher) CollectAlerts(ino, dev uint64, filename string, pid uint32, cgroupID uint64, pidNS uint32, processName string) []MatchedAlert {
 	variants := utils.PathVariants(filename)
 	if len(variants) == 0 && filename != "" {
 		if normalized := utils.NormalizeFilename(filename); normalized != "" {
@@ -298,6 +301,7 @@ func (m *fileMatcher) CollectAlerts(ino, dev uint64, filename string, pid uint32
 		pathVariants: variants,
 		pid:          pid,
 		cgroupID:     cgroupID,
+		pidNS:        pidNS,
 	}
 
 	candidates := m.getCandidateRules(event, ino, dev)
@@ -41,7 +41,7 @@ func TestInodeMatchingWithHardlink(t *testing.T) {
 		t.Fatal("expected Stat_t for hardlink")
 	}
 
-	matched, rule, allowed := engine.MatchFile(stat.Ino, uint64(stat.Dev), alias, 0, 0)
+	matched, rule, allowed := engine.MatchFile(stat.Ino, uint64(stat.Dev), alias, 0, 0, 0)
 	if !matched {
 		t.Fatal("Expected match for inode")
 	}
@@ -70,7 +70,7 @@ func TestFileRuleFallsBackToPathWhenInodeMissing(t *testing.T) {
 
 	engine := NewEngine(rules)
 
-	matched, rule, allowed := engine.MatchFile(0, 0, target, 0, 0)
+	matched, rule, allowed := engine.MatchFile(0, 0, target, 0, 0, 0)
 	if !matched {
 		t.Fatal("Expected path-based match even when inode missing")
 	}
@@ -96,7 +96,7 @@ func TestRelativePathRuleMatches(t *testing.T) {
 
 	engine := NewEngine(rules)
 
-	matched, _, _ := engine.MatchFile(0, 0, "docs/readme.md", 0, 0)
+	matched, _, _ := engine.MatchFile(0, 0, "docs/readme.md", 0, 0, 0)
 	if !matched {
 		t.Fatal("Expected relative filename rule to match")
 	}
@@ -116,11 +116,11 @@ func TestWildcardFilenameMatchesCanonicalForms(t *testing.T) {
 
 	engine := NewEngine(rules)
 
-	if matched, _, _ := engine.MatchFile(0, 0, "var/log/app.log", 0, 0); !matched {
+	if matched, _, _ := engine.MatchFile(0, 0, "var/log/app.log", 0, 0, 0); !matched {
 		t.Fatal("Expected wildcard rule to match relative form")
 	}
 
-	if matched, _, _ := engine.MatchFile(0, 0, "/var/log/app.log", 0, 0); !matched {
+	if matched, _, _ := engine.MatchFile(0, 0, "/var/log/app.log", 0, 0, 0); !matched {
 		t.Fatal("Expected wildcard rule to match canonical form")
 	}
 }
@@ -2,6 +2,7 @@ package rules
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,18 +13,27 @@ import (
 )
 
 func LoadRules(filePath string) ([]Rule, error) {
+	ruleSet, err := LoadRuleSet(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ruleSet.Rules, nil
+}
+
+// LoadRuleSet loads the rules and the policies that bind them to workloads.
+func LoadRuleSet(filePath string) (RuleSet, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read rules file: %w", err)
+		return RuleSet{}, fmt.Errorf("failed to read rules file: %w", err)
 	}
 
 	var ruleSet RuleSet
 	if err := yaml.Unmarshal(data, &ruleSet); err != nil {
-		return nil, fmt.Errorf("failed to parse rules YAML: %w", err)
+		return RuleSet{}, fmt.Errorf("failed to parse rules YAML: %w", err)
 	}
 
 	if len(ruleSet.Rules) == 0 {
-		return nil, fmt.Errorf("no rules found in file")
+		return RuleSet{}, fmt.Errorf("no rules found in file")
 	}
 
 	for i := range ruleSet.Rules {
@@ -32,7 +42,9 @@ func LoadRules(filePath string) ([]Rule, error) {
 		}
 	}
 
-	if errs := ValidateRules(ruleSet.Rules); len(errs) > 0 {
+	errs := ValidateRules(ruleSet.Rules)
+	errs = append(errs, ValidatePolicies(ruleSet.Policies, ruleSet.Rules)...)
+	if len(errs) > 0 {
 		var b strings.Builder
 		b.WriteString("rule validation failed:\n")
 		for _, err := range errs {
@@ -40,10 +52,10 @@ func LoadRules(filePath string) ([]Rule, error) {
 			b.WriteString(err.Error())
 			b.WriteByte('\n')
 		}
-		return nil, fmt.Errorf("%s", strings.TrimSpace(b.String()))
+		return RuleSet{}, fmt.Errorf("%s", strings.TrimSpace(b.String()))
 	}
 
-	return ruleSet.Rules, nil
+	return ruleSet, nil
 }
 
 func CleanRuleForYAML(rule Rule) Rule {
@@ -68,7 +80,8 @@ func SaveRules(filePath string, ruleList []Rule) error {
 	}
 	
 	ruleSet := RuleSet{
-		Rules: cleanRules,
+		Rules:    cleanRules,
+		Policies: savedPolicies(filePath, cleanRules),
 	}
 
 	dir := filepath.Dir(filePath)
@@ -111,6 +124,36 @@ func SaveRules(filePath string, ruleList []Rule) error {
 	return nil
 }
 
+// savedPolicies returns the policies already in the rules file, so saving
+// rules keeps them. References to rules that no longer exist are dropped.
+func savedPolicies(filePath string, ruleList []Rule) []Policy {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	var existing RuleSet
+	if err := yaml.Unmarshal(data, &existing); err != nil {
+		return nil
+	}
+	names := make(map[string]bool, len(ruleList))
+	for _, r := range ruleList {
+		names[r.Name] = true
+	}
+	for i := range existing.Policies {
+		p := &existing.Policies[i]
+		kept := p.Rules[:0]
+		for _, name := range p.Rules {
+			if names[name] {
+				kept = append(kept, name)
+			} else {
+				log.Printf("Policy %q no longer names deleted rule %q", p.Name, name)
+			}
+		}
+		p.Rules = kept
+	}
+	return existing.Policies
+}
+
 func MergeRules(existing []Rule, newRules []Rule) []Rule {
 	existingSet := make(map[string]bool)
 	for _, r := range existing {
@@ -133,13 +176,19 @@ func MergeRules(existing []Rule, newRules []Rule) []Rule {
 }
 
 func ruleSignature(r Rule) string {
-	return fmt.Sprintf("%s|%s|%s|%s|%d|%s",
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%s|%s|%s|%t|%s|%t|%s",
 		r.Match.ProcessName,
 		r.Match.ParentName,
 		r.Match.Filename,
 		r.Match.DestIP,
 		r.Match.DestPort,
 		r.Action,
+		strings.Join(r.Match.ExeSHA256, ","),
+		r.Match.ExeSHA256File,
+		r.Match.ExeFirstSeen,
+		r.Match.PidNamespace,
+		r.Match.Interactive,
+		r.Match.TTY,
 	)
 }
 
@@ -158,10 +207,18 @@ func ValidateRules(rules []Rule) []error {
 			errs = append(errs, fmt.Errorf("%s: action must be one of allow, alert, block", displayName))
 		}
 
+		if !validPidNamespace(strings.TrimSpace(rule.Match.PidNamespace)) {
+			errs = append(errs, fmt.Errorf("%s: pid_namespace must be host, !host, or a namespace inode number", displayName))
+		}
+
+		if tty := rule.Match.TTY; tty != "" && tty != "present" && tty != "absent" {
+			errs = append(errs, fmt.Errorf("%s: tty must be present or absent", displayName))
+		}
+
 		switch rule.DeriveType() {
 		case RuleTypeExec:
 			if !hasExecCondition(rule.Match) {
-				errs = append(errs, fmt.Errorf("%s: exec rules require process_name, parent_name, cgroup_id, pid, or ppid", displayName))
+				errs = append(errs, fmt.Errorf("%s: exec rules require process_name, parent_name, cgroup_id, pid, ppid, exe_sha256, exe_sha256_file, exe_first_seen, pid_namespace, interactive, or tty", displayName))
 			}
 		case RuleTypeFile:
 			if strings.TrimSpace(rule.Match.Filename) == "" {
@@ -172,6 +229,14 @@ func ValidateRules(rules []Rule) []error {
 				errs = append(errs, fmt.Errorf("%s: connect rules require dest_port, dest_ip, or process_name", displayName))
 			}
 		}
+
+		// The kernel looks file and connect rules up by path or port alone,
+		// so it would block in every namespace.
+		if rule.Action == ActionBlock && rule.Match.PidNamespace != "" {
+			if typ := rule.DeriveType(); typ == RuleTypeFile || typ == RuleTypeConnect {
+				errs = append(errs, fmt.Errorf("%s: %s rules cannot block by pid_namespace; use alert", displayName, typ))
+			}
+		}
 	}
 	return errs
 }
@@ -181,7 +246,12 @@ func hasExecCondition(match MatchCondition) bool {
 		strings.TrimSpace(match.ParentName) != "" ||
 		strings.TrimSpace(match.CgroupID) != "" ||
 		match.PID != 0 ||
-		match.PPID != 0
+		match.PPID != 0 ||
+		match.HasExeHashes() ||
+		match.ExeFirstSeen ||
+		match.PidNamespace != "" ||
+		match.Interactive ||
+		match.TTY != ""
 }
 
 func isValidAction(action ActionType) bool {
@@ -0,0 +1,50 @@
+package rules
+
+import (
+	"testing"
+
+	"aegis/pkg/events"
+)
+
+func execInPidNS(ns uint32) events.ProcessedEvent {
+	ev := events.ExecEvent{Hdr: events.EventHeader{PID: 4242, PidNS: ns, NsPID: 7}}
+	return events.ProcessedEvent{Event: ev, Process: "sh", Parent: "runc"}
+}
+
+func TestPidNamespaceRule(t *testing.T) {
+	const container = 4026532500
+	engine := NewEngine([]Rule{{
+		Name:   "Container Exec",
+		Action: ActionAlert,
+		State:  RuleStateProduction,
+		Match:  MatchCondition{PidNamespace: "!host"},
+	}})
+
+	if matched, _, _ := engine.MatchExec(execInPidNS(container)); !matched {
+		t.Error("exec in a container namespace not matched")
+	}
+	if matched, _, _ := engine.MatchExec(execInPidNS(events.HostPidNS)); matched {
+		t.Error("exec in the host namespace matched")
+	}
+	if matched, _, _ := engine.MatchExec(execInPidNS(0)); matched {
+		t.Error("exec in an unknown namespace matched")
+	}
+
+	if !matchPidNamespace("4026532500", container) || matchPidNamespace("host", container) {
+		t.Error("namespace inode patterns")
+	}
+	if errs := ValidateRules([]Rule{{Name: "Bad", Action: ActionAlert, Match: MatchCondition{PidNamespace: "container"}}}); len(errs) != 1 {
+		t.Errorf("invalid pid_namespace: %v", errs)
+	}
+	for _, match := range []MatchCondition{
+		{Filename: "/etc/shadow", PidNamespace: "!host"},
+		{DestPort: 25, PidNamespace: "host"},
+	} {
+		if errs := ValidateRules([]Rule{{Name: "Bad", Action: ActionBlock, Match: match}}); len(errs) != 1 {
+			t.Errorf("block by pid_namespace %+v: %v", match, errs)
+		}
+	}
+	if errs := ValidateRules([]Rule{{Name: "Exec", Action: ActionBlock, Match: MatchCondition{ProcessName: "sh", PidNamespace: "!host"}}}); len(errs) != 0 {
+		t.Errorf("exec block by pid_namespace: %v", errs)
+	}
+}
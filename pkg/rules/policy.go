@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PolicyMode says how a policy's rules apply to the workloads it selects.
+type PolicyMode string
+
+const (
+	PolicyModeOff     PolicyMode = "off"     // rules are not evaluated
+	PolicyModeMonitor PolicyMode = "monitor" // block rules only alert
+	PolicyModeEnforce PolicyMode = "enforce" // rules apply as written
+)
+
+// MaxPolicies is the number of policies the kernel can tell apart: each
+// gets one bit in the per-cgroup policy mask.
+const MaxPolicies = 32
+
+// Policy groups rules, by name, and binds them to the workloads its
+// selector matches. A rule named by any policy applies only through its
+// policies; rules no policy names apply to every workload.
+type Policy struct {
+	Name     string           `json:"name" yaml:"name"`
+	Mode     PolicyMode       `json:"mode" yaml:"mode"`
+	Selector WorkloadSelector `json:"selector" yaml:"selector"`
+	Rules    []string         `json:"rules" yaml:"rules"`
+}
+
+// WorkloadSelector selects workloads. Every field that is set must match;
+// CgroupPath, Image and SystemdUnit are path globs (e.g.
+// "/system.slice/docker-*.scope", "golang:*").
+type WorkloadSelector struct {
+	CgroupPath  string            `json:"cgroupPath,omitempty" yaml:"cgroup_path,omitempty"`
+	Image       string            `json:"image,omitempty" yaml:"image,omitempty"`
+	SystemdUnit string            `json:"systemdUnit,omitempty" yaml:"systemd_unit,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// Workload is what a selector is matched against.
+type Workload struct {
+	CgroupPath  string
+	Image       string
+	SystemdUnit string
+	Labels      map[string]string // container labels, when the runtime reports them
+}
+
+// WorkloadResolver describes the workload of a cgroup, or returns false
+// while it is not known yet.
+type WorkloadResolver func(cgroupID uint64) (Workload, bool)
+
+// IsZero reports whether the selector sets no field.
+func (s WorkloadSelector) IsZero() bool {
+	return s.CgroupPath == "" && s.Image == "" && s.SystemdUnit == "" && len(s.Labels) == 0
+}
+
+// Matches reports whether w is selected. An empty selector matches nothing.
+func (s WorkloadSelector) Matches(w Workload) bool {
+	if s.IsZero() {
+		return false
+	}
+	if !matchGlob(s.CgroupPath, w.CgroupPath) ||
+		!matchGlob(s.Image, w.Image) ||
+		!matchGlob(s.SystemdUnit, w.SystemdUnit) {
+		return false
+	}
+	for k, v := range s.Labels {
+		if got, ok := w.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matchGlob(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
+
+// RulePolicies maps the name of each rule a policy names to the indexes of
+// the policies naming it, skipping policies that are off.
+func RulePolicies(policies []Policy) map[string][]int {
+	scoped := make(map[string][]int)
+	for i, p := range policies {
+		if p.Mode == PolicyModeOff {
+			continue
+		}
+		for _, name := range p.Rules {
+			scoped[name] = append(scoped[name], i)
+		}
+	}
+	return scoped
+}
+
+// ScopedRuleNames returns the names of the rules any policy names, whatever
+// its mode: such rules never apply globally.
+func ScopedRuleNames(policies []Policy) map[string]bool {
+	names := make(map[string]bool)
+	for _, p := range policies {
+		for _, name := range p.Rules {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// ValidatePolicies checks policies against the rules they name.
+func ValidatePolicies(policies []Policy, ruleList []Rule) []error {
+	var errs []error
+	if len(policies) > MaxPolicies {
+		errs = append(errs, fmt.Errorf("at most %d policies are supported, got %d", MaxPolicies, len(policies)))
+	}
+	ruleNames := make(map[string]bool, len(ruleList))
+	for _, r := range ruleList {
+		ruleNames[r.Name] = true
+	}
+	seen := make(map[string]bool, len(policies))
+	for idx, p := range policies {
+		name := strings.TrimSpace(p.Name)
+		display := fmt.Sprintf("policy %q", name)
+		if name == "" {
+			display = fmt.Sprintf("policy %d", idx+1)
+			errs = append(errs, fmt.Errorf("%s: missing name", display))
+		} else if seen[name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate name", display))
+		}
+		seen[name] = true
+
+		switch p.Mode {
+		case PolicyModeOff, PolicyModeMonitor, PolicyModeEnforce:
+		default:
+			errs = append(errs, fmt.Errorf("%s: mode must be one of off, monitor, enforce", display))
+		}
+		if p.Selector.IsZero() {
+			errs = append(errs, fmt.Errorf("%s: selector requires cgroup_path, image, systemd_unit, or labels", display))
+		}
+		for _, glob := range []string{p.Selector.CgroupPath, p.Selector.Image, p.Selector.SystemdUnit} {
+			if _, err := path.Match(glob, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid pattern %q", display, glob))
+			}
+		}
+		for _, r := range p.Rules {
+			if !ruleNames[r] {
+				errs = append(errs, fmt.Errorf("%s: unknown rule %q", display, r))
+			}
+		}
+	}
+	return errs
+}
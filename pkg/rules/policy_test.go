@@ -0,0 +1,229 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"aegis/pkg/events"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	prodCgroup  = 100
+	buildCgroup = 200
+	otherCgroup = 300
+)
+
+func execIn(cgroupID uint64, process string) events.ProcessedEvent {
+	ev := events.ExecEvent{Hdr: events.EventHeader{PID: 4242, CgroupID: cgroupID}}
+	return events.ProcessedEvent{Event: ev, Process: process}
+}
+
+func policyTestEngine() (*Engine, map[uint64][]int) {
+	ruleList := []Rule{{
+		Name:   "Shell",
+		Action: ActionAlert,
+		State:  RuleStateProduction,
+		Match:  MatchCondition{ProcessName: "sh"},
+	}, {
+		Name:   "No Compilers",
+		Action: ActionBlock,
+		State:  RuleStateProduction,
+		Match:  MatchCondition{ProcessName: "gcc"},
+	}}
+	policies := []Policy{{
+		Name:     "prod",
+		Mode:     PolicyModeEnforce,
+		Selector: WorkloadSelector{SystemdUnit: "*.service"},
+		Rules:    []string{"No Compilers"},
+	}, {
+		Name:     "builds",
+		Mode:     PolicyModeMonitor,
+		Selector: WorkloadSelector{Image: "golang:*", Labels: map[string]string{"ci": "true"}},
+		Rules:    []string{"No Compilers"},
+	}}
+	workloads := map[uint64]Workload{
+		prodCgroup:  {CgroupPath: "/system.slice/api.service", SystemdUnit: "api.service"},
+		buildCgroup: {CgroupPath: "/system.slice/docker-1.scope", Image: "golang:1.22", Labels: map[string]string{"ci": "true"}},
+		otherCgroup: {CgroupPath: "/user.slice", Image: "golang:1.22"},
+	}
+
+	engine := NewPolicyEngine(ruleList, policies)
+	engine.SetWorkloadResolver(func(cgroupID uint64) (Workload, bool) {
+		w, ok := workloads[cgroupID]
+		return w, ok
+	})
+	bound := make(map[uint64][]int)
+	engine.SetBindFunc(func(cgroupID uint64, b []int) { bound[cgroupID] = b })
+	return engine, bound
+}
+
+func TestPolicyScopesRulesToWorkloads(t *testing.T) {
+	engine, bound := policyTestEngine()
+
+	matched, rule, _ := engine.MatchExec(execIn(prodCgroup, "gcc"))
+	if !matched || rule.Policy != "prod" || rule.Action != ActionBlock {
+		t.Fatalf("enforcing policy: matched=%v rule=%+v", matched, rule)
+	}
+	matched, rule, _ = engine.MatchExec(execIn(buildCgroup, "gcc"))
+	if !matched || rule.Policy != "builds" || rule.Action != ActionAlert {
+		t.Fatalf("monitoring policy should downgrade block: matched=%v rule=%+v", matched, rule)
+	}
+	if matched, _, _ := engine.MatchExec(execIn(otherCgroup, "gcc")); matched {
+		t.Error("scoped rule matched a workload no policy selects")
+	}
+	if matched, _, _ := engine.MatchExec(execIn(999, "gcc")); matched {
+		t.Error("scoped rule matched an unknown workload")
+	}
+
+	// Rules no policy names still apply everywhere.
+	for _, id := range []uint64{prodCgroup, buildCgroup, otherCgroup, 999} {
+		if matched, _, _ := engine.MatchExec(execIn(id, "sh")); !matched {
+			t.Errorf("global rule not matched in cgroup %d", id)
+		}
+	}
+
+	if got := bound[prodCgroup]; len(got) != 1 || got[0] != 0 {
+		t.Errorf("prod bindings = %v", got)
+	}
+	if got := engine.BoundPolicies(buildCgroup); len(got) != 1 || got[0] != 1 {
+		t.Errorf("build bindings = %v", got)
+	}
+	if _, ok := bound[999]; ok {
+		t.Error("unknown workload should not be bound")
+	}
+}
+
+func TestPolicyBindingIsRecordedOnce(t *testing.T) {
+	engine, _ := policyTestEngine()
+	var mu sync.Mutex
+	calls := 0
+	engine.SetBindFunc(func(uint64, []int) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if matched, rule, _ := engine.MatchExec(execIn(prodCgroup, "gcc")); !matched || rule.Policy != "prod" {
+				t.Errorf("matched=%v rule=%+v", matched, rule)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("bind func called %d times, want 1", calls)
+	}
+}
+
+func TestPruneBindings(t *testing.T) {
+	engine, bound := policyTestEngine()
+	engine.BoundPolicies(prodCgroup)
+	engine.BoundPolicies(buildCgroup)
+
+	engine.PruneBindings(map[uint64]bool{prodCgroup: true})
+	clear(bound)
+	engine.BoundPolicies(prodCgroup)
+	engine.BoundPolicies(buildCgroup)
+	if _, ok := bound[prodCgroup]; ok {
+		t.Error("live cgroup was bound again")
+	}
+	if _, ok := bound[buildCgroup]; !ok {
+		t.Error("pruned cgroup was not bound again")
+	}
+
+	// A full cache evicts one binding rather than all of them.
+	engine.mu.Lock()
+	engine.limit = 2
+	engine.mu.Unlock()
+	engine.BoundPolicies(otherCgroup)
+	if n := len(engine.bindings); n != 2 {
+		t.Errorf("%d bindings cached, want 2", n)
+	}
+}
+
+func TestPolicyModeOffDisablesRules(t *testing.T) {
+	policies := []Policy{{
+		Name:     "prod",
+		Mode:     PolicyModeOff,
+		Selector: WorkloadSelector{CgroupPath: "/system.slice/*"},
+		Rules:    []string{"No Compilers"},
+	}}
+	engine := NewPolicyEngine([]Rule{{
+		Name:   "No Compilers",
+		Action: ActionBlock,
+		State:  RuleStateProduction,
+		Match:  MatchCondition{ProcessName: "gcc"},
+	}}, policies)
+	engine.SetWorkloadResolver(func(uint64) (Workload, bool) {
+		return Workload{CgroupPath: "/system.slice/api.service"}, true
+	})
+	if matched, _, _ := engine.MatchExec(execIn(prodCgroup, "gcc")); matched {
+		t.Error("rule of a policy that is off matched")
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	ruleList := []Rule{{Name: "Shell"}}
+	valid := Policy{Name: "prod", Mode: PolicyModeEnforce, Selector: WorkloadSelector{Image: "nginx:*"}, Rules: []string{"Shell"}}
+	if errs := ValidatePolicies([]Policy{valid}, ruleList); len(errs) != 0 {
+		t.Fatalf("valid policy: %v", errs)
+	}
+
+	cases := map[string]Policy{
+		"no selector":  {Name: "a", Mode: PolicyModeEnforce},
+		"bad mode":     {Name: "a", Mode: "audit", Selector: valid.Selector},
+		"unknown rule": {Name: "a", Mode: PolicyModeMonitor, Selector: valid.Selector, Rules: []string{"Missing"}},
+		"bad glob":     {Name: "a", Mode: PolicyModeMonitor, Selector: WorkloadSelector{CgroupPath: "/[x"}},
+	}
+	for name, p := range cases {
+		if errs := ValidatePolicies([]Policy{p}, ruleList); len(errs) != 1 {
+			t.Errorf("%s: got %v", name, errs)
+		}
+	}
+	if errs := ValidatePolicies([]Policy{valid, valid}, ruleList); len(errs) != 1 {
+		t.Errorf("duplicate name: got %v", errs)
+	}
+}
+
+func TestSaveRulesKeepsPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	ruleList := []Rule{
+		{Name: "Shell", Action: ActionAlert, Type: RuleTypeExec, State: RuleStateProduction, Match: MatchCondition{ProcessName: "sh"}},
+		{Name: "Curl", Action: ActionAlert, Type: RuleTypeExec, State: RuleStateProduction, Match: MatchCondition{ProcessName: "curl"}},
+	}
+	if err := SaveRules(path, ruleList); err != nil {
+		t.Fatal(err)
+	}
+	policy := Policy{Name: "prod", Mode: PolicyModeEnforce, Selector: WorkloadSelector{Image: "nginx:*"}, Rules: []string{"Shell", "Curl"}}
+	data, err := yaml.Marshal(RuleSet{Rules: ruleList, Policies: []Policy{policy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving the rules alone, as the API does, keeps the policies and drops
+	// the names of deleted rules.
+	if err := SaveRules(path, ruleList[:1]); err != nil {
+		t.Fatal(err)
+	}
+	set, err := LoadRuleSet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Policies) != 1 || set.Policies[0].Name != "prod" {
+		t.Fatalf("policies = %+v", set.Policies)
+	}
+	if got := set.Policies[0].Rules; len(got) != 1 || got[0] != "Shell" {
+		t.Errorf("policy rules = %v", got)
+	}
+}
@@ -0,0 +1,39 @@
+package rules
+
+import (
+	"testing"
+
+	"aegis/pkg/events"
+)
+
+func TestInteractiveAndTTYRules(t *testing.T) {
+	engine := NewEngine([]Rule{{
+		Name:   "Interactive Shell",
+		Action: ActionAlert,
+		State:  RuleStateProduction,
+		Match:  MatchCondition{ProcessName: "sh", Interactive: true},
+	}, {
+		Name:   "Batch Job",
+		Action: ActionAlert,
+		State:  RuleStateProduction,
+		Match:  MatchCondition{ProcessName: "cron", TTY: "absent"},
+	}})
+
+	login := events.ExecEvent{LoginUID: 1001}
+	copy(login.TTY[:], "pts0")
+	if matched, _, _ := engine.MatchExec(events.ProcessedEvent{Event: login, Process: "sh"}); !matched {
+		t.Error("interactive exec not matched")
+	}
+	// A terminal without a login, such as a container started with -t.
+	noLogin := events.ExecEvent{LoginUID: events.AuditUnset, TTY: login.TTY}
+	if matched, _, _ := engine.MatchExec(events.ProcessedEvent{Event: noLogin, Process: "sh"}); matched {
+		t.Error("exec without a login matched interactive")
+	}
+	if matched, _, _ := engine.MatchExec(events.ProcessedEvent{Event: events.ExecEvent{}, Process: "cron"}); !matched {
+		t.Error("exec without a terminal not matched by tty: absent")
+	}
+
+	if errs := ValidateRules([]Rule{{Name: "Bad", Action: ActionAlert, Match: MatchCondition{TTY: "yes"}}}); len(errs) != 1 {
+		t.Errorf("invalid tty: %v", errs)
+	}
+}
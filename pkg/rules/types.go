@@ -77,6 +77,10 @@ type Rule struct {
 	// NEW: Metadata
 	LastReviewedAt *time.Time `json:"last_reviewed_at,omitempty" yaml:"-"`
 	ReviewNotes    string     `json:"review_notes,omitempty" yaml:"-"`
+
+	// Policy names the policy a matched rule was applied through; it is
+	// empty for rules that apply to every workload.
+	Policy string `json:"policy,omitempty" yaml:"-"`
 }
 
 // Helper functions for rule state checks
@@ -114,26 +118,46 @@ func (r *Rule) DeriveType() RuleType {
 }
 
 type MatchCondition struct {
-	ProcessName     string     `yaml:"process_name,omitempty"`
-	ProcessNameType MatchType  `yaml:"process_name_type,omitempty"`
-	ParentName      string     `yaml:"parent_name,omitempty"`
-	ParentNameType  MatchType  `yaml:"parent_name_type,omitempty"`
-	PID             uint32     `yaml:"pid,omitempty"`
-	PPID            uint32     `yaml:"ppid,omitempty"`
-	CgroupID        string     `yaml:"cgroup_id,omitempty"`
-	Filename        string     `yaml:"filename,omitempty"`
-	DestPort        uint16     `yaml:"dest_port,omitempty"`
-	DestIP          string     `yaml:"dest_ip,omitempty"`
-	destIPNet       *net.IPNet `yaml:"-"`
-	destIPPrepared  bool       `yaml:"-"`
-	inode           InodeKey   `yaml:"-"`
-	inodeResolved   bool       `yaml:"-"`
-	pathExactKeys   []string   `yaml:"-"`
-	pathPrefixKeys  []string   `yaml:"-"`
+	ProcessName     string    `yaml:"process_name,omitempty"`
+	ProcessNameType MatchType `yaml:"process_name_type,omitempty"`
+	ParentName      string    `yaml:"parent_name,omitempty"`
+	ParentNameType  MatchType `yaml:"parent_name_type,omitempty"`
+	PID             uint32    `yaml:"pid,omitempty"`
+	PPID            uint32    `yaml:"ppid,omitempty"`
+	CgroupID        string    `yaml:"cgroup_id,omitempty"`
+	Filename        string    `yaml:"filename,omitempty"`
+	DestPort        uint16    `yaml:"dest_port,omitempty"`
+	DestIP          string    `yaml:"dest_ip,omitempty"`
+
+	// PidNamespace matches the process's PID namespace: "host", "!host"
+	// (any container or sandbox) or a namespace inode number.
+	PidNamespace string `yaml:"pid_namespace,omitempty"`
+
+	// Interactive matches execs in a login session with a terminal. TTY
+	// matches on the controlling terminal alone: "present" or "absent".
+	Interactive bool   `yaml:"interactive,omitempty"`
+	TTY         string `yaml:"tty,omitempty"`
+
+	// Executable digests: inline and/or one hex SHA-256 per line in a file
+	// (sha256sum output works). Use with action block as a deny list or
+	// action allow as an allow list.
+	ExeSHA256     []string `yaml:"exe_sha256,omitempty"`
+	ExeSHA256File string   `yaml:"exe_sha256_file,omitempty"`
+	// Match only the first execution of a binary on this host.
+	ExeFirstSeen bool `yaml:"exe_first_seen,omitempty"`
+
+	destIPNet      *net.IPNet `yaml:"-"`
+	destIPPrepared bool       `yaml:"-"`
+	inode          InodeKey   `yaml:"-"`
+	inodeResolved  bool       `yaml:"-"`
+	pathExactKeys  []string   `yaml:"-"`
+	pathPrefixKeys []string   `yaml:"-"`
+	exeHashes      map[string]struct{}
 }
 
 type RuleSet struct {
-	Rules []Rule `yaml:"rules"`
+	Rules    []Rule   `yaml:"rules"`
+	Policies []Policy `yaml:"policies,omitempty"`
 }
 
 type MatchedAlert struct {
@@ -147,6 +171,8 @@ func (m *MatchCondition) Prepare() {
 		return
 	}
 
+	m.prepareExeHashes()
+
 	if m.Filename != "" {
 		m.prepareFilenameKeys(m.Filename)
 		m.prepareInode()
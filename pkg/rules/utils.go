@@ -3,6 +3,8 @@ package rules
 import (
 	"strconv"
 	"strings"
+
+	"aegis/pkg/events"
 )
 
 // match a value against a pattern using the specified match type.
@@ -23,6 +25,44 @@ func matchCgroupID(pattern string, cgroupID uint64) bool {
 	return pattern == "" || strconv.FormatUint(cgroupID, 10) == pattern
 }
 
+// matchPidNamespace matches a pid_namespace condition. An unknown namespace
+// (0, e.g. from replayed events that predate it) matches only an empty
+// pattern.
+func matchPidNamespace(pattern string, ns uint32) bool {
+	switch pattern {
+	case "":
+		return true
+	case "host":
+		return ns == events.HostPidNS
+	case "!host":
+		return ns != 0 && ns != events.HostPidNS
+	default:
+		return ns != 0 && strconv.FormatUint(uint64(ns), 10) == pattern
+	}
+}
+
+// validPidNamespace reports whether pattern is a pid_namespace condition
+// matchPidNamespace understands.
+func validPidNamespace(pattern string) bool {
+	if pattern == "" || pattern == "host" || pattern == "!host" {
+		return true
+	}
+	_, err := strconv.ParseUint(pattern, 10, 32)
+	return err == nil
+}
+
+// matchTTY matches a tty condition: "present" or "absent".
+func matchTTY(pattern string, hasTTY bool) bool {
+	switch pattern {
+	case "present":
+		return hasTTY
+	case "absent":
+		return !hasTTY
+	default:
+		return true
+	}
+}
+
 func matchPID(pattern uint32, pid uint32) bool {
 	return pattern == 0 || pid == pattern
 }
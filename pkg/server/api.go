@@ -2,9 +2,13 @@ package server
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"aegis/pkg/apimodel"
+	"aegis/pkg/ebpf"
 	"aegis/pkg/rules"
 
 	"gopkg.in/yaml.v3"
@@ -18,19 +22,109 @@ func (a *App) GetSystemStats() SystemStatsDTO {
 
 	exec, file, net := a.stats.Rates()
 
-	return SystemStatsDTO{
+	probeStatus := "starting"
+	var mode ebpf.AttachMode
+	if a.core != nil {
+		mode = a.core.AttachMode()
+		switch {
+		case mode == ebpf.AttachModeReplay:
+			probeStatus = "replay"
+		case mode.Enforcing():
+			probeStatus = "active"
+		default:
+			probeStatus = "monitor-only"
+		}
+	}
+
+	dto := SystemStatsDTO{
 		ProcessCount:  processCount,
 		WorkloadCount: a.stats.WorkloadCount(),
 		EventsPerSec:  float64(exec + file + net),
 		AlertCount:    int(a.stats.TotalAlertCount()),
-		ProbeStatus:   "active",
+		ProbeStatus:   probeStatus,
+		ProbeMode:     string(mode),
+		Enforcement:   mode.Enforcing(),
+	}
+	if a.core != nil && a.core.WorkloadReg != nil {
+		s := a.core.WorkloadReg.Stats()
+		dto.WorkloadLimit, dto.WorkloadEvictions = s.MaxSize, s.Evicted
+	}
+	if a.core != nil {
+		dto.PolicyMapFailures = a.core.PolicyMapFailures()
 	}
+	return dto
 }
 
 func (a *App) GetAlerts() []apimodel.Alert {
 	return a.stats.Alerts()
 }
 
+func (a *App) GetWorkloads() []apimodel.Workload {
+	if a.core == nil || a.core.WorkloadReg == nil {
+		return []apimodel.Workload{}
+	}
+
+	list := a.core.WorkloadReg.List()
+	result := make([]apimodel.Workload, 0, len(list))
+	for _, m := range list {
+		wl := WorkloadToFrontend(m)
+		wl.Policies = a.BoundPolicyNames(uint64(m.ID))
+		result = append(result, wl)
+	}
+	return result
+}
+
+// BoundPolicyNames returns the names of the policies bound to a workload.
+func (a *App) BoundPolicyNames(cgroupID uint64) []string {
+	if a.core == nil || a.core.RuleEngine == nil {
+		return nil
+	}
+	engine := a.core.RuleEngine
+	policies := engine.Policies()
+	var names []string
+	for _, i := range engine.BoundPolicies(cgroupID) {
+		names = append(names, policies[i].Name)
+	}
+	return names
+}
+
+// GetPolicies returns the loaded policies with the known workloads bound to
+// each.
+func (a *App) GetPolicies() []apimodel.Policy {
+	if a.core == nil || a.core.RuleEngine == nil {
+		return []apimodel.Policy{}
+	}
+	engine := a.core.RuleEngine
+	policies := engine.Policies()
+	result := make([]apimodel.Policy, len(policies))
+	for i, p := range policies {
+		result[i] = PolicyToFrontend(p)
+	}
+	if a.core.WorkloadReg != nil {
+		for _, m := range a.core.WorkloadReg.List() {
+			id := uint64(m.ID)
+			for _, i := range engine.BoundPolicies(id) {
+				result[i].Workloads = append(result[i].Workloads, strconv.FormatUint(id, 10))
+			}
+		}
+	}
+	for i := range result {
+		sort.Strings(result[i].Workloads)
+	}
+	return result
+}
+
+// ContainerFor returns the container metadata of a known workload, or nil.
+func (a *App) ContainerFor(cgroupID uint64) *apimodel.Container {
+	if a.core == nil || a.core.WorkloadReg == nil {
+		return nil
+	}
+	if m := a.core.WorkloadReg.Get(cgroupID); m != nil {
+		return ContainerToFrontend(m.Container)
+	}
+	return nil
+}
+
 func (a *App) GetRules() []RuleDTO {
 	ruleList := a.GetRulesInternal()
 	result := make([]RuleDTO, len(ruleList))
@@ -102,12 +196,24 @@ func (a *App) FindRuleByName(ruleName string) (*rules.Rule, []rules.Rule) {
 }
 
 func (a *App) SaveAndReloadRules(allRules []rules.Rule) error {
-	if err := rules.SaveRules(a.opts.RulesPath, allRules); err != nil {
+	err := rules.SaveRules(a.opts.RulesPath, allRules)
+	// The save replaces the file, so even a failed one may leave a new,
+	// unprotected inode behind.
+	a.RefreshProtectedFiles()
+	if err != nil {
 		return fmt.Errorf("failed to save rules: %w", err)
 	}
 	return a.reloadRules()
 }
 
+// RefreshProtectedFiles re-registers the agent's self-protected files after
+// it rewrote one of them.
+func (a *App) RefreshProtectedFiles() {
+	if a.core != nil {
+		a.core.RefreshSelfProtection()
+	}
+}
+
 func buildMatchMap(rule rules.Rule) map[string]string {
 	matchMap := make(map[string]string)
 	if rule.Match.ProcessName != "" {
@@ -128,5 +234,23 @@ func buildMatchMap(rule rules.Rule) map[string]string {
 	if rule.Match.CgroupID != "" {
 		matchMap["cgroup_id"] = rule.Match.CgroupID
 	}
+	if rule.Match.PidNamespace != "" {
+		matchMap["pid_namespace"] = rule.Match.PidNamespace
+	}
+	if rule.Match.Interactive {
+		matchMap["interactive"] = "true"
+	}
+	if rule.Match.TTY != "" {
+		matchMap["tty"] = rule.Match.TTY
+	}
+	if len(rule.Match.ExeSHA256) > 0 {
+		matchMap["exe_sha256"] = strings.Join(rule.Match.ExeSHA256, ",")
+	}
+	if rule.Match.ExeSHA256File != "" {
+		matchMap["exe_sha256_file"] = rule.Match.ExeSHA256File
+	}
+	if rule.Match.ExeFirstSeen {
+		matchMap["exe_first_seen"] = "true"
+	}
 	return matchMap
 }
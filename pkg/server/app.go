@@ -6,14 +6,17 @@ import (
 	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"aegis/pkg/ai/sentinel"
 	"aegis/pkg/ai/service"
 	"aegis/pkg/ai/types"
+	"aegis/pkg/capture"
 	"aegis/pkg/config"
 	"aegis/pkg/core"
 	"aegis/pkg/events"
+	"aegis/pkg/metrics"
 	"aegis/pkg/proc"
 	"aegis/pkg/storage"
 	"aegis/pkg/tracer"
@@ -31,6 +34,8 @@ type App struct {
 	aiService *service.Service
 	sentinel  *sentinel.Sentinel
 
+	pipeline atomic.Pointer[tracer.Pipeline]
+
 	ready       chan struct{}
 	stopWatcher chan struct{}
 	watcherMu   sync.Mutex
@@ -192,7 +197,15 @@ func (a *App) Analyze(ctx context.Context, req *types.AnalyzeRequest) (*types.An
 }
 
 func (a *App) Run() error {
-	log.Println("Starting eBPF tracer...")
+	return a.RunContext(context.Background())
+}
+
+// RunContext bootstraps the core components and dispatches events from the
+// configured source until it is exhausted or ctx is cancelled.
+func (a *App) RunContext(ctx context.Context) error {
+	if a.opts.EventSource.Type == tracer.SourceRingBuffer {
+		log.Println("Starting eBPF tracer...")
+	}
 
 	components, err := core.Bootstrap(a.opts)
 	if err != nil {
@@ -200,12 +213,88 @@ func (a *App) Run() error {
 	}
 	defer components.Close()
 
+	// Offline sources would mix replayed activity into the host's history.
+	if a.opts.EventSource.Type == tracer.SourceRingBuffer && a.opts.StatsHistoryPath != "" {
+		a.openStatsHistory(a.opts.StatsHistoryPath)
+		defer func() {
+			if err := a.stats.History().Save(); err != nil {
+				log.Printf("Failed to save stats history: %v", err)
+			}
+		}()
+	}
+
+	chain := a.start(components)
+
+	var recorder *capture.Writer
+	if a.opts.CapturePath != "" {
+		recorder, err = capture.Create(a.opts.CapturePath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := recorder.Close(); err != nil {
+				log.Printf("Failed to close capture file: %v", err)
+			}
+			log.Printf("Captured %d events to %s", recorder.Frames(), a.opts.CapturePath)
+		}()
+		log.Printf("Capturing raw events to %s", a.opts.CapturePath)
+	}
+
+	pipeline := tracer.NewPipeline(tracer.PipelineConfig{
+		Workers:    a.opts.Pipeline.Workers,
+		QueueDepth: a.opts.Pipeline.QueueDepth,
+		DropPolicy: tracer.DropPolicy(a.opts.Pipeline.DropPolicy),
+	}, chain, components.ProcessTree, components.WorkloadReg, components.Storage, components.ProfileReg)
+	if components.ExeReputation != nil {
+		pipeline.SetExecEnricher(components.ExeReputation)
+	}
+	a.pipeline.Store(pipeline)
+
+	metrics := pipeline.Metrics()
+	log.Printf("Event source %s started (%d dispatch workers, queue depth %d, policy %s)",
+		a.opts.EventSource.Type, metrics.Workers, metrics.QueueDepth, metrics.DropPolicy)
+	return tracer.PipelineLoop(ctx, components.Source, recorder, pipeline)
+}
+
+// openStatsHistory loads the persisted rate and alert history, keeping the
+// in-memory one if the file cannot be read.
+func (a *App) openStatsHistory(path string) {
+	history, err := metrics.OpenRollup(path)
+	if err != nil {
+		log.Printf("Stats history unavailable, keeping it in memory: %v", err)
+		return
+	}
+	a.stats.SetHistory(history)
+	log.Printf("Stats history: %s", path)
+}
+
+// PipelineMetrics reports dispatch throughput and backpressure, or false
+// before the event source has started.
+func (a *App) PipelineMetrics() (tracer.PipelineMetrics, bool) {
+	p := a.pipeline.Load()
+	if p == nil {
+		return tracer.PipelineMetrics{}, false
+	}
+	return p.Metrics(), true
+}
+
+// start wires the core components into the app and starts the background
+// workers. It returns the handler chain events must be dispatched to.
+func (a *App) start(components *core.CoreComponents) *events.HandlerChain {
 	a.core = components
 
 	a.stats.SetWorkloadCountFunc(components.WorkloadReg.Count)
 
 	a.bridge.SetRuleEngine(components.ProcessTree, components.RuleEngine)
 	a.bridge.SetWorkloadRegistry(components.WorkloadReg)
+	a.bridge.SetSessions(components.Sessions)
+	if components.ExeReputation != nil {
+		a.bridge.SetExecBlocker(components)
+	}
+	components.ProfileReg.SetDeviationFunc(a.bridge.HandleDeviation)
+	if a.opts.Anomaly.Alerts {
+		components.ProfileReg.SetAnomalyFunc(a.bridge.HandleAnomalies)
+	}
 
 	// Initialize Sentinel if AI service is available
 	if a.aiService != nil {
@@ -230,18 +319,20 @@ func (a *App) Run() error {
 		if d, err := time.ParseDuration(a.opts.AI.SentinelDailyReport); err == nil && d > 0 {
 			cfg.DailyReport = d
 		}
-		a.sentinel = s.WithSchedule(cfg)
+		a.sentinel = s.WithSchedule(cfg).WithHistory(a.stats.History())
 		a.sentinel.Start()
 		log.Println("[Sentinel] AI Sentinel started")
 	}
 
 	go a.watchRulesFile()
+	go a.syncRateLimits()
+	go a.flushState()
 
 	chain := events.NewHandlerChain()
+	// Sessions come first so alerts can name the session of an exec.
+	chain.Add(components.Sessions)
 	chain.Add(a.bridge)
-
-	log.Println("eBPF tracer started")
-	return tracer.EventLoop(components.Reader, chain, components.ProcessTree, components.WorkloadReg, components.Storage, components.ProfileReg)
+	return chain
 }
 
 func (a *App) watchRulesFile() {
@@ -280,6 +371,59 @@ func (a *App) watchRulesFile() {
 	}
 }
 
+// syncRateLimits periodically applies rate limit overrides and policy
+// bindings to the workloads seen since the last tick.
+func (a *App) syncRateLimits() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopWatcher:
+			return
+		case <-ticker.C:
+			if err := a.core.SyncRateLimits(); err != nil {
+				log.Printf("Failed to sync rate limits: %v", err)
+			}
+			if err := a.core.SyncPolicies(); err != nil {
+				log.Printf("Failed to sync policies: %v", err)
+			}
+		}
+	}
+}
+
+// flushState periodically persists newly seen executable digests and
+// changed baselines, which are also written on shutdown. It drops the
+// profiles of processes idle for longer than the process tree keeps them,
+// idle baselines, and rate series idle for longer than their moving average
+// spans.
+func (a *App) flushState() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopWatcher:
+			return
+		case <-ticker.C:
+			if err := a.core.FlushExeSeen(); err != nil {
+				log.Printf("Failed to save executable first-seen state: %v", err)
+			}
+			a.core.ExpireBaselines(a.opts.Baselines, time.Now())
+			if err := a.core.FlushBaselines(); err != nil {
+				log.Printf("Failed to save behavioural baselines: %v", err)
+			}
+			if a.opts.ProcessTreeMaxAge > 0 {
+				a.core.ProfileReg.Prune(time.Now().Add(-a.opts.ProcessTreeMaxAge))
+			}
+			if d := a.core.ProfileReg.Anomalies(); d != nil {
+				cfg := d.Config()
+				d.Prune(time.Now().Add(-time.Duration(cfg.BaselineWindows) * cfg.Window))
+			}
+		}
+	}
+}
+
 func (a *App) reloadRules() error {
 	if a.core == nil {
 		return nil
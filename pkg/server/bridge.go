@@ -3,24 +3,36 @@ package server
 import (
 	"encoding/binary"
 	"fmt"
+	"log"
 	"net"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
 
+	"aegis/pkg/anomaly"
 	"aegis/pkg/apimodel"
 	"aegis/pkg/events"
 	"aegis/pkg/proc"
 	"aegis/pkg/rules"
+	"aegis/pkg/session"
 	"aegis/pkg/utils"
 	"aegis/pkg/workload"
 )
 
+// ExecBlocker terminates a process running a binary or script denied by
+// digest. With everywhere false the file stays allowed in other workloads.
+type ExecBlocker interface {
+	BlockExecutable(pid uint32, sha256, filename string, everywhere bool) error
+}
+
 type Bridge struct {
 	stats            *Stats
 	processTree      *proc.ProcessTree
 	ruleEngine       *rules.Engine
 	workloadRegistry *workload.Registry
+	sessions         *session.Tracker
+	execBlocker      ExecBlocker
 	mu               sync.RWMutex
 }
 
@@ -46,13 +58,31 @@ func (b *Bridge) SetWorkloadRegistry(wr *workload.Registry) {
 	b.workloadRegistry = wr
 }
 
+// SetSessions lets exec alerts name the login session they were raised in.
+// The tracker must see execs before the bridge does.
+func (b *Bridge) SetSessions(t *session.Tracker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sessions = t
+}
+
+// SetExecBlocker enables enforcement of block rules that match on
+// executable digests, which the kernel cannot evaluate on first exec.
+func (b *Bridge) SetExecBlocker(eb ExecBlocker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.execBlocker = eb
+}
+
 func (b *Bridge) HandleExec(ev events.ExecEvent) {
 	b.stats.RecordExec()
+	b.stats.RecordWorkload(ev.Hdr.CgroupID)
 	frontendEvent := ExecToFrontend(ev)
+	frontendEvent.Container = b.containerFor(ev.Hdr.CgroupID)
 	b.stats.PublishEvent(frontendEvent)
 
 	b.mu.RLock()
-	re := b.ruleEngine
+	re, eb, st := b.ruleEngine, b.execBlocker, b.sessions
 	b.mu.RUnlock()
 
 	if re == nil {
@@ -61,6 +91,7 @@ func (b *Bridge) HandleExec(ev events.ExecEvent) {
 
 	comm := utils.ExtractCString(ev.Hdr.Comm[:])
 	pcomm := utils.ExtractCString(ev.PComm[:])
+	sess := sessionOf(st, &ev)
 
 	processed := events.ProcessedEvent{
 		Event:     ev,
@@ -79,7 +110,7 @@ func (b *Bridge) HandleExec(ev events.ExecEvent) {
 
 	// If kernel blocked but no alerts collected, still emit alert
 	if blocked && len(alerts) == 0 {
-		b.emitAlert(apimodel.Alert{
+		b.emitEventAlert(ev.Hdr, apimodel.Alert{
 			ID:          fmt.Sprintf("exec-%d-%d", ev.Hdr.PID, time.Now().UnixNano()),
 			Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 			Severity:    "critical",
@@ -91,6 +122,9 @@ func (b *Bridge) HandleExec(ev events.ExecEvent) {
 			CgroupID:    strconv.FormatUint(ev.Hdr.CgroupID, 10),
 			Action:      "block",
 			Blocked:     true,
+			ExeSHA256:   ev.ExeSHA256,
+			EventID:     ev.Hdr.ID,
+			Session:     sess,
 		})
 		return
 	}
@@ -112,11 +146,20 @@ func (b *Bridge) HandleExec(ev events.ExecEvent) {
 			continue // Skip alert for testing mode
 		}
 
+		alertBlocked := blocked
+		if !blocked && eb != nil && alert.Rule.Action == rules.ActionBlock && alert.Rule.Match.HasExeHashes() {
+			if err := eb.BlockExecutable(ev.Hdr.PID, ev.ExeSHA256, utils.ExtractCString(ev.Filename[:]), alert.Rule.Policy == ""); err != nil {
+				log.Printf("Failed to block %s (pid %d): %v", comm, ev.Hdr.PID, err)
+			} else {
+				alertBlocked = true
+			}
+		}
+
 		severity := alert.Rule.Severity
-		if blocked && severity != "critical" {
+		if alertBlocked && severity != "critical" {
 			severity = "critical"
 		}
-		b.emitAlert(apimodel.Alert{
+		b.emitEventAlert(ev.Hdr, apimodel.Alert{
 			ID:          fmt.Sprintf("exec-%d-%d", ev.Hdr.PID, time.Now().UnixNano()),
 			Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 			Severity:    severity,
@@ -127,14 +170,20 @@ func (b *Bridge) HandleExec(ev events.ExecEvent) {
 			ParentName:  pcomm,
 			CgroupID:    strconv.FormatUint(ev.Hdr.CgroupID, 10),
 			Action:      string(alert.Rule.Action),
-			Blocked:     blocked,
+			Blocked:     alertBlocked,
+			ExeSHA256:   ev.ExeSHA256,
+			EventID:     ev.Hdr.ID,
+			Session:     sess,
+			Policy:      alert.Rule.Policy,
 		})
 	}
 }
 
 func (b *Bridge) HandleFileOpen(ev events.FileOpenEvent, filename string) {
 	b.stats.RecordFile()
+	b.stats.RecordWorkload(ev.Hdr.CgroupID)
 	frontendEvent := FileToFrontend(ev, filename)
+	frontendEvent.Container = b.containerFor(ev.Hdr.CgroupID)
 	b.stats.PublishEvent(frontendEvent)
 
 	b.mu.RLock()
@@ -154,11 +203,11 @@ func (b *Bridge) HandleFileOpen(ev events.FileOpenEvent, filename string) {
 
 	blocked := ev.Hdr.Blocked == 1
 
-	matched, rule, allowed := re.MatchFile(ev.Ino, ev.Dev, filename, ev.Hdr.PID, ev.Hdr.CgroupID)
+	matched, rule, allowed := re.MatchFile(ev.Ino, ev.Dev, filename, ev.Hdr.PID, ev.Hdr.CgroupID, ev.Hdr.PidNS)
 
 	// If kernel blocked the file but Go-side matching failed, still emit alert
 	if blocked && (!matched || rule == nil) {
-		b.emitAlert(apimodel.Alert{
+		b.emitEventAlert(ev.Hdr, apimodel.Alert{
 			ID:          fmt.Sprintf("file-%d-%d", ev.Hdr.PID, time.Now().UnixNano()),
 			Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 			Severity:    "critical",
@@ -169,6 +218,7 @@ func (b *Bridge) HandleFileOpen(ev events.FileOpenEvent, filename string) {
 			CgroupID:    strconv.FormatUint(ev.Hdr.CgroupID, 10),
 			Action:      "block",
 			Blocked:     true,
+			EventID:     ev.Hdr.ID,
 		})
 		return
 	}
@@ -197,7 +247,7 @@ func (b *Bridge) HandleFileOpen(ev events.FileOpenEvent, filename string) {
 	if blocked && severity != "critical" {
 		severity = "critical"
 	}
-	b.emitAlert(apimodel.Alert{
+	b.emitEventAlert(ev.Hdr, apimodel.Alert{
 		ID:          fmt.Sprintf("file-%d-%d", ev.Hdr.PID, time.Now().UnixNano()),
 		Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 		Severity:    severity,
@@ -208,6 +258,8 @@ func (b *Bridge) HandleFileOpen(ev events.FileOpenEvent, filename string) {
 		CgroupID:    strconv.FormatUint(ev.Hdr.CgroupID, 10),
 		Action:      string(rule.Action),
 		Blocked:     blocked,
+		EventID:     ev.Hdr.ID,
+		Policy:      rule.Policy,
 	})
 }
 
@@ -224,7 +276,9 @@ func (b *Bridge) HandleConnect(ev events.ConnectEvent) {
 	}
 
 	b.stats.RecordConnect()
+	b.stats.RecordWorkload(ev.Hdr.CgroupID)
 	frontendEvent := ConnectToFrontend(ev, formatAddr(ev), processName)
+	frontendEvent.Container = b.containerFor(ev.Hdr.CgroupID)
 	b.stats.PublishEvent(frontendEvent)
 
 	if re == nil {
@@ -237,7 +291,7 @@ func (b *Bridge) HandleConnect(ev events.ConnectEvent) {
 
 	// If kernel blocked the connection but Go-side matching failed, still emit alert
 	if blocked && (!matched || rule == nil) {
-		b.emitAlert(apimodel.Alert{
+		b.emitEventAlert(ev.Hdr, apimodel.Alert{
 			ID:          fmt.Sprintf("net-%d-%d", ev.Hdr.PID, time.Now().UnixNano()),
 			Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 			Severity:    "critical",
@@ -248,6 +302,7 @@ func (b *Bridge) HandleConnect(ev events.ConnectEvent) {
 			CgroupID:    strconv.FormatUint(ev.Hdr.CgroupID, 10),
 			Action:      "block",
 			Blocked:     true,
+			EventID:     ev.Hdr.ID,
 		})
 		return
 	}
@@ -276,7 +331,7 @@ func (b *Bridge) HandleConnect(ev events.ConnectEvent) {
 	if blocked && severity != "critical" {
 		severity = "critical"
 	}
-	b.emitAlert(apimodel.Alert{
+	b.emitEventAlert(ev.Hdr, apimodel.Alert{
 		ID:          fmt.Sprintf("net-%d-%d", ev.Hdr.PID, time.Now().UnixNano()),
 		Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
 		Severity:    severity,
@@ -287,16 +342,197 @@ func (b *Bridge) HandleConnect(ev events.ConnectEvent) {
 		CgroupID:    strconv.FormatUint(ev.Hdr.CgroupID, 10),
 		Action:      string(rule.Action),
 		Blocked:     blocked,
+		EventID:     ev.Hdr.ID,
+		Policy:      rule.Policy,
+	})
+}
+
+// HandleTamper reports an attempt to modify Aegis' protected files or to
+// signal the agent. The kernel has already denied it.
+func (b *Bridge) HandleTamper(ev events.TamperEvent) {
+	comm := utils.ExtractCString(ev.Hdr.Comm[:])
+
+	var description string
+	switch ev.Kind {
+	case events.TamperKill:
+		description = fmt.Sprintf("Blocked signal %d to the Aegis agent (pid %d) from %s", ev.Signal, ev.TargetPID, comm)
+	default:
+		description = fmt.Sprintf("Blocked %s of protected file %s by %s",
+			ev.Kind, utils.ExtractCString(ev.Filename[:]), comm)
+	}
+
+	b.emitEventAlert(ev.Hdr, apimodel.Alert{
+		ID:          fmt.Sprintf("tamper-%d-%d", ev.Hdr.PID, time.Now().UnixNano()),
+		Timestamp:   ev.Hdr.Timestamp().UnixMilli(),
+		Severity:    "critical",
+		RuleName:    "Agent Tamper Attempt",
+		Description: description,
+		PID:         ev.Hdr.PID,
+		ProcessName: comm,
+		CgroupID:    strconv.FormatUint(ev.Hdr.CgroupID, 10),
+		Action:      "block",
+		Blocked:     true,
+	})
+}
+
+// HandleDeviation reports behaviour outside a program's learned baseline.
+func (b *Bridge) HandleDeviation(d proc.Deviation) {
+	b.mu.RLock()
+	pt := b.processTree
+	b.mu.RUnlock()
+
+	processName := filepath.Base(d.Key.Exe)
+	if pt != nil {
+		if info, ok := pt.GetProcess(d.PID); ok {
+			processName = info.Comm
+		}
+	}
+
+	var description string
+	switch d.Kind {
+	case proc.BehaviorChild:
+		description = fmt.Sprintf("%s started %s, a child process not seen while learning", d.Key.Exe, d.Value)
+	case proc.BehaviorFile:
+		description = fmt.Sprintf("%s opened a file under %s for the first time", d.Key.Exe, d.Value)
+	case proc.BehaviorPort:
+		description = fmt.Sprintf("%s connected to port %s for the first time", d.Key.Exe, d.Value)
+	case proc.BehaviorDestination:
+		description = fmt.Sprintf("%s connected to %s for the first time", d.Key.Exe, d.Value)
+	default:
+		description = fmt.Sprintf("%s: new %s %s", d.Key.Exe, d.Kind, d.Value)
+	}
+
+	b.emitAlert(apimodel.Alert{
+		ID:          fmt.Sprintf("baseline-%d-%d", d.PID, time.Now().UnixNano()),
+		Timestamp:   d.Time.UnixMilli(),
+		Severity:    "medium",
+		RuleName:    "New Behavior",
+		Description: description,
+		PID:         d.PID,
+		ProcessName: processName,
+		CgroupID:    strconv.FormatUint(d.Key.CgroupID, 10),
+		Action:      "alert",
 	})
 }
 
+// HandleAnomalies reports the rate anomalies completed by one event as a
+// single alert, described by the highest scoring one.
+func (b *Bridge) HandleAnomalies(found []anomaly.Anomaly) {
+	if len(found) == 0 {
+		return
+	}
+	top := found[0]
+
+	var pid uint32
+	var cgroupID string
+	evidence := top.Evidence()
+	for i, a := range found {
+		switch a.Entity.Kind {
+		case anomaly.EntityProcess:
+			if n, err := strconv.ParseUint(a.Entity.ID, 10, 32); err == nil {
+				pid = uint32(n)
+			}
+		case anomaly.EntityWorkload:
+			cgroupID = a.Entity.ID
+		}
+		if i > 0 {
+			evidence = append(evidence, fmt.Sprintf("also %s: z_score=%.1f", a.Entity, a.Score))
+		}
+	}
+
+	b.mu.RLock()
+	pt := b.processTree
+	b.mu.RUnlock()
+	processName := filepath.Base(top.Name)
+	if pt != nil && pid != 0 {
+		if info, ok := pt.GetProcess(pid); ok {
+			processName = info.Comm
+		}
+	}
+
+	b.emitAlert(apimodel.Alert{
+		ID:          fmt.Sprintf("anomaly-%d-%d", pid, time.Now().UnixNano()),
+		Timestamp:   top.Time.UnixMilli(),
+		Severity:    top.Severity,
+		RuleName:    "Rate Anomaly",
+		Description: top.Description(),
+		PID:         pid,
+		ProcessName: processName,
+		CgroupID:    cgroupID,
+		Action:      "alert",
+		Evidence:    evidence,
+	})
+}
+
+// emitEventAlert emits an alert raised by an event, placing the process in
+// the PID namespace the event was recorded in.
+func (b *Bridge) emitEventAlert(hdr events.EventHeader, alert apimodel.Alert) {
+	alert.PidNamespace = PidNamespaceToFrontend(proc.PidNamespaceOf(hdr))
+	b.emitAlert(alert)
+}
+
 func (b *Bridge) emitAlert(alert apimodel.Alert) {
+	cgroupID, err := strconv.ParseUint(alert.CgroupID, 10, 64)
+	if err == nil && alert.Container == nil {
+		alert.Container = b.containerFor(cgroupID)
+	}
+	if alert.PidNamespace == nil && alert.PID != 0 {
+		alert.PidNamespace = b.pidNamespaceFor(alert.PID)
+	}
 	b.stats.AddAlert(alert)
-	if b.workloadRegistry != nil {
-		if cgroupID, err := strconv.ParseUint(alert.CgroupID, 10, 64); err == nil {
-			b.workloadRegistry.RecordAlert(cgroupID, alert.Blocked)
-		}
+	if b.workloadRegistry != nil && err == nil {
+		b.workloadRegistry.RecordAlert(cgroupID, alert.Blocked)
+	}
+}
+
+// containerFor returns the container metadata the registry resolved for a
+// cgroup, or nil. Enrichment runs before delivery, so the workload is known
+// by the time handlers see its events.
+func (b *Bridge) containerFor(cgroupID uint64) *apimodel.Container {
+	b.mu.RLock()
+	wr := b.workloadRegistry
+	b.mu.RUnlock()
+	if wr == nil {
+		return nil
+	}
+	if m := wr.Get(cgroupID); m != nil {
+		return ContainerToFrontend(m.Container)
+	}
+	return nil
+}
+
+// sessionOf returns the login session of an exec, without its commands, or
+// nil.
+func sessionOf(t *session.Tracker, ev *events.ExecEvent) *apimodel.Session {
+	if t == nil {
+		return nil
+	}
+	id, ok := session.IDFor(ev)
+	if !ok {
+		return nil
+	}
+	s, ok := t.Get(id)
+	if !ok {
+		return nil
+	}
+	s.Commands = nil
+	out := SessionToFrontend(s)
+	return &out
+}
+
+// pidNamespaceFor returns the PID namespace the process tree knows for pid,
+// or nil.
+func (b *Bridge) pidNamespaceFor(pid uint32) *apimodel.PidNamespace {
+	b.mu.RLock()
+	pt := b.processTree
+	b.mu.RUnlock()
+	if pt == nil {
+		return nil
+	}
+	if info, ok := pt.GetProcess(pid); ok {
+		return PidNamespaceToFrontend(info.PidNS)
 	}
+	return nil
 }
 
 func (b *Bridge) NotifyRulesReload() {
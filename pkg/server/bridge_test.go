@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"aegis/pkg/apimodel"
+	"aegis/pkg/events"
+	"aegis/pkg/proc"
+	"aegis/pkg/rules"
+	"aegis/pkg/storage"
+	"aegis/pkg/tracer"
+	"aegis/pkg/workload"
+)
+
+// runPipeline feeds source through the same dispatch path the agent uses
+// and returns the bridge's stats once the source is exhausted.
+func runPipeline(t *testing.T, ruleList []rules.Rule, source tracer.EventSource) (*Stats, *storage.Manager) {
+	t.Helper()
+
+	stats := NewServerStats(100, 0)
+	tree := proc.NewEmptyProcessTree(time.Minute, 1000, 50)
+	registry := workload.NewRegistry(100)
+	store := storage.NewManager(1000, 100)
+
+	bridge := NewBridge(stats)
+	bridge.SetRuleEngine(tree, rules.NewEngine(ruleList))
+	bridge.SetWorkloadRegistry(registry)
+	chain := events.NewHandlerChain(bridge)
+
+	if err := tracer.EventLoop(context.Background(), source, nil, chain, tree, registry, store, proc.NewProfileRegistry()); err != nil {
+		t.Fatalf("EventLoop: %v", err)
+	}
+	return stats, store
+}
+
+func encodeJSON(t *testing.T, evs ...tracer.JSONEvent) [][]byte {
+	t.Helper()
+	samples := make([][]byte, 0, len(evs))
+	for _, ev := range evs {
+		sample, err := ev.Encode()
+		if err != nil {
+			t.Fatalf("encode %+v: %v", ev, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func findAlert(alerts []apimodel.Alert, ruleName string) (apimodel.Alert, bool) {
+	for _, a := range alerts {
+		if a.RuleName == ruleName {
+			return a, true
+		}
+	}
+	return apimodel.Alert{}, false
+}
+
+func TestBridgeAlertsOnSyntheticTraffic(t *testing.T) {
+	ruleList := []rules.Rule{
+		{
+			Name:     "Curl Execution",
+			Severity: "medium",
+			Action:   rules.ActionAlert,
+			State:    rules.RuleStateProduction,
+			Match:    rules.MatchCondition{ProcessName: "curl"},
+		},
+		{
+			Name:     "Reverse Shell Port",
+			Severity: "high",
+			Action:   rules.ActionBlock,
+			State:    rules.RuleStateProduction,
+			Match:    rules.MatchCondition{DestPort: 4444},
+		},
+	}
+
+	source := tracer.NewGeneratorSource(7, 0, tracer.SyntheticTraffic)
+	stats, store := runPipeline(t, ruleList, source)
+
+	exec, file, net := stats.Counts()
+	if exec != 3 || file != 2 || net != 2 {
+		t.Fatalf("counts = exec %d, file %d, connect %d; want 3, 2, 2", exec, file, net)
+	}
+	if got := store.Size(); got != 7 {
+		t.Fatalf("stored %d events, want 7", got)
+	}
+
+	alerts := stats.Alerts()
+	curl, ok := findAlert(alerts, "Curl Execution")
+	if !ok {
+		t.Fatalf("missing Curl Execution alert in %+v", alerts)
+	}
+	if curl.ProcessName != "curl" || curl.ParentName != "bash" || curl.Blocked {
+		t.Errorf("unexpected curl alert: %+v", curl)
+	}
+
+	port, ok := findAlert(alerts, "Reverse Shell Port")
+	if !ok {
+		t.Fatalf("missing Reverse Shell Port alert in %+v", alerts)
+	}
+	if port.ProcessName != "sh" || port.Severity != "high" {
+		t.Errorf("unexpected port alert: %+v", port)
+	}
+}
+
+func TestBridgeReportsKernelBlocks(t *testing.T) {
+	// The kernel blocked these without a matching Go-side rule; the bridge
+	// must still surface them.
+	samples := encodeJSON(t,
+		tracer.JSONEvent{Type: "exec", PID: 10, PPID: 1, Comm: "miner", PComm: "sh", Blocked: true},
+		tracer.JSONEvent{Type: "connect", PID: 10, Comm: "miner", Addr: "203.0.113.7", Port: 3333, Blocked: true},
+	)
+	tamper := events.TamperEvent{Kind: events.TamperKill, TargetPID: 99, Signal: 9}
+	tamper.Hdr.PID = 11
+	copy(tamper.Hdr.Comm[:], "pkill")
+	samples = append(samples, events.EncodeTamperEvent(tamper))
+
+	stats, _ := runPipeline(t, nil, tracer.NewSampleSource(samples))
+	alerts := stats.Alerts()
+
+	for _, name := range []string{"Kernel Blocked Execution", "Kernel Blocked Connection", "Agent Tamper Attempt"} {
+		a, ok := findAlert(alerts, name)
+		if !ok {
+			t.Errorf("missing %q alert in %+v", name, alerts)
+			continue
+		}
+		if !a.Blocked || a.Severity != "critical" {
+			t.Errorf("%s: blocked=%v severity=%s, want blocked critical", name, a.Blocked, a.Severity)
+		}
+	}
+	if a, ok := findAlert(alerts, "Kernel Blocked Connection"); ok && !strings.Contains(a.Description, "203.0.113.7:3333") {
+		t.Errorf("connection description %q lacks the destination", a.Description)
+	}
+}
+
+func TestBridgeIgnoresTestingRules(t *testing.T) {
+	ruleList := []rules.Rule{{
+		Name:     "Testing Curl",
+		Severity: "low",
+		Action:   rules.ActionAlert,
+		State:    rules.RuleStateTesting,
+		Match:    rules.MatchCondition{ProcessName: "curl"},
+	}}
+	engine := rules.NewEngine(ruleList)
+
+	stats := NewServerStats(100, 0)
+	bridge := NewBridge(stats)
+	tree := proc.NewEmptyProcessTree(time.Minute, 1000, 50)
+	bridge.SetRuleEngine(tree, engine)
+
+	samples := encodeJSON(t, tracer.JSONEvent{Type: "exec", PID: 20, PPID: 1, Comm: "curl", PComm: "bash"})
+	if err := tracer.EventLoop(context.Background(), tracer.NewSampleSource(samples), nil,
+		events.NewHandlerChain(bridge), tree, nil, nil, nil); err != nil {
+		t.Fatalf("EventLoop: %v", err)
+	}
+
+	if n := stats.AlertCount(); n != 0 {
+		t.Fatalf("testing rule raised %d alerts, want 0", n)
+	}
+	if hits := engine.GetTestingBuffer().GetHitsByRule("Testing Curl"); len(hits) != 1 {
+		t.Fatalf("testing buffer recorded %d hits, want 1", len(hits))
+	}
+}
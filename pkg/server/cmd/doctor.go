@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"aegis/pkg/config"
+	"aegis/pkg/doctor"
+)
+
+// RunDoctor prints the host capability report. It returns an error when a
+// required check fails so the exit status can be used in scripts.
+func RunDoctor(opts config.Options, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report := doctor.Run(context.Background(), opts)
+	if *asJSON {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			return err
+		}
+	} else {
+		report.WriteText(os.Stdout)
+	}
+
+	if !report.OK {
+		return fmt.Errorf("required checks failed")
+	}
+	return nil
+}
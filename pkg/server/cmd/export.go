@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"aegis/pkg/config"
+	"aegis/pkg/export"
+	"aegis/pkg/storage"
+)
+
+// RunExport writes events from the persisted event store, in the formats
+// of GET /api/export/events. It opens the store read-only, so it can run
+// next to a live agent. Alerts are held by the running agent and are
+// exported with GET /api/export/alerts.
+func RunExport(opts config.Options, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", export.FormatJSONL, "output format: jsonl, csv or ecs")
+	dir := fs.String("store", opts.EventStore.Path, "event store directory")
+	since := fs.String("since", "", "oldest event, as RFC 3339 or a duration ago (default: the whole store)")
+	until := fs.String("until", "", "newest event, as RFC 3339 or a duration ago (default: now)")
+	outPath := fs.String("o", "", "output file (default: stdout)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: aegis-web export [events] [flags] [query]")
+		fmt.Fprintln(fs.Output(), `Example: aegis-web export -format csv -since 24h 'type = exec and comm = curl'`)
+		fs.PrintDefaults()
+	}
+
+	if len(args) > 0 && args[0] == "events" {
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "alerts" {
+		return fmt.Errorf("alerts are kept by the running agent; use GET /api/export/alerts")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("no event store configured; set event_store.path or -store")
+	}
+
+	now := time.Now()
+	var err error
+	q := &storage.Query{}
+	if src := strings.Join(fs.Args(), " "); src != "" {
+		if q, err = storage.ParseQuery(src, now); err != nil {
+			return err
+		}
+	}
+	from, to := q.Since, now
+	if !q.Until.IsZero() {
+		to = q.Until
+	}
+	if *since != "" {
+		if from, err = storage.ParseQueryTime(*since, now); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if to, err = storage.ParseQueryTime(*until, now); err != nil {
+			return err
+		}
+	}
+
+	store, err := storage.OpenDiskStoreReadOnly(*dir)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if *outPath != "" {
+		if file, err = os.Create(*outPath); err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	out, err := export.NewEventWriter(w, *format)
+	if err != nil {
+		return err
+	}
+
+	var writeErr error
+	store.Scan(from, to, func(ev *storage.Event) bool {
+		if q.Match(ev, storage.QueryContext{}) {
+			writeErr = out.WriteEvent(ev, nil)
+		}
+		return writeErr == nil
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d events\n", out.Count())
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"aegis/pkg/config"
+	"aegis/pkg/server"
+	"aegis/pkg/tracer"
+)
+
+// RunReplay replays a capture file through rules, alerts and AI without
+// loading BPF. By default the web UI stays up after the replay finishes so
+// the results can be explored; --headless prints the alerts and exits.
+func RunReplay(opts config.Options, args []string, assets embed.FS) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	rulesPath := fs.String("rules", opts.RulesPath, "rules file to evaluate the capture against")
+	speed := fs.Float64("speed", 1, "replay speed multiplier; 0 replays as fast as possible")
+	port := fs.Int("port", 3000, "port for the web GUI")
+	headless := fs.Bool("headless", false, "print alerts to stdout and exit instead of serving the web UI")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: aegis-web replay <capture file> [flags]")
+		fs.PrintDefaults()
+	}
+
+	// Accept the capture file before or after the flags.
+	var capturePath string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		capturePath, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if capturePath == "" {
+		capturePath = fs.Arg(0)
+	}
+	if capturePath == "" {
+		fs.Usage()
+		return fmt.Errorf("missing capture file")
+	}
+
+	opts.RulesPath = *rulesPath
+	opts.EventSource = config.EventSourceOptions{Type: tracer.SourceReplay, Path: capturePath, Speed: *speed}
+	opts.SelfProtection = false
+	opts.CapturePath = ""
+	app := server.NewApp(opts)
+	app.SetReady()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *headless {
+		if err := app.RunContext(ctx); err != nil {
+			return err
+		}
+		alerts := app.GetAlerts()
+		for _, a := range alerts {
+			fmt.Printf("[%s] %s pid=%d process=%s: %s\n", a.Severity, a.RuleName, a.PID, a.ProcessName, a.Description)
+		}
+		exec, file, net := app.Stats().Counts()
+		fmt.Printf("Replayed %d events, %d alerts\n", exec+file+net, len(alerts))
+		return nil
+	}
+
+	go func() {
+		if err := app.RunContext(ctx); err != nil {
+			log.Printf("Replay error: %v", err)
+			return
+		}
+		log.Printf("Replay finished; the UI stays available until interrupted")
+	}()
+	return serve(app, *port, assets)
+}
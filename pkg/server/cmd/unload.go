@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"aegis/pkg/config"
+	"aegis/pkg/ebpf"
+)
+
+// RunUnload detaches pinned programs and removes pinned maps left behind by
+// an agent running with pin_bpf_objects enabled.
+func RunUnload(opts config.Options, args []string) error {
+	fs := flag.NewFlagSet("unload", flag.ContinueOnError)
+	pinPath := fs.String("pin-path", opts.BPFPinPath, "bpffs directory holding pinned Aegis objects")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("must run as root (current euid=%d)", os.Geteuid())
+	}
+
+	if !ebpf.HasPinnedLinks(*pinPath) {
+		log.Printf("No pinned Aegis programs found in %s", *pinPath)
+	}
+	if err := ebpf.UnloadPinned(*pinPath); err != nil {
+		return err
+	}
+	log.Printf("Removed pinned Aegis objects from %s", *pinPath)
+	return nil
+}
@@ -15,10 +15,12 @@ import (
 	"aegis/pkg/config"
 	"aegis/pkg/server"
 	"aegis/pkg/server/handlers"
+	"aegis/pkg/tracer"
 )
 
 func RunWebServer(opts config.Options, port int, assets embed.FS) error {
-	if os.Geteuid() != 0 {
+	// Only the ring buffer source loads BPF programs.
+	if opts.EventSource.Type == tracer.SourceRingBuffer && os.Geteuid() != 0 {
 		return fmt.Errorf("must run as root (current euid=%d)", os.Geteuid())
 	}
 
@@ -28,9 +30,15 @@ func RunWebServer(opts config.Options, port int, assets embed.FS) error {
 	go func() {
 		if err := app.Run(); err != nil {
 			log.Printf("Tracer error: %v", err)
+			log.Printf("Run 'aegis-web doctor' to check kernel and configuration requirements")
 		}
 	}()
 
+	return serve(app, port, assets)
+}
+
+// serve runs the HTTP API and UI until SIGINT or SIGTERM.
+func serve(app *server.App, port int, assets embed.FS) error {
 	mux := http.NewServeMux()
 	registerAPI(mux, app)
 	registerStatic(mux, assets)
@@ -73,4 +81,10 @@ func registerAPI(mux *http.ServeMux, app *server.App) {
 	handlers.RegisterAIHandlers(mux, app)
 	handlers.RegisterSettingsHandlers(mux, app)
 	handlers.RegisterQueryHandlers(mux, app)
+	handlers.RegisterExportHandlers(mux, app)
+	handlers.RegisterWorkloadHandlers(mux, app)
+	handlers.RegisterProcessHandlers(mux, app)
+	handlers.RegisterSessionHandlers(mux, app)
+	handlers.RegisterPolicyHandlers(mux, app)
+	handlers.RegisterSystemHandlers(mux, app)
 }
@@ -11,7 +11,6 @@ import (
 	"aegis/pkg/apimodel"
 	"aegis/pkg/ai/sentinel"
 	"aegis/pkg/ai/types"
-	"aegis/pkg/events"
 	"aegis/pkg/proc"
 	"aegis/pkg/rules"
 	"aegis/pkg/server"
@@ -371,21 +370,27 @@ func registerAIRuleHandlers(mux *http.ServeMux, app *server.App) {
 			return
 		}
 
-		req, event := parseExplainRequest(raw)
-		if event == nil {
-			http.Error(w, "Event not found", http.StatusNotFound)
+		req := parseExplainRequest(raw)
+		if req.EventID == 0 {
+			http.Error(w, "eventId is required", http.StatusBadRequest)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
-		defer cancel()
-
 		core := app.Core()
-		if core == nil {
+		if core == nil || core.Storage == nil {
 			http.Error(w, "Core components not available", http.StatusServiceUnavailable)
 			return
 		}
 
+		event, ok := core.Storage.Get(req.EventID)
+		if !ok {
+			http.Error(w, "Event not found", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+		defer cancel()
+
 		var processTree *proc.ProcessTree
 		if core.ProcessTree != nil {
 			processTree = core.ProcessTree
@@ -624,45 +629,22 @@ func registerAISentinelHandlers(mux *http.ServeMux, app *server.App) {
 
 // --- Explain request parsing ---
 
-func parseExplainRequest(raw map[string]any) (*types.ExplainRequest, *storage.Event) {
+func parseExplainRequest(raw map[string]any) *types.ExplainRequest {
 	var req types.ExplainRequest
-	if v, ok := raw["eventId"].(string); ok {
-		req.EventID = v
-	} else if v, ok := raw["event_id"].(string); ok {
-		req.EventID = v
+	id, ok := raw["eventId"]
+	if !ok {
+		id = raw["event_id"]
+	}
+	switch v := id.(type) {
+	case float64:
+		if v > 0 {
+			req.EventID = uint64(v)
+		}
+	case string:
+		req.EventID, _ = strconv.ParseUint(v, 10, 64)
 	}
 	if v, ok := raw["question"].(string); ok {
 		req.Question = v
 	}
-	if v, ok := raw["eventData"].(map[string]any); ok {
-		req.EventData = &storage.Event{Data: v, Timestamp: time.Now()}
-	} else if v, ok := raw["event_data"].(map[string]any); ok {
-		req.EventData = &storage.Event{Data: v, Timestamp: time.Now()}
-	}
-
-	var event *storage.Event
-	if req.EventData != nil {
-		event = &storage.Event{Timestamp: req.EventData.Timestamp, Data: req.EventData.Data}
-		if m, ok := req.EventData.Data.(map[string]any); ok {
-			if ts, ok := m["timestamp"].(float64); ok {
-				event.Timestamp = time.UnixMilli(int64(ts))
-			} else if hdr, ok := m["header"].(map[string]any); ok {
-				if ts, ok := hdr["timestamp"].(float64); ok {
-					event.Timestamp = time.UnixMilli(int64(ts))
-				}
-			}
-			if t, ok := m["type"].(string); ok {
-				switch t {
-				case "exec":
-					event.Type = events.EventTypeExec
-				case "file":
-					event.Type = events.EventTypeFileOpen
-				case "connect":
-					event.Type = events.EventTypeConnect
-				}
-			}
-		}
-	}
-
-	return &req, event
+	return &req
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"aegis/pkg/apimodel"
 	"aegis/pkg/events"
 	"aegis/pkg/server"
 	"aegis/pkg/storage"
@@ -129,7 +130,7 @@ func RegisterEventsHandlers(mux *http.ServeMux, app *server.App) {
 			}
 
 			// Convert to frontend format
-			frontendEvents := convertEventsToFrontend(filtered)
+			frontendEvents := convertEventsToFrontend(app, filtered)
 
 			json.NewEncoder(w).Encode(map[string]any{
 				"events": frontendEvents,
@@ -195,7 +196,7 @@ func RegisterEventsHandlers(mux *http.ServeMux, app *server.App) {
 			}
 
 			// Convert to frontend format
-			frontendEvents := convertEventsToFrontend(eventList)
+			frontendEvents := convertEventsToFrontend(app, eventList)
 
 			json.NewEncoder(w).Encode(map[string]any{
 				"events": frontendEvents,
@@ -203,8 +204,12 @@ func RegisterEventsHandlers(mux *http.ServeMux, app *server.App) {
 			return
 		}
 
-		// GET /api/events/{id} - Get event by ID
-		eventID := pathParts[0]
+		// GET /api/events/{id} - Get event by ID with its process ancestry
+		eventID, err := strconv.ParseUint(pathParts[0], 10, 64)
+		if err != nil || eventID == 0 {
+			http.Error(w, "Invalid event ID", http.StatusBadRequest)
+			return
+		}
 
 		core := app.Core()
 		if core == nil || core.Storage == nil {
@@ -212,83 +217,84 @@ func RegisterEventsHandlers(mux *http.ServeMux, app *server.App) {
 			return
 		}
 
-		// Search through recent events to find matching ID
-		// Event ID is generated as hash of timestamp + event data
-		eventList, err := core.Storage.Latest(10000) // Search last 10k events
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		var foundEvent *storage.Event
-		for _, ev := range eventList {
-			// Generate ID for this event
-			id := generateEventID(ev)
-			if id == eventID {
-				foundEvent = ev
-				break
-			}
-		}
-
-		if foundEvent == nil {
+		foundEvent, ok := core.Storage.Get(eventID)
+		if !ok {
 			http.Error(w, "Event not found", http.StatusNotFound)
 			return
 		}
 
-		// Convert to frontend format
-		frontendEvent := convertEventToFrontend(foundEvent)
+		frontendEvent := convertEventToFrontend(app, foundEvent)
 		if frontendEvent == nil {
 			http.Error(w, "Event format not supported", http.StatusInternalServerError)
 			return
 		}
 
-		json.NewEncoder(w).Encode(frontendEvent)
+		detail := apimodel.EventDetail{
+			Event:     frontendEvent,
+			Ancestors: []apimodel.ProcessInfo{},
+		}
+		if hdr, ok := foundEvent.Header(); ok && core.ProcessTree != nil {
+			for _, p := range core.ProcessTree.GetAncestors(hdr.PID) {
+				detail.Ancestors = append(detail.Ancestors, server.ProcessToFrontend(p))
+			}
+		}
+
+		json.NewEncoder(w).Encode(detail)
 	})
 }
 
 
-func convertEventsToFrontend(events []*storage.Event) []any {
+func convertEventsToFrontend(app *server.App, events []*storage.Event) []any {
 	frontendEvents := make([]any, 0, len(events))
 	for _, ev := range events {
-		if fe := convertEventToFrontend(ev); fe != nil {
+		if fe := convertEventToFrontend(app, ev); fe != nil {
 			frontendEvents = append(frontendEvents, fe)
 		}
 	}
 	return frontendEvents
 }
 
-
-func convertEventToFrontend(ev *storage.Event) any {
-	switch ev.Type {
-	case events.EventTypeExec:
-		switch v := ev.Data.(type) {
-		case *events.ExecEvent:
-			return server.ExecToFrontend(*v)
-		case events.ExecEvent:
-			return server.ExecToFrontend(v)
-		}
-	case events.EventTypeFileOpen:
-		switch v := ev.Data.(type) {
-		case *events.FileOpenEvent:
-			filename := utils.ExtractCString(v.Filename[:])
-			return server.FileToFrontend(*v, filename)
-		case events.FileOpenEvent:
-			filename := utils.ExtractCString(v.Filename[:])
-			return server.FileToFrontend(v, filename)
-		}
-	case events.EventTypeConnect:
-		switch v := ev.Data.(type) {
-		case *events.ConnectEvent:
-			ip := utils.ExtractIP(v)
-			addr := fmt.Sprintf("%s:%d", ip, v.Port)
-			processName := utils.ExtractCString(v.Hdr.Comm[:])
-			return server.ConnectToFrontend(*v, addr, processName)
-		case events.ConnectEvent:
-			ip := utils.ExtractIP(&v)
-			addr := fmt.Sprintf("%s:%d", ip, v.Port)
-			processName := utils.ExtractCString(v.Hdr.Comm[:])
-			return server.ConnectToFrontend(v, addr, processName)
-		}
+// convertEventToFrontend converts a stored event and attaches the container
+// metadata of its workload.
+func convertEventToFrontend(app *server.App, ev *storage.Event) any {
+	hdr, ok := ev.Header()
+	if !ok {
+		return nil
+	}
+	container := app.ContainerFor(hdr.CgroupID)
+
+	switch v := ev.Data.(type) {
+	case *events.ExecEvent:
+		return execToFrontend(*v, container)
+	case events.ExecEvent:
+		return execToFrontend(v, container)
+	case *events.FileOpenEvent:
+		return fileToFrontend(*v, container)
+	case events.FileOpenEvent:
+		return fileToFrontend(v, container)
+	case *events.ConnectEvent:
+		return connectToFrontend(*v, container)
+	case events.ConnectEvent:
+		return connectToFrontend(v, container)
 	}
 	return nil
 }
+
+func execToFrontend(ev events.ExecEvent, container *apimodel.Container) apimodel.ExecEvent {
+	fe := server.ExecToFrontend(ev)
+	fe.Container = container
+	return fe
+}
+
+func fileToFrontend(ev events.FileOpenEvent, container *apimodel.Container) apimodel.FileEvent {
+	fe := server.FileToFrontend(ev, utils.ExtractCString(ev.Filename[:]))
+	fe.Container = container
+	return fe
+}
+
+func connectToFrontend(ev events.ConnectEvent, container *apimodel.Container) apimodel.ConnectEvent {
+	addr := fmt.Sprintf("%s:%d", utils.ExtractIP(&ev), ev.Port)
+	fe := server.ConnectToFrontend(ev, addr, utils.ExtractCString(ev.Hdr.Comm[:]))
+	fe.Container = container
+	return fe
+}
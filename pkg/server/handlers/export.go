@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"aegis/pkg/apimodel"
+	"aegis/pkg/export"
+	"aegis/pkg/server"
+	"aegis/pkg/storage"
+)
+
+// exportFlushEvery is how many records are written between flushes of a
+// chunked export response.
+const exportFlushEvery = 1000
+
+func RegisterExportHandlers(mux *http.ServeMux, app *server.App) {
+	// GET /api/export/events?format=csv&query=type = exec&from=24h streams
+	// the events matching query in [from, to]. from defaults to the query's
+	// since, or 24 hours ago; to defaults to its until, or now.
+	mux.HandleFunc("/api/export/events", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		core := app.Core()
+		if core == nil || core.Storage == nil {
+			writeJSONStringError(w, http.StatusServiceUnavailable, "storage not available")
+			return
+		}
+
+		params := r.URL.Query()
+		now := time.Now()
+		q := &storage.Query{}
+		if src := params.Get("query"); src != "" {
+			var err error
+			if q, err = storage.ParseQuery(src, now); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		defFrom, defTo := now.Add(-24*time.Hour), now
+		if !q.Since.IsZero() {
+			defFrom = q.Since
+		}
+		if !q.Until.IsZero() {
+			defTo = q.Until
+		}
+		from, to, limit, err := exportRange(params, now, defFrom, defTo)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		format := params.Get("format")
+		if format == "" {
+			format = export.FormatJSONL
+		}
+		out, err := export.NewEventWriter(w, format)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		startExport(w, "events", format, now)
+
+		ctx := storage.QueryContext{CgroupPath: cgroupPathResolver(core.WorkloadReg)}
+		flusher, _ := w.(http.Flusher)
+		var writeErr error
+		err = core.Storage.Scan(from, to, func(ev *storage.Event) bool {
+			if !q.Match(ev, ctx) {
+				return true
+			}
+			var container *apimodel.Container
+			if hdr, ok := ev.Header(); ok {
+				container = app.ContainerFor(hdr.CgroupID)
+			}
+			if writeErr = out.WriteEvent(ev, container); writeErr != nil {
+				return false
+			}
+			if out.Count()%exportFlushEvery == 0 {
+				writeErr = flushExport(out, flusher)
+			}
+			return writeErr == nil && r.Context().Err() == nil && (limit == 0 || out.Count() < limit)
+		})
+		if err == nil {
+			err = writeErr
+		}
+		if err == nil {
+			err = flushExport(out, flusher)
+		}
+		if err != nil && r.Context().Err() == nil {
+			log.Printf("Event export stopped after %d events: %v", out.Count(), err)
+		}
+	})
+
+	// GET /api/export/alerts?format=ecs&from=6h&severity=high,critical
+	// streams the alerts held in memory, optionally narrowed by time,
+	// severity and rule name.
+	mux.HandleFunc("/api/export/alerts", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		params := r.URL.Query()
+		now := time.Now()
+		from, to, limit, err := exportRange(params, now, time.Time{}, now)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		severities := make(map[string]bool)
+		for _, s := range strings.Split(params.Get("severity"), ",") {
+			if s = strings.TrimSpace(strings.ToLower(s)); s != "" {
+				severities[s] = true
+			}
+		}
+		rule := params.Get("rule")
+
+		format := params.Get("format")
+		if format == "" {
+			format = export.FormatJSONL
+		}
+		out, err := export.NewAlertWriter(w, format)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		startExport(w, "alerts", format, now)
+
+		for _, a := range app.GetAlerts() {
+			ts := time.UnixMilli(a.Timestamp)
+			if ts.Before(from) || ts.After(to) {
+				continue
+			}
+			if len(severities) > 0 && !severities[strings.ToLower(a.Severity)] {
+				continue
+			}
+			if rule != "" && a.RuleName != rule {
+				continue
+			}
+			if err = out.WriteAlert(a); err != nil || (limit > 0 && out.Count() >= limit) {
+				break
+			}
+		}
+		if err == nil {
+			err = out.Flush()
+		}
+		if err != nil && r.Context().Err() == nil {
+			log.Printf("Alert export stopped after %d alerts: %v", out.Count(), err)
+		}
+	})
+}
+
+// exportRange parses the from, to and limit parameters of an export.
+func exportRange(params url.Values, now, defFrom, defTo time.Time) (from, to time.Time, limit int, err error) {
+	if from, err = parseHistoryTime(params.Get("from"), now, defFrom); err != nil {
+		return from, to, 0, fmt.Errorf("invalid from: %w", err)
+	}
+	if to, err = parseHistoryTime(params.Get("to"), now, defTo); err != nil {
+		return from, to, 0, fmt.Errorf("invalid to: %w", err)
+	}
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return from, to, 0, fmt.Errorf("invalid limit %q", v)
+		}
+	}
+	return from, to, limit, nil
+}
+
+// startExport sets the headers of a chunked export download.
+func startExport(w http.ResponseWriter, kind, format string, now time.Time) {
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="aegis-%s-%s.%s"`,
+		kind, now.UTC().Format("20060102T150405Z"), export.Extension(format)))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+}
+
+func flushExport(out *export.Writer, flusher http.Flusher) error {
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
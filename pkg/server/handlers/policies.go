@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"aegis/pkg/server"
+)
+
+func RegisterPolicyHandlers(mux *http.ServeMux, app *server.App) {
+	// GET /api/policies lists the policies in the rules file with their
+	// mode, selector, rules and the known workloads bound to each.
+	mux.HandleFunc("/api/policies", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"policies": app.GetPolicies(),
+		})
+	})
+}
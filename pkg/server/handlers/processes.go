@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"aegis/pkg/apimodel"
+	"aegis/pkg/server"
+)
+
+const (
+	defaultProcessLimit = 500
+	maxProcessLimit     = 5000
+	defaultTreeDepth    = 4
+	maxTreeDepth        = 64
+	maxTreeNodes        = 5000
+	processEventLimit   = 50
+)
+
+func RegisterProcessHandlers(mux *http.ServeMux, app *server.App) {
+	// GET /api/processes?comm=curl&cgroup_id=123&ppid=1&limit=100 lists the
+	// tracked processes, ordered by PID. comm matches case-insensitive
+	// substrings.
+	mux.HandleFunc("/api/processes", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		core := app.Core()
+		if core == nil || core.ProcessTree == nil {
+			writeJSONStringError(w, http.StatusServiceUnavailable, "process tree not available")
+			return
+		}
+
+		params := r.URL.Query()
+		comm := strings.ToLower(params.Get("comm"))
+		var cgroupID, ppid uint64
+		var hasCgroup, hasPPID bool
+		if v := params.Get("cgroup_id"); v != "" {
+			var err error
+			if cgroupID, err = strconv.ParseUint(v, 10, 64); err != nil {
+				writeJSONStringError(w, http.StatusBadRequest, "invalid cgroup_id")
+				return
+			}
+			hasCgroup = true
+		}
+		if v := params.Get("ppid"); v != "" {
+			var err error
+			if ppid, err = strconv.ParseUint(v, 10, 32); err != nil {
+				writeJSONStringError(w, http.StatusBadRequest, "invalid ppid")
+				return
+			}
+			hasPPID = true
+		}
+		limit, ok := intParam(params.Get("limit"), defaultProcessLimit, maxProcessLimit)
+		if !ok {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+
+		matched := make([]apimodel.ProcessInfo, 0)
+		total := 0
+		for _, p := range core.ProcessTree.Processes() {
+			if comm != "" && !strings.Contains(strings.ToLower(p.Comm), comm) {
+				continue
+			}
+			if hasCgroup && p.CgroupID != cgroupID {
+				continue
+			}
+			if hasPPID && uint64(p.PPID) != ppid {
+				continue
+			}
+			total++
+			if len(matched) < limit {
+				matched = append(matched, server.ProcessToFrontend(p))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"processes": matched,
+			"total":     total,
+		})
+	})
+
+	// GET /api/processes/tree?root=1&depth=4 returns the process tree below
+	// root as nested JSON. GET /api/processes/{pid} returns one process with
+	// its ancestors, children, profile and recent events.
+	mux.HandleFunc("/api/processes/", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		core := app.Core()
+		if core == nil || core.ProcessTree == nil {
+			writeJSONStringError(w, http.StatusServiceUnavailable, "process tree not available")
+			return
+		}
+		tree := core.ProcessTree
+
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/processes/"), "/")
+		if rest == "tree" {
+			params := r.URL.Query()
+			root := uint64(1)
+			if v := params.Get("root"); v != "" {
+				var err error
+				if root, err = strconv.ParseUint(v, 10, 32); err != nil {
+					writeJSONStringError(w, http.StatusBadRequest, "invalid root")
+					return
+				}
+			}
+			depth, ok := intParam(params.Get("depth"), defaultTreeDepth, maxTreeDepth)
+			if !ok {
+				writeJSONStringError(w, http.StatusBadRequest, "invalid depth")
+				return
+			}
+			writeJSON(w, http.StatusOK, server.ProcessNodeToFrontend(tree.Subtree(uint32(root), depth, maxTreeNodes)))
+			return
+		}
+
+		pid, err := strconv.ParseUint(rest, 10, 32)
+		if err != nil {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid pid")
+			return
+		}
+		info, ok := tree.GetProcess(uint32(pid))
+		if !ok {
+			writeJSONStringError(w, http.StatusNotFound, "process not tracked")
+			return
+		}
+
+		detail := apimodel.ProcessDetail{
+			Process:   server.ProcessToFrontend(info),
+			Ancestors: []apimodel.ProcessInfo{},
+			Children:  []apimodel.ProcessInfo{},
+			Container: app.ContainerFor(info.CgroupID),
+			Events:    []any{},
+		}
+		// GetAncestors starts with the process itself.
+		if chain := tree.GetAncestors(info.PID); len(chain) > 1 {
+			for _, p := range chain[1:] {
+				detail.Ancestors = append(detail.Ancestors, server.ProcessToFrontend(p))
+			}
+		}
+		for _, p := range tree.GetChildren(info.PID) {
+			detail.Children = append(detail.Children, server.ProcessToFrontend(p))
+		}
+		if core.ProfileReg != nil {
+			if profile, ok := core.ProfileReg.GetProfile(info.PID); ok {
+				detail.Profile = server.ProfileToFrontend(profile)
+			}
+		}
+		if core.Storage != nil {
+			evs := core.Storage.QueryByPID(info.PID)
+			if len(evs) > processEventLimit {
+				evs = evs[len(evs)-processEventLimit:]
+			}
+			detail.Events = convertEventsToFrontend(app, evs)
+		}
+		writeJSON(w, http.StatusOK, detail)
+	})
+}
+
+// intParam parses a non-negative integer parameter, returning def when it
+// is empty and capping it at limit.
+func intParam(v string, def, limit int) (int, bool) {
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return min(n, limit), true
+}
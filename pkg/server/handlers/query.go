@@ -10,7 +10,7 @@ import (
 	"aegis/pkg/events"
 	"aegis/pkg/server"
 	"aegis/pkg/storage"
-	"aegis/pkg/utils"
+	"aegis/pkg/workload"
 )
 
 func RegisterQueryHandlers(mux *http.ServeMux, app *server.App) {
@@ -28,20 +28,14 @@ func RegisterQueryHandlers(mux *http.ServeMux, app *server.App) {
 		}
 
 		var req struct {
-			Filter struct {
-				Types      []string `json:"types"`
-				Processes  []string `json:"processes"`
-				PIDs       []uint32 `json:"pids"`
-				CgroupIDs  []uint64 `json:"cgroup_ids"`
-				TimeWindow struct {
-					Start string `json:"start"`
-					End   string `json:"end"`
-				} `json:"time_window"`
-			} `json:"filter"`
-			Page      int    `json:"page"`
-			Limit     int    `json:"limit"`
-			SortBy    string `json:"sort_by"`
-			SortOrder string `json:"sort_order"`
+			// Query is an event query (see storage.ParseQuery). When set,
+			// it replaces the structured filter fields below.
+			Query     string      `json:"query"`
+			Filter    eventFilter `json:"filter"`
+			Page      int         `json:"page"`
+			Limit     int         `json:"limit"`
+			SortBy    string      `json:"sort_by"`
+			SortOrder string      `json:"sort_order"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -54,52 +48,45 @@ func RegisterQueryHandlers(mux *http.ServeMux, app *server.App) {
 			return
 		}
 
-		// Build storage filter
-		filter := storage.Filter{
-			PIDs:      req.Filter.PIDs,
-			CgroupIDs: req.Filter.CgroupIDs,
-			Processes: req.Filter.Processes,
-		}
-
-		// Convert type strings to EventType
-		for _, t := range req.Filter.Types {
-			switch strings.ToLower(t) {
-			case "exec":
-				filter.Types = append(filter.Types, events.EventTypeExec)
-			case "file", "fileopen":
-				filter.Types = append(filter.Types, events.EventTypeFileOpen)
-			case "connect", "network":
-				filter.Types = append(filter.Types, events.EventTypeConnect)
-			}
-		}
-
-		// Query events
 		var allEvents []*storage.Event
-		var err error
-
-		if req.Filter.TimeWindow.Start != "" && req.Filter.TimeWindow.End != "" {
-			startTime, err1 := time.Parse(time.RFC3339, req.Filter.TimeWindow.Start)
-			endTime, err2 := time.Parse(time.RFC3339, req.Filter.TimeWindow.End)
-			if err1 == nil && err2 == nil {
-				allEvents, err = core.Storage.Query(startTime, endTime)
-			} else {
-				allEvents, err = core.Storage.Latest(10000)
+		var plan string
+		if req.Query != "" {
+			q, err := storage.ParseQuery(req.Query, time.Now())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			res, err := core.Storage.Execute(q, storage.QueryContext{CgroupPath: cgroupPathResolver(core.WorkloadReg)})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to query events: %v", err), http.StatusInternalServerError)
+				return
 			}
+			allEvents, plan = res.Events, res.Plan
 		} else {
-			allEvents, err = core.Storage.Latest(10000)
+			var err error
+			allEvents, err = legacyQuery(core.Storage, req.Filter)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to query events: %v", err), http.StatusInternalServerError)
+				return
+			}
+			plan = "filter"
 		}
 
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to query events: %v", err), http.StatusInternalServerError)
-			return
+		// Container filters select workloads, and through them cgroups
+		var cgroupAllowed map[uint64]bool
+		if !req.Filter.containerFilter.empty() {
+			cgroupAllowed = req.Filter.containerFilter.cgroups(core.WorkloadReg)
 		}
 
 		// Apply filters
 		filteredEvents := make([]*storage.Event, 0)
 		for _, event := range allEvents {
-			if matchesFilter(event, &filter) {
-				filteredEvents = append(filteredEvents, event)
+			if cgroupAllowed != nil {
+				if hdr, ok := event.Header(); !ok || !cgroupAllowed[hdr.CgroupID] {
+					continue
+				}
 			}
+			filteredEvents = append(filteredEvents, event)
 		}
 
 		// Paginate
@@ -152,48 +139,7 @@ func RegisterQueryHandlers(mux *http.ServeMux, app *server.App) {
 		}
 
 		// Convert storage events to frontend events
-		frontendEvents := make([]any, 0, len(displayedEvents))
-		for _, ev := range displayedEvents {
-			if ev == nil {
-				continue
-			}
-			switch ev.Type {
-			case events.EventTypeExec:
-				var execEv *events.ExecEvent
-				if ptr, ok := ev.Data.(*events.ExecEvent); ok {
-					execEv = ptr
-				} else if val, ok := ev.Data.(events.ExecEvent); ok {
-					execEv = &val
-				}
-				if execEv != nil {
-					frontendEvents = append(frontendEvents, server.ExecToFrontend(*execEv))
-				}
-			case events.EventTypeFileOpen:
-				var fileEv *events.FileOpenEvent
-				if ptr, ok := ev.Data.(*events.FileOpenEvent); ok {
-					fileEv = ptr
-				} else if val, ok := ev.Data.(events.FileOpenEvent); ok {
-					fileEv = &val
-				}
-				if fileEv != nil {
-					filename := utils.ExtractCString(fileEv.Filename[:])
-					frontendEvents = append(frontendEvents, server.FileToFrontend(*fileEv, filename))
-				}
-			case events.EventTypeConnect:
-				var connEv *events.ConnectEvent
-				if ptr, ok := ev.Data.(*events.ConnectEvent); ok {
-					connEv = ptr
-				} else if val, ok := ev.Data.(events.ConnectEvent); ok {
-					connEv = &val
-				}
-				if connEv != nil {
-					ip := utils.ExtractIP(connEv)
-					addr := fmt.Sprintf("%s:%d", ip, connEv.Port)
-					processName := utils.ExtractCString(connEv.Hdr.Comm[:])
-					frontendEvents = append(frontendEvents, server.ConnectToFrontend(*connEv, addr, processName))
-				}
-			}
-		}
+		frontendEvents := convertEventsToFrontend(app, displayedEvents)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]any{
@@ -203,6 +149,283 @@ func RegisterQueryHandlers(mux *http.ServeMux, app *server.App) {
 			"limit":       limit,
 			"total_pages": totalPages,
 			"type_counts": typeCounts,
+			"plan":        plan,
 		})
 	})
+
+	mux.HandleFunc("/api/query/aggregate", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			return
+		}
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req struct {
+			Query    string   `json:"query"`
+			Op       string   `json:"op"`
+			GroupBy  []string `json:"group_by"`
+			Field    string   `json:"field"`
+			Limit    int      `json:"limit"`
+			Interval string   `json:"interval"`
+			Window   string   `json:"window"` // e.g. "1h"; overridden by since in the query
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		core := app.Core()
+		if core == nil || core.Storage == nil {
+			http.Error(w, "Storage not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		now := time.Now()
+		q, err := storage.ParseQuery(req.Query, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Window != "" && q.Since.IsZero() {
+			window, err := time.ParseDuration(req.Window)
+			if err != nil || window <= 0 {
+				http.Error(w, "Invalid window", http.StatusBadRequest)
+				return
+			}
+			q.Since = now.Add(-window)
+			if q.Until.IsZero() {
+				q.Until = now
+			}
+		}
+
+		agg := storage.Aggregation{Op: req.Op, GroupBy: req.GroupBy, Field: req.Field, Limit: req.Limit}
+		if req.Interval != "" {
+			if agg.Interval, err = time.ParseDuration(req.Interval); err != nil {
+				http.Error(w, "Invalid interval", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := agg.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res, err := core.Storage.Aggregate(q, agg, storage.QueryContext{CgroupPath: cgroupPathResolver(core.WorkloadReg)})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		type group struct {
+			Key     []string `json:"key"`
+			Count   int      `json:"count"`
+			Blocked int      `json:"blocked"`
+		}
+		type bucket struct {
+			Start   int64 `json:"start"` // Unix milliseconds
+			Count   int   `json:"count"`
+			Blocked int   `json:"blocked"`
+		}
+		resp := map[string]any{
+			"op":        agg.Op,
+			"matched":   res.Matched,
+			"scanned":   res.Scanned,
+			"plan":      res.Plan,
+			"truncated": res.Truncated,
+		}
+		switch agg.Op {
+		case storage.AggCount, storage.AggTop:
+			groups := make([]group, len(res.Groups))
+			for i, g := range res.Groups {
+				groups[i] = group{Key: g.Key, Count: g.Count, Blocked: g.Blocked}
+			}
+			resp["group_by"] = agg.GroupBy
+			resp["groups"] = groups
+		case storage.AggDistinct:
+			resp["field"] = agg.Field
+			resp["distinct"] = res.Distinct
+		case storage.AggHistogram:
+			buckets := make([]bucket, len(res.Buckets))
+			for i, b := range res.Buckets {
+				buckets[i] = bucket{Start: b.Start.UnixMilli(), Count: b.Count, Blocked: b.Blocked}
+			}
+			resp["interval_ms"] = agg.Interval.Milliseconds()
+			resp["buckets"] = buckets
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// eventFilter is the structured filter form of /api/query.
+type eventFilter struct {
+	Types     []string `json:"types"`
+	Processes []string `json:"processes"`
+	PIDs      []uint32 `json:"pids"`
+	CgroupIDs []uint64 `json:"cgroup_ids"`
+	containerFilter
+	TimeWindow struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	} `json:"time_window"`
+
+	// Answered from the storage indexes
+	Paths        []string `json:"paths"`
+	PathPrefixes []string `json:"path_prefixes"`
+	DstIPs       []string `json:"dst_ips"`
+	DstPorts     []uint16 `json:"dst_ports"`
+	CmdlineTerms []string `json:"cmdline_terms"`
+}
+
+// legacyQuery answers the structured filter form of /api/query. Path,
+// destination and command-line criteria select candidates from the storage
+// indexes; the rest are checked on each event.
+func legacyQuery(store *storage.Manager, f eventFilter) ([]*storage.Event, error) {
+	filter := storage.Filter{
+		PIDs:      f.PIDs,
+		CgroupIDs: f.CgroupIDs,
+		Processes: f.Processes,
+	}
+	for _, t := range f.Types {
+		switch strings.ToLower(t) {
+		case "exec":
+			filter.Types = append(filter.Types, events.EventTypeExec)
+		case "file", "fileopen":
+			filter.Types = append(filter.Types, events.EventTypeFileOpen)
+		case "connect", "network":
+			filter.Types = append(filter.Types, events.EventTypeConnect)
+		}
+	}
+
+	var startTime, endTime time.Time
+	windowed := false
+	if f.TimeWindow.Start != "" && f.TimeWindow.End != "" {
+		var err1, err2 error
+		startTime, err1 = time.Parse(time.RFC3339, f.TimeWindow.Start)
+		endTime, err2 = time.Parse(time.RFC3339, f.TimeWindow.End)
+		windowed = err1 == nil && err2 == nil
+	}
+
+	var allEvents []*storage.Event
+	var err error
+	indexed := storage.Filter{
+		Paths:        f.Paths,
+		PathPrefixes: f.PathPrefixes,
+		DstIPs:       f.DstIPs,
+		DstPorts:     f.DstPorts,
+		CmdlineTerms: f.CmdlineTerms,
+	}
+	switch {
+	case len(indexed.Paths) > 0 || len(indexed.PathPrefixes) > 0 || len(indexed.DstIPs) > 0 ||
+		len(indexed.DstPorts) > 0 || len(indexed.CmdlineTerms) > 0:
+		allEvents = store.QueryByFilter(indexed)
+		if windowed {
+			inWindow := allEvents[:0]
+			for _, ev := range allEvents {
+				if !ev.Timestamp.Before(startTime) && !ev.Timestamp.After(endTime) {
+					inWindow = append(inWindow, ev)
+				}
+			}
+			allEvents = inWindow
+		}
+	case windowed:
+		allEvents, err = store.Query(startTime, endTime)
+	default:
+		allEvents, err = store.Latest(10000)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]*storage.Event, 0)
+	for _, event := range allEvents {
+		if matchesFilter(event, &filter) {
+			filtered = append(filtered, event)
+		}
+	}
+	return filtered, nil
+}
+
+// cgroupPathResolver looks up cgroup paths for the query language's
+// cgroup_path field from the workload registry.
+func cgroupPathResolver(reg *workload.Registry) func(uint64) string {
+	if reg == nil {
+		return nil
+	}
+	return func(id uint64) string {
+		if m := reg.Get(id); m != nil {
+			return m.CgroupPath
+		}
+		return ""
+	}
+}
+
+// containerFilter narrows a query to workloads by container metadata. Each
+// non-empty list must match; within a list any entry may match.
+type containerFilter struct {
+	Containers   []string `json:"containers"` // container name or ID prefix
+	Runtimes     []string `json:"runtimes"`
+	Images       []string `json:"images"` // with or without tag
+	PodUIDs      []string `json:"pod_uids"`
+	SystemdUnits []string `json:"systemd_units"`
+}
+
+func (f containerFilter) empty() bool {
+	return len(f.Containers) == 0 && len(f.Runtimes) == 0 && len(f.Images) == 0 &&
+		len(f.PodUIDs) == 0 && len(f.SystemdUnits) == 0
+}
+
+func (f containerFilter) matches(c workload.Container) bool {
+	if len(f.Containers) > 0 && !anyMatch(f.Containers, func(v string) bool {
+		return c.ID != "" && (v == c.Name || strings.HasPrefix(c.ID, v))
+	}) {
+		return false
+	}
+	if len(f.Runtimes) > 0 && !anyMatch(f.Runtimes, func(v string) bool {
+		return c.Runtime != "" && strings.EqualFold(v, c.Runtime)
+	}) {
+		return false
+	}
+	if len(f.Images) > 0 && !anyMatch(f.Images, func(v string) bool {
+		return c.Image != "" && (v == c.Image || strings.HasPrefix(c.Image, v+":"))
+	}) {
+		return false
+	}
+	if len(f.PodUIDs) > 0 && !anyMatch(f.PodUIDs, func(v string) bool { return v == c.PodUID }) {
+		return false
+	}
+	if len(f.SystemdUnits) > 0 && !anyMatch(f.SystemdUnits, func(v string) bool { return v == c.SystemdUnit }) {
+		return false
+	}
+	return true
+}
+
+// cgroups returns the cgroup IDs of known workloads matching the filter.
+// Events of workloads evicted from the registry no longer match.
+func (f containerFilter) cgroups(reg *workload.Registry) map[uint64]bool {
+	allowed := make(map[uint64]bool)
+	if reg == nil {
+		return allowed
+	}
+	for _, m := range reg.List() {
+		if f.matches(m.Container) {
+			allowed[uint64(m.ID)] = true
+		}
+	}
+	return allowed
+}
+
+func anyMatch(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if v != "" && match(v) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"aegis/pkg/apimodel"
+	"aegis/pkg/server"
+	"aegis/pkg/session"
+)
+
+const (
+	defaultSessionLimit = 100
+	maxSessionLimit     = 1000
+)
+
+func RegisterSessionHandlers(mux *http.ServeMux, app *server.App) {
+	// GET /api/sessions?active=true&uid=1001&interactive=true&since=6h&limit=50
+	// lists login sessions, most recently active first, with their command
+	// timelines unless commands=false.
+	mux.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		core := app.Core()
+		if core == nil || core.Sessions == nil {
+			writeJSONStringError(w, http.StatusServiceUnavailable, "session tracking not available")
+			return
+		}
+
+		params := r.URL.Query()
+		var f session.Filter
+		f.ActiveOnly = params.Get("active") == "true"
+		f.Interactive = params.Get("interactive") == "true"
+		if v := params.Get("uid"); v != "" {
+			uid, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				writeJSONStringError(w, http.StatusBadRequest, "invalid uid")
+				return
+			}
+			u := uint32(uid)
+			f.LoginUID = &u
+		}
+		since, err := parseHistoryTime(params.Get("since"), time.Now(), time.Time{})
+		if err != nil {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+		f.Since = since
+		limit, ok := intParam(params.Get("limit"), defaultSessionLimit, maxSessionLimit)
+		if !ok {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+
+		list := core.Sessions.List(f, params.Get("commands") != "false")
+		out := make([]apimodel.Session, 0, min(len(list), limit))
+		for _, s := range list {
+			if len(out) == limit {
+				break
+			}
+			out = append(out, server.SessionToFrontend(s))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"sessions": out,
+			"total":    len(list),
+		})
+	})
+
+	// GET /api/sessions/{id} returns one session with its commands.
+	mux.HandleFunc("/api/sessions/", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		core := app.Core()
+		if core == nil || core.Sessions == nil {
+			writeJSONStringError(w, http.StatusServiceUnavailable, "session tracking not available")
+			return
+		}
+
+		id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/sessions/"), "/")
+		s, ok := core.Sessions.Get(id)
+		if !ok {
+			writeJSONStringError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, server.SessionToFrontend(s))
+	})
+}
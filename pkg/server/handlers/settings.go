@@ -87,7 +87,9 @@ func RegisterSettingsHandlers(mux *http.ServeMux, app *server.App) {
 			}
 
 			// Save to config.yaml file
-			if err := saveConfigToFile(opts); err != nil {
+			err := saveConfigToFile(opts)
+			app.RefreshProtectedFiles()
+			if err != nil {
 				http.Error(w, "Failed to save config: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
@@ -103,13 +105,15 @@ func RegisterSettingsHandlers(mux *http.ServeMux, app *server.App) {
 
 // saveConfigToFile saves the options to config.yaml file
 func saveConfigToFile(opts *config.Options) error {
-	cwd, err := os.Getwd()
-	if err != nil {
-		cwd = "."
+	configPath := opts.ConfigPath
+	if configPath == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			cwd = "."
+		}
+		configPath = filepath.Join(cwd, "config.yaml")
 	}
 
-	configPath := filepath.Join(cwd, "config.yaml")
-
 	data, err := yaml.Marshal(opts)
 	if err != nil {
 		return err
@@ -3,6 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"aegis/pkg/server"
 )
@@ -13,11 +16,16 @@ func RegisterStatsHandlers(mux *http.ServeMux, app *server.App) {
 		w.Header().Set("Content-Type", "application/json")
 		s := app.GetSystemStats()
 		json.NewEncoder(w).Encode(map[string]any{
-			"processCount":  s.ProcessCount,
-			"workloadCount": s.WorkloadCount,
-			"eventsPerSec":  s.EventsPerSec,
-			"alertCount":    s.AlertCount,
-			"probeStatus":   s.ProbeStatus,
+			"processCount":      s.ProcessCount,
+			"workloadCount":     s.WorkloadCount,
+			"workloadLimit":     s.WorkloadLimit,
+			"workloadEvictions": s.WorkloadEvictions,
+			"policyMapFailures": s.PolicyMapFailures,
+			"eventsPerSec":      s.EventsPerSec,
+			"alertCount":        s.AlertCount,
+			"probeStatus":       s.ProbeStatus,
+			"probeMode":         s.ProbeMode,
+			"enforcement":       s.Enforcement,
 		})
 	})
 
@@ -38,6 +46,78 @@ func RegisterStatsHandlers(mux *http.ServeMux, app *server.App) {
 		})
 	})
 
+	// GET /api/stats/history?metric=rate.exec,alerts.critical&from=6h&step=1m
+	// returns rolled-up series. Without metric it lists the known metrics.
+	mux.HandleFunc("/api/stats/history", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		history := app.Stats().History()
+		q := r.URL.Query()
+		if q.Get("metric") == "" {
+			writeJSON(w, http.StatusOK, map[string]any{"metrics": history.Metrics()})
+			return
+		}
+
+		now := time.Now()
+		from, err := parseHistoryTime(q.Get("from"), now, now.Add(-time.Hour))
+		if err != nil {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+			return
+		}
+		to, err := parseHistoryTime(q.Get("to"), now, now)
+		if err != nil {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+			return
+		}
+		var step time.Duration
+		if v := q.Get("step"); v != "" {
+			if step, err = time.ParseDuration(v); err != nil || step <= 0 {
+				writeJSONStringError(w, http.StatusBadRequest, "invalid step")
+				return
+			}
+		}
+
+		type point struct {
+			T     int64   `json:"t"`     // bucket start, Unix milliseconds
+			Value float64 `json:"value"` // sum over the bucket
+			Rate  float64 `json:"rate"`  // value per second
+		}
+		type series struct {
+			Metric string  `json:"metric"`
+			Points []point `json:"points"`
+		}
+		var out []series
+		var stepUsed time.Duration
+		for _, name := range strings.Split(q.Get("metric"), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			points, used, err := history.Query(name, from, to, step)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err)
+				return
+			}
+			stepUsed = used
+			s := series{Metric: name, Points: make([]point, len(points))}
+			for i, p := range points {
+				s.Points[i] = point{T: p.Time.UnixMilli(), Value: p.Value, Rate: p.Value / used.Seconds()}
+			}
+			out = append(out, s)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"from":    from.UnixMilli(),
+			"to":      to.UnixMilli(),
+			"step_ms": stepUsed.Milliseconds(),
+			"series":  out,
+		})
+	})
+
 	mux.HandleFunc("/api/alerts", func(w http.ResponseWriter, r *http.Request) {
 		setCORS(w)
 		w.Header().Set("Content-Type", "application/json")
@@ -67,3 +147,22 @@ func RegisterStatsHandlers(mux *http.ServeMux, app *server.App) {
 		w.Write([]byte("]"))
 	})
 }
+
+// parseHistoryTime accepts a duration before now ("6h"), RFC 3339, or Unix
+// milliseconds. An empty value yields def.
+func parseHistoryTime(v string, now, def time.Time) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
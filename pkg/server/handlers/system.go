@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"aegis/pkg/doctor"
+	"aegis/pkg/server"
+)
+
+func RegisterSystemHandlers(mux *http.ServeMux, app *server.App) {
+	mux.HandleFunc("/api/system/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		defer cancel()
+
+		writeJSON(w, http.StatusOK, doctor.Run(ctx, *app.Options()))
+	})
+	mux.HandleFunc("/api/system/pipeline", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		metrics, ok := app.PipelineMetrics()
+		if !ok {
+			writeJSONStringError(w, http.StatusServiceUnavailable, "event pipeline not started")
+			return
+		}
+		writeJSON(w, http.StatusOK, metrics)
+	})
+
+	mux.HandleFunc("/api/system/storage", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		core := app.Core()
+		if core == nil || core.Storage == nil {
+			writeJSONStringError(w, http.StatusServiceUnavailable, "storage not available")
+			return
+		}
+		writeJSON(w, http.StatusOK, core.Storage.Metrics())
+	})
+}
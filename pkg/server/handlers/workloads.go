@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aegis/pkg/apimodel"
+	"aegis/pkg/server"
+	"aegis/pkg/storage"
+)
+
+const (
+	defaultWorkloadLimit    = 500
+	maxWorkloadLimit        = 5000
+	defaultWorkloadWindow   = 24 * time.Hour
+	defaultTimelineWindow   = time.Hour
+	defaultTimelineInterval = time.Minute
+	workloadTopLimit        = 10
+	workloadAlertLimit      = 50
+)
+
+// workloadOrder compares workloads for each sort key, ascending.
+var workloadOrder = map[string]func(a, b *apimodel.Workload) bool{
+	"name":      func(a, b *apimodel.Workload) bool { return a.Name < b.Name },
+	"firstSeen": func(a, b *apimodel.Workload) bool { return a.FirstSeen < b.FirstSeen },
+	"lastSeen":  func(a, b *apimodel.Workload) bool { return a.LastSeen < b.LastSeen },
+	"execs":     func(a, b *apimodel.Workload) bool { return a.ExecCount < b.ExecCount },
+	"files":     func(a, b *apimodel.Workload) bool { return a.FileCount < b.FileCount },
+	"connects":  func(a, b *apimodel.Workload) bool { return a.ConnectCount < b.ConnectCount },
+	"alerts":    func(a, b *apimodel.Workload) bool { return a.AlertCount < b.AlertCount },
+	"blocked":   func(a, b *apimodel.Workload) bool { return a.BlockedCount < b.BlockedCount },
+}
+
+func RegisterWorkloadHandlers(mux *http.ServeMux, app *server.App) {
+	// GET /api/workloads?q=nginx&runtime=docker&container=true&sort=alerts&order=desc&limit=50
+	// lists the tracked workloads. q matches name, cgroup path and image
+	// case-insensitively; sort is one of name, firstSeen, lastSeen (the
+	// default), execs, files, connects, alerts or blocked.
+	mux.HandleFunc("/api/workloads", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		params := r.URL.Query()
+		sortKey := params.Get("sort")
+		if sortKey == "" {
+			sortKey = "lastSeen"
+		}
+		less, ok := workloadOrder[sortKey]
+		if !ok {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid sort")
+			return
+		}
+		desc := sortKey != "name"
+		switch params.Get("order") {
+		case "":
+		case "asc":
+			desc = false
+		case "desc":
+			desc = true
+		default:
+			writeJSONStringError(w, http.StatusBadRequest, "invalid order")
+			return
+		}
+		limit, ok := intParam(params.Get("limit"), defaultWorkloadLimit, maxWorkloadLimit)
+		if !ok {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q := strings.ToLower(params.Get("q"))
+		runtime := params.Get("runtime")
+		container := params.Get("container")
+
+		workloads := make([]apimodel.Workload, 0)
+		for _, wl := range app.GetWorkloads() {
+			c := wl.Container
+			if c == nil {
+				c = &apimodel.Container{}
+			}
+			if q != "" && !strings.Contains(strings.ToLower(wl.Name), q) &&
+				!strings.Contains(strings.ToLower(wl.CgroupPath), q) &&
+				!strings.Contains(strings.ToLower(c.Image), q) {
+				continue
+			}
+			if runtime != "" && c.Runtime != runtime {
+				continue
+			}
+			if container != "" && (c.ID != "") != (container == "true") {
+				continue
+			}
+			workloads = append(workloads, wl)
+		}
+		sort.SliceStable(workloads, func(i, j int) bool {
+			if desc {
+				return less(&workloads[j], &workloads[i])
+			}
+			return less(&workloads[i], &workloads[j])
+		})
+		if len(workloads) > limit {
+			workloads = workloads[:limit]
+		}
+		writeJSON(w, http.StatusOK, workloads)
+	})
+
+	// GET /api/workloads/{id}?window=24h returns a workload with its busiest
+	// processes, files and destinations over the window and its most recent
+	// alerts. GET /api/workloads/{id}/timeline?window=1h&interval=1m counts
+	// its events and alerts per interval. GET /api/workloads/{id}/baselines
+	// lists the learned behaviour of the programs in a workload; DELETE
+	// forgets it so they learn again.
+	mux.HandleFunc("/api/workloads/", func(w http.ResponseWriter, r *http.Request) {
+		setCORS(w)
+		if handleCORSPreflight(w, r, "GET, DELETE, OPTIONS") {
+			return
+		}
+
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/workloads/"), "/"), "/")
+		if len(parts) > 2 || (len(parts) == 2 && parts[1] != "baselines" && parts[1] != "timeline") {
+			writeJSONStringError(w, http.StatusNotFound, "not found")
+			return
+		}
+		cgroupID, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil || cgroupID == 0 {
+			writeJSONStringError(w, http.StatusBadRequest, "invalid workload id")
+			return
+		}
+		if len(parts) == 2 && parts[1] == "baselines" {
+			handleWorkloadBaselines(w, r, app, cgroupID)
+			return
+		}
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		if len(parts) == 2 {
+			handleWorkloadTimeline(w, r, app, cgroupID)
+			return
+		}
+		handleWorkloadDetail(w, r, app, cgroupID)
+	})
+}
+
+func handleWorkloadBaselines(w http.ResponseWriter, r *http.Request, app *server.App, cgroupID uint64) {
+	core := app.Core()
+	if core == nil || core.ProfileReg == nil || core.ProfileReg.Baselines() == nil {
+		writeJSONStringError(w, http.StatusServiceUnavailable, "baselines not enabled")
+		return
+	}
+	store := core.ProfileReg.Baselines()
+
+	switch r.Method {
+	case http.MethodGet:
+		baselines := make([]apimodel.Baseline, 0)
+		for _, b := range store.List(cgroupID, time.Now()) {
+			baselines = append(baselines, server.BaselineToFrontend(b))
+		}
+		writeJSON(w, http.StatusOK, baselines)
+	case http.MethodDelete:
+		writeJSON(w, http.StatusOK, map[string]int{"removed": store.Reset(cgroupID)})
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func handleWorkloadDetail(w http.ResponseWriter, r *http.Request, app *server.App, cgroupID uint64) {
+	core := app.Core()
+	if core == nil || core.WorkloadReg == nil {
+		writeJSONStringError(w, http.StatusServiceUnavailable, "workload registry not available")
+		return
+	}
+	m := core.WorkloadReg.Get(cgroupID)
+	if m == nil {
+		writeJSONStringError(w, http.StatusNotFound, "workload not tracked")
+		return
+	}
+	now := time.Now()
+	window, err := durationParam(r.URL.Query().Get("window"), defaultWorkloadWindow)
+	if err != nil {
+		writeJSONStringError(w, http.StatusBadRequest, "invalid window")
+		return
+	}
+
+	detail := apimodel.WorkloadDetail{
+		Workload:        server.WorkloadToFrontend(*m),
+		WindowStart:     now.Add(-window).UnixMilli(),
+		TopProcesses:    []apimodel.TopCount{},
+		TopFiles:        []apimodel.TopCount{},
+		TopDestinations: []apimodel.TopCount{},
+		Alerts:          []apimodel.Alert{},
+	}
+	detail.Workload.Policies = app.BoundPolicyNames(cgroupID)
+	if core.ProcessTree != nil {
+		for _, p := range core.ProcessTree.Processes() {
+			if p.CgroupID == cgroupID {
+				detail.RunningProcesses++
+			}
+		}
+	}
+	if core.Storage != nil {
+		ctx := storage.QueryContext{CgroupPath: cgroupPathResolver(core.WorkloadReg)}
+		top := func(where string, groupBy ...string) ([]apimodel.TopCount, error) {
+			q, err := storage.ParseQuery(fmt.Sprintf("cgroup = %d%s", cgroupID, where), now)
+			if err != nil {
+				return nil, err
+			}
+			q.Since, q.Until = now.Add(-window), now
+			res, err := core.Storage.Aggregate(q, storage.Aggregation{Op: storage.AggTop, GroupBy: groupBy, Limit: workloadTopLimit}, ctx)
+			if err != nil {
+				return nil, err
+			}
+			counts := make([]apimodel.TopCount, len(res.Groups))
+			for i, g := range res.Groups {
+				value := g.Key[0]
+				if len(g.Key) == 2 {
+					value = net.JoinHostPort(g.Key[0], g.Key[1])
+				}
+				counts[i] = apimodel.TopCount{Value: value, Count: g.Count, Blocked: g.Blocked}
+			}
+			return counts, nil
+		}
+		if detail.TopProcesses, err = top("", "comm"); err == nil {
+			if detail.TopFiles, err = top(" and type = file", "filename"); err == nil {
+				detail.TopDestinations, err = top(" and type = connect", "dst.ip", "dst.port")
+			}
+		}
+		if err != nil {
+			writeJSONStringError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	id := strconv.FormatUint(cgroupID, 10)
+	alerts := app.GetAlerts()
+	for i := len(alerts) - 1; i >= 0 && len(detail.Alerts) < workloadAlertLimit; i-- {
+		if alerts[i].CgroupID == id {
+			detail.Alerts = append(detail.Alerts, alerts[i])
+		}
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// handleWorkloadTimeline answers for any cgroup with stored events, so the
+// timeline of an evicted workload can still be read.
+func handleWorkloadTimeline(w http.ResponseWriter, r *http.Request, app *server.App, cgroupID uint64) {
+	core := app.Core()
+	if core == nil || core.Storage == nil {
+		writeJSONStringError(w, http.StatusServiceUnavailable, "storage not available")
+		return
+	}
+	params := r.URL.Query()
+	now := time.Now()
+	window, err := durationParam(params.Get("window"), defaultTimelineWindow)
+	if err != nil {
+		writeJSONStringError(w, http.StatusBadRequest, "invalid window")
+		return
+	}
+	interval, err := durationParam(params.Get("interval"), defaultTimelineInterval)
+	if err != nil || interval < time.Second {
+		writeJSONStringError(w, http.StatusBadRequest, "invalid interval")
+		return
+	}
+
+	ctx := storage.QueryContext{CgroupPath: cgroupPathResolver(core.WorkloadReg)}
+	buckets := []apimodel.WorkloadBucket{}
+	for _, typ := range []string{"exec", "file", "connect"} {
+		q, err := storage.ParseQuery(fmt.Sprintf("cgroup = %d and type = %s", cgroupID, typ), now)
+		if err != nil {
+			writeJSONStringError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		q.Since, q.Until = now.Add(-window), now
+		res, err := core.Storage.Aggregate(q, storage.Aggregation{Op: storage.AggHistogram, Interval: interval}, ctx)
+		if err != nil {
+			writeJSONStringError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(buckets) == 0 {
+			buckets = make([]apimodel.WorkloadBucket, len(res.Buckets))
+		}
+		for i, b := range res.Buckets {
+			buckets[i].Start = b.Start.UnixMilli()
+			buckets[i].Blocked += b.Blocked
+			switch typ {
+			case "exec":
+				buckets[i].Exec = b.Count
+			case "file":
+				buckets[i].File = b.Count
+			case "connect":
+				buckets[i].Connect = b.Count
+			}
+		}
+	}
+
+	id := strconv.FormatUint(cgroupID, 10)
+	if len(buckets) > 0 {
+		start := buckets[0].Start
+		for _, a := range app.GetAlerts() {
+			i := int((a.Timestamp - start) / interval.Milliseconds())
+			if a.CgroupID == id && a.Timestamp >= start && i < len(buckets) {
+				buckets[i].Alerts++
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":         id,
+		"intervalMs": interval.Milliseconds(),
+		"buckets":    buckets,
+	})
+}
+
+// durationParam parses a positive duration, returning def when v is empty.
+func durationParam(v string, def time.Duration) (time.Duration, error) {
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return d, nil
+}
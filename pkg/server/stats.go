@@ -1,6 +1,8 @@
 package server
 
 import (
+	"log"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,6 +34,8 @@ type Stats struct {
 
 	workloadCountFn WorkloadCountFunc
 
+	history atomic.Pointer[metrics.Rollup]
+
 	eventSubs   map[chan any]struct{}
 	eventSubsMu sync.RWMutex
 }
@@ -56,6 +60,7 @@ func NewServerStats(maxAlerts int, dedupWindow time.Duration) *Stats {
 		alertDedup:  make(map[alertKey]time.Time),
 		dedupWindow: dedupWindow,
 	}
+	s.history.Store(metrics.NewRollup(metrics.DefaultTiers))
 	go s.rateLoop()
 	return s
 }
@@ -64,11 +69,24 @@ func (s *Stats) SetWorkloadCountFunc(fn WorkloadCountFunc) {
 	s.workloadCountFn = fn
 }
 
+// SetHistory replaces the in-memory rollup, typically with one loaded from
+// disk. Points recorded before the switch are dropped.
+func (s *Stats) SetHistory(h *metrics.Rollup) {
+	s.history.Store(h)
+}
+
+// History returns the rollup of rates, alerts and per-workload and per-rule
+// hits.
+func (s *Stats) History() *metrics.Rollup {
+	return s.history.Load()
+}
+
 func (s *Stats) rateLoop() {
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	var saved time.Time
+	for now := range ticker.C {
 		exec := s.lastSecExec.Swap(0)
 		file := s.lastSecFile.Swap(0)
 		net := s.lastSecConnect.Swap(0)
@@ -76,9 +94,30 @@ func (s *Stats) rateLoop() {
 		s.rateExec.Store(exec)
 		s.rateFile.Store(file)
 		s.rateConnect.Store(net)
+
+		h := s.history.Load()
+		h.Add("rate.exec", now, float64(exec))
+		h.Add("rate.file", now, float64(file))
+		h.Add("rate.connect", now, float64(net))
+		h.Flush(now)
+		if now.Sub(saved) >= time.Minute {
+			if err := h.Save(); err != nil {
+				log.Printf("[Stats] Failed to save history: %v", err)
+			}
+			saved = now
+		}
 	}
 }
 
+// RecordWorkload counts an event of the workload in cgroupID for the
+// per-workload history.
+func (s *Stats) RecordWorkload(cgroupID uint64) {
+	if cgroupID == 0 {
+		return
+	}
+	s.history.Load().Incr(metrics.WorkloadPrefix + strconv.FormatUint(cgroupID, 10))
+}
+
 func (s *Stats) RecordExec() {
 	s.execCount.Add(1)
 	s.lastSecExec.Add(1)
@@ -99,6 +138,16 @@ func (s *Stats) RecordConnectEvent(ev apimodel.ConnectEvent) {
 }
 
 func (s *Stats) AddAlert(alert apimodel.Alert) {
+	// History counts every hit, including those deduplicated below.
+	h := s.history.Load()
+	h.Incr("alerts.total")
+	if alert.Severity != "" {
+		h.Incr("alerts." + alert.Severity)
+	}
+	if alert.RuleName != "" {
+		h.Incr(metrics.RulePrefix + alert.RuleName)
+	}
+
 	s.alertsMu.Lock()
 	now := time.Now()
 	if s.dedupWindow > 0 {
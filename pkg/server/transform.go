@@ -1,9 +1,17 @@
 package server
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"aegis/pkg/apimodel"
 	"aegis/pkg/events"
 	"aegis/pkg/frontend"
+	"aegis/pkg/proc"
+	"aegis/pkg/rules"
+	"aegis/pkg/session"
+	"aegis/pkg/workload"
 )
 
 
@@ -20,3 +28,176 @@ func FileToFrontend(ev events.FileOpenEvent, filename string) apimodel.FileEvent
 func ConnectToFrontend(ev events.ConnectEvent, addr string, processName string) apimodel.ConnectEvent {
 	return frontend.ConnectToFrontend(ev, addr, processName)
 }
+
+func ProcessToFrontend(p *proc.ProcessInfo) apimodel.ProcessInfo {
+	return apimodel.ProcessInfo{
+		PID:       p.PID,
+		PPID:      p.PPID,
+		Comm:      p.Comm,
+		CgroupID:  fmt.Sprintf("%d", p.CgroupID),
+		Timestamp: unixMilli(p.Timestamp),
+
+		PidNamespace: PidNamespaceToFrontend(p.PidNS),
+	}
+}
+
+// SessionToFrontend converts a session; commands are included when s has
+// them.
+func SessionToFrontend(s session.Session) apimodel.Session {
+	out := apimodel.Session{
+		ID:           s.ID,
+		Description:  s.Description(),
+		Leader:       s.Leader,
+		LeaderComm:   s.LeaderComm,
+		TTY:          s.TTY,
+		Interactive:  s.Interactive(),
+		Origin:       string(s.Origin),
+		RemoteAddr:   s.RemoteAddr,
+		CgroupID:     strconv.FormatUint(s.CgroupID, 10),
+		Active:       s.Active,
+		Started:      unixMilli(s.Started),
+		LastSeen:     unixMilli(s.LastSeen),
+		CommandCount: s.CommandCount,
+	}
+	if s.LoginUID != events.AuditUnset {
+		uid := s.LoginUID
+		out.LoginUID = &uid
+	}
+	if s.AuditID != events.AuditUnset {
+		id := s.AuditID
+		out.AuditSessionID = &id
+	}
+	for _, c := range s.Commands {
+		out.Commands = append(out.Commands, apimodel.SessionCommand{
+			Timestamp:   unixMilli(c.Time),
+			EventID:     c.EventID,
+			PID:         c.PID,
+			PPID:        c.PPID,
+			UID:         c.UID,
+			Comm:        c.Comm,
+			CommandLine: c.CommandLine,
+			Blocked:     c.Blocked,
+		})
+	}
+	return out
+}
+
+// PidNamespaceToFrontend returns nil when the namespace is unknown.
+func PidNamespaceToFrontend(ns proc.PidNamespace) *apimodel.PidNamespace {
+	if ns.Inode == 0 {
+		return nil
+	}
+	return &apimodel.PidNamespace{
+		Inode: ns.Inode,
+		PID:   ns.PID,
+		PPID:  ns.PPID,
+		Host:  ns.IsHost(),
+	}
+}
+
+func ProcessNodeToFrontend(n *proc.ProcessNode) apimodel.ProcessNode {
+	node := apimodel.ProcessNode{
+		ProcessInfo: ProcessToFrontend(n.Info),
+		Truncated:   n.Truncated,
+	}
+	for _, c := range n.Children {
+		node.Children = append(node.Children, ProcessNodeToFrontend(c))
+	}
+	return node
+}
+
+func ProfileToFrontend(p *proc.ProcessProfile) *apimodel.ProcessProfile {
+	static, dynamic := p.Snapshot()
+	return &apimodel.ProcessProfile{
+		StartTime:     unixMilli(static.StartTime),
+		CommandLine:   static.CommandLine,
+		Genealogy:     static.Genealogy,
+		ExecCount:     dynamic.ExecCount,
+		FileOpenCount: dynamic.FileOpenCount,
+		ConnectCount:  dynamic.NetConnectCount,
+		LastExec:      unixMilli(dynamic.LastExec),
+		LastFileOpen:  unixMilli(dynamic.LastFileOpen),
+		LastConnect:   unixMilli(dynamic.LastConnect),
+	}
+}
+
+func BaselineToFrontend(b proc.BaselineSummary) apimodel.Baseline {
+	return apimodel.Baseline{
+		Exe:          b.Key.Exe,
+		CgroupID:     strconv.FormatUint(b.Key.CgroupID, 10),
+		Learning:     b.Learning,
+		Started:      unixMilli(b.Started),
+		LastSeen:     unixMilli(b.LastSeen),
+		Children:     b.Children,
+		FilePrefixes: b.FilePrefixes,
+		Ports:        b.Ports,
+		Destinations: b.Destinations,
+		ExecRate:     b.ExecRate,
+		FileRate:     b.FileRate,
+		ConnectRate:  b.ConnectRate,
+		ExecPeak:     b.ExecPeak,
+		FilePeak:     b.FilePeak,
+		ConnectPeak:  b.ConnectPeak,
+	}
+}
+
+// unixMilli returns t in Unix milliseconds, or 0 for the zero time.
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func WorkloadToFrontend(m workload.Metadata) apimodel.Workload {
+	return apimodel.Workload{
+		ID:              fmt.Sprintf("%d", m.ID),
+		Name:            m.Name(),
+		CgroupPath:      m.CgroupPath,
+		ExecCount:       m.ExecCount,
+		FileCount:       m.FileCount,
+		ConnectCount:    m.ConnectCount,
+		AlertCount:      m.AlertCount,
+		BlockedCount:    m.BlockedCount,
+		FirstSeen:       m.FirstSeen.UnixMilli(),
+		LastSeen:        m.LastSeen.UnixMilli(),
+		SuppressedCount: m.SuppressedCount,
+		Container:       ContainerToFrontend(m.Container),
+	}
+}
+
+func PolicyToFrontend(p rules.Policy) apimodel.Policy {
+	rulesList := p.Rules
+	if rulesList == nil {
+		rulesList = []string{}
+	}
+	return apimodel.Policy{
+		Name: p.Name,
+		Mode: string(p.Mode),
+		Selector: apimodel.PolicySelector{
+			CgroupPath:  p.Selector.CgroupPath,
+			Image:       p.Selector.Image,
+			SystemdUnit: p.Selector.SystemdUnit,
+			Labels:      p.Selector.Labels,
+		},
+		Rules:     rulesList,
+		Workloads: []string{},
+	}
+}
+
+// ContainerToFrontend returns nil when nothing is known about the cgroup so
+// the field is omitted from JSON.
+func ContainerToFrontend(c workload.Container) *apimodel.Container {
+	if c.IsZero() {
+		return nil
+	}
+	return &apimodel.Container{
+		Runtime:      c.Runtime,
+		ID:           c.ID,
+		Name:         c.Name,
+		Image:        c.Image,
+		PodUID:       c.PodUID,
+		SystemdUnit:  c.SystemdUnit,
+		SystemdSlice: c.SystemdSlice,
+	}
+}
@@ -7,7 +7,18 @@ type SystemStatsDTO struct {
 	WorkloadCount int     `json:"workloadCount"`
 	EventsPerSec  float64 `json:"eventsPerSec"`
 	AlertCount    int     `json:"alertCount"`
-	ProbeStatus   string  `json:"probeStatus"` // "active", "error", "starting"
+	ProbeStatus   string  `json:"probeStatus"` // "active", "monitor-only", "replay", "starting"
+	ProbeMode     string  `json:"probeMode"`   // "lsm", "tracepoint" or "replay"
+	Enforcement   bool    `json:"enforcement"`
+
+	// WorkloadLimit is the registry size; WorkloadEvictions counts the
+	// workloads dropped to stay within it.
+	WorkloadLimit     int   `json:"workloadLimit"`
+	WorkloadEvictions int64 `json:"workloadEvictions"`
+
+	// PolicyMapFailures counts policy bindings the kernel could not record,
+	// leaving those workloads unblocked by their enforcing policies.
+	PolicyMapFailures int64 `json:"policyMapFailures"`
 }
 
 type RuleDTO struct {
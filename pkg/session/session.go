@@ -0,0 +1,343 @@
+// Package session attributes executions to login sessions. A session is
+// identified by the kernel's audit session ID, which pam_loginuid assigns
+// at login and every process started from the login inherits, even across
+// su and sudo. Without one, a process with a controlling terminal or an
+// audit login UID is grouped by its session leader. Sessions are kept in
+// memory with the most recent commands run in them.
+package session
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aegis/pkg/events"
+	"aegis/pkg/utils"
+)
+
+const (
+	DefaultMaxSessions = 1000
+	DefaultMaxCommands = 200
+	DefaultIdleTimeout = 30 * time.Minute
+)
+
+// Origin is how a session was started, as far as it can be told.
+type Origin string
+
+const (
+	OriginSSH     Origin = "ssh"
+	OriginConsole Origin = "console"
+)
+
+// Command is one execution within a session.
+type Command struct {
+	Time        time.Time
+	EventID     uint64
+	PID         uint32
+	PPID        uint32
+	UID         uint32
+	Comm        string
+	CommandLine string
+	Blocked     bool
+}
+
+// Session is a login session and the commands run in it.
+type Session struct {
+	ID         string
+	AuditID    uint32 // events.AuditUnset when the kernel assigned none
+	LoginUID   uint32 // events.AuditUnset when the session has no login
+	Leader     uint32 // PID of the session leader
+	LeaderComm string
+	TTY        string // controlling terminal, empty for batch sessions
+	Origin     Origin
+	RemoteAddr string // client address of SSH sessions, when known
+	CgroupID   uint64
+	Started    time.Time
+	LastSeen   time.Time
+	Active     bool
+
+	// CommandCount counts every command; Commands holds the most recent,
+	// oldest first.
+	CommandCount int
+	Commands     []Command
+}
+
+// Interactive reports whether the session has a terminal.
+func (s *Session) Interactive() bool {
+	return s.TTY != ""
+}
+
+// Description names the session for people, for example
+// "ssh session from 10.1.2.3 by uid 1001 on pts/0".
+func (s *Session) Description() string {
+	var b strings.Builder
+	if s.Origin != "" {
+		b.WriteString(string(s.Origin) + " ")
+	}
+	b.WriteString("session")
+	if s.RemoteAddr != "" {
+		b.WriteString(" from " + s.RemoteAddr)
+	}
+	if s.LoginUID != events.AuditUnset {
+		fmt.Fprintf(&b, " by uid %d", s.LoginUID)
+	} else if s.LeaderComm != "" {
+		fmt.Fprintf(&b, " of %s (pid %d)", s.LeaderComm, s.Leader)
+	}
+	if s.TTY != "" {
+		b.WriteString(" on " + s.TTY)
+	}
+	return b.String()
+}
+
+// IDFor returns the ID of the session an exec belongs to, or false for
+// processes outside any login session, such as daemons.
+func IDFor(ev *events.ExecEvent) (string, bool) {
+	switch {
+	case ev.SessionID != events.AuditUnset:
+		return strconv.FormatUint(uint64(ev.SessionID), 10), true
+	case ev.SessionLeader != 0 && (ev.TTY[0] != 0 || ev.LoginUID != events.AuditUnset):
+		return "sid-" + strconv.FormatUint(uint64(ev.SessionLeader), 10), true
+	default:
+		return "", false
+	}
+}
+
+// Config tunes a Tracker. Zero values select defaults.
+type Config struct {
+	MaxSessions int           // least recently active sessions are dropped beyond this
+	MaxCommands int           // commands kept per session
+	IdleTimeout time.Duration // sessions without commands for this long are inactive
+	// ReadProc looks up session leaders in /proc, to tell whether they
+	// are still running and where SSH sessions come from. Leave it unset
+	// for recorded events.
+	ReadProc bool
+}
+
+// Tracker records login sessions from exec events. It implements
+// events.EventHandler and ignores everything but execs. It is safe for
+// concurrent use.
+type Tracker struct {
+	cfg Config
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	lru      *list.List // of session IDs, most recently active first
+	lruIndex map[string]*list.Element
+}
+
+var _ events.EventHandler = (*Tracker)(nil)
+
+func NewTracker(cfg Config) *Tracker {
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = DefaultMaxSessions
+	}
+	if cfg.MaxCommands <= 0 {
+		cfg.MaxCommands = DefaultMaxCommands
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultIdleTimeout
+	}
+	return &Tracker{
+		cfg:      cfg,
+		sessions: make(map[string]*Session),
+		lru:      list.New(),
+		lruIndex: make(map[string]*list.Element),
+	}
+}
+
+func (t *Tracker) HandleExec(ev events.ExecEvent) {
+	t.Record(&ev)
+}
+
+func (t *Tracker) HandleFileOpen(events.FileOpenEvent, string) {}
+func (t *Tracker) HandleConnect(events.ConnectEvent)           {}
+func (t *Tracker) HandleTamper(events.TamperEvent)             {}
+
+// Record adds an exec to its session and returns the session ID, or false
+// if the exec belongs to none.
+func (t *Tracker) Record(ev *events.ExecEvent) (string, bool) {
+	id, ok := IDFor(ev)
+	if !ok {
+		return "", false
+	}
+	now := ev.Hdr.Timestamp()
+	tty := ev.TTYName()
+	comm := utils.ExtractCString(ev.Hdr.Comm[:])
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[id]
+	if !ok {
+		s = &Session{
+			ID:       id,
+			AuditID:  ev.SessionID,
+			LoginUID: ev.LoginUID,
+			Leader:   ev.SessionLeader,
+			CgroupID: ev.Hdr.CgroupID,
+			Started:  now,
+		}
+		t.sessions[id] = s
+		t.lruIndex[id] = t.lru.PushFront(id)
+		t.evictLocked()
+	} else {
+		t.lru.MoveToFront(t.lruIndex[id])
+	}
+	if s.TTY == "" && tty != "" {
+		s.TTY = tty
+	}
+	if ev.Hdr.PID == s.Leader && s.LeaderComm == "" {
+		s.LeaderComm = comm
+		t.identifyLocked(s, ev)
+	}
+	if now.After(s.LastSeen) {
+		s.LastSeen = now
+	}
+
+	s.CommandCount++
+	cmdline := utils.ExtractCString(ev.CommandLine[:])
+	if cmdline == "" {
+		cmdline = utils.ExtractCString(ev.Filename[:])
+	}
+	s.Commands = append(s.Commands, Command{
+		Time:        now,
+		EventID:     ev.Hdr.ID,
+		PID:         ev.Hdr.PID,
+		PPID:        ev.PPID,
+		UID:         ev.Hdr.UID,
+		Comm:        comm,
+		CommandLine: cmdline,
+		Blocked:     ev.Hdr.Blocked == 1,
+	})
+	if over := len(s.Commands) - t.cfg.MaxCommands; over > 0 {
+		s.Commands = append(s.Commands[:0], s.Commands[over:]...)
+	}
+	return id, true
+}
+
+// identifyLocked works out where a session came from when its leader
+// execs: SSH when the leader was started by sshd or has SSH_CONNECTION in
+// its environment, console on a virtual or serial terminal.
+func (t *Tracker) identifyLocked(s *Session, ev *events.ExecEvent) {
+	if t.cfg.ReadProc {
+		if addr := sshClient(ev.Hdr.PID); addr != "" {
+			s.Origin, s.RemoteAddr = OriginSSH, addr
+			return
+		}
+	}
+	switch {
+	case utils.ExtractCString(ev.PComm[:]) == "sshd":
+		s.Origin = OriginSSH
+	case strings.HasPrefix(s.TTY, "tty"):
+		s.Origin = OriginConsole
+	}
+}
+
+// sshClient returns the client address from the SSH_CONNECTION or
+// SSH_CLIENT variable of a running process.
+func sshClient(pid uint32) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return ""
+	}
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		for _, key := range []string{"SSH_CONNECTION=", "SSH_CLIENT="} {
+			if v, ok := bytes.CutPrefix(kv, []byte(key)); ok {
+				if fields := strings.Fields(string(v)); len(fields) > 0 {
+					return fields[0]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func (t *Tracker) evictLocked() {
+	for len(t.sessions) > t.cfg.MaxSessions {
+		oldest := t.lru.Back()
+		id := oldest.Value.(string)
+		t.lru.Remove(oldest)
+		delete(t.lruIndex, id)
+		delete(t.sessions, id)
+	}
+}
+
+// active reports whether a session may still be in use: its leader is
+// running, or, without /proc, it ran a command within the idle timeout.
+func (t *Tracker) active(s *Session, now time.Time) bool {
+	if t.cfg.ReadProc && s.Leader != 0 {
+		_, err := os.Stat(fmt.Sprintf("/proc/%d", s.Leader))
+		return err == nil
+	}
+	return now.Sub(s.LastSeen) < t.cfg.IdleTimeout
+}
+
+// Get returns a copy of a session with its commands.
+func (t *Tracker) Get(id string) (Session, bool) {
+	t.mu.Lock()
+	s, ok := t.sessions[id]
+	var out Session
+	if ok {
+		out = *s
+		out.Commands = append([]Command(nil), s.Commands...)
+	}
+	t.mu.Unlock()
+	if ok {
+		out.Active = t.active(&out, time.Now())
+	}
+	return out, ok
+}
+
+// Filter narrows List. Zero values match every session.
+type Filter struct {
+	ActiveOnly  bool
+	LoginUID    *uint32
+	Interactive bool
+	Since       time.Time // sessions active since
+}
+
+// List returns copies of the sessions matching f, most recently active
+// first. Commands are included only with commands set.
+func (t *Tracker) List(f Filter, commands bool) []Session {
+	t.mu.Lock()
+	list := make([]Session, 0, len(t.sessions))
+	for e := t.lru.Front(); e != nil; e = e.Next() {
+		s := t.sessions[e.Value.(string)]
+		if f.LoginUID != nil && s.LoginUID != *f.LoginUID {
+			continue
+		}
+		if f.Interactive && !s.Interactive() {
+			continue
+		}
+		if !f.Since.IsZero() && s.LastSeen.Before(f.Since) {
+			continue
+		}
+		out := *s
+		out.Commands = nil
+		if commands {
+			out.Commands = append([]Command(nil), s.Commands...)
+		}
+		list = append(list, out)
+	}
+	t.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, s := range list {
+		s.Active = t.active(&s, now)
+		if f.ActiveOnly && !s.Active {
+			continue
+		}
+		list[n] = s
+		n++
+	}
+	list = list[:n]
+	sort.SliceStable(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+	return list
+}
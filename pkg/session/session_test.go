@@ -0,0 +1,82 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func exec(pid, sid, leader, loginUID uint32, tty, comm string, at time.Time) *events.ExecEvent {
+	ev := &events.ExecEvent{
+		PPID:          leader,
+		LoginUID:      loginUID,
+		SessionID:     sid,
+		SessionLeader: leader,
+	}
+	ev.Hdr.PID = pid
+	ev.Hdr.UID = loginUID
+	ev.Hdr.WallTimeNs = at.UnixNano()
+	copy(ev.Hdr.Comm[:], comm)
+	copy(ev.TTY[:], tty)
+	copy(ev.PComm[:], "sshd")
+	copy(ev.CommandLine[:], comm)
+	return ev
+}
+
+func TestTrackerGroupsCommandsBySession(t *testing.T) {
+	tr := NewTracker(Config{MaxCommands: 2})
+
+	// An SSH login: the shell is the leader; sudo keeps the audit session.
+	tr.Record(exec(4100, 7, 4100, 1001, "pts0", "bash", start))
+	tr.Record(exec(4101, 7, 4100, 1001, "pts0", "id", start.Add(time.Second)))
+	tr.Record(exec(4102, 7, 4200, 1001, "", "sudo", start.Add(2*time.Second)))
+	// A daemon belongs to no session.
+	if _, ok := tr.Record(exec(900, events.AuditUnset, 1, events.AuditUnset, "", "cron", start)); ok {
+		t.Error("daemon exec attributed to a session")
+	}
+	// Without audit, a terminal session is keyed by its leader.
+	if id, ok := tr.Record(exec(5001, events.AuditUnset, 5000, events.AuditUnset, "tty1", "ls", start)); !ok || id != "sid-5000" {
+		t.Errorf("console exec in session %q %v", id, ok)
+	}
+
+	s, ok := tr.Get("7")
+	if !ok {
+		t.Fatal("audit session not tracked")
+	}
+	if s.CommandCount != 3 || len(s.Commands) != 2 || s.Commands[0].Comm != "id" || !s.Interactive() {
+		t.Errorf("session = %+v", s)
+	}
+	if got := s.Description(); got != "ssh session by uid 1001 on pts/0" {
+		t.Errorf("description = %q", got)
+	}
+	s.RemoteAddr = "10.1.2.3"
+	if got := s.Description(); got != "ssh session from 10.1.2.3 by uid 1001 on pts/0" {
+		t.Errorf("description = %q", got)
+	}
+
+	uid := uint32(1001)
+	if list := tr.List(Filter{LoginUID: &uid}, false); len(list) != 1 || list[0].Commands != nil {
+		t.Errorf("sessions of uid 1001 = %+v", list)
+	}
+	if list := tr.List(Filter{Since: start.Add(time.Second)}, true); len(list) != 1 || list[0].ID != "7" {
+		t.Errorf("sessions since = %+v", list)
+	}
+}
+
+func TestTrackerEvictsLeastRecentlyActive(t *testing.T) {
+	tr := NewTracker(Config{MaxSessions: 2})
+	tr.Record(exec(1, 1, 1, 0, "pts1", "sh", start))
+	tr.Record(exec(2, 2, 2, 0, "pts2", "sh", start))
+	tr.Record(exec(3, 1, 1, 0, "pts1", "ls", start))
+	tr.Record(exec(4, 3, 4, 0, "pts3", "sh", start))
+
+	if _, ok := tr.Get("2"); ok {
+		t.Error("least recently active session kept")
+	}
+	if list := tr.List(Filter{}, false); len(list) != 2 {
+		t.Errorf("sessions = %+v", list)
+	}
+}
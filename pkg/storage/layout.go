@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"aegis/pkg/events"
+)
+
+// Segments record the kernel event layout of the agent that wrote them in
+// the version digit of segmentMagic. Records of older layouts are upgraded
+// to the current one before decoding, one version at a time; fields an
+// older agent did not record are left zero or unset.
+//
+//	1  56-byte header
+//	2  64-byte header with PID namespace, namespace PID and parent PID
+//	3  exec events with login UID, session ID, session leader and TTY
+const segmentVersion = 3
+
+// segmentVersionOf returns the layout version in a segment magic, or 0 if
+// the magic is not one of ours.
+func segmentVersionOf(magic []byte) int {
+	if len(magic) != len(segmentMagic) || string(magic[:6]) != segmentMagic[:6] || magic[7] != '\n' {
+		return 0
+	}
+	if magic[6] < '1' || magic[6] > '9' {
+		return 0
+	}
+	return int(magic[6] - '0')
+}
+
+// upgradeRecordBody converts the kernel part of a record body written with
+// layout version to the current layout. The exec trailer that follows it
+// is kept as is.
+func upgradeRecordBody(version int, typ events.EventType, body []byte) ([]byte, error) {
+	if version == 1 {
+		const oldHeader, newHeader = 56, 64
+		if len(body) < oldHeader {
+			return nil, fmt.Errorf("version 1 record too small: %d bytes", len(body))
+		}
+		// PID namespace fields went in before the event type; the padding
+		// after the type and blocked flag shrank from six bytes to two.
+		out := make([]byte, 0, len(body)+newHeader-oldHeader)
+		out = append(out, body[:32]...)
+		out = append(out, make([]byte, 12)...)
+		out = append(out, body[32:34]...)
+		out = append(out, 0, 0)
+		out = append(out, body[40:]...)
+		body, version = out, 2
+	}
+	if version == 2 {
+		if typ == events.EventTypeExec {
+			// Session fields replaced the padding after the parent PID.
+			const ppidEnd = events.EventHeaderSize + 4
+			if len(body) < ppidEnd+4 {
+				return nil, fmt.Errorf("version 2 exec record too small: %d bytes", len(body))
+			}
+			session := make([]byte, 12+events.TTYNameLen)
+			binary.LittleEndian.PutUint32(session[0:], events.AuditUnset)
+			binary.LittleEndian.PutUint32(session[4:], events.AuditUnset)
+			out := make([]byte, 0, len(body)+len(session)-4)
+			out = append(out, body[:ppidEnd]...)
+			out = append(out, session...)
+			out = append(out, body[ppidEnd+4:]...)
+			body = out
+		}
+		version = 3
+	}
+	if version != segmentVersion {
+		return nil, fmt.Errorf("unsupported segment version %d", version)
+	}
+	return body, nil
+}
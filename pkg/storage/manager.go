@@ -3,45 +3,172 @@ package storage
 import (
 	"sync"
 	"time"
+	"unsafe"
 
 	"aegis/pkg/events"
 )
 
+// Manager keeps recent events in a ring buffer with secondary indexes. With
+// a disk store attached the ring is a hot cache in front of it: every event
+// is also persisted, and reads reaching past the ring go to disk.
+//
+// Every event leaving the ring, whether overwritten at capacity or dropped
+// to stay within the memory budget, is removed from the indexes and the ID
+// map in the same critical section, so index lookups only ever return
+// events the ring still holds.
 type Manager struct {
 	store   *TimeRingBuffer
 	indexer *Indexer
+	byID    map[uint64]*Event // events still in the ring buffer
+	disk    *DiskStore
 	mu      sync.RWMutex
+
+	budget        int64 // bytes; 0 is unlimited
+	bytes         int64 // estimated size of retained events and their index entries
+	evicted       uint64
+	budgetEvicted uint64
 }
 
 func NewManager(capacity int, maxIndexSize int) *Manager {
-	return &Manager{
+	m := &Manager{
 		store:   NewTimeRingBuffer(capacity),
 		indexer: NewIndexer(maxIndexSize),
+		byID:    make(map[uint64]*Event),
 	}
+	m.store.SetEvictFunc(m.evict)
+	return m
 }
 
-func (m *Manager) Append(event *Event) error {
+// SetMemoryBudget bounds the estimated memory held by retained events and
+// their index entries. The oldest events are dropped once it is exceeded;
+// with a disk store attached they remain readable from disk. Zero removes
+// the bound.
+func (m *Manager) SetMemoryBudget(bytes int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.budget = bytes
+	m.enforceBudgetLocked()
+}
 
-	if err := m.store.Append(event); err != nil {
-		return err
+// evict is called by the ring buffer, with m.mu held, for every event it
+// drops.
+func (m *Manager) evict(event *Event) {
+	if event.ID != 0 && m.byID[event.ID] == event {
+		delete(m.byID, event.ID)
+	}
+	k := keysOf(event)
+	m.indexer.remove(event, k)
+	m.bytes -= eventBytes(event, k)
+	m.evicted++
+}
+
+func (m *Manager) enforceBudgetLocked() {
+	for m.budget > 0 && m.bytes > m.budget && m.store.Size() > 1 {
+		m.store.EvictOldest()
+		m.budgetEvicted++
+	}
+}
+
+// SetDiskStore attaches a persistent store. It must be called before the
+// first Append.
+func (m *Manager) SetDiskStore(d *DiskStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disk = d
+}
+
+// DiskStore returns the attached persistent store, or nil.
+func (m *Manager) DiskStore() *DiskStore {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.disk
+}
+
+func (m *Manager) Append(event *Event) error {
+	if event == nil {
+		return nil
 	}
 
-	m.indexer.IndexEvent(event)
+	m.mu.Lock()
+	m.store.Append(event)
+	if event.ID != 0 {
+		m.byID[event.ID] = event
+	}
+	k := keysOf(event)
+	m.indexer.add(event, k)
+	m.bytes += eventBytes(event, k)
+	m.enforceBudgetLocked()
+	disk := m.disk
+	m.mu.Unlock()
+
+	if disk != nil {
+		return disk.Append(event)
+	}
 	return nil
 }
 
+// Get returns the event with the given ID if it is still retained.
+func (m *Manager) Get(id uint64) (*Event, bool) {
+	m.mu.RLock()
+	ev, ok := m.byID[id]
+	disk := m.disk
+	m.mu.RUnlock()
+	if ok || disk == nil {
+		return ev, ok
+	}
+	return disk.Get(id)
+}
+
+// Query returns events in [start, end]. Ranges that begin before the
+// oldest event in the ring are answered from disk when one is attached.
 func (m *Manager) Query(start, end time.Time) ([]*Event, error) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.store.Query(start, end)
+	disk := m.disk
+	oldest := m.store.Oldest()
+	if disk == nil || (!oldest.IsZero() && !start.Before(oldest)) {
+		defer m.mu.RUnlock()
+		return m.store.Query(start, end)
+	}
+	m.mu.RUnlock()
+	return disk.Query(start, end)
+}
+
+// Scan calls visit for the events in [start, end], oldest first, until it
+// returns false. Like Query it reads from disk when the range begins before
+// the ring, but streams rather than collecting the events.
+func (m *Manager) Scan(start, end time.Time, visit func(*Event) bool) error {
+	m.mu.RLock()
+	disk := m.disk
+	oldest := m.store.Oldest()
+	m.mu.RUnlock()
+	if disk != nil && (oldest.IsZero() || start.Before(oldest)) {
+		disk.Scan(start, end, visit)
+		return nil
+	}
+
+	evs, err := m.store.Query(start, end)
+	if err != nil {
+		return err
+	}
+	for _, ev := range evs {
+		if !visit(ev) {
+			break
+		}
+	}
+	return nil
 }
 
+// Latest returns the most recent n events, from disk when the ring holds
+// fewer.
 func (m *Manager) Latest(n int) ([]*Event, error) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.store.Latest(n)
+	disk := m.disk
+	if disk == nil || n <= m.store.Size() {
+		defer m.mu.RUnlock()
+		return m.store.Latest(n)
+	}
+	m.mu.RUnlock()
+	return disk.Latest(n)
 }
 
 func (m *Manager) QueryByPID(pid uint32) []*Event {
@@ -89,6 +216,36 @@ func (m *Manager) QueryByProcess(processName string) []*Event {
 	return m.indexer.QueryByProcess(processName)
 }
 
+func (m *Manager) QueryByPath(path string) []*Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.indexer.QueryByPath(path)
+}
+
+func (m *Manager) QueryByPathPrefix(prefix string) []*Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.indexer.QueryByPathPrefix(prefix)
+}
+
+func (m *Manager) QueryByDestination(ip string) []*Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.indexer.QueryByDestination(ip)
+}
+
+func (m *Manager) QueryByPort(port uint16) []*Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.indexer.QueryByPort(port)
+}
+
+func (m *Manager) QueryByCmdlineTerm(term string) []*Event {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.indexer.QueryByCmdlineTerm(term)
+}
+
 func (m *Manager) QueryByFilter(filter Filter) []*Event {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -98,7 +255,15 @@ func (m *Manager) QueryByFilter(filter Filter) []*Event {
 func (m *Manager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.store.Close()
+	clear(m.byID)
+	m.bytes = 0
+	err := m.store.Close()
+	if m.disk != nil {
+		if derr := m.disk.Close(); err == nil {
+			err = derr
+		}
+	}
+	return err
 }
 
 func (m *Manager) Size() int {
@@ -110,3 +275,68 @@ func (m *Manager) Size() int {
 func (m *Manager) Capacity() int {
 	return m.store.Capacity()
 }
+
+// indexEntryBytes approximates one index entry: the list slot and a share of
+// the map or trie node holding it.
+const indexEntryBytes = 16
+
+// eventBytes estimates the memory held by an event, its payload and its
+// index entries.
+func eventBytes(event *Event, k indexKeys) int64 {
+	n := int64(unsafe.Sizeof(*event))
+	switch v := event.Data.(type) {
+	case *events.ExecEvent:
+		n += int64(unsafe.Sizeof(*v))
+	case events.ExecEvent:
+		n += int64(unsafe.Sizeof(v))
+	case *events.FileOpenEvent:
+		n += int64(unsafe.Sizeof(*v))
+	case events.FileOpenEvent:
+		n += int64(unsafe.Sizeof(v))
+	case *events.ConnectEvent:
+		n += int64(unsafe.Sizeof(*v))
+	case events.ConnectEvent:
+		n += int64(unsafe.Sizeof(v))
+	}
+
+	n += int64(k.entries() * indexEntryBytes)
+	for _, t := range k.terms {
+		n += int64(len(t))
+	}
+	return n
+}
+
+// StorageMetrics is a snapshot of the in-memory event store.
+type StorageMetrics struct {
+	Events       int    `json:"events"`
+	Capacity     int    `json:"capacity"`
+	Bytes        int64  `json:"bytes"`       // estimate, including index entries
+	BudgetBytes  int64  `json:"budgetBytes"` // 0 is unlimited
+	IndexEntries int    `json:"indexEntries"`
+	IndexedIDs   int    `json:"indexedIds"`
+	Oldest       string `json:"oldest,omitempty"` // RFC 3339
+
+	// Evicted counts every event dropped from memory; EvictedForBudget is
+	// the part dropped before the ring was full to stay within the budget.
+	Evicted          uint64 `json:"evicted"`
+	EvictedForBudget uint64 `json:"evictedForBudget"`
+}
+
+func (m *Manager) Metrics() StorageMetrics {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sm := StorageMetrics{
+		Events:           m.store.Size(),
+		Capacity:         m.store.Capacity(),
+		Bytes:            m.bytes,
+		BudgetBytes:      m.budget,
+		IndexEntries:     m.indexer.Entries(),
+		IndexedIDs:       len(m.byID),
+		Evicted:          m.evicted,
+		EvictedForBudget: m.budgetEvicted,
+	}
+	if oldest := m.store.Oldest(); !oldest.IsZero() {
+		sm.Oldest = oldest.Format(time.RFC3339)
+	}
+	return sm
+}
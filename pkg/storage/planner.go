@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultQueryScanLimit bounds how many recent events a query without a
+// time range or usable index examines.
+const DefaultQueryScanLimit = 10000
+
+// MaxQueryScan bounds how many events a time range scan examines. Range
+// scans stream from disk, so only matches are held in memory.
+const MaxQueryScan = 1000000
+
+// MaxQueryResults bounds the events returned by a query without a limit.
+const MaxQueryResults = 10000
+
+// QueryContext supplies data that is not stored with events.
+type QueryContext struct {
+	// CgroupPath resolves a cgroup ID for the cgroup_path field. When nil,
+	// cgroup_path predicates match nothing.
+	CgroupPath func(cgroupID uint64) string
+}
+
+// QueryResult holds the events matching a query.
+type QueryResult struct {
+	Events    []*Event
+	Total     int    // matches before the limit was applied
+	Scanned   int    // candidate events examined
+	Plan      string // how the candidates were selected
+	Truncated bool   // the scan stopped after MaxQueryScan events
+}
+
+// Execute runs q. Top-level and-ed equality predicates on type, pid, cgroup,
+// comm, filename, dst.ip or dst.port, and anchored filename patterns, are
+// answered from the indexer when it covers the requested time range;
+// anything else scans the time range, or the most recent
+// DefaultQueryScanLimit events when there is none.
+//
+// Results are in storage order unless q sorts them. Without a sort, a limit
+// keeps the most recent matches. A query without a limit returns at most
+// MaxQueryResults events; Total still counts every match.
+func (m *Manager) Execute(q *Query, ctx QueryContext) (*QueryResult, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = MaxQueryResults
+	}
+	top := &topRows{q: q, limit: limit}
+	match := newRowMatcher(q, ctx)
+	scan, err := m.scanCandidates(q, func(ev *Event) {
+		if r := match(ev); r != nil {
+			top.add(r)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := top.result()
+	result := &QueryResult{
+		Events:    make([]*Event, len(rows)),
+		Total:     top.total,
+		Scanned:   scan.scanned,
+		Plan:      scan.plan,
+		Truncated: scan.truncated,
+	}
+	for i, r := range rows {
+		result.Events[i] = r.ev
+	}
+	return result, nil
+}
+
+// topRows keeps the rows a limited query returns: the last limit rows in
+// storage order, or the first limit in q's sort order. It holds at most
+// twice limit rows at a time.
+type topRows struct {
+	q     *Query
+	limit int
+	rows  []*row
+	total int
+}
+
+func (t *topRows) add(r *row) {
+	t.total++
+	t.rows = append(t.rows, r)
+	if len(t.rows) >= 2*t.limit {
+		t.trim()
+	}
+}
+
+func (t *topRows) trim() {
+	if t.q.SortBy == "" {
+		if n := len(t.rows); n > t.limit {
+			t.rows = append([]*row(nil), t.rows[n-t.limit:]...)
+		}
+		return
+	}
+	// Sorting is stable and rows arrive in storage order, so ties keep
+	// storage order across trims.
+	sort.SliceStable(t.rows, func(i, j int) bool {
+		c := compareRows(t.rows[i], t.rows[j], t.q.SortBy)
+		if t.q.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	if len(t.rows) > t.limit {
+		t.rows = append([]*row(nil), t.rows[:t.limit]...)
+	}
+}
+
+func (t *topRows) result() []*row {
+	t.trim()
+	return t.rows
+}
+
+// Match reports whether ev satisfies q's condition and time range. Sort and
+// limit clauses do not apply to single events.
+func (q *Query) Match(ev *Event, ctx QueryContext) bool {
+	if ev == nil {
+		return false
+	}
+	if !q.Since.IsZero() && ev.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && ev.Timestamp.After(q.Until) {
+		return false
+	}
+	return q.Where == nil || q.Where.eval(newRow(ev, ctx.CgroupPath))
+}
+
+// matchRows returns rows for the events in evs that fall in q's time range
+// and satisfy its expression.
+func matchRows(evs []*Event, q *Query, ctx QueryContext) []*row {
+	match := newRowMatcher(q, ctx)
+	rows := make([]*row, 0, len(evs))
+	for _, ev := range evs {
+		if r := match(ev); r != nil {
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// newRowMatcher returns a function giving the row for an event that falls
+// in q's time range and satisfies its expression, and nil for any other.
+// Cgroup paths are resolved once per cgroup.
+func newRowMatcher(q *Query, ctx QueryContext) func(*Event) *row {
+	var cgroupPath func(uint64) string
+	if ctx.CgroupPath != nil {
+		paths := make(map[uint64]string)
+		cgroupPath = func(id uint64) string {
+			p, ok := paths[id]
+			if !ok {
+				p = ctx.CgroupPath(id)
+				paths[id] = p
+			}
+			return p
+		}
+	}
+
+	return func(ev *Event) *row {
+		if ev == nil {
+			return nil
+		}
+		if !q.Since.IsZero() && ev.Timestamp.Before(q.Since) {
+			return nil
+		}
+		if !q.Until.IsZero() && ev.Timestamp.After(q.Until) {
+			return nil
+		}
+		r := newRow(ev, cgroupPath)
+		if q.Where == nil || q.Where.eval(r) {
+			return r
+		}
+		return nil
+	}
+}
+
+// candidateScan describes how the candidates of a query were selected.
+type candidateScan struct {
+	plan      string
+	scanned   int
+	truncated bool
+}
+
+// scanCandidates calls visit for each event q is evaluated against, in
+// storage order. A time range the index cannot serve is streamed, and
+// stops after MaxQueryScan events.
+func (m *Manager) scanCandidates(q *Query, visit func(*Event)) (candidateScan, error) {
+	if evs, plan, ok := m.indexCandidates(q); ok {
+		for _, ev := range evs {
+			visit(ev)
+		}
+		return candidateScan{plan: plan, scanned: len(evs)}, nil
+	}
+
+	if q.Since.IsZero() {
+		evs, err := m.Latest(DefaultQueryScanLimit)
+		for _, ev := range evs {
+			visit(ev)
+		}
+		return candidateScan{plan: fmt.Sprintf("scan latest %d", DefaultQueryScanLimit), scanned: len(evs)}, err
+	}
+
+	end := q.Until
+	if end.IsZero() {
+		end = time.Now()
+	}
+	scan := candidateScan{plan: "scan range"}
+	err := m.Scan(q.Since, end, func(ev *Event) bool {
+		if scan.scanned == MaxQueryScan {
+			scan.truncated = true
+			return false
+		}
+		scan.scanned++
+		visit(ev)
+		return true
+	})
+	if scan.truncated {
+		scan.plan = fmt.Sprintf("scan range, stopped after %d events", MaxQueryScan)
+	}
+	return scan, err
+}
+
+// indexCandidates picks the smallest index lookup among the top-level
+// conjuncts. It declines when an index list may be missing events in the
+// requested range: lists are capped at maxIndexSize, and with a disk store
+// attached, events older than the ring were never indexed by this process.
+func (m *Manager) indexCandidates(q *Query) ([]*Event, string, bool) {
+	m.mu.RLock()
+	var covered time.Time
+	if m.disk != nil {
+		covered = m.store.Oldest()
+	}
+	m.mu.RUnlock()
+
+	if !q.Since.IsZero() && q.Since.Before(covered) {
+		return nil, "", false
+	}
+
+	var best []*Event
+	var bestPlan string
+	found := false
+	for _, c := range conjuncts(q.Where) {
+		p, ok := c.(*Predicate)
+		if !ok || (p.Op != "=" && p.Op != "in" && p.Op != "~=") {
+			continue
+		}
+		evs, ok := m.indexer.lookup(p, q.Since)
+		if !ok {
+			continue
+		}
+		if !found || len(evs) < len(best) {
+			best, bestPlan, found = evs, "index "+p.String(), true
+		}
+	}
+	if !found {
+		return nil, "", false
+	}
+	sort.SliceStable(best, func(i, j int) bool {
+		return best[i].Timestamp.Before(best[j].Timestamp)
+	})
+	return best, bestPlan, true
+}
+
+// lookup returns the union of the index lists for p's values. It reports
+// false when p's field is not indexed or a capped list does not reach back
+// to since.
+func (idx *Indexer) lookup(p *Predicate, since time.Time) ([]*Event, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	complete := func(list []*Event) bool {
+		return len(list) < idx.maxIndexSize || (!since.IsZero() && !list[0].Timestamp.After(since))
+	}
+
+	var out []*Event
+	if p.Op == "~=" {
+		// An anchored pattern with a literal prefix can only match
+		// filenames under that prefix.
+		prefix, _ := p.re.LiteralPrefix()
+		if p.Field != "filename" || !strings.HasPrefix(p.Values[0], "^") || prefix == "" {
+			return nil, false
+		}
+		ok := true
+		idx.paths.prefixed(prefix, func(n *pathNode) {
+			ok = ok && complete(n.events)
+			out = append(out, n.events...)
+		})
+		return out, ok
+	}
+
+	for i, v := range p.Values {
+		var list []*Event
+		switch p.Field {
+		case "type":
+			list = idx.typeIndex[eventTypeNames[v]]
+		case "pid":
+			list = idx.pidIndex[uint32(p.nums[i])]
+		case "cgroup":
+			list = idx.cgroupIndex[p.nums[i]]
+		case "comm":
+			list = idx.processIndex[v]
+		case "filename":
+			if n := idx.paths.find(v); n != nil {
+				list = n.events
+			}
+		case "dst.port":
+			if p.nums[i] > 0xffff {
+				continue
+			}
+			list = idx.portIndex[uint16(p.nums[i])]
+		case "dst.ip":
+			// Only single addresses map to one index entry.
+			if ones, bits := p.nets[i].Mask.Size(); ones != bits {
+				return nil, false
+			}
+			list = idx.ipIndex[p.nets[i].IP.String()]
+		default:
+			return nil, false
+		}
+		if !complete(list) {
+			return nil, false
+		}
+		out = append(out, list...)
+	}
+	return out, true
+}
+
+func compareRows(a, b *row, field string) int {
+	switch queryFields[field] {
+	case kindTime:
+		return a.ev.Timestamp.Compare(b.ev.Timestamp)
+	case kindNumber:
+		x, _ := a.number(field)
+		y, _ := b.number(field)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case kindBool:
+		return int(a.hdr.Blocked) - int(b.hdr.Blocked)
+	case kindIP:
+		return strings.Compare(ipKey(a), ipKey(b))
+	}
+	x, _ := a.text(field)
+	y, _ := b.text(field)
+	return strings.Compare(x, y)
+}
+
+func ipKey(r *row) string {
+	if r.ip == nil {
+		return ""
+	}
+	return string(r.ip.To16())
+}
@@ -0,0 +1,704 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"aegis/pkg/events"
+	"aegis/pkg/utils"
+)
+
+// Event query language
+//
+// A query is an optional boolean expression over event fields followed by
+// optional clauses:
+//
+//	type = exec and parent in (bash, sh) and cmdline contains "curl"
+//	dst.port = 4444 or dst.ip = 10.0.0.0/8 since 1h
+//	filename ~= "^/etc/(passwd|shadow)$" and not blocked = true
+//	comm = nginx since 2024-05-01T00:00:00Z until 2024-05-02T00:00:00Z
+//	uid = 0 sort by time desc limit 20
+//
+// Operators are =, !=, <, <=, >, >=, in (...), contains and ~= (regular
+// expression), combined with and, or, not and parentheses. Values are
+// quoted strings or bare words. since and until take an RFC 3339 time or a
+// duration back from now. Keywords are case-insensitive.
+
+// Field kinds determine which operators apply and how values are parsed.
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindNumber
+	kindBool
+	kindIP
+	kindTime
+)
+
+var queryFields = map[string]fieldKind{
+	"id":          kindNumber,
+	"type":        kindString,
+	"time":        kindTime,
+	"pid":         kindNumber,
+	"ppid":        kindNumber,
+	"uid":         kindNumber,
+	"gid":         kindNumber,
+	"cgroup":      kindNumber,
+	"cgroup_path": kindString,
+	"comm":        kindString,
+	"parent":      kindString,
+	"filename":    kindString,
+	"cmdline":     kindString,
+	"exe_sha256":  kindString,
+	"dst.ip":      kindIP,
+	"dst.port":    kindNumber,
+	"blocked":     kindBool,
+}
+
+// Query is a parsed event query.
+type Query struct {
+	Where  Expr      // nil matches every event
+	Since  time.Time // zero leaves the range open
+	Until  time.Time
+	SortBy string // field name; empty keeps storage order
+	Desc   bool
+	Limit  int // 0 returns all matches
+}
+
+// Expr is a boolean expression over an event.
+type Expr interface {
+	eval(r *row) bool
+	String() string
+}
+
+type andExpr struct{ left, right Expr }
+type orExpr struct{ left, right Expr }
+type notExpr struct{ inner Expr }
+
+func (e andExpr) eval(r *row) bool { return e.left.eval(r) && e.right.eval(r) }
+func (e orExpr) eval(r *row) bool  { return e.left.eval(r) || e.right.eval(r) }
+func (e notExpr) eval(r *row) bool { return !e.inner.eval(r) }
+
+func (e andExpr) String() string { return "(" + e.left.String() + " and " + e.right.String() + ")" }
+func (e orExpr) String() string  { return "(" + e.left.String() + " or " + e.right.String() + ")" }
+func (e notExpr) String() string { return "not " + e.inner.String() }
+
+// Predicate compares one field with one or more values.
+type Predicate struct {
+	Field  string
+	Op     string // "=", "!=", "<", "<=", ">", ">=", "in", "contains", "~="
+	Values []string
+
+	kind  fieldKind
+	nums  []uint64
+	times []time.Time
+	nets  []*net.IPNet
+	re    *regexp.Regexp
+	bool  bool
+}
+
+func (p *Predicate) String() string {
+	if p.Op == "in" {
+		return fmt.Sprintf("%s in (%s)", p.Field, strings.Join(quoteAll(p.Values), ", "))
+	}
+	return fmt.Sprintf("%s %s %s", p.Field, p.Op, strconv.Quote(p.Values[0]))
+}
+
+func quoteAll(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strconv.Quote(v)
+	}
+	return out
+}
+
+// conjuncts splits the top-level and-chain of e.
+func conjuncts(e Expr) []Expr {
+	if a, ok := e.(andExpr); ok {
+		return append(conjuncts(a.left), conjuncts(a.right)...)
+	}
+	if e == nil {
+		return nil
+	}
+	return []Expr{e}
+}
+
+// ParseQuery parses src. Relative times are resolved against now.
+func ParseQuery(src string, now time.Time) (*Query, error) {
+	toks, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks, now: now}
+	return p.parse()
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOp
+	tokEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) is(keyword string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:/-*@+", r)
+}
+
+func lexQuery(src string) ([]token, error) {
+	var toks []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				// Only the quote and the backslash are escaped, so regular
+				// expressions keep their backslashes.
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == r || runes[i+1] == '\\') {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			toks = append(toks, token{tokString, b.String(), start})
+		case strings.ContainsRune("(),", r):
+			toks = append(toks, token{tokOp, string(r), i})
+			i++
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				op += "="
+			}
+			i += len(op)
+			switch op {
+			case "==":
+				op = "="
+			case "!", "~":
+				return nil, fmt.Errorf("unexpected %q at %d", op, start)
+			}
+			toks = append(toks, token{tokOp, op, start})
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			toks = append(toks, token{tokWord, string(runes[start:i]), start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", r, i)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+type queryParser struct {
+	toks []token
+	pos  int
+	now  time.Time
+}
+
+func (p *queryParser) peek() token { return p.toks[p.pos] }
+
+func (p *queryParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("query: "+format+" at %d", append(args, t.pos)...)
+}
+
+func isClauseKeyword(t token) bool {
+	return t.is("since") || t.is("until") || t.is("sort") || t.is("limit")
+}
+
+func (p *queryParser) parse() (*Query, error) {
+	q := &Query{}
+	if t := p.peek(); t.kind != tokEOF && !isClauseKeyword(t) {
+		where, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		q.Where = where
+	}
+
+	for {
+		t := p.next()
+		switch {
+		case t.kind == tokEOF:
+			if !q.Since.IsZero() && !q.Until.IsZero() && q.Until.Before(q.Since) {
+				return nil, fmt.Errorf("query: until is before since")
+			}
+			return q, nil
+		case t.is("since"), t.is("until"):
+			v := p.next()
+			ts, err := ParseQueryTime(v.text, p.now)
+			if err != nil || (v.kind != tokWord && v.kind != tokString) {
+				return nil, p.errorf(v, "invalid time %q", v.text)
+			}
+			if t.is("since") {
+				q.Since = ts
+			} else {
+				q.Until = ts
+			}
+		case t.is("sort"):
+			if by := p.next(); !by.is("by") {
+				return nil, p.errorf(by, "expected \"by\"")
+			}
+			f := p.next()
+			field := strings.ToLower(f.text)
+			if _, ok := queryFields[field]; !ok || f.kind != tokWord {
+				return nil, p.errorf(f, "unknown field %q", f.text)
+			}
+			q.SortBy = field
+			if d := p.peek(); d.is("asc") || d.is("desc") {
+				q.Desc = p.next().is("desc")
+			}
+		case t.is("limit"):
+			v := p.next()
+			n, err := strconv.Atoi(v.text)
+			if err != nil || n < 0 || v.kind != tokWord {
+				return nil, p.errorf(v, "invalid limit %q", v.text)
+			}
+			q.Limit = n
+		default:
+			return nil, p.errorf(t, "unexpected %q", t.text)
+		}
+	}
+}
+
+func (p *queryParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (Expr, error) {
+	if p.peek().is("not") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (Expr, error) {
+	t := p.next()
+	if t.kind == tokOp && t.text == "(" {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokOp || c.text != ")" {
+			return nil, p.errorf(c, "expected \")\"")
+		}
+		return e, nil
+	}
+	if t.kind != tokWord {
+		return nil, p.errorf(t, "expected a field name, got %q", t.text)
+	}
+
+	field := strings.ToLower(t.text)
+	kind, ok := queryFields[field]
+	if !ok {
+		return nil, p.errorf(t, "unknown field %q", t.text)
+	}
+
+	opTok := p.next()
+	pred := &Predicate{Field: field, kind: kind}
+	switch {
+	case opTok.kind == tokOp && opTok.text != "(" && opTok.text != ")" && opTok.text != ",":
+		pred.Op = opTok.text
+	case opTok.is("in"), opTok.is("contains"):
+		pred.Op = strings.ToLower(opTok.text)
+	default:
+		return nil, p.errorf(opTok, "expected an operator after %s", field)
+	}
+
+	if pred.Op == "in" {
+		if o := p.next(); o.kind != tokOp || o.text != "(" {
+			return nil, p.errorf(o, "expected \"(\" after in")
+		}
+		for {
+			v := p.next()
+			if v.kind != tokWord && v.kind != tokString {
+				return nil, p.errorf(v, "expected a value")
+			}
+			pred.Values = append(pred.Values, v.text)
+			sep := p.next()
+			if sep.kind == tokOp && sep.text == ")" {
+				break
+			}
+			if sep.kind != tokOp || sep.text != "," {
+				return nil, p.errorf(sep, "expected \",\" or \")\"")
+			}
+		}
+	} else {
+		v := p.next()
+		if v.kind != tokWord && v.kind != tokString {
+			return nil, p.errorf(v, "expected a value after %s %s", field, pred.Op)
+		}
+		pred.Values = []string{v.text}
+	}
+
+	if err := pred.compile(p.now); err != nil {
+		return nil, fmt.Errorf("query: %s: %w", field, err)
+	}
+	return pred, nil
+}
+
+// compile checks the operator against the field kind and parses the values.
+func (p *Predicate) compile(now time.Time) error {
+	allowed := map[fieldKind]string{
+		kindString: "= != in contains ~=",
+		kindNumber: "= != < <= > >= in",
+		kindBool:   "= !=",
+		kindIP:     "= != in contains ~=",
+		kindTime:   "= != < <= > >=",
+	}[p.kind]
+	if !strings.Contains(" "+allowed+" ", " "+p.Op+" ") {
+		return fmt.Errorf("operator %s not supported", p.Op)
+	}
+
+	if p.Op == "~=" {
+		re, err := regexp.Compile(p.Values[0])
+		if err != nil {
+			return err
+		}
+		p.re = re
+		return nil
+	}
+	if p.Op == "contains" {
+		return nil
+	}
+
+	for i, v := range p.Values {
+		switch p.kind {
+		case kindString:
+			if p.Field == "type" {
+				v = strings.ToLower(v)
+				if _, ok := eventTypeNames[v]; !ok {
+					return fmt.Errorf("unknown event type %q", v)
+				}
+				p.Values[i] = v
+			}
+		case kindNumber:
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %q", v)
+			}
+			p.nums = append(p.nums, n)
+		case kindBool:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid boolean %q", v)
+			}
+			p.bool = b
+		case kindIP:
+			cidr := v
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(v); ip == nil {
+					return fmt.Errorf("invalid address %q", v)
+				} else if ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid address %q", v)
+			}
+			p.nets = append(p.nets, n)
+		case kindTime:
+			ts, err := ParseQueryTime(v, now)
+			if err != nil {
+				return err
+			}
+			p.times = append(p.times, ts)
+		}
+	}
+	return nil
+}
+
+// ParseQueryTime parses a since or until value: RFC 3339, "now", or a
+// duration meaning that long before now.
+func ParseQueryTime(v string, now time.Time) (time.Time, error) {
+	if strings.EqualFold(v, "now") {
+		return now, nil
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return ts, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(v, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
+}
+
+var eventTypeNames = map[string]events.EventType{
+	"exec":    events.EventTypeExec,
+	"file":    events.EventTypeFileOpen,
+	"connect": events.EventTypeConnect,
+}
+
+func eventTypeName(t events.EventType) string {
+	for name, et := range eventTypeNames {
+		if et == t {
+			return name
+		}
+	}
+	return ""
+}
+
+func (p *Predicate) eval(r *row) bool {
+	switch p.kind {
+	case kindNumber:
+		n, ok := r.number(p.Field)
+		if !ok {
+			return false
+		}
+		return p.compareNumber(n)
+	case kindBool:
+		match := (r.hdr.Blocked != 0) == p.bool
+		return match == (p.Op == "=")
+	case kindTime:
+		return p.compareTime(r.ev.Timestamp)
+	case kindIP:
+		if r.ip == nil {
+			return false
+		}
+		switch p.Op {
+		case "contains":
+			return strings.Contains(r.ip.String(), p.Values[0])
+		case "~=":
+			return p.re.MatchString(r.ip.String())
+		}
+		in := false
+		for _, n := range p.nets {
+			if n.Contains(r.ip) {
+				in = true
+				break
+			}
+		}
+		return in == (p.Op != "!=")
+	}
+
+	s, ok := r.text(p.Field)
+	if !ok {
+		return false
+	}
+	switch p.Op {
+	case "contains":
+		return strings.Contains(s, p.Values[0])
+	case "~=":
+		return p.re.MatchString(s)
+	case "!=":
+		return s != p.Values[0]
+	}
+	for _, v := range p.Values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Predicate) compareNumber(n uint64) bool {
+	switch p.Op {
+	case "=", "in":
+		for _, v := range p.nums {
+			if n == v {
+				return true
+			}
+		}
+		return false
+	case "!=":
+		return n != p.nums[0]
+	case "<":
+		return n < p.nums[0]
+	case "<=":
+		return n <= p.nums[0]
+	case ">":
+		return n > p.nums[0]
+	case ">=":
+		return n >= p.nums[0]
+	}
+	return false
+}
+
+func (p *Predicate) compareTime(t time.Time) bool {
+	v := p.times[0]
+	switch p.Op {
+	case "=":
+		return t.Equal(v)
+	case "!=":
+		return !t.Equal(v)
+	case "<":
+		return t.Before(v)
+	case "<=":
+		return !t.After(v)
+	case ">":
+		return t.After(v)
+	case ">=":
+		return !t.Before(v)
+	}
+	return false
+}
+
+// row holds the fields of one event as the query language sees them.
+type row struct {
+	ev       *Event
+	hdr      events.EventHeader
+	ppid     uint32
+	comm     string
+	parent   string
+	filename string
+	cmdline  string
+	sha      string
+	ip       net.IP
+	port     uint16
+	hasPort  bool
+
+	cgroupPath func(uint64) string
+}
+
+func newRow(ev *Event, cgroupPath func(uint64) string) *row {
+	r := &row{ev: ev, cgroupPath: cgroupPath}
+	r.hdr, _ = ev.Header()
+	r.comm = extractCString(r.hdr.Comm[:])
+	switch v := ev.TypedData().(type) {
+	case *events.ExecEvent:
+		r.ppid = v.PPID
+		r.parent = extractCString(v.PComm[:])
+		r.filename = extractCString(v.Filename[:])
+		r.cmdline = extractCString(v.CommandLine[:])
+		r.sha = v.ExeSHA256
+	case *events.FileOpenEvent:
+		r.filename = extractCString(v.Filename[:])
+	case *events.ConnectEvent:
+		r.ip = net.ParseIP(utils.ExtractIP(v))
+		r.port, r.hasPort = v.Port, true
+	}
+	return r
+}
+
+func (r *row) number(field string) (uint64, bool) {
+	switch field {
+	case "id":
+		return r.ev.ID, true
+	case "pid":
+		return uint64(r.hdr.PID), true
+	case "ppid":
+		return uint64(r.ppid), r.ev.Type == events.EventTypeExec
+	case "uid":
+		return uint64(r.hdr.UID), true
+	case "gid":
+		return uint64(r.hdr.GID), true
+	case "cgroup":
+		return r.hdr.CgroupID, true
+	case "dst.port":
+		return uint64(r.port), r.hasPort
+	}
+	return 0, false
+}
+
+func (r *row) text(field string) (string, bool) {
+	switch field {
+	case "type":
+		return eventTypeName(r.ev.Type), true
+	case "comm":
+		return r.comm, true
+	case "parent":
+		return r.parent, r.ev.Type == events.EventTypeExec
+	case "filename":
+		return r.filename, r.ev.Type != events.EventTypeConnect
+	case "cmdline":
+		return r.cmdline, r.ev.Type == events.EventTypeExec
+	case "exe_sha256":
+		return r.sha, r.ev.Type == events.EventTypeExec
+	case "cgroup_path":
+		if r.cgroupPath == nil {
+			return "", false
+		}
+		return r.cgroupPath(r.hdr.CgroupID), true
+	}
+	return "", false
+}
+
+// value formats field for grouping. It reports false when the field does
+// not apply to the event.
+func (r *row) value(field string) (string, bool) {
+	switch queryFields[field] {
+	case kindNumber:
+		n, ok := r.number(field)
+		return strconv.FormatUint(n, 10), ok
+	case kindBool:
+		return strconv.FormatBool(r.hdr.Blocked != 0), true
+	case kindIP:
+		if r.ip == nil {
+			return "", false
+		}
+		return r.ip.String(), true
+	case kindTime:
+		return r.ev.Timestamp.UTC().Format(time.RFC3339Nano), true
+	}
+	return r.text(field)
+}
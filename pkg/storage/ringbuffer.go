@@ -11,8 +11,10 @@ type TimeRingBuffer struct {
 	events    []*Event
 	capacity  int
 	writePos  int64 // Atomic counter for write position
+	readPos   int64 // position of the oldest retained event
 	mu        sync.RWMutex
 	startTime time.Time // Time of first event
+	onEvict   func(*Event)
 }
 
 func NewTimeRingBuffer(capacity int) *TimeRingBuffer {
@@ -25,6 +27,15 @@ func NewTimeRingBuffer(capacity int) *TimeRingBuffer {
 	}
 }
 
+// SetEvictFunc registers fn to be called, with the buffer locked, for every
+// event that leaves the buffer, whether overwritten or dropped by
+// EvictOldest. It must be set before the first Append.
+func (rb *TimeRingBuffer) SetEvictFunc(fn func(*Event)) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.onEvict = fn
+}
+
 func (rb *TimeRingBuffer) Append(event *Event) error {
 	if event == nil {
 		return nil
@@ -43,40 +54,43 @@ func (rb *TimeRingBuffer) Append(event *Event) error {
 		rb.startTime = event.Timestamp
 	}
 
-	// Calculate position using atomic counter
-	pos := int(rb.writePos % int64(rb.capacity))
-	rb.events[pos] = event
+	if rb.writePos-rb.readPos == int64(rb.capacity) {
+		rb.evictOldestLocked()
+	}
+	rb.events[rb.writePos%int64(rb.capacity)] = event
 	rb.writePos++
-
 	return nil
 }
 
-func (rb *TimeRingBuffer) Query(start, end time.Time) ([]*Event, error) {
-	rb.mu.RLock()
-	defer rb.mu.RUnlock()
+// EvictOldest drops the oldest event and reports whether there was one.
+func (rb *TimeRingBuffer) EvictOldest() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	return rb.evictOldestLocked()
+}
 
-	if rb.writePos == 0 {
-		return []*Event{}, nil
+func (rb *TimeRingBuffer) evictOldestLocked() bool {
+	if rb.readPos == rb.writePos {
+		return false
 	}
-
-	var results []*Event
-	totalEvents := int(rb.writePos)
-	if totalEvents > rb.capacity {
-		totalEvents = rb.capacity
+	pos := rb.readPos % int64(rb.capacity)
+	evicted := rb.events[pos]
+	rb.events[pos] = nil
+	rb.readPos++
+	if evicted != nil && rb.onEvict != nil {
+		rb.onEvict(evicted)
 	}
+	return true
+}
 
-	// Start from the oldest event (writePos - totalEvents) or 0
-	startIdx := 0
-	if totalEvents == rb.capacity {
-		// Buffer is full, start from the oldest event
-		oldestPos := int(rb.writePos % int64(rb.capacity))
-		startIdx = oldestPos
-	}
+// Query returns the events in [start, end], oldest first.
+func (rb *TimeRingBuffer) Query(start, end time.Time) ([]*Event, error) {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
 
-	// Iterate through events in chronological order
-	for i := 0; i < totalEvents; i++ {
-		idx := (startIdx + i) % rb.capacity
-		event := rb.events[idx]
+	results := []*Event{}
+	for i := rb.readPos; i < rb.writePos; i++ {
+		event := rb.events[i%int64(rb.capacity)]
 		if event == nil {
 			continue
 		}
@@ -90,6 +104,7 @@ func (rb *TimeRingBuffer) Query(start, end time.Time) ([]*Event, error) {
 	return results, nil
 }
 
+// Latest returns the most recent n events, oldest first.
 func (rb *TimeRingBuffer) Latest(n int) ([]*Event, error) {
 	rb.mu.RLock()
 	defer rb.mu.RUnlock()
@@ -97,59 +112,56 @@ func (rb *TimeRingBuffer) Latest(n int) ([]*Event, error) {
 	if n <= 0 {
 		return []*Event{}, nil
 	}
-
-	if rb.writePos == 0 {
-		return []*Event{}, nil
+	from := rb.writePos - int64(n)
+	if from < rb.readPos {
+		from = rb.readPos
 	}
 
-	totalEvents := int(rb.writePos)
-	if totalEvents > rb.capacity {
-		totalEvents = rb.capacity
-	}
-
-	if n > totalEvents {
-		n = totalEvents
-	}
-
-	results := make([]*Event, 0, n)
-
-	// Start from the most recent event and work backwards
-	startPos := int((rb.writePos - 1) % int64(rb.capacity))
-	for i := 0; i < n; i++ {
-		idx := (startPos - i + rb.capacity) % rb.capacity
-		event := rb.events[idx]
-		if event != nil {
-			// Insert at beginning to maintain chronological order
-			results = append([]*Event{event}, results...)
+	results := make([]*Event, 0, rb.writePos-from)
+	for i := from; i < rb.writePos; i++ {
+		if event := rb.events[i%int64(rb.capacity)]; event != nil {
+			results = append(results, event)
 		}
 	}
 
 	return results, nil
 }
 
+// Oldest returns the timestamp of the oldest retained event, or the zero
+// time when the buffer is empty.
+func (rb *TimeRingBuffer) Oldest() time.Time {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	if rb.readPos == rb.writePos {
+		return time.Time{}
+	}
+	if ev := rb.events[rb.readPos%int64(rb.capacity)]; ev != nil {
+		return ev.Timestamp
+	}
+	return time.Time{}
+}
+
 func (rb *TimeRingBuffer) Close() error {
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
 	rb.events = nil
+	rb.readPos = rb.writePos
 	return nil
 }
 
 func (rb *TimeRingBuffer) Size() int {
 	rb.mu.RLock()
 	defer rb.mu.RUnlock()
-	totalEvents := int(rb.writePos)
-	if totalEvents > rb.capacity {
-		return rb.capacity
-	}
-	return totalEvents
+	return int(rb.writePos - rb.readPos)
 }
 
 func (rb *TimeRingBuffer) Capacity() int {
 	return rb.capacity
 }
 
-func EventFromBackend(eventType events.EventType, timestamp time.Time, data any) *Event {
+func EventFromBackend(id uint64, eventType events.EventType, timestamp time.Time, data any) *Event {
 	return &Event{
+		ID:        id,
 		Type:      eventType,
 		Timestamp: timestamp,
 		Data:      data,
@@ -7,11 +7,47 @@ import (
 )
 
 type Event struct {
+	ID        uint64 // assigned at dispatch, see events.EventHeader.ID
 	Type      events.EventType
 	Timestamp time.Time
 	Data      any // Can be *events.ExecEvent, *events.FileOpenEvent, or *events.ConnectEvent
 }
 
+// Header returns the common header of the event, whose payload may be held
+// by value or by pointer.
+func (e *Event) Header() (events.EventHeader, bool) {
+	switch ev := e.Data.(type) {
+	case *events.ExecEvent:
+		return ev.Hdr, true
+	case events.ExecEvent:
+		return ev.Hdr, true
+	case *events.FileOpenEvent:
+		return ev.Hdr, true
+	case events.FileOpenEvent:
+		return ev.Hdr, true
+	case *events.ConnectEvent:
+		return ev.Hdr, true
+	case events.ConnectEvent:
+		return ev.Hdr, true
+	}
+	return events.EventHeader{}, false
+}
+
+// TypedData returns the payload in pointer form (*events.ExecEvent,
+// *events.FileOpenEvent or *events.ConnectEvent) regardless of how it was
+// stored. Other payloads are returned unchanged.
+func (e *Event) TypedData() any {
+	switch ev := e.Data.(type) {
+	case events.ExecEvent:
+		return &ev
+	case events.FileOpenEvent:
+		return &ev
+	case events.ConnectEvent:
+		return &ev
+	}
+	return e.Data
+}
+
 type EventStore interface {
 	// Append adds an event to the store.
 	Append(event *Event) error
@@ -31,4 +67,10 @@ type Filter struct {
 	PIDs      []uint32
 	CgroupIDs []uint64
 	Processes []string
+
+	Paths        []string // exact exec or file-open filenames
+	PathPrefixes []string // filename prefixes, e.g. "/etc/" or "/etc/pass"
+	DstIPs       []string // connect destinations
+	DstPorts     []uint16
+	CmdlineTerms []string // exec command-line arguments; all must be present
 }
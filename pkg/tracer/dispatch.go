@@ -2,6 +2,7 @@ package tracer
 
 import (
 	"log"
+	"sync/atomic"
 
 	"aegis/pkg/events"
 	"aegis/pkg/proc"
@@ -10,82 +11,199 @@ import (
 	"aegis/pkg/workload"
 )
 
+// decodedEvent is an event after the decode stage. Exactly one of the
+// typed pointers is set.
+type decodedEvent struct {
+	Type    events.EventType
+	ID      uint64
+	PID     uint32
+	Blocked bool
+
+	Exec    *events.ExecEvent
+	File    *events.FileOpenEvent
+	Connect *events.ConnectEvent
+	Tamper  *events.TamperEvent
+
+	// Genealogy is the exec'd process' ancestor chain, nearest first, when
+	// the process tree knows it.
+	Genealogy []uint32
+}
+
+// ExecEnricher adds userspace-derived fields, such as the binary's digest,
+// to exec events before they are stored and matched.
+type ExecEnricher interface {
+	EnrichExec(ev *events.ExecEvent)
+}
+
+// eventSeq numbers events in the order they are decoded.
+var eventSeq atomic.Uint64
+
+// ResumeEventIDs makes numbering continue after last, the highest ID a
+// persistent store already holds, so IDs stay unique across restarts.
+func ResumeEventIDs(last uint64) {
+	for {
+		cur := eventSeq.Load()
+		if cur >= last || eventSeq.CompareAndSwap(cur, last) {
+			return
+		}
+	}
+}
+
 // DispatchEvent decodes and dispatches an event to handlers.
 func DispatchEvent(data []byte, handlers *events.HandlerChain, processTree *proc.ProcessTree, registry *workload.Registry, storageMgr *storage.Manager, profileReg *proc.ProfileRegistry) {
-	if len(data) < events.EventHeaderSize {
+	ev := decodeEvent(data)
+	if ev == nil {
 		return
 	}
-	// Event type is at offset 32 in the header (after timestamp, cgroup_id, pid, tid, uid, gid)
-	// 8+8+4+4+4+4 = 32 bytes
-	eventType := events.EventType(data[32])
+	enrichEvent(ev, processTree, registry, nil)
+	deliverEvent(ev, handlers, storageMgr, profileReg)
+}
+
+// decodeEvent parses a raw sample and assigns it the next event ID. It
+// returns nil for short samples, unknown types and decode errors, which are
+// logged.
+func decodeEvent(data []byte) *decodedEvent {
+	ev := decodeSample(data)
+	if ev == nil {
+		return nil
+	}
+	ev.ID = eventSeq.Add(1)
+	switch ev.Type {
+	case events.EventTypeExec:
+		ev.Exec.Hdr.ID = ev.ID
+	case events.EventTypeFileOpen:
+		ev.File.Hdr.ID = ev.ID
+	case events.EventTypeConnect:
+		ev.Connect.Hdr.ID = ev.ID
+	case events.EventTypeTamper:
+		ev.Tamper.Hdr.ID = ev.ID
+	}
+	return ev
+}
+
+func decodeSample(data []byte) *decodedEvent {
+	if len(data) < events.EventHeaderSize {
+		return nil
+	}
+	eventType := events.EventType(data[events.EventTypeOffset])
 
 	switch eventType {
 	case events.EventTypeExec:
 		ev, err := events.DecodeExecEvent(data)
 		if err != nil {
 			log.Printf("Error decoding exec event: %v", err)
-			return
-		}
-		processTree.AddProcess(ev.Hdr.PID, ev.PPID, ev.Hdr.CgroupID, utils.ExtractCString(ev.Hdr.Comm[:]))
-		if registry != nil {
-			cgroupPath := proc.ResolveCgroupPath(ev.Hdr.PID, ev.Hdr.CgroupID)
-			registry.RecordExec(ev.Hdr.CgroupID, cgroupPath)
+			return nil
 		}
-		// Store event
-		if storageMgr != nil {
-			// Store the value event; snapshot/AI code handles both value and pointer forms.
-			storeEvent := storage.EventFromBackend(events.EventTypeExec, ev.Hdr.Timestamp(), ev)
-			_ = storageMgr.Append(storeEvent)
-		}
-		// Update profile
-		if profileReg != nil {
-			profileReg.RecordExec(ev.Hdr.PID)
-		}
-		handlers.HandleExec(ev)
+		return &decodedEvent{Type: eventType, PID: ev.Hdr.PID, Blocked: ev.Hdr.Blocked == 1, Exec: &ev}
 
 	case events.EventTypeFileOpen:
 		ev, err := events.DecodeFileOpenEvent(data)
 		if err != nil {
 			log.Printf("Error decoding file open event: %v", err)
-			return
-		}
-		if registry != nil {
-			cgroupPath := proc.ResolveCgroupPath(ev.Hdr.PID, ev.Hdr.CgroupID)
-			registry.RecordFile(ev.Hdr.CgroupID, cgroupPath)
-		}
-		// Store event
-		if storageMgr != nil {
-			// Store the value event; snapshot/AI code handles both value and pointer forms.
-			storeEvent := storage.EventFromBackend(events.EventTypeFileOpen, ev.Hdr.Timestamp(), ev)
-			_ = storageMgr.Append(storeEvent)
+			return nil
 		}
-		// Update profile
-		if profileReg != nil {
-			profileReg.RecordFileOpen(ev.Hdr.PID)
-		}
-		filename := utils.ExtractCString(ev.Filename[:])
-		handlers.HandleFileOpen(ev, filename)
+		return &decodedEvent{Type: eventType, PID: ev.Hdr.PID, Blocked: ev.Hdr.Blocked == 1, File: &ev}
 
 	case events.EventTypeConnect:
 		ev, err := events.DecodeConnectEvent(data)
 		if err != nil {
 			log.Printf("Error decoding connect event: %v", err)
-			return
+			return nil
+		}
+		return &decodedEvent{Type: eventType, PID: ev.Hdr.PID, Blocked: ev.Hdr.Blocked == 1, Connect: &ev}
+
+	case events.EventTypeTamper:
+		ev, err := events.DecodeTamperEvent(data)
+		if err != nil {
+			log.Printf("Error decoding tamper event: %v", err)
+			return nil
+		}
+		return &decodedEvent{Type: eventType, PID: ev.Hdr.PID, Blocked: true, Tamper: &ev}
+	}
+	return nil
+}
+
+// enrichEvent records process lineage, resolves the workload and runs the
+// exec enricher. Cgroup path resolution and binary hashing may read /proc
+// and are the slow part of this stage.
+func enrichEvent(ev *decodedEvent, processTree *proc.ProcessTree, registry *workload.Registry, execEnricher ExecEnricher) {
+	switch ev.Type {
+	case events.EventTypeExec:
+		if execEnricher != nil {
+			execEnricher.EnrichExec(ev.Exec)
+		}
+		hdr := ev.Exec.Hdr
+		if processTree != nil {
+			processTree.AddProcess(hdr.PID, ev.Exec.PPID, hdr.CgroupID, utils.ExtractCString(hdr.Comm[:]), proc.PidNamespaceOf(hdr))
+			if chain := processTree.GetAncestors(hdr.PID); len(chain) > 1 {
+				for _, p := range chain[1:] {
+					ev.Genealogy = append(ev.Genealogy, p.PID)
+				}
+			}
+		}
+		if registry != nil {
+			registry.RecordExec(hdr.CgroupID, proc.ResolveCgroupPath(hdr.PID, hdr.CgroupID))
+		}
+
+	case events.EventTypeFileOpen:
+		hdr := ev.File.Hdr
+		if registry != nil {
+			registry.RecordFile(hdr.CgroupID, proc.ResolveCgroupPath(hdr.PID, hdr.CgroupID))
 		}
+
+	case events.EventTypeConnect:
+		hdr := ev.Connect.Hdr
 		if registry != nil {
-			cgroupPath := proc.ResolveCgroupPath(ev.Hdr.PID, ev.Hdr.CgroupID)
-			registry.RecordConnect(ev.Hdr.CgroupID, cgroupPath)
+			registry.RecordConnect(hdr.CgroupID, proc.ResolveCgroupPath(hdr.PID, hdr.CgroupID))
 		}
-		// Store event
+	}
+}
+
+// deliverEvent stores the event, updates the process profile and runs the
+// handlers. Tamper attempts are always blocked and surface only as alerts;
+// they are not part of the workload's behavioural history. Neither are
+// other blocked events in process profiles: the behaviour did not happen.
+func deliverEvent(ev *decodedEvent, handlers *events.HandlerChain, storageMgr *storage.Manager, profileReg *proc.ProfileRegistry) {
+	switch ev.Type {
+	case events.EventTypeExec:
+		// Store the value event; snapshot/AI code handles both value and pointer forms.
 		if storageMgr != nil {
-			// Store the value event; snapshot/AI code handles both value and pointer forms.
-			storeEvent := storage.EventFromBackend(events.EventTypeConnect, ev.Hdr.Timestamp(), ev)
-			_ = storageMgr.Append(storeEvent)
+			_ = storageMgr.Append(storage.EventFromBackend(ev.ID, events.EventTypeExec, ev.Exec.Hdr.Timestamp(), *ev.Exec))
 		}
-		// Update profile
-		if profileReg != nil {
-			profileReg.RecordConnect(ev.Hdr.PID)
+		if profileReg != nil && !ev.Blocked {
+			hdr := ev.Exec.Hdr
+			exe := utils.ExtractCString(ev.Exec.Filename[:])
+			if exe == "" {
+				exe = utils.ExtractCString(hdr.Comm[:])
+			}
+			profileReg.RecordExec(hdr.PID, ev.Exec.PPID, hdr.CgroupID, exe, utils.ExtractCString(ev.Exec.PComm[:]),
+				utils.ExtractCString(ev.Exec.CommandLine[:]), ev.Genealogy, hdr.Timestamp())
 		}
-		handlers.HandleConnect(ev)
+		handlers.HandleExec(*ev.Exec)
+
+	case events.EventTypeFileOpen:
+		if storageMgr != nil {
+			_ = storageMgr.Append(storage.EventFromBackend(ev.ID, events.EventTypeFileOpen, ev.File.Hdr.Timestamp(), *ev.File))
+		}
+		if profileReg != nil && !ev.Blocked {
+			hdr := ev.File.Hdr
+			profileReg.RecordFileOpen(hdr.PID, hdr.CgroupID, utils.ExtractCString(hdr.Comm[:]),
+				utils.ExtractCString(ev.File.Filename[:]), hdr.Timestamp())
+		}
+		handlers.HandleFileOpen(*ev.File, utils.ExtractCString(ev.File.Filename[:]))
+
+	case events.EventTypeConnect:
+		if storageMgr != nil {
+			_ = storageMgr.Append(storage.EventFromBackend(ev.ID, events.EventTypeConnect, ev.Connect.Hdr.Timestamp(), *ev.Connect))
+		}
+		if profileReg != nil && !ev.Blocked {
+			hdr := ev.Connect.Hdr
+			profileReg.RecordConnect(hdr.PID, hdr.CgroupID, utils.ExtractCString(hdr.Comm[:]),
+				utils.ExtractIP(ev.Connect), ev.Connect.Port, hdr.Timestamp())
+		}
+		handlers.HandleConnect(*ev.Connect)
+
+	case events.EventTypeTamper:
+		handlers.HandleTamper(*ev.Tamper)
 	}
 }
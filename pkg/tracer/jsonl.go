@@ -0,0 +1,177 @@
+package tracer
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"aegis/pkg/events"
+)
+
+// JSONEvent is one line of a JSONL event file. Fields that do not apply to
+// the event type are ignored. A missing timestamp means "now".
+//
+//	{"type":"exec","pid":42,"ppid":1,"comm":"curl","pcomm":"bash","filename":"/usr/bin/curl","command_line":"curl http://x"}
+//	{"type":"file","pid":42,"comm":"cat","filename":"/etc/shadow","flags":0}
+//	{"type":"connect","pid":42,"comm":"curl","addr":"10.0.0.1","port":4444}
+type JSONEvent struct {
+	Type        string `json:"type"` // "exec", "file" or "connect"
+	TimestampNs uint64 `json:"timestamp_ns,omitempty"`
+	CgroupID    uint64 `json:"cgroup_id,omitempty"`
+	PID         uint32 `json:"pid"`
+	TID         uint32 `json:"tid,omitempty"`
+	UID         uint32 `json:"uid,omitempty"`
+	GID         uint32 `json:"gid,omitempty"`
+	Comm        string `json:"comm"`
+	Blocked     bool   `json:"blocked,omitempty"`
+
+	// PID namespace inode and the PID and parent PID inside it; zero for
+	// an unknown namespace.
+	PidNS  uint32 `json:"pid_ns,omitempty"`
+	NsPID  uint32 `json:"ns_pid,omitempty"`
+	NsPPID uint32 `json:"ns_ppid,omitempty"`
+
+	// exec
+	PPID        uint32 `json:"ppid,omitempty"`
+	PComm       string `json:"pcomm,omitempty"`
+	CommandLine string `json:"command_line,omitempty"`
+
+	// exec session; a missing loginuid or sessionid means no login
+	LoginUID      *uint32 `json:"loginuid,omitempty"`
+	SessionID     *uint32 `json:"sessionid,omitempty"`
+	SessionLeader uint32  `json:"session_leader,omitempty"`
+	TTY           string  `json:"tty,omitempty"`
+
+	// exec and file
+	Filename string `json:"filename,omitempty"`
+
+	// file
+	Ino   uint64 `json:"ino,omitempty"`
+	Dev   uint64 `json:"dev,omitempty"`
+	Flags uint32 `json:"flags,omitempty"`
+
+	// connect
+	Addr string `json:"addr,omitempty"`
+	Port uint16 `json:"port,omitempty"`
+}
+
+// Encode converts the event to the ring buffer wire format.
+func (e JSONEvent) Encode() ([]byte, error) {
+	hdr := events.EventHeader{
+		TimestampNs: e.TimestampNs,
+		CgroupID:    e.CgroupID,
+		PID:         e.PID,
+		TID:         e.TID,
+		UID:         e.UID,
+		GID:         e.GID,
+		PidNS:       e.PidNS,
+		NsPID:       e.NsPID,
+		NsPPID:      e.NsPPID,
+	}
+	if hdr.TID == 0 {
+		hdr.TID = hdr.PID
+	}
+	if hdr.TimestampNs == 0 {
+		hdr.TimestampNs = uint64(time.Since(events.BootTime()))
+	}
+	if e.Blocked {
+		hdr.Blocked = 1
+	}
+	copy(hdr.Comm[:events.TaskCommLen-1], e.Comm)
+
+	switch e.Type {
+	case "exec":
+		ev := events.ExecEvent{Hdr: hdr, PPID: e.PPID, LoginUID: events.AuditUnset, SessionID: events.AuditUnset, SessionLeader: e.SessionLeader}
+		if e.LoginUID != nil {
+			ev.LoginUID = *e.LoginUID
+		}
+		if e.SessionID != nil {
+			ev.SessionID = *e.SessionID
+		}
+		copy(ev.TTY[:events.TTYNameLen-1], e.TTY)
+		copy(ev.PComm[:events.TaskCommLen-1], e.PComm)
+		copy(ev.Filename[:events.PathMaxLen-1], e.Filename)
+		copy(ev.CommandLine[:events.CommandLineLen-1], e.CommandLine)
+		return events.EncodeExecEvent(ev), nil
+	case "file":
+		ev := events.FileOpenEvent{Hdr: hdr, Ino: e.Ino, Dev: e.Dev, Flags: e.Flags}
+		copy(ev.Filename[:events.PathMaxLen-1], e.Filename)
+		return events.EncodeFileOpenEvent(ev), nil
+	case "connect":
+		ev := events.ConnectEvent{Hdr: hdr, Port: e.Port}
+		ip := net.ParseIP(e.Addr)
+		switch {
+		case ip == nil:
+			return nil, fmt.Errorf("invalid connect addr %q", e.Addr)
+		case ip.To4() != nil:
+			ev.Family = 2
+			ev.AddrV4 = binary.LittleEndian.Uint32(ip.To4())
+		default:
+			ev.Family = 10
+			copy(ev.AddrV6[:], ip.To16())
+		}
+		return events.EncodeConnectEvent(ev), nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", e.Type)
+	}
+}
+
+// JSONLSource reads one JSON event per line. Blank lines are skipped and
+// malformed lines are logged with their line number and skipped.
+type JSONLSource struct {
+	f       *os.File
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewJSONLSource(path string) (*JSONLSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open jsonl events: %w", err)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &JSONLSource{f: f, scanner: scanner}, nil
+}
+
+func (s *JSONLSource) Read(ctx context.Context) ([]byte, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !s.scanner.Scan() {
+			if err := s.scanner.Err(); err != nil {
+				return nil, fmt.Errorf("read jsonl events: %w", err)
+			}
+			return nil, io.EOF
+		}
+		s.line++
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var ev JSONEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			log.Printf("Skipping jsonl line %d: %v", s.line, err)
+			continue
+		}
+		sample, err := ev.Encode()
+		if err != nil {
+			log.Printf("Skipping jsonl line %d: %v", s.line, err)
+			continue
+		}
+		return sample, nil
+	}
+}
+
+func (s *JSONLSource) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,317 @@
+package tracer
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"aegis/pkg/events"
+	"aegis/pkg/proc"
+	"aegis/pkg/storage"
+	"aegis/pkg/workload"
+)
+
+// DropPolicy decides what happens when a shard's input queue is full.
+type DropPolicy string
+
+const (
+	// DropPolicyBlock applies backpressure: the reader waits, and the
+	// kernel ring buffer absorbs (or eventually loses) the burst.
+	DropPolicyBlock DropPolicy = "block"
+	// DropPolicyNewest discards the incoming event.
+	DropPolicyNewest DropPolicy = "drop_newest"
+	// DropPolicyOldest discards the oldest queued event to make room.
+	DropPolicyOldest DropPolicy = "drop_oldest"
+)
+
+const (
+	DefaultPipelineQueueDepth = 1024
+	maxDefaultPipelineWorkers = 8
+)
+
+// PipelineConfig sizes the dispatch pipeline. Zero values select defaults.
+type PipelineConfig struct {
+	Workers    int        // PID shards; default GOMAXPROCS, at most 8
+	QueueDepth int        // per-shard queue length for each stage
+	DropPolicy DropPolicy // applied to the shard input queue
+}
+
+// PipelineMetrics is a snapshot of pipeline throughput and backpressure.
+type PipelineMetrics struct {
+	Workers    int    `json:"workers"`
+	QueueDepth int    `json:"queueDepth"`
+	DropPolicy string `json:"dropPolicy"`
+
+	Received  uint64 `json:"received"`
+	Processed uint64 `json:"processed"`
+	Dropped   uint64 `json:"dropped"`
+
+	// BackpressureEvents counts submissions that found their shard full and
+	// had to wait; BackpressureWaitMs is the total time spent waiting.
+	BackpressureEvents uint64 `json:"backpressureEvents"`
+	BackpressureWaitMs int64  `json:"backpressureWaitMs"`
+
+	Queued    int `json:"queued"`    // events currently waiting in input queues
+	MaxQueued int `json:"maxQueued"` // high-water mark of a single shard queue
+}
+
+// Pipeline dispatches events in three stages: decode (on the submitting
+// goroutine), enrich (process tree and workload resolution) and deliver
+// (storage, profiles and handlers). Events are sharded by PID so each
+// process's events are handled in order by the same enrich and deliver
+// goroutines, while different processes proceed in parallel.
+type Pipeline struct {
+	cfg    PipelineConfig
+	shards []*pipelineShard
+	wg     sync.WaitGroup
+
+	handlers    *events.HandlerChain
+	processTree *proc.ProcessTree
+	registry    *workload.Registry
+	storageMgr  *storage.Manager
+	profileReg  *proc.ProfileRegistry
+	execEnrich  ExecEnricher
+
+	received         atomic.Uint64
+	processed        atomic.Uint64
+	dropped          atomic.Uint64
+	backpressure     atomic.Uint64
+	backpressureWait atomic.Int64
+	maxQueued        atomic.Int64
+}
+
+type pipelineShard struct {
+	input   *eventQueue
+	deliver chan *decodedEvent
+}
+
+func NewPipeline(cfg PipelineConfig, handlers *events.HandlerChain, processTree *proc.ProcessTree, registry *workload.Registry, storageMgr *storage.Manager, profileReg *proc.ProfileRegistry) *Pipeline {
+	if cfg.Workers <= 0 {
+		cfg.Workers = min(runtime.GOMAXPROCS(0), maxDefaultPipelineWorkers)
+	}
+	if cfg.QueueDepth <= 0 {
+		cfg.QueueDepth = DefaultPipelineQueueDepth
+	}
+	switch cfg.DropPolicy {
+	case DropPolicyNewest, DropPolicyOldest:
+	default:
+		cfg.DropPolicy = DropPolicyBlock
+	}
+
+	p := &Pipeline{
+		cfg:         cfg,
+		handlers:    handlers,
+		processTree: processTree,
+		registry:    registry,
+		storageMgr:  storageMgr,
+		profileReg:  profileReg,
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		s := &pipelineShard{
+			input:   newEventQueue(cfg.QueueDepth),
+			deliver: make(chan *decodedEvent, cfg.QueueDepth),
+		}
+		p.shards = append(p.shards, s)
+		p.wg.Add(2)
+		go p.enrichLoop(s)
+		go p.deliverLoop(s)
+	}
+	return p
+}
+
+// SetExecEnricher installs an exec enricher. It must be called before the
+// first Submit.
+func (p *Pipeline) SetExecEnricher(e ExecEnricher) {
+	p.execEnrich = e
+}
+
+// Submit decodes a raw sample and queues it on its PID's shard. It is not
+// safe for concurrent use; the event loop is the only producer.
+func (p *Pipeline) Submit(data []byte) {
+	p.received.Add(1)
+	ev := decodeEvent(data)
+	if ev == nil {
+		return
+	}
+
+	s := p.shards[ev.PID%uint32(len(p.shards))]
+	res := s.input.push(ev, p.cfg.DropPolicy)
+	if res.dropped {
+		p.dropped.Add(1)
+	}
+	if res.waited > 0 {
+		p.backpressure.Add(1)
+		p.backpressureWait.Add(int64(res.waited))
+	}
+	for {
+		cur := p.maxQueued.Load()
+		if int64(res.depth) <= cur || p.maxQueued.CompareAndSwap(cur, int64(res.depth)) {
+			break
+		}
+	}
+}
+
+// Close stops accepting events and waits until every queued event has been
+// delivered.
+func (p *Pipeline) Close() {
+	for _, s := range p.shards {
+		s.input.close()
+	}
+	p.wg.Wait()
+}
+
+func (p *Pipeline) Metrics() PipelineMetrics {
+	m := PipelineMetrics{
+		Workers:            p.cfg.Workers,
+		QueueDepth:         p.cfg.QueueDepth,
+		DropPolicy:         string(p.cfg.DropPolicy),
+		Received:           p.received.Load(),
+		Processed:          p.processed.Load(),
+		Dropped:            p.dropped.Load(),
+		BackpressureEvents: p.backpressure.Load(),
+		BackpressureWaitMs: time.Duration(p.backpressureWait.Load()).Milliseconds(),
+		MaxQueued:          int(p.maxQueued.Load()),
+	}
+	for _, s := range p.shards {
+		m.Queued += s.input.len()
+	}
+	return m
+}
+
+func (p *Pipeline) enrichLoop(s *pipelineShard) {
+	defer p.wg.Done()
+	defer close(s.deliver)
+	for {
+		ev, ok := s.input.pop()
+		if !ok {
+			return
+		}
+		enrichEvent(ev, p.processTree, p.registry, p.execEnrich)
+		s.deliver <- ev
+	}
+}
+
+func (p *Pipeline) deliverLoop(s *pipelineShard) {
+	defer p.wg.Done()
+	for ev := range s.deliver {
+		deliverEvent(ev, p.handlers, p.storageMgr, p.profileReg)
+		p.processed.Add(1)
+	}
+}
+
+// eventQueue is a bounded FIFO. Unlike a channel it can evict its oldest
+// droppable entry, which drop_oldest needs.
+type eventQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	buf      []*decodedEvent
+	head     int
+	n        int
+	closed   bool
+}
+
+type pushResult struct {
+	dropped bool
+	waited  time.Duration
+	depth   int
+}
+
+func newEventQueue(capacity int) *eventQueue {
+	q := &eventQueue{buf: make([]*decodedEvent, capacity)}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push appends ev, applying policy when the queue is full. Events carrying
+// a kernel block decision are never dropped: they wait for space instead,
+// and drop_oldest skips over queued ones.
+func (q *eventQueue) push(ev *decodedEvent, policy DropPolicy) pushResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var res pushResult
+	if q.n == len(q.buf) && !q.closed {
+		switch {
+		case policy == DropPolicyNewest && !ev.Blocked:
+			res.dropped = true
+			res.depth = q.n
+			return res
+		case policy == DropPolicyOldest:
+			res.dropped = q.evictOldestLocked()
+		}
+	}
+
+	if q.n == len(q.buf) && !q.closed {
+		start := time.Now()
+		for q.n == len(q.buf) && !q.closed {
+			q.notFull.Wait()
+		}
+		res.waited = time.Since(start)
+	}
+	if q.closed {
+		res.dropped = true
+		return res
+	}
+
+	q.buf[(q.head+q.n)%len(q.buf)] = ev
+	q.n++
+	res.depth = q.n
+	q.notEmpty.Signal()
+	return res
+}
+
+// evictOldestLocked removes the oldest entry without a block decision and
+// reports whether one was found.
+func (q *eventQueue) evictOldestLocked() bool {
+	for i := 0; i < q.n; i++ {
+		idx := (q.head + i) % len(q.buf)
+		if q.buf[idx].Blocked {
+			continue
+		}
+		// Shift the entries before idx forward by one to close the gap.
+		for j := i; j > 0; j-- {
+			q.buf[(q.head+j)%len(q.buf)] = q.buf[(q.head+j-1)%len(q.buf)]
+		}
+		q.buf[q.head] = nil
+		q.head = (q.head + 1) % len(q.buf)
+		q.n--
+		return true
+	}
+	return false
+}
+
+// pop returns the next event, blocking while the queue is empty. It
+// returns false once the queue is closed and drained.
+func (q *eventQueue) pop() (*decodedEvent, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.n == 0 {
+		return nil, false
+	}
+	ev := q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) % len(q.buf)
+	q.n--
+	q.notFull.Signal()
+	return ev, true
+}
+
+func (q *eventQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
+
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
@@ -0,0 +1,260 @@
+package tracer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"aegis/pkg/events"
+	"aegis/pkg/proc"
+	"aegis/pkg/rules"
+	"aegis/pkg/storage"
+	"aegis/pkg/workload"
+)
+
+// recordingHandler remembers the order in which each PID's exec events
+// arrive. It can be slowed down to force queues to fill.
+type recordingHandler struct {
+	mu    sync.Mutex
+	seen  map[uint32][]uint32 // pid -> ppid sequence
+	total int
+	delay time.Duration
+	gate  chan struct{}
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{seen: make(map[uint32][]uint32)}
+}
+
+func (h *recordingHandler) HandleExec(ev events.ExecEvent) {
+	if h.gate != nil {
+		<-h.gate
+	}
+	if h.delay > 0 {
+		time.Sleep(h.delay)
+	}
+	h.mu.Lock()
+	h.seen[ev.Hdr.PID] = append(h.seen[ev.Hdr.PID], ev.PPID)
+	h.total++
+	h.mu.Unlock()
+}
+
+func (h *recordingHandler) HandleFileOpen(events.FileOpenEvent, string) {}
+func (h *recordingHandler) HandleConnect(events.ConnectEvent)           {}
+func (h *recordingHandler) HandleTamper(events.TamperEvent)             {}
+
+func execSample(pid, seq uint32, blocked bool) []byte {
+	ev := events.ExecEvent{PPID: seq}
+	ev.Hdr.PID = pid
+	if blocked {
+		ev.Hdr.Blocked = 1
+	}
+	return events.EncodeExecEvent(ev)
+}
+
+func TestPipelinePreservesPerPIDOrder(t *testing.T) {
+	h := newRecordingHandler()
+	p := NewPipeline(PipelineConfig{Workers: 4, QueueDepth: 8}, events.NewHandlerChain(h), nil, nil, nil, nil)
+
+	const pids, perPID = 16, 200
+	for seq := uint32(0); seq < perPID; seq++ {
+		for pid := uint32(1); pid <= pids; pid++ {
+			p.Submit(execSample(pid, seq, false))
+		}
+	}
+	p.Close()
+
+	if h.total != pids*perPID {
+		t.Fatalf("delivered %d events, want %d", h.total, pids*perPID)
+	}
+	for pid, seqs := range h.seen {
+		for i, seq := range seqs {
+			if seq != uint32(i) {
+				t.Fatalf("pid %d: event %d has sequence %d; per-process order broken", pid, i, seq)
+			}
+		}
+	}
+	m := p.Metrics()
+	if m.Received != pids*perPID || m.Processed != pids*perPID || m.Dropped != 0 {
+		t.Fatalf("metrics = %+v", m)
+	}
+}
+
+func TestPipelineDropNewestKeepsBlockedEvents(t *testing.T) {
+	h := newRecordingHandler()
+	h.gate = make(chan struct{})
+	p := NewPipeline(PipelineConfig{Workers: 1, QueueDepth: 2, DropPolicy: DropPolicyNewest},
+		events.NewHandlerChain(h), nil, nil, nil, nil)
+
+	// Stall delivery so both stages fill up, then overflow the input queue.
+	for seq := uint32(0); seq < 20; seq++ {
+		p.Submit(execSample(1, seq, false))
+	}
+	dropped := p.Metrics().Dropped
+	if dropped == 0 {
+		t.Fatalf("expected drops with a full queue, metrics %+v", p.Metrics())
+	}
+
+	// A blocked event must wait for room rather than be dropped.
+	done := make(chan struct{})
+	go func() {
+		p.Submit(execSample(1, 100, true))
+		close(done)
+	}()
+	close(h.gate)
+	<-done
+	p.Close()
+
+	m := p.Metrics()
+	if m.Dropped != dropped {
+		t.Fatalf("blocked event was dropped: %+v", m)
+	}
+	if got := h.seen[1]; got[len(got)-1] != 100 {
+		t.Fatalf("blocked event not delivered last: %v", got)
+	}
+	if m.Received != m.Processed+m.Dropped {
+		t.Fatalf("received %d != processed %d + dropped %d", m.Received, m.Processed, m.Dropped)
+	}
+}
+
+func TestPipelineAssignsEventIDs(t *testing.T) {
+	store := storage.NewManager(4, 10)
+	p := NewPipeline(PipelineConfig{Workers: 2, QueueDepth: 8}, events.NewHandlerChain(newRecordingHandler()), nil, nil, store, nil)
+	first := eventSeq.Load() + 1
+	for seq := uint32(0); seq < 10; seq++ {
+		p.Submit(execSample(seq%3+1, seq, false))
+	}
+	p.Close()
+
+	stored, _ := store.Latest(10)
+	if len(stored) != 4 {
+		t.Fatalf("stored %d events, want 4", len(stored))
+	}
+	seen := make(map[uint64]bool)
+	for _, ev := range stored {
+		hdr, _ := ev.Header()
+		if ev.ID < first || ev.ID >= first+10 || hdr.ID != ev.ID || seen[ev.ID] {
+			t.Fatalf("event ID %d (header %d) not unique or out of range", ev.ID, hdr.ID)
+		}
+		seen[ev.ID] = true
+		if got, ok := store.Get(ev.ID); !ok || got != ev {
+			t.Fatalf("Get(%d) did not return the stored event", ev.ID)
+		}
+	}
+	for id := first; id < first+10; id++ {
+		if _, ok := store.Get(id); ok != seen[id] {
+			t.Fatalf("Get(%d) = %v after eviction, want %v", id, ok, seen[id])
+		}
+	}
+}
+
+func TestEventQueueDropOldestSkipsBlocked(t *testing.T) {
+	q := newEventQueue(3)
+	q.push(&decodedEvent{PID: 1, Blocked: true}, DropPolicyOldest)
+	q.push(&decodedEvent{PID: 2}, DropPolicyOldest)
+	q.push(&decodedEvent{PID: 3}, DropPolicyOldest)
+
+	res := q.push(&decodedEvent{PID: 4}, DropPolicyOldest)
+	if !res.dropped {
+		t.Fatal("expected the oldest unblocked event to be evicted")
+	}
+
+	var got []uint32
+	q.close()
+	for {
+		ev, ok := q.pop()
+		if !ok {
+			break
+		}
+		got = append(got, ev.PID)
+	}
+	want := []uint32{1, 3, 4}
+	if len(got) != len(want) {
+		t.Fatalf("queue = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("queue = %v, want %v", got, want)
+		}
+	}
+}
+
+// The benchmarks compare synchronous DispatchEvent with the pipeline.
+// Throughput scales with cores, so run them with several CPU counts:
+//
+//	go test -run '^$' -bench . -cpu 1,4,8 ./pkg/tracer
+
+// benchmarkSamples is a mixed workload spread over many processes.
+func benchmarkSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = SyntheticTraffic(uint64(i))
+	}
+	return samples
+}
+
+// matchingHandler runs the rule engine like server.Bridge does, without
+// the web-facing side effects.
+type matchingHandler struct {
+	engine *rules.Engine
+}
+
+func (h matchingHandler) HandleExec(ev events.ExecEvent) {
+	h.engine.CollectExecAlerts(events.ProcessedEvent{Event: ev, Process: "x"})
+}
+func (h matchingHandler) HandleFileOpen(ev events.FileOpenEvent, filename string) {
+	h.engine.MatchFile(ev.Ino, ev.Dev, filename, ev.Hdr.PID, ev.Hdr.CgroupID, ev.Hdr.PidNS)
+}
+func (h matchingHandler) HandleConnect(ev events.ConnectEvent) { h.engine.MatchConnect(&ev) }
+func (h matchingHandler) HandleTamper(events.TamperEvent)      {}
+
+type benchComponents struct {
+	chain    *events.HandlerChain
+	tree     *proc.ProcessTree
+	registry *workload.Registry
+	store    *storage.Manager
+	profiles *proc.ProfileRegistry
+}
+
+func newBenchComponents() benchComponents {
+	engine := rules.NewEngine([]rules.Rule{
+		{Name: "curl", Action: rules.ActionAlert, State: rules.RuleStateProduction, Match: rules.MatchCondition{ProcessName: "curl"}},
+		{Name: "port", Action: rules.ActionAlert, State: rules.RuleStateProduction, Match: rules.MatchCondition{DestPort: 4444}},
+	})
+	return benchComponents{
+		chain:    events.NewHandlerChain(matchingHandler{engine}),
+		tree:     proc.NewEmptyProcessTree(time.Minute, 100000, 50),
+		registry: workload.NewRegistry(1000),
+		store:    storage.NewManager(100000, 1000),
+		profiles: proc.NewProfileRegistry(),
+	}
+}
+
+func BenchmarkDispatchSequential(b *testing.B) {
+	c := newBenchComponents()
+	samples := benchmarkSamples(4096)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DispatchEvent(samples[i%len(samples)], c.chain, c.tree, c.registry, c.store, c.profiles)
+	}
+}
+
+func benchmarkPipeline(b *testing.B, workers int) {
+	c := newBenchComponents()
+	samples := benchmarkSamples(4096)
+	p := NewPipeline(PipelineConfig{Workers: workers}, c.chain, c.tree, c.registry, c.store, c.profiles)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Submit(samples[i%len(samples)])
+	}
+	p.Close()
+	b.StopTimer()
+	m := p.Metrics()
+	b.ReportMetric(float64(m.BackpressureEvents)/float64(b.N), "backpressure/op")
+}
+
+func BenchmarkPipeline1Worker(b *testing.B)  { benchmarkPipeline(b, 1) }
+func BenchmarkPipeline4Workers(b *testing.B) { benchmarkPipeline(b, 4) }
+func BenchmarkPipeline8Workers(b *testing.B) { benchmarkPipeline(b, 8) }
@@ -1,36 +1,52 @@
 package tracer
 
 import (
+	"context"
 	"errors"
-	"fmt"
-	"syscall"
+	"io"
+	"log"
 
+	"aegis/pkg/capture"
 	"aegis/pkg/events"
 	"aegis/pkg/proc"
 	"aegis/pkg/storage"
 	"aegis/pkg/workload"
-
-	"github.com/cilium/ebpf/ringbuf"
 )
 
-// EventLoop reads events from the ring buffer and dispatches them.
-func EventLoop(reader *ringbuf.Reader, handlers *events.HandlerChain, processTree *proc.ProcessTree, registry *workload.Registry, storageMgr *storage.Manager, profileReg *proc.ProfileRegistry) error {
+// EventLoop reads events from source and dispatches them synchronously
+// until the source is exhausted or closed, or ctx is cancelled. When
+// recorder is non-nil every raw sample is also appended to the capture.
+func EventLoop(ctx context.Context, source EventSource, recorder *capture.Writer, handlers *events.HandlerChain, processTree *proc.ProcessTree, registry *workload.Registry, storageMgr *storage.Manager, profileReg *proc.ProfileRegistry) error {
+	return readLoop(ctx, source, recorder, func(sample []byte) {
+		DispatchEvent(sample, handlers, processTree, registry, storageMgr, profileReg)
+	})
+}
+
+// PipelineLoop is EventLoop backed by a concurrent Pipeline. The pipeline
+// is drained and closed before it returns.
+func PipelineLoop(ctx context.Context, source EventSource, recorder *capture.Writer, pipeline *Pipeline) error {
+	defer pipeline.Close()
+	return readLoop(ctx, source, recorder, pipeline.Submit)
+}
+
+func readLoop(ctx context.Context, source EventSource, recorder *capture.Writer, dispatch func([]byte)) error {
+	recordErrLogged := false
 	for {
-		record, err := reader.Read()
-		if errors.Is(err, ringbuf.ErrClosed) {
+		sample, err := source.Read(ctx)
+		if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 			return nil
 		}
 		if err != nil {
-			if errors.Is(err, syscall.EINTR) {
-				continue
-			}
-			return fmt.Errorf("read ringbuf: %w", err)
+			return err
 		}
 
-		if len(record.RawSample) < 1 {
-			continue
+		if recorder != nil {
+			if err := recorder.Write(sample); err != nil && !recordErrLogged {
+				log.Printf("Warning: capture write failed, further errors suppressed: %v", err)
+				recordErrLogged = true
+			}
 		}
 
-		DispatchEvent(record.RawSample, handlers, processTree, registry, storageMgr, profileReg)
+		dispatch(sample)
 	}
 }
@@ -0,0 +1,113 @@
+package tracer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+
+	"aegis/pkg/capture"
+
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// Event source types accepted in config.yaml.
+const (
+	SourceRingBuffer = "ringbuf"
+	SourceReplay     = "replay"
+	SourceJSONL      = "jsonl"
+	SourceGenerator  = "generator"
+)
+
+// EventSource yields raw events in the ring buffer wire format. Read
+// returns io.EOF once the source is exhausted or closed.
+type EventSource interface {
+	Read(ctx context.Context) ([]byte, error)
+	Close() error
+}
+
+// RingBufferSource reads events from the BPF ring buffer.
+type RingBufferSource struct {
+	reader *ringbuf.Reader
+}
+
+func NewRingBufferSource(reader *ringbuf.Reader) *RingBufferSource {
+	return &RingBufferSource{reader: reader}
+}
+
+// Read blocks until a sample is available. The ring buffer cannot be
+// interrupted by ctx; Close unblocks a pending Read instead.
+func (s *RingBufferSource) Read(ctx context.Context) ([]byte, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := s.reader.Read()
+		if errors.Is(err, ringbuf.ErrClosed) {
+			return nil, io.EOF
+		}
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return nil, fmt.Errorf("read ringbuf: %w", err)
+		}
+		if len(record.RawSample) < 1 {
+			continue
+		}
+		return record.RawSample, nil
+	}
+}
+
+func (s *RingBufferSource) Close() error {
+	return s.reader.Close()
+}
+
+// ReplaySource reads events from a capture file, paced by their original
+// timestamps divided by speed (0 replays as fast as possible).
+type ReplaySource struct {
+	reader  *capture.Reader
+	pacer   *capture.Pacer
+	samples int
+}
+
+// NewReplaySource opens a capture file. Decoded timestamps use the boot
+// time of the capturing host.
+func NewReplaySource(path string, speed float64) (*ReplaySource, error) {
+	r, err := capture.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	capture.PrepareReplay(r)
+	return &ReplaySource{reader: r, pacer: capture.NewPacer(speed)}, nil
+}
+
+func (s *ReplaySource) Read(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sample, err := s.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pacer.Wait(ctx, sample); err != nil {
+		return nil, err
+	}
+	s.samples++
+	return sample, nil
+}
+
+// Samples returns the number of events read so far.
+func (s *ReplaySource) Samples() int {
+	return s.samples
+}
+
+// Header describes the capture being replayed.
+func (s *ReplaySource) Header() capture.Header {
+	return s.reader.Header
+}
+
+func (s *ReplaySource) Close() error {
+	return s.reader.Close()
+}
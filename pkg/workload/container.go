@@ -0,0 +1,300 @@
+package workload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Container runtimes recognised in cgroup paths.
+const (
+	RuntimeDocker     = "docker"
+	RuntimeContainerd = "containerd"
+	RuntimeCRIO       = "cri-o"
+	RuntimePodman     = "podman"
+	// RuntimeCRI is a Kubernetes container under the cgroupfs driver, whose
+	// path does not name the runtime.
+	RuntimeCRI = "cri"
+)
+
+// Container describes what runs in a cgroup. Runtime, ID, PodUID and the
+// systemd fields come from the cgroup path; Name and Image are only known
+// when a container runtime socket is configured.
+type Container struct {
+	Runtime      string
+	ID           string
+	PodUID       string
+	SystemdUnit  string // innermost .service or .scope that is not a container
+	SystemdSlice string // innermost .slice, e.g. "user-1000.slice"
+	Name         string
+	Image        string
+}
+
+// IsZero reports whether nothing is known about the cgroup.
+func (c Container) IsZero() bool {
+	return c == Container{}
+}
+
+// IsContainer reports whether the cgroup belongs to a container.
+func (c Container) IsContainer() bool {
+	return c.ID != ""
+}
+
+// scopePrefixes maps systemd scope and cgroupfs directory prefixes to the
+// runtime that creates them. conmon scopes hold the runtime monitor, not the
+// container, and are deliberately absent.
+var scopePrefixes = []struct {
+	prefix  string
+	runtime string
+}{
+	{"cri-containerd-", RuntimeContainerd},
+	{"crio-", RuntimeCRIO},
+	{"docker-", RuntimeDocker},
+	{"libpod-", RuntimePodman},
+}
+
+// ParseCgroupPath derives container and systemd metadata from a cgroup v2
+// path. It understands the systemd and cgroupfs layouts of docker,
+// containerd, cri-o, podman and Kubernetes, for example:
+//
+//	/system.slice/docker-<id>.scope
+//	/docker/<id>
+//	/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+//	/kubepods/besteffort/pod<uid>/<id>
+//	/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-<id>.scope
+//	/system.slice/sshd.service
+func ParseCgroupPath(path string) Container {
+	var c Container
+	inKubepods := false
+	prev := ""
+
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+
+		switch {
+		case part == "kubepods" || strings.HasPrefix(part, "kubepods.") || strings.HasPrefix(part, "kubepods-"):
+			inKubepods = true
+			if uid, ok := kubepodsPodUID(part); ok {
+				c.PodUID = uid
+			}
+
+		case inKubepods && strings.HasPrefix(part, "pod"):
+			c.PodUID = strings.TrimPrefix(part, "pod")
+
+		case strings.HasSuffix(part, ".slice"):
+			c.SystemdSlice = part
+
+		default:
+			if runtime, id, ok := scopeContainer(part); ok {
+				c.Runtime, c.ID = runtime, id
+			} else if isContainerID(part) {
+				c.ID = part
+				switch {
+				case prev == "docker":
+					c.Runtime = RuntimeDocker
+				case inKubepods:
+					c.Runtime = RuntimeCRI
+				default:
+					// containerd namespaces: /<namespace>/<id>
+					c.Runtime = RuntimeContainerd
+				}
+			} else if strings.HasSuffix(part, ".service") || strings.HasSuffix(part, ".scope") {
+				if !strings.Contains(part, "-conmon-") {
+					c.SystemdUnit = part
+				}
+			}
+		}
+		prev = part
+	}
+	return c
+}
+
+// FriendlyName names a workload for people: the container name when the
+// runtime socket provided one, else the runtime and short container ID, the
+// pod, the systemd unit or slice, and finally the last element of the
+// cgroup path. The root cgroup is "host"; an unknown path has no name.
+func FriendlyName(cgroupPath string, c Container) string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.IsContainer():
+		return c.Runtime + " " + c.ID[:12]
+	case c.PodUID != "":
+		return "pod " + c.PodUID
+	case c.SystemdUnit != "":
+		return c.SystemdUnit
+	case c.SystemdSlice != "":
+		return c.SystemdSlice
+	case cgroupPath == "":
+		return ""
+	case cgroupPath == "/":
+		return "host"
+	}
+	return path.Base(cgroupPath)
+}
+
+// kubepodsPodUID extracts the pod UID from a systemd slice such as
+// "kubepods-burstable-pod12ab_34cd.slice". systemd escapes the UID's dashes
+// as underscores.
+func kubepodsPodUID(part string) (string, bool) {
+	name, ok := strings.CutSuffix(part, ".slice")
+	if !ok {
+		return "", false
+	}
+	i := strings.LastIndex(name, "-pod")
+	if i < 0 {
+		return "", false
+	}
+	return strings.ReplaceAll(name[i+len("-pod"):], "_", "-"), true
+}
+
+func scopeContainer(part string) (runtime, id string, ok bool) {
+	name := strings.TrimSuffix(part, ".scope")
+	for _, p := range scopePrefixes {
+		if rest, found := strings.CutPrefix(name, p.prefix); found && isContainerID(rest) {
+			return p.runtime, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// isContainerID reports whether s looks like a full 64-character hex
+// container ID.
+func isContainerID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	defaultRuntimeTimeout = 500 * time.Millisecond
+	maxEnricherEntries    = 4096
+)
+
+// Enricher turns cgroup paths into Container metadata and caches the
+// result per path. With a runtime socket it also asks the Docker-compatible
+// API (docker, or podman's compat socket) for container name, image and
+// labels.
+type Enricher struct {
+	client *http.Client
+
+	mu    sync.RWMutex
+	cache map[string]described
+}
+
+type described struct {
+	container Container
+	labels    map[string]string
+}
+
+// NewEnricher returns an enricher that queries socketPath for container
+// names and images. An empty socketPath disables runtime queries; a zero
+// timeout selects 500ms.
+func NewEnricher(socketPath string, timeout time.Duration) *Enricher {
+	e := &Enricher{cache: make(map[string]described)}
+	if socketPath == "" {
+		return e
+	}
+	if timeout <= 0 {
+		timeout = defaultRuntimeTimeout
+	}
+	e.client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	return e
+}
+
+// Describe returns the metadata for a cgroup path. The first call for a
+// container path may query the runtime socket; failures are cached like
+// successes so an unreachable socket costs one timeout per container.
+func (e *Enricher) Describe(cgroupPath string) Container {
+	c, _ := e.DescribeWithLabels(cgroupPath)
+	return c
+}
+
+// DescribeWithLabels is Describe plus the container's labels, which are
+// only known with a runtime socket. The returned map must not be modified.
+func (e *Enricher) DescribeWithLabels(cgroupPath string) (Container, map[string]string) {
+	if cgroupPath == "" {
+		return Container{}, nil
+	}
+
+	e.mu.RLock()
+	d, ok := e.cache[cgroupPath]
+	e.mu.RUnlock()
+	if ok {
+		return d.container, d.labels
+	}
+
+	d.container = ParseCgroupPath(cgroupPath)
+	if d.container.IsContainer() && e.client != nil {
+		if info, err := e.inspect(d.container.ID); err == nil {
+			d.container.Name, d.container.Image = info.name, info.image
+			d.labels = info.labels
+		}
+	}
+
+	e.mu.Lock()
+	if len(e.cache) >= maxEnricherEntries {
+		clear(e.cache)
+	}
+	e.cache[cgroupPath] = d
+	e.mu.Unlock()
+	return d.container, d.labels
+}
+
+type containerInfo struct {
+	name   string
+	image  string
+	labels map[string]string
+}
+
+// inspect fetches a container's name, image and labels from the runtime
+// socket.
+func (e *Enricher) inspect(id string) (containerInfo, error) {
+	resp, err := e.client.Get("http://runtime/containers/" + id + "/json")
+	if err != nil {
+		return containerInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return containerInfo{}, fmt.Errorf("inspect container %s: %s", id, resp.Status)
+	}
+
+	var body struct {
+		Name   string `json:"Name"`
+		Config struct {
+			Image  string            `json:"Image"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return containerInfo{}, fmt.Errorf("inspect container %s: %w", id, err)
+	}
+	return containerInfo{
+		name:   strings.TrimPrefix(body.Name, "/"),
+		image:  body.Config.Image,
+		labels: body.Config.Labels,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package workload
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testID = strings.Repeat("ab12", 16)
+
+func TestParseCgroupPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want Container
+	}{
+		{"/system.slice/docker-" + testID + ".scope",
+			Container{Runtime: RuntimeDocker, ID: testID, SystemdSlice: "system.slice"}},
+		{"/docker/" + testID,
+			Container{Runtime: RuntimeDocker, ID: testID}},
+		{"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b_3c4d.slice/cri-containerd-" + testID + ".scope",
+			Container{Runtime: RuntimeContainerd, ID: testID, PodUID: "1a2b-3c4d"}},
+		{"/kubepods.slice/kubepods-pod9f_00.slice/crio-" + testID + ".scope",
+			Container{Runtime: RuntimeCRIO, ID: testID, PodUID: "9f-00"}},
+		{"/kubepods/besteffort/pod1a2b-3c4d/" + testID,
+			Container{Runtime: RuntimeCRI, ID: testID, PodUID: "1a2b-3c4d"}},
+		{"/machine.slice/libpod-" + testID + ".scope",
+			Container{Runtime: RuntimePodman, ID: testID, SystemdSlice: "machine.slice"}},
+		{"/machine.slice/libpod-conmon-" + testID + ".scope",
+			Container{SystemdSlice: "machine.slice"}},
+		{"/default/" + testID,
+			Container{Runtime: RuntimeContainerd, ID: testID}},
+		{"/system.slice/sshd.service",
+			Container{SystemdUnit: "sshd.service", SystemdSlice: "system.slice"}},
+		{"/user.slice/user-1000.slice/session-3.scope",
+			Container{SystemdUnit: "session-3.scope", SystemdSlice: "user-1000.slice"}},
+		{"/user.slice/user-1000.slice/user@1000.service/app.slice/app-gnome-terminal.scope",
+			Container{SystemdUnit: "app-gnome-terminal.scope", SystemdSlice: "app.slice"}},
+		{"/", Container{}},
+	}
+	for _, tt := range tests {
+		if got := ParseCgroupPath(tt.path); got != tt.want {
+			t.Errorf("ParseCgroupPath(%q)\n got %+v\nwant %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestEnricherQueriesRuntimeSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	requests := 0
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/containers/"+testID+"/json" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"Name":   "/web",
+			"Config": map[string]string{"Image": "nginx:1.27"},
+		})
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	e := NewEnricher(socket, 0)
+	path := "/system.slice/docker-" + testID + ".scope"
+	c := e.Describe(path)
+	if c.Name != "web" || c.Image != "nginx:1.27" || c.Runtime != RuntimeDocker {
+		t.Fatalf("Describe = %+v", c)
+	}
+	e.Describe(path)
+	e.Describe("/system.slice/sshd.service")
+	if requests != 1 {
+		t.Fatalf("runtime queried %d times, want 1 (cached, hosts not queried)", requests)
+	}
+}
+
+func TestRegistryAttachesContainer(t *testing.T) {
+	r := NewRegistry(10)
+	r.RecordExec(7, "")
+	r.RecordFile(7, "/docker/"+testID)
+	m := r.Get(7)
+	if m == nil || m.Container.ID != testID || m.Container.Runtime != RuntimeDocker {
+		t.Fatalf("workload = %+v", m)
+	}
+}
+
+func TestFriendlyName(t *testing.T) {
+	for path, want := range map[string]string{
+		"/system.slice/docker-" + testID + ".scope": "docker ab12ab12ab12",
+		"/kubepods/besteffort/pod1a2b-3c4d":         "pod 1a2b-3c4d",
+		"/system.slice/sshd.service":                "sshd.service",
+		"/user.slice/user-1000.slice":               "user-1000.slice",
+		"/build/job-42":                             "job-42",
+		"/":                                         "host",
+	} {
+		if got := FriendlyName(path, ParseCgroupPath(path)); got != want {
+			t.Errorf("FriendlyName(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if got := FriendlyName("/docker/"+testID, Container{ID: testID, Name: "web"}); got != "web" {
+		t.Errorf("named container = %q", got)
+	}
+}
+
+func TestRegistryEvictsLeastRecentlySeen(t *testing.T) {
+	r := NewRegistry(2)
+	r.RecordExec(1, "/a")
+	r.RecordExec(2, "/b")
+	r.RecordFile(1, "/a")
+	r.RecordExec(3, "/c")
+	if r.Get(2) != nil || r.Get(1) == nil {
+		t.Fatalf("workloads = %+v", r.List())
+	}
+	if s := r.Stats(); s.Size != 2 || s.MaxSize != 2 || s.Evicted != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
@@ -12,6 +12,8 @@ type WorkloadID uint64
 type Metadata struct {
 	ID           WorkloadID
 	CgroupPath   string
+	Container    Container
+	Labels       map[string]string // container labels; nil when unknown
 	FirstSeen    time.Time
 	LastSeen     time.Time
 	ExecCount    int64
@@ -19,6 +21,15 @@ type Metadata struct {
 	ConnectCount int64
 	AlertCount   int64
 	BlockedCount int64
+
+	// SuppressedCount is the number of monitor-only events the kernel
+	// dropped for this cgroup because it exceeded its rate limit.
+	SuppressedCount int64
+}
+
+// Name returns the workload's friendly name, see FriendlyName.
+func (m *Metadata) Name() string {
+	return FriendlyName(m.CgroupPath, m.Container)
 }
 
 type Registry struct {
@@ -28,26 +39,45 @@ type Registry struct {
 	lruIndex map[WorkloadID]*list.Element
 	maxSize  int
 	count    atomic.Int32
+	evicted  atomic.Int64
+	enricher atomic.Pointer[Enricher]
+}
+
+// Stats describes how full the registry is. Evicted counts the workloads
+// dropped to stay within MaxSize since the registry was created.
+type Stats struct {
+	Size    int
+	MaxSize int
+	Evicted int64
 }
 
 func NewRegistry(maxSize int) *Registry {
 	if maxSize <= 0 {
 		maxSize = 1000
 	}
-	return &Registry{
+	r := &Registry{
 		data:     make(map[WorkloadID]*Metadata),
 		lru:      list.New(),
 		lruIndex: make(map[WorkloadID]*list.Element),
 		maxSize:  maxSize,
 	}
+	r.enricher.Store(NewEnricher("", 0))
+	return r
+}
+
+// SetEnricher replaces the cgroup path enricher, e.g. with one that queries
+// a container runtime socket. Workloads already known keep their metadata.
+func (r *Registry) SetEnricher(e *Enricher) {
+	r.enricher.Store(e)
 }
 
 func (r *Registry) RecordExec(cgroupID uint64, cgroupPath string) {
 	id := WorkloadID(cgroupID)
+	container, labels := r.Describe(cgroupPath)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	m := r.getOrCreate(id, cgroupPath)
+	m := r.getOrCreate(id, cgroupPath, container, labels)
 	m.ExecCount++
 	m.LastSeen = time.Now()
 	r.touch(id)
@@ -55,10 +85,11 @@ func (r *Registry) RecordExec(cgroupID uint64, cgroupPath string) {
 
 func (r *Registry) RecordFile(cgroupID uint64, cgroupPath string) {
 	id := WorkloadID(cgroupID)
+	container, labels := r.Describe(cgroupPath)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	m := r.getOrCreate(id, cgroupPath)
+	m := r.getOrCreate(id, cgroupPath, container, labels)
 	m.FileCount++
 	m.LastSeen = time.Now()
 	r.touch(id)
@@ -66,10 +97,11 @@ func (r *Registry) RecordFile(cgroupID uint64, cgroupPath string) {
 
 func (r *Registry) RecordConnect(cgroupID uint64, cgroupPath string) {
 	id := WorkloadID(cgroupID)
+	container, labels := r.Describe(cgroupPath)
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	m := r.getOrCreate(id, cgroupPath)
+	m := r.getOrCreate(id, cgroupPath, container, labels)
 	m.ConnectCount++
 	m.LastSeen = time.Now()
 	r.touch(id)
@@ -90,6 +122,18 @@ func (r *Registry) RecordAlert(cgroupID uint64, blocked bool) {
 	}
 }
 
+// SetSuppressedCount records the kernel's cumulative suppressed-event
+// counter for a known workload.
+func (r *Registry) SetSuppressedCount(cgroupID uint64, count int64) {
+	id := WorkloadID(cgroupID)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m, ok := r.data[id]; ok {
+		m.SuppressedCount = count
+	}
+}
+
 func (r *Registry) Get(cgroupID uint64) *Metadata {
 	id := WorkloadID(cgroupID)
 	r.mu.RLock()
@@ -117,10 +161,32 @@ func (r *Registry) Count() int {
 	return int(r.count.Load())
 }
 
-func (r *Registry) getOrCreate(id WorkloadID, cgroupPath string) *Metadata {
+func (r *Registry) Stats() Stats {
+	return Stats{
+		Size:    r.Count(),
+		MaxSize: r.maxSize,
+		Evicted: r.evicted.Load(),
+	}
+}
+
+// Describe resolves container metadata for a cgroup path with the
+// registry's enricher. Record* call it before taking the registry lock
+// because the enricher may query a runtime socket the first time it sees a
+// container.
+func (r *Registry) Describe(cgroupPath string) (Container, map[string]string) {
+	e := r.enricher.Load()
+	if e == nil {
+		return Container{}, nil
+	}
+	return e.DescribeWithLabels(cgroupPath)
+}
+
+func (r *Registry) getOrCreate(id WorkloadID, cgroupPath string, container Container, labels map[string]string) *Metadata {
 	if m, ok := r.data[id]; ok {
 		if m.CgroupPath == "" && cgroupPath != "" {
 			m.CgroupPath = cgroupPath
+			m.Container = container
+			m.Labels = labels
 		}
 		return m
 	}
@@ -133,6 +199,8 @@ func (r *Registry) getOrCreate(id WorkloadID, cgroupPath string) *Metadata {
 	m := &Metadata{
 		ID:         id,
 		CgroupPath: cgroupPath,
+		Container:  container,
+		Labels:     labels,
 		FirstSeen:  now,
 		LastSeen:   now,
 	}
@@ -159,4 +227,5 @@ func (r *Registry) evictOldest() {
 	delete(r.lruIndex, id)
 	delete(r.data, id)
 	r.count.Add(-1)
+	r.evicted.Add(1)
 }